@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"mediacloset/api/internal/config"
+	"mediacloset/api/internal/services"
+)
+
+// runBackfillKeys computes normalized_key for catalog rows saved before keys
+// existed (or for every row with -all). Runs in dry-run mode unless
+// -dry-run=false is passed.
+func runBackfillKeys(args []string) error {
+	fs := flag.NewFlagSet("backfill-keys", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", true, "report rows that need a key without writing")
+	all := fs.Bool("all", false, "recompute keys for every row, not just rows missing one")
+	batch := fs.Int("batch", services.DefaultKeyBackfillBatchSize, "rows per request")
+	verbose := fs.Bool("v", false, "list keys shared by more than one row")
+	fs.Parse(args)
+
+	cfg := config.Load()
+	hasuraClient := services.NewHasuraClient(cfg.HasuraEndpoint, cfg.HasuraAdminSecret)
+	backfill := services.NewKeyBackfillService(hasuraClient, *batch)
+
+	report, err := backfill.Run(context.Background(), *dryRun, *all)
+	if report != nil {
+		printKeyBackfillReport(report, *all, *verbose)
+	}
+	return err
+}
+
+func printKeyBackfillReport(report *services.KeyBackfillReport, all, verbose bool) {
+	mode := "write"
+	if report.DryRun {
+		mode = "dry-run"
+	}
+	scope := "missing keys"
+	if all {
+		scope = "all rows"
+	}
+	fmt.Printf("Normalized key backfill (%s, %s)\n", mode, scope)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  TABLE\tSCANNED\tCHANGED\tUPDATED\tSHARED KEYS")
+	for _, t := range report.Tables {
+		fmt.Fprintf(w, "  %s\t%d\t%d\t%d\t%d\n", t.Kind, t.Scanned, t.Changed, t.Updated, len(t.SharedKeys))
+	}
+	w.Flush()
+
+	if !verbose {
+		return
+	}
+	for _, t := range report.Tables {
+		if len(t.SharedKeys) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s rows sharing a key:\n", t.Kind)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  KEY\tIDS")
+		for _, shared := range t.SharedKeys {
+			fmt.Fprintf(w, "  %s\t%s\n", shared.Key, strings.Join(shared.IDs, ", "))
+		}
+		w.Flush()
+	}
+}
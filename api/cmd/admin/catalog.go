@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+
+	"mediacloset/api/internal/config"
+	"mediacloset/api/internal/services"
+)
+
+// runMerge folds one catalog row into another. Runs in dry-run mode unless
+// -dry-run=false is passed.
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	kindName := fs.String("kind", "", "catalog kind: movie, album, or cassette")
+	targetID := fs.String("into", "", "ID of the row to keep")
+	sourceID := fs.String("from", "", "ID of the duplicate row to fold in and delete")
+	dryRun := fs.Bool("dry-run", true, "show the merge plan without applying it")
+	reason := fs.String("reason", "", "why the rows are being merged (recorded in the audit log)")
+	actor := fs.String("actor", defaultActor(), "who is making the change (recorded in the audit log)")
+	fs.Parse(args)
+
+	kind, err := services.ParseMediaKind(*kindName)
+	if err != nil {
+		return err
+	}
+	if *targetID == "" || *sourceID == "" {
+		return fmt.Errorf("-into and -from are required")
+	}
+
+	admin := newCatalogAdmin()
+	ctx := context.Background()
+
+	plan, err := admin.PlanMerge(ctx, kind, *targetID, *sourceID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Merge %s %s into %s\n", kind, *sourceID, *targetID)
+	fmt.Printf("  keep:          %s\n", describeRow(plan.Target))
+	fmt.Printf("  fold in:       %s\n", describeRow(plan.Source))
+	fmt.Printf("  links moved:   %d\n", plan.MovedLinks)
+	fmt.Printf("  links dropped: %d (users who already have the kept row)\n", len(plan.DropLinkIDs))
+	printFields("  fields taken from the duplicate:", plan.Changes)
+
+	if *dryRun {
+		fmt.Println("\nDry run, nothing changed. Pass -dry-run=false to apply.")
+		return nil
+	}
+	if *reason == "" {
+		return fmt.Errorf("-reason is required when applying a merge")
+	}
+
+	auditID, err := admin.ApplyMerge(ctx, plan, *actor, *reason)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nMerged. Audit entry %s\n", auditID)
+	return nil
+}
+
+// runSplit moves some users of a catalog row onto a new row with corrected
+// fields. Runs in dry-run mode unless -dry-run=false is passed.
+func runSplit(args []string) error {
+	fs := flag.NewFlagSet("split", flag.ExitOnError)
+	kindName := fs.String("kind", "", "catalog kind: movie, album, or cassette")
+	sourceID := fs.String("from", "", "ID of the row that conflates two releases")
+	users := fs.String("users", "", "comma-separated IDs of users whose copy is the other release")
+	var sets setFlags
+	fs.Var(&sets, "set", "column=value for the new row (repeatable; lists are comma-separated)")
+	dryRun := fs.Bool("dry-run", true, "show the split plan without applying it")
+	reason := fs.String("reason", "", "why the row is being split (recorded in the audit log)")
+	actor := fs.String("actor", defaultActor(), "who is making the change (recorded in the audit log)")
+	fs.Parse(args)
+
+	kind, err := services.ParseMediaKind(*kindName)
+	if err != nil {
+		return err
+	}
+	if *sourceID == "" {
+		return fmt.Errorf("-from is required")
+	}
+
+	overrides := map[string]interface{}{}
+	for _, set := range sets {
+		column, raw, ok := strings.Cut(set, "=")
+		if !ok {
+			return fmt.Errorf("invalid -set %q (expected column=value)", set)
+		}
+		value, err := kind.ParseColumnValue(column, raw)
+		if err != nil {
+			return err
+		}
+		overrides[column] = value
+	}
+
+	userIDs := []string{}
+	for _, id := range strings.Split(*users, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			userIDs = append(userIDs, id)
+		}
+	}
+
+	admin := newCatalogAdmin()
+	ctx := context.Background()
+
+	plan, err := admin.PlanSplit(ctx, kind, *sourceID, userIDs, overrides)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Split %s %s\n", kind, *sourceID)
+	fmt.Printf("  original:    %s\n", describeRow(plan.Source))
+	fmt.Printf("  new row:     %s (%s)\n", describeRow(plan.Object), plan.Object["id"])
+	fmt.Printf("  users moved: %s\n", strings.Join(plan.UserIDs, ", "))
+	printFields("  fields changed on the new row:", overrides)
+
+	if *dryRun {
+		fmt.Println("\nDry run, nothing changed. Pass -dry-run=false to apply.")
+		return nil
+	}
+	if *reason == "" {
+		return fmt.Errorf("-reason is required when applying a split")
+	}
+
+	auditID, err := admin.ApplySplit(ctx, plan, *actor, *reason)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nSplit. Audit entry %s\n", auditID)
+	return nil
+}
+
+// setFlags collects repeated -set flags
+type setFlags []string
+
+func (s *setFlags) String() string     { return strings.Join(*s, ", ") }
+func (s *setFlags) Set(v string) error { *s = append(*s, v); return nil }
+
+func newCatalogAdmin() *services.CatalogAdminService {
+	cfg := config.Load()
+	return services.NewCatalogAdminService(services.NewHasuraClient(cfg.HasuraEndpoint, cfg.HasuraAdminSecret))
+}
+
+// defaultActor identifies the operator in the audit log when -actor is not given
+func defaultActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "cli:" + u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return "cli:" + name
+	}
+	return "cli"
+}
+
+// describeRow renders a catalog row as "Artist - Album (Year)" or "Title (Year)"
+func describeRow(row map[string]interface{}) string {
+	name, _ := row["title"].(string)
+	if album, ok := row["album"].(string); ok {
+		artist, _ := row["artist"].(string)
+		name = artist + " - " + album
+	}
+	if year, ok := row["year"]; ok && year != nil {
+		name = fmt.Sprintf("%s (%v)", name, year)
+	}
+	return name
+}
+
+func printFields(heading string, fields map[string]interface{}) {
+	if len(fields) == 0 {
+		return
+	}
+	fmt.Println(heading)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("    %-16s %v\n", name, fields[name])
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"mediacloset/api/internal/config"
+	"mediacloset/api/internal/services"
+)
+
+// runClientKeys manages the keys apps send as X-API-Key:
+//
+//	client-keys list
+//	client-keys issue -name ios [-expires-in 2160h]
+//	client-keys rotate -name ios [-overlap 720h] [-dry-run=false]
+//	client-keys revoke -id <key id> [-dry-run=false]
+//
+// Rotating keeps the old key working for -overlap so installed apps have
+// time to update. Revoking takes effect on every server within a minute.
+func runClientKeys(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected list, issue, rotate, or revoke")
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("client-keys "+action, flag.ExitOnError)
+	name := fs.String("name", "", "client name, e.g. ios or shelf-lights")
+	id := fs.String("id", "", "key ID (see client-keys list)")
+	expiresIn := fs.Duration("expires-in", 0, "issue: how long the key works (0 never expires)")
+	overlap := fs.Duration("overlap", services.DefaultClientKeyOverlap, "rotate: how long the old key keeps working")
+	dryRun := fs.Bool("dry-run", true, "rotate/revoke: show the change without applying it")
+	fs.Parse(args[1:])
+
+	cfg := config.Load()
+	keys := services.NewClientKeyService(services.NewHasuraClient(cfg.HasuraEndpoint, cfg.HasuraAdminSecret), "")
+	ctx := context.Background()
+
+	switch action {
+	case "list":
+		list, err := keys.ListClientKeys(ctx)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("No client keys issued.")
+		}
+		for _, k := range list {
+			printClientKey(k)
+		}
+		if cfg.APIKey != "" {
+			fmt.Printf("%-36s  %-16s  active (API_KEY environment variable)\n", services.LegacyClientKeyID, "API_KEY")
+		}
+		return nil
+
+	case "issue":
+		if *name == "" {
+			return fmt.Errorf("-name is required")
+		}
+		var expiresAt *time.Time
+		if *expiresIn > 0 {
+			t := time.Now().Add(*expiresIn)
+			expiresAt = &t
+		}
+		k, secret, err := keys.IssueClientKey(ctx, *name, expiresAt)
+		if err != nil {
+			return err
+		}
+		printClientKey(k)
+		fmt.Printf("\nKey (shown once): %s\n", secret)
+		return nil
+
+	case "rotate":
+		if *name == "" {
+			return fmt.Errorf("-name is required")
+		}
+		if *dryRun {
+			list, err := keys.ListClientKeys(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("A new %s key will be issued. These keys will stop working at %s:\n", *name, time.Now().Add(*overlap).Format(time.RFC3339))
+			for _, k := range list {
+				if k.Name == *name && k.Active(time.Now()) {
+					printClientKey(k)
+				}
+			}
+			fmt.Println("\nDry run, nothing changed. Pass -dry-run=false to apply.")
+			return nil
+		}
+		k, secret, previous, err := keys.RotateClientKey(ctx, *name, *overlap)
+		if err != nil {
+			return err
+		}
+		printClientKey(k)
+		fmt.Printf("\nKey (shown once): %s\n\nRotated out:\n", secret)
+		for _, old := range previous {
+			printClientKey(old)
+		}
+		return nil
+
+	case "revoke":
+		if *id == "" {
+			return fmt.Errorf("-id is required")
+		}
+		if *dryRun {
+			fmt.Printf("Key %s will stop working within a minute.\n", *id)
+			fmt.Println("\nDry run, nothing changed. Pass -dry-run=false to apply.")
+			return nil
+		}
+		revoked, err := keys.RevokeClientKey(ctx, *id)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return fmt.Errorf("no unrevoked key %s", *id)
+		}
+		fmt.Printf("Key %s revoked.\n", *id)
+		return nil
+	}
+
+	return fmt.Errorf("unknown action %q (expected list, issue, rotate, or revoke)", action)
+}
+
+func printClientKey(k *services.ClientKey) {
+	status := "active"
+	switch {
+	case k.RevokedAt != nil:
+		status = "revoked " + k.RevokedAt.Format(time.RFC3339)
+	case k.ExpiresAt != nil && !k.Active(time.Now()):
+		status = "expired " + k.ExpiresAt.Format(time.RFC3339)
+	case k.ExpiresAt != nil:
+		status = "active until " + k.ExpiresAt.Format(time.RFC3339)
+	}
+	line := fmt.Sprintf("%-36s  %-16s  %s (created %s", k.ID, k.Name, status, k.CreatedAt.Format(time.RFC3339))
+	if k.RotatedAt != nil {
+		line += ", rotated " + k.RotatedAt.Format(time.RFC3339)
+	}
+	fmt.Println(line + ")")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"mediacloset/api/internal/config"
+	"mediacloset/api/internal/services"
+)
+
+// runCoverGC reconciles uploaded covers against the catalog.
+// Runs in dry-run mode unless -dry-run=false is passed.
+func runCoverGC(args []string) error {
+	fs := flag.NewFlagSet("cover-gc", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", true, "report orphaned covers without deleting them")
+	grace := fs.Duration("grace", 0, "minimum age of an unreferenced object before it is deleted (default COVER_GC_GRACE_PERIOD)")
+	verbose := fs.Bool("v", false, "list every orphaned object")
+	fs.Parse(args)
+
+	cfg := config.Load()
+	if *grace == 0 {
+		*grace = cfg.CoverGCGracePeriod
+	}
+
+	if cfg.StorageBackend == "" {
+		return fmt.Errorf("image storage is not configured (set STORAGE_BACKEND or S3_BUCKET)")
+	}
+
+	ctx := context.Background()
+	storage, err := services.NewObjectStorage(ctx, cfg.StorageConfig())
+	if err != nil {
+		return fmt.Errorf("failed to initialize %s storage: %w", cfg.StorageBackend, err)
+	}
+
+	hasuraClient := services.NewHasuraClient(cfg.HasuraEndpoint, cfg.HasuraAdminSecret)
+	gc := services.NewCoverGCService(hasuraClient, storage, *grace)
+
+	report, err := gc.Run(ctx, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	var orphanedBytes int64
+	for _, obj := range report.Orphaned {
+		orphanedBytes += obj.Size
+	}
+
+	mode := "delete"
+	if report.DryRun {
+		mode = "dry-run"
+	}
+	fmt.Printf("Cover GC (%s storage, %s, grace period %s)\n", storage.Name(), mode, *grace)
+	fmt.Printf("  scanned:     %d\n", report.Scanned)
+	fmt.Printf("  referenced:  %d\n", report.Referenced)
+	fmt.Printf("  too recent:  %d\n", report.TooRecent)
+	fmt.Printf("  orphaned:    %d (%d bytes)\n", len(report.Orphaned), orphanedBytes)
+	fmt.Printf("  cleared:     %d rows nobody owns\n", report.Cleared)
+	fmt.Printf("  deleted:     %d\n", report.Deleted)
+	fmt.Printf("  failed:      %d\n", len(report.Failed))
+
+	if *verbose && len(report.Orphaned) > 0 {
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tSIZE\tLAST MODIFIED")
+		for _, obj := range report.Orphaned {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", obj.Key, obj.Size, obj.LastModified.Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+	}
+
+	for key, err := range report.Failed {
+		fmt.Fprintf(os.Stderr, "failed to delete %s: %v\n", key, err)
+	}
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("%d objects could not be deleted", len(report.Failed))
+	}
+
+	return nil
+}
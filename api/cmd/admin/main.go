@@ -0,0 +1,66 @@
+// Command admin runs maintenance jobs against the MediaCloset backend.
+//
+// Usage:
+//
+//	admin <command> [flags]
+//
+// Commands:
+//
+//	cover-gc        Delete uploaded cover images that no catalog row references
+//	backfill-keys   Compute normalized dedup keys for existing catalog rows
+//	merge           Fold a duplicate catalog row into another
+//	split           Move some users of a catalog row onto a new, corrected row
+//	set-role        Change a user's role (read_only, user, admin)
+//	client-keys     List, issue, rotate, or revoke API client keys
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"cover-gc", "Delete uploaded cover images that no catalog row references", runCoverGC},
+	{"backfill-keys", "Compute normalized dedup keys for existing catalog rows", runBackfillKeys},
+	{"merge", "Fold a duplicate catalog row into another", runMerge},
+	{"split", "Move some users of a catalog row onto a new, corrected row", runSplit},
+	{"set-role", "Change a user's role (read_only, user, admin)", runSetRole},
+	{"client-keys", "List, issue, rotate, or revoke API client keys", runClientKeys},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: admin <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"mediacloset/api/internal/config"
+	"mediacloset/api/internal/services"
+)
+
+// runSetRole changes a user's role. This is how the first admin is created;
+// after that admins can use the setUserRole mutation. Runs in dry-run mode
+// unless -dry-run=false is passed.
+func runSetRole(args []string) error {
+	fs := flag.NewFlagSet("set-role", flag.ExitOnError)
+	who := fs.String("user", "", "user ID or email address")
+	roleName := fs.String("role", "", "new role: read_only, user, or admin")
+	dryRun := fs.Bool("dry-run", true, "show the change without applying it")
+	fs.Parse(args)
+
+	if *who == "" {
+		return fmt.Errorf("-user is required")
+	}
+	role, err := services.ParseRole(*roleName)
+	if err != nil {
+		return err
+	}
+
+	cfg := config.Load()
+	hasuraClient := services.NewHasuraClient(cfg.HasuraEndpoint, cfg.HasuraAdminSecret)
+	auth := services.NewAuthService(hasuraClient, nil, cfg.JWTSecret, cfg.IsDevelopment())
+	ctx := context.Background()
+
+	var u *services.User
+	if strings.Contains(*who, "@") {
+		u, err = auth.GetUserByEmail(ctx, *who)
+	} else {
+		u, err = auth.GetUserByID(ctx, *who)
+	}
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return fmt.Errorf("user %s not found", *who)
+	}
+
+	fmt.Printf("%s (%s): %s -> %s\n", u.Email, u.ID, u.Role, role)
+	if u.Role == role {
+		fmt.Println("Nothing to change.")
+		return nil
+	}
+	if *dryRun {
+		fmt.Println("\nDry run, nothing changed. Pass -dry-run=false to apply.")
+		return nil
+	}
+
+	if _, err := auth.SetUserRole(ctx, u.ID, role); err != nil {
+		return err
+	}
+	fmt.Println("\nRole updated. The user has been signed out everywhere and gets the new role on their next sign-in.")
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"mediacloset/api/internal/buildinfo"
+	"mediacloset/api/internal/config"
+	"mediacloset/api/internal/health"
+	"mediacloset/api/internal/ratelimit"
+	"mediacloset/api/internal/resilient"
+	"mediacloset/api/internal/services"
+)
+
+// providerPinger is a metadata service that can check it reaches its API
+type providerPinger interface {
+	Ping(ctx context.Context) error
+}
+
+// newHealthChecker builds the readiness checks. Only Hasura is critical:
+// without it nothing works, while the others each take out one feature.
+func newHealthChecker(cfg *config.Config, hasura *services.HasuraClient, storage services.ObjectStorage, email *services.EmailService, providers map[ratelimit.Provider]providerPinger) *health.Checker {
+	checks := []health.Check{
+		{Name: "hasura", Critical: true, CacheFor: 5 * time.Second, Run: hasura.Ping},
+		{Name: "config", Run: func(ctx context.Context) error {
+			if warnings := cfg.Warnings(); len(warnings) > 0 {
+				return health.Degraded("%s", strings.Join(warnings, "; "))
+			}
+			return nil
+		}},
+		{Name: "storage", CacheFor: 30 * time.Second, Run: func(ctx context.Context) error {
+			if storage == nil {
+				return health.Disabled("no storage backend configured")
+			}
+			return storage.Ping(ctx)
+		}},
+		// SES allows one GetAccount call per second
+		{Name: "email", CacheFor: time.Minute, Run: func(ctx context.Context) error {
+			if email == nil {
+				return health.Disabled("AWS SES not configured")
+			}
+			err := email.Ping(ctx)
+			if errors.Is(err, services.ErrEmailSandbox) {
+				return health.Degraded("%v: only verified addresses receive email", err)
+			}
+			return err
+		}},
+	}
+
+	for _, provider := range ratelimit.Providers {
+		pinger := providers[provider]
+		checks = append(checks, health.Check{
+			Name:     string(provider),
+			CacheFor: time.Minute,
+			Run: func(ctx context.Context) error {
+				if cfg.HealthPingProviders && pinger != nil {
+					if err := pinger.Ping(ctx); err != nil {
+						return err
+					}
+				}
+				for _, b := range resilient.BreakerStates() {
+					if b.Provider == string(provider) && b.State != resilient.StateClosed {
+						return health.Degraded("circuit breaker %s", b.State)
+					}
+				}
+				return nil
+			},
+		})
+	}
+
+	return health.NewChecker(checks...)
+}
+
+// livenessHandler answers as long as the process can serve requests
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// readinessHandler reports each component and fails with 503 while a
+// critical one is down. Error details only go to the logs, since the
+// endpoint needs no authentication.
+func readinessHandler(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Check(r.Context())
+		build := buildinfo.Get()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !report.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     report.Status,
+			"version":    build.Version,
+			"commit":     build.Commit,
+			"uptime":     int(time.Since(startTime).Seconds()),
+			"components": report.WithoutMessages().Components,
+		})
+	}
+}
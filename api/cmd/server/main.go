@@ -2,9 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
@@ -12,26 +18,76 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"mediacloset/api/internal/buildinfo"
 	"mediacloset/api/internal/config"
 	"mediacloset/api/internal/graph"
+	"mediacloset/api/internal/metrics"
 	custommw "mediacloset/api/internal/middleware"
 	"mediacloset/api/internal/ratelimit"
+	"mediacloset/api/internal/resilient"
 	"mediacloset/api/internal/services"
+	"mediacloset/api/internal/tracing"
 )
 
 var startTime = time.Now()
 
 func main() {
-	log.Println("Starting MediaCloset GraphQL API...")
+	if err := run(); err != nil {
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the server and blocks until SIGINT or SIGTERM has drained it.
+// Everything started here is tied to the signal context so deferred
+// cleanup runs on the way out.
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	cfg := config.Load()
+	build := buildinfo.Get()
+	slog.Info("Starting MediaCloset GraphQL API", "version", build.Version, "commit", build.Commit)
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TracesExporter)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer func() {
+		// Flush buffered spans even though ctx is already canceled by now
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Warn("Failed to flush traces", "error", err)
+		}
+	}()
+
+	hasuraClient := services.NewHasuraClient(cfg.HasuraEndpoint, cfg.HasuraAdminSecret)
+	clientKeys := services.NewClientKeyService(hasuraClient, cfg.APIKey)
+
+	// Object storage for image uploads (optional)
+	var storage services.ObjectStorage
+	if cfg.StorageBackend != "" {
+		var err error
+		storage, err = services.NewObjectStorage(ctx, cfg.StorageConfig())
+		if err != nil {
+			slog.Warn("Failed to initialize storage, image uploads will not be available", "backend", cfg.StorageBackend, "error", err)
+		} else {
+			slog.Info("Image upload enabled", "backend", storage.Name())
+		}
+	} else {
+		slog.Warn("Image storage not configured, image uploads will not be available")
+	}
 
 	r := chi.NewRouter()
 
 	// Middleware block
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(custommw.RealIP(cfg.TrustedProxies))
+	r.Use(tracing.Middleware)
+	r.Use(custommw.ClientInfoMiddleware)
+	r.Use(custommw.RequestLogger())
+	r.Use(metrics.Middleware)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
 
@@ -48,70 +104,101 @@ func main() {
 		})
 	})
 
-	// API key authentication for clients
-	r.Use(custommw.APIKeyAuth(cfg.APIKey, cfg.IsDevelopment()))
+	// API key authentication for clients; the local storage backend's
+	// uploads are authorized by their signed URLs instead
+	_, localUploads := storage.(*services.LocalStorageService)
+	r.Use(custommw.APIKeyAuth(clientKeys, cfg.IsDevelopment(), localUploads))
 
-	apiRateLimiter := custommw.NewRateLimiter()
-	r.Use(apiRateLimiter.Middleware())
+	// Rate limit buckets and login throttling are shared across replicas when
+	// Redis is configured
+	var limitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RedisURL != "" {
+		redisStore, err := ratelimit.NewRedisStoreFromURL(ctx, cfg.RedisURL)
+		if err != nil {
+			slog.Warn("Failed to connect to Redis, rate limits will be enforced per instance", "error", err)
+		} else {
+			defer redisStore.Close()
+			limitStore = redisStore
+		}
+	}
 
-	rateLimiter := ratelimit.NewServiceLimiter()
-	omdbService := services.NewOMDBService(cfg.OMDBAPIKey)
+	rateLimiter := ratelimit.NewServiceLimiter(limitStore, map[ratelimit.Provider]ratelimit.ProviderLimit{
+		ratelimit.ProviderMusicBrainz: {RequestsPerMinute: cfg.MusicBrainzRequestsPerMinute, DailyQuota: cfg.MusicBrainzDailyQuota},
+		ratelimit.ProviderDiscogs:     {RequestsPerMinute: cfg.DiscogsRequestsPerMinute, DailyQuota: cfg.DiscogsDailyQuota},
+		ratelimit.ProviderOMDB:        {RequestsPerMinute: cfg.OMDBRequestsPerMinute, DailyQuota: cfg.OMDBDailyQuota},
+		ratelimit.ProviderITunes:      {RequestsPerMinute: cfg.ITunesRequestsPerMinute, DailyQuota: cfg.ITunesDailyQuota},
+	})
+	omdbService := services.NewOMDBService(cfg.OMDBAPIKey, rateLimiter)
 	musicBrainzService := services.NewMusicBrainzService(rateLimiter)
-	discogsService := services.NewDiscogsService(cfg.DiscogsKey, cfg.DiscogsSecret)
-	itunesService := services.NewITunesService()
+	discogsService := services.NewDiscogsService(cfg.DiscogsKey, cfg.DiscogsSecret, rateLimiter)
+	itunesService := services.NewITunesService(rateLimiter)
 	barcodeService := services.NewBarcodeService(
 		discogsService,
 		itunesService,
 		musicBrainzService,
 		omdbService,
 	)
-	hasuraClient := services.NewHasuraClient(cfg.HasuraEndpoint, cfg.HasuraAdminSecret)
 
 	var emailService *services.EmailService
 	if cfg.AWSSESFromEmail != "" && cfg.AWSAccessKeyID != "" && cfg.AWSSecretAccessKey != "" {
 		var err error
 		emailService, err = services.NewEmailService(
-			context.Background(),
+			ctx,
 			cfg.AWSRegion,
 			cfg.AWSAccessKeyID,
 			cfg.AWSSecretAccessKey,
 			cfg.AWSSESFromEmail,
 		)
 		if err != nil {
-			log.Printf("Warning: Failed to initialize email service: %v", err)
-			log.Println("Login codes will be logged to console instead")
+			slog.Warn("Failed to initialize email service, login codes are only logged in development", "error", err)
 		}
 	} else if !cfg.IsDevelopment() {
-		log.Println("Warning: AWS SES not fully configured ")
+		slog.Warn("AWS SES not fully configured")
 	}
 
 	authService := services.NewAuthService(hasuraClient, emailService, cfg.JWTSecret, cfg.IsDevelopment())
+	authService.SetTokenLifetimes(cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+	authService.SetLoginStore(limitStore)
+	authService.SetMagicLinkURL(strings.TrimSuffix(cfg.PublicBaseURL, "/") + services.MagicLinkPath)
 
-	// S3 service for image uploads (optional)
-	var s3Service *services.S3Service
-	if cfg.S3Bucket != "" && cfg.S3URLPrefix != "" && cfg.AWSAccessKeyID != "" && cfg.AWSSecretAccessKey != "" {
-		var err error
-		s3Service, err = services.NewS3Service(
-			context.Background(),
-			cfg.AWSRegion,
-			cfg.AWSAccessKeyID,
-			cfg.AWSSecretAccessKey,
-			cfg.S3Bucket,
-			cfg.S3URLPrefix,
-		)
-		if err != nil {
-			log.Printf("Warning: Failed to initialize S3 service: %v", err)
-			log.Println("Image uploads will not be available")
-		} else {
-			log.Printf("S3 image upload enabled (bucket: %s)", cfg.S3Bucket)
-		}
-	} else if !cfg.IsDevelopment() {
-		log.Println("Warning: S3 not configured, image uploads will not be available")
+	passkeyService, err := services.NewPasskeyService(hasuraClient, authService, cfg.WebAuthnRPID, cfg.WebAuthnRPOrigins)
+	if err != nil {
+		slog.Warn("Passkeys disabled", "error", err)
 	}
 
+	// Cover hashes are computed in the background as covers are saved; development allows fetching from the local storage backend
+	duplicateService := services.NewDuplicateService(hasuraClient, services.NewCoverHashService(cfg.IsDevelopment()))
+	hasherDone := make(chan struct{})
+	go func() {
+		defer close(hasherDone)
+		duplicateService.RunHasher(ctx)
+	}()
+
+	// Forced update settings: env vars are the defaults until an admin overrides them
+	appConfigService := services.NewAppConfigService(hasuraClient, services.AppVersionConfig{
+		MinimumIOSVersion: cfg.MinimumIOSVersion,
+		UpdateMessage:     cfg.ForceUpdateMessage,
+		ForceUpdate:       true,
+		StoreURL:          cfg.AppStoreURL,
+	})
+
 	// JWT authentication middleware (user authentication)
 	r.Use(custommw.JWTAuth(authService))
 
+	// Per-user (or per-IP) budgets for each kind of operation; needs JWTAuth first
+	if cfg.EnableRateLimit {
+		apiLimiter := custommw.NewRateLimiter(limitStore)
+		apiLimiter.SetMaxBodySize(cfg.MaxQueryBodyBytes)
+		r.Use(apiLimiter.Middleware())
+	}
+
+	healthChecker := newHealthChecker(cfg, hasuraClient, storage, emailService, map[ratelimit.Provider]providerPinger{
+		ratelimit.ProviderMusicBrainz: musicBrainzService,
+		ratelimit.ProviderDiscogs:     discogsService,
+		ratelimit.ProviderOMDB:        omdbService,
+		ratelimit.ProviderITunes:      itunesService,
+	})
+
 	resolver := &graph.Resolver{
 		Config:          cfg,
 		OMDBService:     omdbService,
@@ -121,30 +208,76 @@ func main() {
 		BarcodeService:  barcodeService,
 		HasuraClient:    hasuraClient,
 		AuthService:     authService,
-		S3Service:       s3Service,
+		PasskeyService:  passkeyService,
+		AccountService:  services.NewAccountService(hasuraClient, authService, storage),
+		Storage:         storage,
+		Duplicates:      duplicateService,
+		CatalogAdmin:    services.NewCatalogAdminService(hasuraClient),
+		AppConfig:       appConfigService,
 		RateLimiter:     rateLimiter,
+		HealthChecker:   healthChecker,
 		ServerStartTime: startTime,
 	}
-	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: resolver}))
+	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.NewConfig(resolver)))
+	srv.AroundOperations(graph.LogOperation)
+	srv.Use(metrics.GraphQL{})
+	srv.Use(tracing.GraphQL{})
 
 	if cfg.IsDevelopment() {
 		r.Handle("/", playground.Handler("MediaCloset GraphQL", "/query"))
-		log.Println("GraphQL playground available at http://localhost:" + cfg.Port + "/")
+		slog.Info("GraphQL playground available", "url", "http://localhost:"+cfg.Port+"/")
+	}
+
+	// Uploads go straight to storage via presigned URLs, so GraphQL bodies stay small
+	r.With(custommw.MaxBodySize(cfg.MaxQueryBodyBytes)).Handle("/query", srv)
+
+	// The local storage backend serves uploaded images from this server
+	if local, ok := storage.(*services.LocalStorageService); ok {
+		r.Handle(services.LocalUploadsPath+"*", local.Handler())
 	}
 
-	r.Handle("/query", srv)
+	// Sign-in links: universal link association for the app, web fallback otherwise
+	r.Method(http.MethodGet, services.MagicLinkPath, services.MagicLinkPageHandler(cfg.IOSURLScheme))
+	if cfg.IOSAppID != "" {
+		r.Method(http.MethodGet, "/.well-known/apple-app-site-association", services.AppleAppSiteAssociationHandler(cfg.IOSAppID))
+	}
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		uptime := int(time.Since(startTime).Seconds())
-		response := fmt.Sprintf(`{"status":"ok","version":"1.0.0","uptime":%d}`, uptime)
-		w.Write([]byte(response))
+		// Open breakers are reported but don't fail the check: the API still
+		// serves everything that doesn't need that provider
+		breakers := make(map[string]resilient.State)
+		for _, b := range resilient.BreakerStates() {
+			breakers[b.Provider] = b.State
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":   "ok",
+			"version":  build.Version,
+			"commit":   build.Commit,
+			"uptime":   int(time.Since(startTime).Seconds()),
+			"breakers": breakers,
+		})
 	})
 
+	// Orchestrator probes: restart on liveness failure, stop routing on readiness failure
+	r.Get("/livez", livenessHandler)
+	r.Get("/readyz", readinessHandler(healthChecker))
+
+	if cfg.MetricsToken == "" && !cfg.IsDevelopment() {
+		slog.Warn("METRICS_TOKEN not set, /metrics is open to anyone who can reach the server")
+	}
+	r.Handle("/metrics", metrics.Handler(cfg.MetricsToken))
+
 	addr := cfg.GetServerAddress()
-	log.Printf("Server listening on %s", addr)
-	log.Printf("GraphQL endpoint: http://localhost%s/query", addr)
-	if err := http.ListenAndServe(addr, r); err != nil {
-		log.Fatal("Server failed to start:", err)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
 	}
+	slog.Info("Server listening", "addr", addr, "graphql", "http://localhost"+addr+"/query")
+	err = serve(ctx, newHTTPServer(r), ln, cfg.ShutdownTimeout)
+
+	// Let the hasher finish the cover it is on before exiting
+	stop()
+	<-hasherDone
+	return err
 }
@@ -0,0 +1,53 @@
+// Package buildinfo reports which build of the server is running. Release
+// builds set the variables with -ldflags, e.g.
+//
+//	go build -ldflags "-X mediacloset/api/internal/buildinfo.Version=1.4.0 -X mediacloset/api/internal/buildinfo.Commit=$(git rev-parse --short HEAD)"
+//
+// Builds without them fall back to the VCS details Go embeds, if any.
+package buildinfo
+
+import (
+	"runtime/debug"
+)
+
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime,omitempty"`
+}
+
+// Get returns the build's version and commit. The commit is "unknown" when
+// neither ldflags nor the Go toolchain recorded it.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime}
+	if info.Commit != "" {
+		return info
+	}
+
+	info.Commit = "unknown"
+	if build, ok := debug.ReadBuildInfo(); ok {
+		var dirty bool
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+				if len(info.Commit) > 12 {
+					info.Commit = info.Commit[:12]
+				}
+			case "vcs.modified":
+				dirty = setting.Value == "true"
+			}
+		}
+		if dirty && info.Commit != "unknown" {
+			info.Commit += "-dirty"
+		}
+	}
+	return info
+}
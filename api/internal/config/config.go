@@ -2,9 +2,17 @@ package config
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
+
+	"mediacloset/api/internal/logging"
+	"mediacloset/api/internal/services"
 )
 
 type Config struct {
@@ -14,14 +22,16 @@ type Config struct {
 	HasuraEndpoint    string
 	HasuraAdminSecret string
 
-	APIKey        string // API key for client authentication (legacy, can be removed later)
+	APIKey        string // Legacy client key, accepted alongside keys issued with `admin client-keys`
 	OMDBAPIKey    string
 	DiscogsKey    string
 	DiscogsSecret string
 	LastFMAPIKey  string
 
 	// Auth
-	JWTSecret string // Secret key for JWT token signing
+	JWTSecret       string        // Secret key for JWT token signing
+	AccessTokenTTL  time.Duration // Lifetime of a JWT access token
+	RefreshTokenTTL time.Duration // A session expires after going unused this long
 
 	// AWS SES Email
 	AWSRegion          string
@@ -29,15 +39,65 @@ type Config struct {
 	AWSSecretAccessKey string
 	AWSSESFromEmail    string // Verified sender email in SES
 
-	// AWS S3 Image Uploads
-	S3Bucket    string
-	S3URLPrefix string // Public URL base, e.g. https://bucket.s3.amazonaws.com
+	// Image storage
+	StorageBackend   string // "s3", "local", or "" when uploads are unavailable
+	S3Bucket         string
+	S3URLPrefix      string // Public URL base, e.g. https://bucket.s3.amazonaws.com
+	S3Endpoint       string // Custom endpoint for S3-compatible services (MinIO, R2, ...)
+	S3ForcePathStyle bool   // Address objects as {endpoint}/{bucket}/{key} (required by MinIO)
+	LocalStorageDir  string // Directory used by the local storage backend
+	PublicBaseURL    string // Externally reachable base URL of this server, used for local image URLs and sign-in links
+
+	// Magic-link sign-in
+	IOSAppID     string // TEAMID.bundle.id, enables universal links to the app
+	IOSURLScheme string // Custom URL scheme the web fallback page opens
+
+	// Passkeys (WebAuthn)
+	WebAuthnRPID      string   // Domain passkeys are bound to, defaults to the PUBLIC_BASE_URL host
+	WebAuthnRPOrigins []string // Origins allowed to answer a passkey prompt, defaults to PUBLIC_BASE_URL
+
+	// Cover image garbage collection (cmd/admin cover-gc)
+	CoverGCGracePeriod time.Duration // Unreferenced uploads younger than this are kept
+
+	// Upstream provider limits: requests per minute and per UTC day, 0 for none
+	MusicBrainzRequestsPerMinute int
+	MusicBrainzDailyQuota        int
+	DiscogsRequestsPerMinute     int
+	DiscogsDailyQuota            int
+	OMDBRequestsPerMinute        int
+	OMDBDailyQuota               int
+	ITunesRequestsPerMinute      int
+	ITunesDailyQuota             int
+
+	// Shared rate limit buckets. Empty keeps them in memory per instance.
+	RedisURL string
+
+	// Proxies whose X-Forwarded-For is believed when working out a client's
+	// IP for per-IP limits. Connections from anywhere else use their own
+	// address.
+	TrustedProxies []netip.Prefix
+
+	// Bearer token Prometheus must send to scrape /metrics. Empty leaves
+	// the endpoint open.
+	MetricsToken string
+
+	// Trace exporter: none, stdout or otlp
+	TracesExporter string
+
+	// Readiness checks also ping the metadata providers
+	HealthPingProviders bool
+
+	// How long in-flight requests get to finish after SIGTERM, and the
+	// largest GraphQL request body accepted
+	ShutdownTimeout   time.Duration
+	MaxQueryBodyBytes int64
 
 	// Feature flags
 	EnableCache     bool
 	EnableRateLimit bool
 
-	// App version gating (forced updates)
+	// App version gating (forced updates). Defaults only: admins can override
+	// these at runtime with the updateAppVersionConfig mutation.
 	MinimumIOSVersion  string
 	ForceUpdateMessage string
 	AppStoreURL        string
@@ -53,9 +113,24 @@ func Load() *Config {
 
 	viper.SetDefault("PORT", "8080")
 	viper.SetDefault("ENVIRONMENT", "development")
+	viper.SetDefault("LOG_LEVEL", "info")
+	viper.SetDefault("LOG_FORMAT", "json")
+	viper.SetDefault("OTEL_TRACES_EXPORTER", "none")
+	viper.SetDefault("SHUTDOWN_TIMEOUT", "25s")     // Under the usual 30s grace period before SIGKILL
+	viper.SetDefault("MAX_QUERY_BODY_BYTES", 1<<20) // 1 MB
 	viper.SetDefault("ENABLE_CACHE", false)
 	viper.SetDefault("ENABLE_RATE_LIMIT", true)
 	viper.SetDefault("AWS_REGION", "us-east-1")
+	viper.SetDefault("MUSICBRAINZ_REQUESTS_PER_MINUTE", 60) // 1 req/sec per MusicBrainz policy
+	viper.SetDefault("DISCOGS_REQUESTS_PER_MINUTE", 60)     // Authenticated Discogs limit
+	viper.SetDefault("OMDB_DAILY_QUOTA", 1000)              // Free OMDB keys
+	viper.SetDefault("ITUNES_REQUESTS_PER_MINUTE", 20)      // Documented iTunes Search guidance
+	viper.SetDefault("COVER_GC_GRACE_PERIOD", "24h")
+	viper.SetDefault("TRUSTED_PROXIES", defaultTrustedProxies)
+	viper.SetDefault("LOCAL_STORAGE_DIR", "data/uploads")
+	viper.SetDefault("IOS_URL_SCHEME", "mediacloset")
+	viper.SetDefault("ACCESS_TOKEN_TTL", "24h")
+	viper.SetDefault("REFRESH_TOKEN_TTL", "720h")
 
 	// App version gating defaults
 	viper.SetDefault("MINIMUM_IOS_VERSION", "1.0.0")
@@ -63,11 +138,16 @@ func Load() *Config {
 	viper.SetDefault("APP_STORE_URL", "")
 
 	// Read config file (optional - env vars take precedence)
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			log.Println("No .env file found, using environment variables")
+	readErr := viper.ReadInConfig()
+
+	// Logging comes first so everything after this is structured
+	logging.Setup(os.Stderr, viper.GetString("LOG_LEVEL"), viper.GetString("LOG_FORMAT"))
+
+	if readErr != nil {
+		if _, ok := readErr.(viper.ConfigFileNotFoundError); ok {
+			slog.Info("No .env file found, using environment variables")
 		} else {
-			log.Printf("Error reading config file: %v", err)
+			slog.Error("Error reading config file", "error", readErr)
 		}
 	}
 
@@ -82,40 +162,162 @@ func Load() *Config {
 		DiscogsSecret:      viper.GetString("DISCOGS_CONSUMER_SECRET"),
 		LastFMAPIKey:       viper.GetString("LASTFM_API_KEY"),
 		JWTSecret:          viper.GetString("JWT_SECRET"),
+		AccessTokenTTL:     viper.GetDuration("ACCESS_TOKEN_TTL"),
+		RefreshTokenTTL:    viper.GetDuration("REFRESH_TOKEN_TTL"),
 		AWSRegion:          viper.GetString("AWS_REGION"),
 		AWSAccessKeyID:     viper.GetString("AWS_ACCESS_KEY_ID"),
 		AWSSecretAccessKey: viper.GetString("AWS_SECRET_ACCESS_KEY"),
 		AWSSESFromEmail:    viper.GetString("AWS_SES_FROM_EMAIL"),
 		S3Bucket:           viper.GetString("S3_BUCKET"),
+		StorageBackend:     viper.GetString("STORAGE_BACKEND"),
 		S3URLPrefix:        viper.GetString("S3_URL_PREFIX"),
+		S3Endpoint:         viper.GetString("S3_ENDPOINT"),
+		S3ForcePathStyle:   viper.GetBool("S3_FORCE_PATH_STYLE"),
+		LocalStorageDir:    viper.GetString("LOCAL_STORAGE_DIR"),
+		PublicBaseURL:      viper.GetString("PUBLIC_BASE_URL"),
+		IOSAppID:           viper.GetString("IOS_APP_ID"),
+		IOSURLScheme:       viper.GetString("IOS_URL_SCHEME"),
+		WebAuthnRPID:       viper.GetString("WEBAUTHN_RP_ID"),
+		CoverGCGracePeriod: viper.GetDuration("COVER_GC_GRACE_PERIOD"),
+		RedisURL:           viper.GetString("REDIS_URL"),
 		EnableCache:        viper.GetBool("ENABLE_CACHE"),
 		EnableRateLimit:    viper.GetBool("ENABLE_RATE_LIMIT"),
 
+		MetricsToken:        viper.GetString("METRICS_TOKEN"),
+		TracesExporter:      viper.GetString("OTEL_TRACES_EXPORTER"),
+		HealthPingProviders: viper.GetBool("HEALTH_PING_PROVIDERS"),
+
+		ShutdownTimeout:   viper.GetDuration("SHUTDOWN_TIMEOUT"),
+		MaxQueryBodyBytes: viper.GetInt64("MAX_QUERY_BODY_BYTES"),
+
+		MusicBrainzRequestsPerMinute: viper.GetInt("MUSICBRAINZ_REQUESTS_PER_MINUTE"),
+		MusicBrainzDailyQuota:        viper.GetInt("MUSICBRAINZ_DAILY_QUOTA"),
+		DiscogsRequestsPerMinute:     viper.GetInt("DISCOGS_REQUESTS_PER_MINUTE"),
+		DiscogsDailyQuota:            viper.GetInt("DISCOGS_DAILY_QUOTA"),
+		OMDBRequestsPerMinute:        viper.GetInt("OMDB_REQUESTS_PER_MINUTE"),
+		OMDBDailyQuota:               viper.GetInt("OMDB_DAILY_QUOTA"),
+		ITunesRequestsPerMinute:      viper.GetInt("ITUNES_REQUESTS_PER_MINUTE"),
+		ITunesDailyQuota:             viper.GetInt("ITUNES_DAILY_QUOTA"),
+
 		MinimumIOSVersion:  viper.GetString("MINIMUM_IOS_VERSION"),
 		ForceUpdateMessage: viper.GetString("FORCE_UPDATE_MESSAGE"),
 		AppStoreURL:        viper.GetString("APP_STORE_URL"),
 	}
 
 	if cfg.APIKey == "" {
-		log.Fatal("API_KEY is required")
+		slog.Warn("API_KEY not set, only client keys issued with `admin client-keys` are accepted")
 	}
 	if cfg.OMDBAPIKey == "" {
-		log.Fatal("OMDB_API_KEY is required")
+		fatal("OMDB_API_KEY is required")
 	}
 	if cfg.HasuraEndpoint == "" {
-		log.Fatal("HASURA_ENDPOINT is required")
+		fatal("HASURA_ENDPOINT is required")
 	}
 	if cfg.HasuraAdminSecret == "" {
-		log.Fatal("HASURA_ADMIN_SECRET is required")
+		fatal("HASURA_ADMIN_SECRET is required")
 	}
 	if cfg.JWTSecret == "" {
-		log.Fatal("JWT_SECRET is required")
+		fatal("JWT_SECRET is required")
 	}
 
-	log.Printf("Config loaded: environment=%s, port=%s", cfg.Environment, cfg.Port)
+	if cfg.PublicBaseURL == "" {
+		cfg.PublicBaseURL = fmt.Sprintf("http://localhost:%s", cfg.Port)
+	}
+
+	// Passkeys default to the public host; apps list their origins explicitly
+	for _, origin := range strings.Split(viper.GetString("WEBAUTHN_RP_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.WebAuthnRPOrigins = append(cfg.WebAuthnRPOrigins, origin)
+		}
+	}
+	if base, err := url.Parse(cfg.PublicBaseURL); err == nil {
+		if cfg.WebAuthnRPID == "" {
+			cfg.WebAuthnRPID = base.Hostname()
+		}
+		if len(cfg.WebAuthnRPOrigins) == 0 {
+			cfg.WebAuthnRPOrigins = []string{base.Scheme + "://" + base.Host}
+		}
+	}
+
+	// Trusted proxies are CIDRs or single addresses
+	for _, proxy := range strings.Split(viper.GetString("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		prefix, err := parseProxy(proxy)
+		if err != nil {
+			fatal(fmt.Sprintf("TRUSTED_PROXIES: %v", err))
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, prefix)
+	}
+
+	// Pick a storage backend when none is set explicitly: S3 when a bucket is
+	// configured, the local filesystem in development, otherwise uploads are off
+	if cfg.StorageBackend == "" {
+		if cfg.S3Bucket != "" {
+			cfg.StorageBackend = "s3"
+		} else if cfg.IsDevelopment() {
+			cfg.StorageBackend = "local"
+		}
+	}
+
+	slog.Info("Config loaded", "environment", cfg.Environment, "port", cfg.Port)
 	return cfg
 }
 
+// defaultTrustedProxies covers loopback and private networks, which is
+// where a hosting platform's load balancer connects from
+const defaultTrustedProxies = "127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,100.64.0.0/10,fc00::/7"
+
+// parseProxy reads a CIDR, or a single address as a one-host prefix
+func parseProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// fatal logs a configuration error and exits
+func fatal(msg string) {
+	slog.Error(msg)
+	os.Exit(1)
+}
+
+// Warnings lists settings that don't stop the server from starting but
+// leave a feature off or insecure. Readiness reports them as degraded.
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if c.StorageBackend == "" {
+		warnings = append(warnings, "no storage backend, image uploads are off")
+	}
+	if c.IsDevelopment() {
+		return warnings
+	}
+
+	if c.AWSSESFromEmail == "" || c.AWSAccessKeyID == "" || c.AWSSecretAccessKey == "" {
+		warnings = append(warnings, "AWS SES not configured, login codes can't be sent")
+	}
+	if base, err := url.Parse(c.PublicBaseURL); err != nil || base.Hostname() == "localhost" {
+		warnings = append(warnings, "PUBLIC_BASE_URL points to localhost, sign-in links won't open")
+	}
+	if len(c.JWTSecret) < 32 {
+		warnings = append(warnings, "JWT_SECRET is shorter than 32 characters")
+	}
+	if c.MetricsToken == "" {
+		warnings = append(warnings, "METRICS_TOKEN not set, /metrics is open")
+	}
+	return warnings
+}
+
 func (c *Config) IsDevelopment() bool {
 	return c.Environment == "development"
 }
@@ -123,3 +325,22 @@ func (c *Config) IsDevelopment() bool {
 func (c *Config) GetServerAddress() string {
 	return fmt.Sprintf(":%s", c.Port)
 }
+
+// StorageConfig maps config onto the object storage settings
+func (c *Config) StorageConfig() services.StorageConfig {
+	return services.StorageConfig{
+		Backend: c.StorageBackend,
+		S3: services.S3Options{
+			Region:          c.AWSRegion,
+			AccessKeyID:     c.AWSAccessKeyID,
+			SecretAccessKey: c.AWSSecretAccessKey,
+			Bucket:          c.S3Bucket,
+			URLPrefix:       c.S3URLPrefix,
+			Endpoint:        c.S3Endpoint,
+			UsePathStyle:    c.S3ForcePathStyle,
+		},
+		LocalDir:      c.LocalStorageDir,
+		PublicBaseURL: c.PublicBaseURL,
+		SigningSecret: c.JWTSecret,
+	}
+}
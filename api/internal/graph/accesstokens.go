@@ -0,0 +1,44 @@
+package graph
+
+import (
+	"time"
+
+	"mediacloset/api/internal/graph/model"
+	"mediacloset/api/internal/services"
+)
+
+var scopes = map[model.TokenScope]services.Scope{
+	model.TokenScopeReadCollection:  services.ScopeReadCollection,
+	model.TokenScopeWriteCollection: services.ScopeWriteCollection,
+	model.TokenScopeUploadImages:    services.ScopeUploadImages,
+}
+
+// toServiceScope maps the GraphQL enum onto the stored scope
+func toServiceScope(scope model.TokenScope) services.Scope {
+	return scopes[scope]
+}
+
+func toModelPersonalAccessToken(t *services.PersonalAccessToken) *model.PersonalAccessToken {
+	token := &model.PersonalAccessToken{
+		ID:        t.ID,
+		Name:      t.Name,
+		Scopes:    []model.TokenScope{},
+		CreatedAt: t.CreatedAt.Format(time.RFC3339),
+	}
+	for _, scope := range t.Scopes {
+		for m, s := range scopes {
+			if s == scope {
+				token.Scopes = append(token.Scopes, m)
+			}
+		}
+	}
+	if t.ExpiresAt != nil {
+		expiresAt := t.ExpiresAt.Format(time.RFC3339)
+		token.ExpiresAt = &expiresAt
+	}
+	if t.LastUsedAt != nil {
+		lastUsedAt := t.LastUsedAt.Format(time.RFC3339)
+		token.LastUsedAt = &lastUsedAt
+	}
+	return token
+}
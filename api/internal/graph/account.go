@@ -0,0 +1,22 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+
+	"mediacloset/api/internal/services"
+)
+
+// accountErrorMessage shows account errors the user can act on as they are,
+// and prefixes anything else with what failed
+func accountErrorMessage(prefix string, err error) string {
+	var throttled *services.LoginThrottledError
+	switch {
+	case errors.Is(err, services.ErrEmailInUse),
+		errors.Is(err, services.ErrInvalidEmailChangeCode),
+		errors.Is(err, services.ErrConfirmEmailMismatch),
+		errors.As(err, &throttled):
+		return err.Error()
+	}
+	return fmt.Sprintf("%s: %v", prefix, err)
+}
@@ -0,0 +1,46 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"mediacloset/api/internal/graph/model"
+	custommw "mediacloset/api/internal/middleware"
+	"mediacloset/api/internal/ratelimit"
+	"mediacloset/api/internal/services"
+)
+
+// auditActor identifies the signed-in admin in audit records, alongside the
+// "cli:<name>" actors written by cmd/admin
+func auditActor(ctx context.Context) string {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return "user:unknown"
+	}
+	return "user:" + userInfo.UserID
+}
+
+func toModelAppVersionConfig(cfg *services.AppVersionConfig) *model.AppVersionConfig {
+	return &model.AppVersionConfig{
+		MinimumIOSVersion: cfg.MinimumIOSVersion,
+		UpdateMessage:     cfg.UpdateMessage,
+		ForceUpdate:       cfg.ForceUpdate,
+		StoreURL:          cfg.StoreURL,
+	}
+}
+
+func toModelProviderQuota(q ratelimit.QuotaStatus) *model.ProviderQuota {
+	quota := &model.ProviderQuota{
+		Provider:  string(q.Provider),
+		UsedToday: q.UsedToday,
+		ResetsAt:  q.ResetsAt.Format(time.RFC3339),
+	}
+	if q.Limit.RequestsPerMinute > 0 {
+		quota.RequestsPerMinute = &q.Limit.RequestsPerMinute
+	}
+	if q.Limit.DailyQuota > 0 {
+		quota.DailyQuota = &q.Limit.DailyQuota
+		quota.RemainingToday = &q.Remaining
+	}
+	return quota
+}
@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+
+	"mediacloset/api/internal/services"
+)
+
+func TestHasRoleDirective(t *testing.T) {
+	c := newTestClient(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		role      services.Role
+		expectErr string
+	}{
+		{
+			name:      "read-only user cannot change their collection",
+			query:     `mutation { updateProfile(input: {isPublic: true}) { success } }`,
+			role:      services.RoleReadOnly,
+			expectErr: "not authorized",
+		},
+		{
+			name:  "user can change their own profile",
+			query: `mutation { updateProfile(input: {isPublic: true}) { success } }`,
+			role:  services.RoleUser,
+		},
+		{
+			name:      "anonymous caller must sign in",
+			query:     `mutation { updateProfile(input: {isPublic: true}) { success } }`,
+			expectErr: "authentication required",
+		},
+		{
+			name:      "user cannot change app config",
+			query:     `mutation { updateAppVersionConfig(input: {minimumIOSVersion: "9.0"}) { success } }`,
+			role:      services.RoleUser,
+			expectErr: "not authorized",
+		},
+		{
+			name:      "user cannot list users",
+			query:     `{ users { pageInfo { totalCount } } }`,
+			role:      services.RoleUser,
+			expectErr: "not authorized",
+		},
+		{
+			name:      "user cannot merge catalog rows",
+			query:     `mutation { mergeCatalogItems(kind: ALBUM, targetId: "a", sourceId: "b", reason: "dupe") { success } }`,
+			role:      services.RoleUser,
+			expectErr: "not authorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []client.Option
+			if tt.role != "" {
+				opts = append(opts, asRole("alice", tt.role))
+			}
+
+			var resp map[string]interface{}
+			err := c.Post(tt.query, &resp, opts...)
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAdminReadsPrivateProfiles(t *testing.T) {
+	c := newTestClient(t)
+
+	var resp struct {
+		User struct {
+			Email *string
+			Role  *string
+		}
+		UserMovies []struct{ ID string }
+	}
+	err := c.Post(`{ user(id: "alice") { email role } userMovies(userId: "alice") { id } }`, &resp, asRole("carol", services.RoleAdmin))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.User.Email == nil || len(resp.UserMovies) != 1 {
+		t.Errorf("expected admin to see alice's private profile, got %+v", resp)
+	}
+
+	// Other users never see roles
+	var public struct {
+		User struct{ Role *string }
+	}
+	if err := c.Post(`{ user(id: "bob") { role } }`, &public, asUser("alice")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if public.User.Role != nil {
+		t.Errorf("expected bob's role to be hidden from alice, got %v", *public.User.Role)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	c := newTestClient(t)
+
+	var resp struct {
+		SetUserRole struct {
+			Success bool
+			User    *struct{ Role string }
+			Error   *string
+		}
+	}
+
+	err := c.Post(`mutation { setUserRole(userId: "carol", role: USER) { success error } }`, &resp, asRole("carol", services.RoleAdmin))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.SetUserRole.Success || resp.SetUserRole.Error == nil || !strings.Contains(*resp.SetUserRole.Error, "own role") {
+		t.Errorf("expected admins to be unable to change their own role, got %+v", resp.SetUserRole)
+	}
+
+	err = c.Post(`mutation { setUserRole(userId: "bob", role: READ_ONLY) { success user { role } error } }`, &resp, asRole("carol", services.RoleAdmin))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !resp.SetUserRole.Success || resp.SetUserRole.User == nil || resp.SetUserRole.User.Role != "READ_ONLY" {
+		t.Errorf("expected bob to become read-only, got %+v", resp.SetUserRole)
+	}
+}
+
+func TestAppVersionConfig_StoredOverridesDefaults(t *testing.T) {
+	c := newTestClient(t)
+
+	var resp struct {
+		AppVersionConfig struct {
+			MinimumIOSVersion string
+			ForceUpdate       bool
+		}
+	}
+	if err := c.Post(`{ appVersionConfig { minimumIOSVersion forceUpdate } }`, &resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.AppVersionConfig.MinimumIOSVersion != "2.1.0" || !resp.AppVersionConfig.ForceUpdate {
+		t.Errorf("expected stored version over env defaults, got %+v", resp.AppVersionConfig)
+	}
+}
@@ -0,0 +1,167 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"mediacloset/api/internal/graph/model"
+	"mediacloset/api/internal/services"
+)
+
+// maxCatalogPageSize bounds pages from the catalog-wide queries, which unlike
+// a single collection can be arbitrarily large
+const maxCatalogPageSize = 100
+
+// fetchCatalogPage applies the collection query defaults (25 per page, newest
+// first) and fetches one page of a catalog table
+func (r *Resolver) fetchCatalogPage(ctx context.Context, kind services.MediaKind, pagination *model.PaginationInput, sort *model.SortInput, search *string) (*services.PaginatedResult, *model.PageInfo, error) {
+	limit := 25
+	offset := 0
+	if pagination != nil {
+		limit = pagination.Limit
+		offset = pagination.Offset
+	}
+	if limit < 0 || offset < 0 {
+		return nil, nil, fmt.Errorf("limit and offset must not be negative")
+	}
+	if limit > maxCatalogPageSize {
+		limit = maxCatalogPageSize
+	}
+
+	sortField := "CREATED_AT"
+	sortOrder := "DESC"
+	if sort != nil {
+		sortField = string(sort.Field)
+		sortOrder = string(sort.Order)
+	}
+
+	result, err := r.HasuraClient.GetCatalogPaginated(ctx, kind, limit, offset, sortField, sortOrder, search)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch %s: %w", kind, err)
+	}
+
+	return result, &model.PageInfo{
+		HasNextPage: offset+len(result.Items) < result.TotalCount,
+		TotalCount:  result.TotalCount,
+	}, nil
+}
+
+// toModelMovie converts a Hasura vhs row to its GraphQL type
+func toModelMovie(m map[string]interface{}) *model.Movie {
+	c := toCatalogMovie(m)
+	movie := &model.Movie{
+		ID:       c.ID,
+		Title:    c.Title,
+		Director: c.Director,
+		Year:     c.Year,
+		Genre:    c.Genre,
+		CoverURL: c.CoverURL,
+	}
+	if createdAt, ok := m["created_at"].(string); ok {
+		movie.CreatedAt = &createdAt
+	}
+	if updatedAt, ok := m["updated_at"].(string); ok {
+		movie.UpdatedAt = &updatedAt
+	}
+	return movie
+}
+
+// toModelAlbum converts a Hasura records row to its GraphQL type
+func toModelAlbum(a map[string]interface{}) *model.Album {
+	c := toCatalogAlbum(a)
+	album := &model.Album{
+		ID:            c.ID,
+		Artist:        c.Artist,
+		Album:         c.Album,
+		Year:          c.Year,
+		Label:         c.Label,
+		ColorVariants: c.ColorVariants,
+		Genres:        c.Genres,
+		CoverURL:      c.CoverURL,
+		Size:          c.Size,
+	}
+	if createdAt, ok := a["created_at"].(string); ok {
+		album.CreatedAt = &createdAt
+	}
+	if updatedAt, ok := a["updated_at"].(string); ok {
+		album.UpdatedAt = &updatedAt
+	}
+	return album
+}
+
+func toCatalogMovie(m map[string]interface{}) *model.CatalogMovie {
+	movie := &model.CatalogMovie{}
+	movie.ID, _ = m["id"].(string)
+	movie.Title, _ = m["title"].(string)
+	movie.Director = optionalString(m, "director")
+	movie.Year = optionalInt(m, "year")
+	movie.Genre = optionalString(m, "genre")
+	movie.CoverURL = optionalString(m, "cover_url")
+	return movie
+}
+
+func toCatalogAlbum(a map[string]interface{}) *model.CatalogAlbum {
+	album := &model.CatalogAlbum{}
+	album.ID, _ = a["id"].(string)
+	album.Artist, _ = a["artist"].(string)
+	album.Album, _ = a["album"].(string)
+	album.Year = optionalInt(a, "year")
+	album.Label = optionalString(a, "label")
+	album.ColorVariants = stringList(a, "color_variants")
+	album.Genres = stringList(a, "genres")
+	album.CoverURL = optionalString(a, "cover_url")
+	album.Size = optionalInt(a, "size")
+	return album
+}
+
+func toCatalogCassette(c map[string]interface{}) *model.CatalogCassette {
+	cassette := &model.CatalogCassette{}
+	cassette.ID, _ = c["id"].(string)
+	cassette.Artist, _ = c["artist"].(string)
+	cassette.Album, _ = c["album"].(string)
+	cassette.Year = optionalInt(c, "year")
+	cassette.Label = optionalString(c, "label")
+	cassette.Genres = stringList(c, "genres")
+	cassette.CoverURL = optionalString(c, "cover_url")
+	cassette.TapeType = optionalString(c, "tape_type")
+	return cassette
+}
+
+// catalogCoverURL hides user-uploaded covers from the public catalog, since
+// their URLs contain the uploader's ID. Provider artwork is kept.
+func (r *Resolver) catalogCoverURL(coverURL *string) *string {
+	if coverURL == nil || services.IsUploadedCoverURL(r.Storage, *coverURL) {
+		return nil
+	}
+	return coverURL
+}
+
+func optionalString(row map[string]interface{}, key string) *string {
+	if v, ok := row[key].(string); ok {
+		return &v
+	}
+	return nil
+}
+
+func optionalInt(row map[string]interface{}, key string) *int {
+	if v, ok := row[key].(float64); ok {
+		n := int(v)
+		return &n
+	}
+	return nil
+}
+
+// stringList returns a text array column, or nil when it is missing or empty
+func stringList(row map[string]interface{}, key string) []string {
+	values, _ := row[key].([]interface{})
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	if len(strs) == 0 {
+		return nil
+	}
+	return strs
+}
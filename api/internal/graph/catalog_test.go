@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+
+	"mediacloset/api/internal/services"
+)
+
+func TestCatalogListing_AdminOnly(t *testing.T) {
+	c := newTestClient(t)
+
+	tests := []struct {
+		name      string
+		role      services.Role
+		expectErr string
+	}{
+		{name: "admin", role: services.RoleAdmin},
+		{name: "regular user", role: services.RoleUser, expectErr: "not authorized"},
+		{name: "anonymous", expectErr: "authentication required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []client.Option
+			if tt.role != "" {
+				opts = append(opts, asRole("carol", tt.role))
+			}
+
+			var resp struct {
+				Movies *struct {
+					Items []struct {
+						ID        string
+						CreatedAt *string
+					}
+				}
+			}
+			err := c.Post(`{ movies(pagination: {limit: 10}) { items { id createdAt } } }`, &resp, opts...)
+
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+				if resp.Movies != nil {
+					t.Errorf("expected no data, got %+v", resp.Movies)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(resp.Movies.Items) != 1 || resp.Movies.Items[0].CreatedAt == nil {
+				t.Errorf("expected the admin listing to include timestamps, got %+v", resp.Movies.Items)
+			}
+		})
+	}
+}
+
+func TestCatalogBrowse(t *testing.T) {
+	c := newTestClient(t)
+
+	var resp struct {
+		CatalogMovies struct {
+			Items []struct {
+				ID    string
+				Title string
+				Year  *int
+			}
+			PageInfo struct {
+				HasNextPage bool
+				TotalCount  int
+			}
+		}
+	}
+	err := c.Post(`{ catalogMovies(pagination: {limit: 500}, sort: {field: TITLE, order: ASC}, search: "ali") {
+		items { id title year }
+		pageInfo { hasNextPage totalCount }
+	} }`, &resp)
+	if err != nil {
+		t.Fatalf("expected anonymous catalog browse to succeed, got %v", err)
+	}
+	if len(resp.CatalogMovies.Items) != 1 || resp.CatalogMovies.Items[0].Title != "Alien" {
+		t.Errorf("unexpected items: %+v", resp.CatalogMovies.Items)
+	}
+	if !resp.CatalogMovies.PageInfo.HasNextPage || resp.CatalogMovies.PageInfo.TotalCount != 30 {
+		t.Errorf("unexpected page info: %+v", resp.CatalogMovies.PageInfo)
+	}
+
+	// Row timestamps would reveal when someone added an item
+	err = c.Post(`{ catalogMovies { items { createdAt } } }`, &resp)
+	if err == nil || !strings.Contains(err.Error(), "Cannot query field") {
+		t.Errorf("expected createdAt not to exist on catalog items, got %v", err)
+	}
+}
+
+func TestCatalogBrowse_HidesUploaders(t *testing.T) {
+	c := newTestClient(t)
+
+	resp, err := c.RawPost(`{
+		catalogMovies { items { id coverUrl } }
+		catalogAlbums { items { id coverUrl } }
+	}`)
+	if err != nil || len(resp.Errors) > 0 {
+		t.Fatalf("unexpected error: %v %v", err, resp.Errors)
+	}
+
+	body, err := json.Marshal(resp.Data)
+	if err != nil {
+		t.Fatalf("failed to encode response: %v", err)
+	}
+	if strings.Contains(string(body), "user-42") {
+		t.Errorf("expected no user ID in the catalog, got %s", body)
+	}
+
+	var data struct {
+		CatalogMovies struct{ Items []struct{ CoverURL *string } }
+		CatalogAlbums struct{ Items []struct{ CoverURL *string } }
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(data.CatalogMovies.Items) != 1 || data.CatalogMovies.Items[0].CoverURL != nil {
+		t.Errorf("expected the uploaded cover to be left out, got %+v", data.CatalogMovies.Items)
+	}
+	if len(data.CatalogAlbums.Items) != 1 || data.CatalogAlbums.Items[0].CoverURL == nil {
+		t.Errorf("expected provider artwork to be kept, got %+v", data.CatalogAlbums.Items)
+	}
+}
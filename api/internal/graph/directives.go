@@ -0,0 +1,130 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+
+	"mediacloset/api/internal/graph/model"
+	custommw "mediacloset/api/internal/middleware"
+	"mediacloset/api/internal/services"
+)
+
+var (
+	errUnauthenticated = errors.New("authentication required")
+	errForbidden       = errors.New("not authorized")
+	errTokenNotAllowed = errors.New("personal access tokens cannot use this field")
+)
+
+// NewConfig builds the executable schema config with the authorization
+// directives wired to the resolver's services
+func NewConfig(r *Resolver) Config {
+	cfg := Config{Resolvers: r}
+	cfg.Directives.Auth = authDirective
+	cfg.Directives.HasRole = hasRoleDirective
+	cfg.Directives.Owner = r.ownerDirective
+	cfg.Directives.Scope = scopeDirective
+	return cfg
+}
+
+// tokenAllowed reports whether the caller may use the current root field.
+// Personal access tokens are limited to root fields that declare @scope;
+// scopeDirective checks that the token holds it.
+func tokenAllowed(ctx context.Context, caller *custommw.UserInfo) bool {
+	if !caller.IsAccessToken() {
+		return true
+	}
+	root := graphql.GetRootFieldContext(ctx)
+	return root != nil && root.Field.Definition != nil && root.Field.Definition.Directives.ForName("scope") != nil
+}
+
+// authDirective implements @auth: the caller must be signed in
+func authDirective(ctx context.Context, obj any, next graphql.Resolver) (any, error) {
+	caller, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	if !tokenAllowed(ctx, caller) {
+		return nil, errTokenNotAllowed
+	}
+	return next(ctx)
+}
+
+// hasRoleDirective implements @hasRole: the caller's role must include role
+func hasRoleDirective(ctx context.Context, obj any, next graphql.Resolver, role model.Role) (any, error) {
+	caller, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	if !tokenAllowed(ctx, caller) {
+		return nil, errTokenNotAllowed
+	}
+	if !caller.Role.Satisfies(toServiceRole(role)) {
+		return nil, errForbidden
+	}
+	return next(ctx)
+}
+
+// ownerDirective implements @owner. The owner comes from the field argument
+// named by arg (default "userId"); fields without that argument on a User
+// use the parent User instead, and are hidden rather than failing so the
+// rest of the profile still resolves. Admins can read everything.
+func (r *Resolver) ownerDirective(ctx context.Context, obj any, next graphql.Resolver, arg *string, allowPublic *bool) (any, error) {
+	argName := "userId"
+	if arg != nil {
+		argName = *arg
+	}
+	public := allowPublic != nil && *allowPublic
+	caller, authenticated := custommw.GetUserFromContext(ctx)
+	if authenticated && !tokenAllowed(ctx, caller) {
+		caller, authenticated = nil, false
+	}
+	if authenticated && caller.Role.Satisfies(services.RoleAdmin) {
+		return next(ctx)
+	}
+
+	fc := graphql.GetFieldContext(ctx)
+	ownerID, fromArg := fc.Args[argName].(string)
+	if !fromArg {
+		parent, ok := obj.(*model.User)
+		if !ok {
+			return nil, fmt.Errorf("@owner on %s: no %q argument and no parent User", fc.Field.Name, argName)
+		}
+		if (authenticated && caller.UserID == parent.ID) || (public && parent.IsPublic) {
+			return next(ctx)
+		}
+		return nil, nil
+	}
+
+	if authenticated && caller.UserID == ownerID {
+		return next(ctx)
+	}
+
+	if public {
+		owner, err := r.AuthService.GetUserByID(ctx, ownerID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check profile visibility: %w", err)
+		}
+		if owner != nil && owner.IsPublic {
+			return next(ctx)
+		}
+	}
+
+	// Missing and private users look the same so IDs can't be probed
+	if !authenticated {
+		return nil, errUnauthenticated
+	}
+	return nil, errForbidden
+}
+
+// scopeDirective implements @scope: a personal access token must hold scope.
+// Session callers and anonymous requests are left to the other directives.
+func scopeDirective(ctx context.Context, obj any, next graphql.Resolver, scope model.TokenScope) (any, error) {
+	caller, ok := custommw.GetUserFromContext(ctx)
+	if ok && !caller.HasScope(toServiceScope(scope)) {
+		return nil, fmt.Errorf("personal access token lacks the %s scope", scope)
+	}
+	return next(ctx)
+}
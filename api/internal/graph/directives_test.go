@@ -0,0 +1,322 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+
+	"mediacloset/api/internal/health"
+	"mediacloset/api/internal/metrics"
+	custommw "mediacloset/api/internal/middleware"
+	"mediacloset/api/internal/services"
+	"mediacloset/api/internal/tracing"
+)
+
+// newTestClient serves the schema against a fake Hasura with two users: alice
+// (private) and bob (public). The X-Test-User and X-Test-Role headers stand in
+// for a JWT; adding X-Test-Scopes makes it a personal access token.
+func newTestClient(t *testing.T) *client.Client {
+	t.Helper()
+
+	users := map[string]map[string]interface{}{
+		"alice": {"id": "alice", "email": "alice@example.com", "is_public": false},
+		"bob":   {"id": "bob", "email": "bob@example.com", "is_public": true},
+	}
+
+	hasura := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req services.GraphQLRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "GetUserByID":
+			data["users_by_pk"] = users[req.Variables["id"].(string)]
+		case "GetMoviesByUserID":
+			data["user_vhs"] = []map[string]interface{}{
+				{"vhs": map[string]interface{}{"id": "m-" + req.Variables["user_id"].(string), "title": "Alien"}},
+			}
+		case "GetCatalogPaginated":
+			if limit := req.Variables["limit"].(float64); limit > maxCatalogPageSize {
+				t.Errorf("expected catalog page size to be capped, got %v", limit)
+			}
+			data["vhs"] = []map[string]interface{}{
+				{"id": "v1", "title": "Alien", "year": 1979, "cover_url": "https://cdn.example.com/covers/user-42/3f2a.jpg", "created_at": "2024-01-01T00:00:00Z"},
+			}
+			data["vhs_aggregate"] = map[string]interface{}{"aggregate": map[string]interface{}{"count": 30}}
+			data["records"] = []map[string]interface{}{
+				{"id": "r1", "artist": "Radiohead", "album": "Kid A", "cover_url": "https://coverartarchive.org/release/1/front.jpg"},
+			}
+			data["records_aggregate"] = map[string]interface{}{"aggregate": map[string]interface{}{"count": 1}}
+		case "UpdateProfile":
+			data["update_users_by_pk"] = users[req.Variables["id"].(string)]
+		case "SetUserRole":
+			user := users[req.Variables["id"].(string)]
+			if user != nil {
+				user["role"] = req.Variables["role"]
+			}
+			data["update_users_by_pk"] = user
+		case "RevokeSessions":
+			data["update_sessions"] = map[string]interface{}{"affected_rows": 0, "returning": []interface{}{}}
+		case "Ping":
+			data["__typename"] = "query_root"
+		case "GetAppConfig":
+			data["app_config"] = []map[string]interface{}{{"key": "minimum_ios_version", "value": "2.1.0"}}
+		case "GetMoviesByUserIDPaginated":
+			data["user_vhs"] = []map[string]interface{}{}
+			data["user_vhs_aggregate"] = map[string]interface{}{"aggregate": map[string]interface{}{"count": 0}}
+		default:
+			t.Errorf("unexpected Hasura operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(hasura.Close)
+
+	hasuraClient := services.NewHasuraClient(hasura.URL, "")
+	resolver := &Resolver{
+		HasuraClient: hasuraClient,
+		AuthService:  services.NewAuthService(hasuraClient, nil, "test-secret", true),
+		AppConfig:    services.NewAppConfigService(hasuraClient, services.AppVersionConfig{MinimumIOSVersion: "1.0.0", ForceUpdate: true}),
+		HealthChecker: health.NewChecker(
+			health.Check{Name: "hasura", Critical: true, Run: hasuraClient.Ping},
+			health.Check{Name: "storage", Run: func(ctx context.Context) error { return errors.New("bucket covers not found") }},
+		),
+	}
+	srv := handler.NewDefaultServer(NewExecutableSchema(NewConfig(resolver)))
+	srv.Use(metrics.GraphQL{})
+	srv.Use(tracing.GraphQL{})
+
+	withUser := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if userID := r.Header.Get("X-Test-User"); userID != "" {
+			ctx := context.WithValue(r.Context(), custommw.UserContextKey{}, custommw.UserInfo{
+				UserID: userID,
+				Role:   services.Role(r.Header.Get("X-Test-Role")),
+				Scopes: testScopes(r.Header),
+			})
+			r = r.WithContext(ctx)
+		}
+		srv.ServeHTTP(w, r)
+	})
+
+	return client.New(withUser)
+}
+
+func asUser(userID string) client.Option {
+	return asRole(userID, services.RoleUser)
+}
+
+func asRole(userID string, role services.Role) client.Option {
+	return func(bd *client.Request) {
+		bd.HTTP.Header.Set("X-Test-User", userID)
+		bd.HTTP.Header.Set("X-Test-Role", string(role))
+	}
+}
+
+// asToken calls as userID with a personal access token holding scopes
+func asToken(userID string, scopes ...services.Scope) client.Option {
+	return func(bd *client.Request) {
+		asUser(userID)(bd)
+		names := make([]string, len(scopes))
+		for i, scope := range scopes {
+			names[i] = string(scope)
+		}
+		bd.HTTP.Header.Set("X-Test-Scopes", strings.Join(names, ","))
+	}
+}
+
+func testScopes(header http.Header) []services.Scope {
+	if _, ok := header["X-Test-Scopes"]; !ok {
+		return nil
+	}
+	scopes := []services.Scope{}
+	for _, name := range strings.Split(header.Get("X-Test-Scopes"), ",") {
+		if name != "" {
+			scopes = append(scopes, services.Scope(name))
+		}
+	}
+	return scopes
+}
+
+func TestOwnerDirective_CollectionQueries(t *testing.T) {
+	c := newTestClient(t)
+
+	tests := []struct {
+		name      string
+		caller    string
+		userID    string
+		expectErr string
+	}{
+		{name: "own collection", caller: "alice", userID: "alice"},
+		{name: "other user's private collection", caller: "bob", userID: "alice", expectErr: "not authorized"},
+		{name: "other user's public collection", caller: "alice", userID: "bob"},
+		{name: "anonymous private collection", userID: "alice", expectErr: "authentication required"},
+		{name: "anonymous public collection", userID: "bob"},
+		{name: "unknown user", caller: "alice", userID: "mallory", expectErr: "not authorized"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []client.Option{client.Var("userId", tt.userID)}
+			if tt.caller != "" {
+				opts = append(opts, asUser(tt.caller))
+			}
+
+			var resp struct {
+				UserMovies []struct{ ID string }
+			}
+			err := c.Post(`query($userId: String!) { userMovies(userId: $userId) { id } }`, &resp, opts...)
+
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+				if len(resp.UserMovies) != 0 {
+					t.Errorf("expected no data to leak, got %+v", resp.UserMovies)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(resp.UserMovies) != 1 || resp.UserMovies[0].ID != "m-"+tt.userID {
+				t.Errorf("expected %s's movies, got %+v", tt.userID, resp.UserMovies)
+			}
+		})
+	}
+}
+
+func TestOwnerDirective_PaginatedQueries(t *testing.T) {
+	c := newTestClient(t)
+
+	var resp map[string]interface{}
+	err := c.Post(`{ userMoviesPaginated(userId: "alice") { pageInfo { totalCount } } }`, &resp, asUser("bob"))
+	if err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Fatalf("expected cross-user paginated read to be rejected, got %v", err)
+	}
+
+	err = c.Post(`{ userMoviesPaginated(userId: "alice") { pageInfo { totalCount } } }`, &resp, asUser("alice"))
+	if err != nil {
+		t.Fatalf("expected own paginated read to succeed, got %v", err)
+	}
+}
+
+func TestOwnerDirective_UserProfile(t *testing.T) {
+	c := newTestClient(t)
+
+	type user struct {
+		ID       string
+		Email    *string
+		IsPublic bool
+	}
+
+	tests := []struct {
+		name        string
+		caller      string
+		userID      string
+		expectErr   string
+		expectEmail bool
+	}{
+		{name: "own profile shows email", caller: "alice", userID: "alice", expectEmail: true},
+		{name: "public profile hides email", caller: "alice", userID: "bob"},
+		{name: "private profile is rejected", caller: "bob", userID: "alice", expectErr: "not authorized"},
+		{name: "anonymous public profile hides email", userID: "bob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []client.Option{client.Var("id", tt.userID)}
+			if tt.caller != "" {
+				opts = append(opts, asUser(tt.caller))
+			}
+
+			var resp struct{ User *user }
+			err := c.Post(`query($id: String!) { user(id: $id) { id email isPublic } }`, &resp, opts...)
+
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+				if resp.User != nil {
+					t.Errorf("expected no user data, got %+v", resp.User)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.User == nil || resp.User.ID != tt.userID {
+				t.Fatalf("expected user %s, got %+v", tt.userID, resp.User)
+			}
+			if tt.expectEmail != (resp.User.Email != nil) {
+				t.Errorf("expected email visible=%v, got %v", tt.expectEmail, resp.User.Email)
+			}
+		})
+	}
+}
+
+func TestAuthDirective(t *testing.T) {
+	c := newTestClient(t)
+
+	var resp map[string]interface{}
+	err := c.Post(`{ me { id } }`, &resp)
+	if err == nil || !strings.Contains(err.Error(), "authentication required") {
+		t.Fatalf("expected anonymous me to be rejected, got %v", err)
+	}
+
+	var me struct{ Me struct{ Email string } }
+	if err := c.Post(`{ me { email } }`, &me, asUser("alice")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if me.Me.Email != "alice@example.com" {
+		t.Errorf("expected alice's email, got %q", me.Me.Email)
+	}
+}
+
+func TestScopeDirective(t *testing.T) {
+	c := newTestClient(t)
+
+	read := asToken("alice", services.ScopeReadCollection)
+	tests := []struct {
+		name      string
+		query     string
+		caller    client.Option
+		expectErr string
+	}{
+		{name: "scoped query", query: `{ me { email } }`, caller: read},
+		{name: "scoped owner query", query: `{ userMoviesPaginated(userId: "alice") { pageInfo { totalCount } } }`, caller: read},
+		{name: "missing scope", query: `{ me { email } }`, caller: asToken("alice", services.ScopeUploadImages), expectErr: "lacks the READ_COLLECTION scope"},
+		{name: "missing write scope", query: `mutation { deleteMovie(id: "m1") { success } }`, caller: read, expectErr: "lacks the WRITE_COLLECTION scope"},
+		{name: "session-only query", query: `{ sessions { id } }`, caller: read, expectErr: "personal access tokens cannot use this field"},
+		{name: "token management", query: `mutation { revokePersonalAccessToken(id: "t1") { success } }`, caller: read, expectErr: "personal access tokens cannot use this field"},
+		{name: "admin query", query: `{ users { pageInfo { totalCount } } }`, caller: func(bd *client.Request) {
+			asToken("alice", services.ScopeReadCollection)(bd)
+			bd.HTTP.Header.Set("X-Test-Role", string(services.RoleAdmin))
+		}, expectErr: "personal access tokens cannot use this field"},
+		{name: "unscoped owner query is signed out", query: `{ user(id: "alice") { id } }`, caller: read, expectErr: "authentication required"},
+		{name: "unscoped public profile", query: `{ user(id: "bob") { id } }`, caller: read},
+		{name: "session token needs no scope", query: `{ me { email } }`, caller: asUser("alice")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp map[string]interface{}
+			err := c.Post(tt.query, &resp, tt.caller)
+
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package graph
+
+import (
+	"time"
+
+	"mediacloset/api/internal/buildinfo"
+	"mediacloset/api/internal/graph/model"
+	"mediacloset/api/internal/health"
+)
+
+func toModelSystemStatus(report health.Report, build buildinfo.Info, uptime time.Duration) *model.SystemStatus {
+	status := &model.SystemStatus{
+		Status:     string(report.Status),
+		Version:    build.Version,
+		Commit:     build.Commit,
+		Uptime:     int(uptime.Seconds()),
+		Components: make([]*model.ComponentStatus, 0, len(report.Components)),
+	}
+	for _, c := range report.Components {
+		component := &model.ComponentStatus{
+			Name:      c.Name,
+			Status:    string(c.Status),
+			Critical:  c.Critical,
+			LatencyMs: int(c.LatencyMS),
+			CheckedAt: c.CheckedAt.UTC().Format(time.RFC3339),
+		}
+		if c.Message != "" {
+			component.Message = &c.Message
+		}
+		status.Components = append(status.Components, component)
+	}
+	return status
+}
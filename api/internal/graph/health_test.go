@@ -0,0 +1,57 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"mediacloset/api/internal/services"
+)
+
+func TestSystemStatus(t *testing.T) {
+	c := newTestClient(t)
+	query := `{ systemStatus { status commit components { name status critical message checkedAt } } }`
+
+	type response struct {
+		SystemStatus struct {
+			Status     string
+			Commit     string
+			Components []struct {
+				Name      string
+				Status    string
+				Critical  bool
+				Message   *string
+				CheckedAt string
+			}
+		}
+	}
+
+	var resp response
+	if err := c.Post(query, &resp); err == nil || !strings.Contains(err.Error(), "authentication required") {
+		t.Fatalf("expected anonymous systemStatus to be rejected, got %v", err)
+	}
+
+	if err := c.Post(query, &resp, asUser("alice")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	status := resp.SystemStatus
+	if status.Status != "degraded" || status.Commit == "" || len(status.Components) != 2 {
+		t.Fatalf("expected a degraded report with two components, got %+v", status)
+	}
+	if hasura := status.Components[0]; hasura.Name != "hasura" || hasura.Status != "ok" || !hasura.Critical {
+		t.Errorf("expected a healthy critical hasura component, got %+v", hasura)
+	}
+	if status.Components[0].CheckedAt == "" {
+		t.Error("expected checkedAt to be set")
+	}
+	if storage := status.Components[1]; storage.Status != "down" || storage.Message != nil {
+		t.Errorf("expected storage down without details for a user, got %+v", storage)
+	}
+
+	var admin response
+	if err := c.Post(query, &admin, asRole("carol", services.RoleAdmin)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg := admin.SystemStatus.Components[1].Message; msg == nil || *msg != "bucket covers not found" {
+		t.Errorf("expected admins to see the error, got %v", msg)
+	}
+}
@@ -0,0 +1,27 @@
+package graph
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+
+	"mediacloset/api/internal/logging"
+)
+
+// LogOperation adds the GraphQL operation to the request's log fields. Use
+// it with the server's AroundOperations. Unnamed operations are logged by
+// their first root field.
+func LogOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	if oc := graphql.GetOperationContext(ctx); oc != nil {
+		name := oc.OperationName
+		if name == "" && oc.Operation != nil && len(oc.Operation.SelectionSet) > 0 {
+			if field, ok := oc.Operation.SelectionSet[0].(*ast.Field); ok {
+				name = field.Name
+			}
+		}
+		logging.AddFields(ctx, slog.String("operation", name))
+	}
+	return next(ctx)
+}
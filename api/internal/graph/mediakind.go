@@ -0,0 +1,95 @@
+package graph
+
+import (
+	"fmt"
+
+	"mediacloset/api/internal/graph/model"
+	"mediacloset/api/internal/services"
+)
+
+var mediaKinds = map[model.MediaKind]services.MediaKind{
+	model.MediaKindMovie:    services.MediaKindMovie,
+	model.MediaKindAlbum:    services.MediaKindAlbum,
+	model.MediaKindCassette: services.MediaKindCassette,
+}
+
+// toServiceKind maps the GraphQL enum onto the catalog table it refers to
+func toServiceKind(kind model.MediaKind) (services.MediaKind, error) {
+	k, ok := mediaKinds[kind]
+	if !ok {
+		return "", fmt.Errorf("unsupported media kind: %s", kind)
+	}
+	return k, nil
+}
+
+func toModelKind(kind services.MediaKind) model.MediaKind {
+	for m, k := range mediaKinds {
+		if k == kind {
+			return m
+		}
+	}
+	return ""
+}
+
+// maxCoverMatches bounds the results of itemsByCover
+const maxCoverMatches = 25
+
+// clampCoverThreshold applies the default to a requested cover distance and caps
+// it, since a loose threshold makes every cover match every other
+func clampCoverThreshold(requested *int) (int, error) {
+	if requested == nil {
+		return services.DefaultCoverThreshold, nil
+	}
+	if *requested < 0 {
+		return 0, fmt.Errorf("threshold must not be negative")
+	}
+	if *requested > services.MaxCoverThreshold {
+		return services.MaxCoverThreshold, nil
+	}
+	return *requested, nil
+}
+
+// toMediaItemSummary converts a duplicate-detection item to its GraphQL type
+func toMediaItemSummary(item services.DuplicateItem) *model.MediaItemSummary {
+	summary := &model.MediaItemSummary{
+		ID:    item.ID,
+		Kind:  toModelKind(item.Kind),
+		Title: item.Title,
+	}
+	if item.Creator != "" {
+		summary.Creator = &item.Creator
+	}
+	if item.CoverURL != "" {
+		summary.CoverURL = &item.CoverURL
+	}
+	if item.CreatedAt != "" {
+		summary.CreatedAt = &item.CreatedAt
+	}
+	return summary
+}
+
+// withNormalizedKey refreshes normalized_key in updates when one of the fields
+// it is derived from changes, using existing values for the rest
+func withNormalizedKey(kind services.MediaKind, existing, updates map[string]interface{}) {
+	fields := []string{"artist", "album"}
+	if kind == services.MediaKindMovie {
+		fields = []string{"title"}
+	}
+
+	merged := make(map[string]interface{}, len(existing))
+	for k, v := range existing {
+		merged[k] = v
+	}
+
+	changed := false
+	for _, field := range fields {
+		if v, ok := updates[field]; ok {
+			merged[field] = v
+			changed = true
+		}
+	}
+
+	if changed {
+		updates["normalized_key"] = kind.NormalizedKey(merged)
+	}
+}
@@ -0,0 +1,33 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"mediacloset/api/internal/metrics"
+)
+
+func TestOperationMetrics(t *testing.T) {
+	c := newTestClient(t)
+
+	ok := testutil.ToFloat64(metrics.GraphQLOperations.WithLabelValues("me", "ok"))
+	failed := testutil.ToFloat64(metrics.GraphQLOperations.WithLabelValues("me", "error"))
+	resolverErrors := testutil.ToFloat64(metrics.ResolverErrors.WithLabelValues("Query.me"))
+
+	var resp map[string]interface{}
+	if err := c.Post(`query WhoAmI { me { id } }`, &resp, asUser("alice")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Post(`{ me { id } }`, &resp)
+
+	if got := testutil.ToFloat64(metrics.GraphQLOperations.WithLabelValues("me", "ok")) - ok; got != 1 {
+		t.Errorf("expected 1 successful me operation labeled by root field, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.GraphQLOperations.WithLabelValues("me", "error")) - failed; got != 1 {
+		t.Errorf("expected 1 failed me operation, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.ResolverErrors.WithLabelValues("Query.me")) - resolverErrors; got != 1 {
+		t.Errorf("expected 1 resolver error on Query.me, got %v", got)
+	}
+}
@@ -64,14 +64,107 @@ type CassetteConnection struct {
 	PageInfo *PageInfo   `json:"pageInfo"`
 }
 
+type CatalogAlbum struct {
+	ID            string   `json:"id"`
+	Artist        string   `json:"artist"`
+	Album         string   `json:"album"`
+	Year          *int     `json:"year,omitempty"`
+	Label         *string  `json:"label,omitempty"`
+	ColorVariants []string `json:"color_variants,omitempty"`
+	Genres        []string `json:"genres,omitempty"`
+	CoverURL      *string  `json:"coverUrl,omitempty"`
+	Size          *int     `json:"size,omitempty"`
+}
+
+type CatalogAlbumConnection struct {
+	Items    []*CatalogAlbum `json:"items"`
+	PageInfo *PageInfo       `json:"pageInfo"`
+}
+
+type CatalogCassette struct {
+	ID       string   `json:"id"`
+	Artist   string   `json:"artist"`
+	Album    string   `json:"album"`
+	Year     *int     `json:"year,omitempty"`
+	Label    *string  `json:"label,omitempty"`
+	Genres   []string `json:"genres,omitempty"`
+	CoverURL *string  `json:"coverUrl,omitempty"`
+	TapeType *string  `json:"tapeType,omitempty"`
+}
+
+type CatalogCassetteConnection struct {
+	Items    []*CatalogCassette `json:"items"`
+	PageInfo *PageInfo          `json:"pageInfo"`
+}
+
+type CatalogChangeResponse struct {
+	Success bool    `json:"success"`
+	ItemID  *string `json:"itemId,omitempty"`
+	AuditID *string `json:"auditId,omitempty"`
+	Error   *string `json:"error,omitempty"`
+}
+
+type CatalogFieldInput struct {
+	Column string `json:"column"`
+	Value  string `json:"value"`
+}
+
+type CatalogMovie struct {
+	ID       string  `json:"id"`
+	Title    string  `json:"title"`
+	Director *string `json:"director,omitempty"`
+	Year     *int    `json:"year,omitempty"`
+	Genre    *string `json:"genre,omitempty"`
+	CoverURL *string `json:"coverUrl,omitempty"`
+}
+
+type CatalogMovieConnection struct {
+	Items    []*CatalogMovie `json:"items"`
+	PageInfo *PageInfo       `json:"pageInfo"`
+}
+
+type ComponentStatus struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMs int     `json:"latencyMs"`
+	Message   *string `json:"message,omitempty"`
+	CheckedAt string  `json:"checkedAt"`
+}
+
+type CoverMatch struct {
+	Item     *MediaItemSummary `json:"item"`
+	Distance int               `json:"distance"`
+}
+
+type CreatePersonalAccessTokenInput struct {
+	Name      string       `json:"name"`
+	Scopes    []TokenScope `json:"scopes"`
+	ExpiresAt *string      `json:"expiresAt,omitempty"`
+}
+
+type CreatePersonalAccessTokenResponse struct {
+	Success             bool                 `json:"success"`
+	Token               *string              `json:"token,omitempty"`
+	PersonalAccessToken *PersonalAccessToken `json:"personalAccessToken,omitempty"`
+	Error               *string              `json:"error,omitempty"`
+}
+
 type DeleteResponse struct {
 	Success bool    `json:"success"`
 	Error   *string `json:"error,omitempty"`
 }
 
+type DuplicateCluster struct {
+	Kind                 MediaKind           `json:"kind"`
+	SuggestedCanonicalID string              `json:"suggestedCanonicalId"`
+	Items                []*MediaItemSummary `json:"items"`
+}
+
 type Health struct {
 	Status  string `json:"status"`
 	Version string `json:"version"`
+	Commit  string `json:"commit"`
 	Uptime  int    `json:"uptime"`
 }
 
@@ -80,6 +173,22 @@ type ImageUploadURL struct {
 	ImageURL  string `json:"imageUrl"`
 }
 
+type MediaItemSummary struct {
+	ID        string    `json:"id"`
+	Kind      MediaKind `json:"kind"`
+	Title     string    `json:"title"`
+	Creator   *string   `json:"creator,omitempty"`
+	CoverURL  *string   `json:"coverUrl,omitempty"`
+	CreatedAt *string   `json:"createdAt,omitempty"`
+}
+
+type MergeDuplicatesResponse struct {
+	Success     bool    `json:"success"`
+	CanonicalID *string `json:"canonicalId,omitempty"`
+	MergedCount int     `json:"mergedCount"`
+	Error       *string `json:"error,omitempty"`
+}
+
 type Movie struct {
 	ID        string  `json:"id"`
 	Title     string  `json:"title"`
@@ -119,13 +228,56 @@ type PaginationInput struct {
 	Offset int `json:"offset"`
 }
 
+type Passkey struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	CreatedAt  string  `json:"createdAt"`
+	LastUsedAt *string `json:"lastUsedAt,omitempty"`
+}
+
+type PasskeyOptions struct {
+	ChallengeID string `json:"challengeId"`
+	Options     string `json:"options"`
+}
+
+type PasskeyResponse struct {
+	Success bool     `json:"success"`
+	Passkey *Passkey `json:"passkey,omitempty"`
+	Error   *string  `json:"error,omitempty"`
+}
+
+type PersonalAccessToken struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Scopes     []TokenScope `json:"scopes"`
+	CreatedAt  string       `json:"createdAt"`
+	ExpiresAt  *string      `json:"expiresAt,omitempty"`
+	LastUsedAt *string      `json:"lastUsedAt,omitempty"`
+}
+
+type ProviderQuota struct {
+	Provider          string `json:"provider"`
+	RequestsPerMinute *int   `json:"requestsPerMinute,omitempty"`
+	DailyQuota        *int   `json:"dailyQuota,omitempty"`
+	UsedToday         int    `json:"usedToday"`
+	RemainingToday    *int   `json:"remainingToday,omitempty"`
+	ResetsAt          string `json:"resetsAt"`
+}
+
 type Query struct {
 }
 
 type RequestLoginCodeResponse struct {
-	Success bool    `json:"success"`
-	Message string  `json:"message"`
-	Error   *string `json:"error,omitempty"`
+	Success           bool    `json:"success"`
+	Message           string  `json:"message"`
+	Error             *string `json:"error,omitempty"`
+	RetryAfterSeconds *int    `json:"retryAfterSeconds,omitempty"`
+}
+
+type RevokeSessionsResponse struct {
+	Success      bool    `json:"success"`
+	RevokedCount int     `json:"revokedCount"`
+	Error        *string `json:"error,omitempty"`
 }
 
 type SaveAlbumInput struct {
@@ -210,11 +362,36 @@ type SavedMovie struct {
 	CoverURL *string `json:"coverUrl,omitempty"`
 }
 
+type Session struct {
+	ID         string  `json:"id"`
+	DeviceName *string `json:"deviceName,omitempty"`
+	UserAgent  *string `json:"userAgent,omitempty"`
+	IPAddress  *string `json:"ipAddress,omitempty"`
+	CreatedAt  string  `json:"createdAt"`
+	LastUsedAt string  `json:"lastUsedAt"`
+	ExpiresAt  string  `json:"expiresAt"`
+	Current    bool    `json:"current"`
+}
+
+type SetUserRoleResponse struct {
+	Success bool    `json:"success"`
+	User    *User   `json:"user,omitempty"`
+	Error   *string `json:"error,omitempty"`
+}
+
 type SortInput struct {
 	Field SortField `json:"field"`
 	Order SortOrder `json:"order"`
 }
 
+type SystemStatus struct {
+	Status     string             `json:"status"`
+	Version    string             `json:"version"`
+	Commit     string             `json:"commit"`
+	Uptime     int                `json:"uptime"`
+	Components []*ComponentStatus `json:"components"`
+}
+
 type TrackData struct {
 	Title           string `json:"title"`
 	TrackNumber     *int   `json:"trackNumber,omitempty"`
@@ -238,6 +415,19 @@ type UpdateAlbumResponse struct {
 	Error   *string `json:"error,omitempty"`
 }
 
+type UpdateAppVersionConfigInput struct {
+	MinimumIOSVersion *string `json:"minimumIOSVersion,omitempty"`
+	UpdateMessage     *string `json:"updateMessage,omitempty"`
+	ForceUpdate       *bool   `json:"forceUpdate,omitempty"`
+	StoreURL          *string `json:"storeURL,omitempty"`
+}
+
+type UpdateAppVersionConfigResponse struct {
+	Success bool              `json:"success"`
+	Config  *AppVersionConfig `json:"config,omitempty"`
+	Error   *string           `json:"error,omitempty"`
+}
+
 type UpdateCassetteInput struct {
 	Artist   *string  `json:"artist,omitempty"`
 	Album    *string  `json:"album,omitempty"`
@@ -268,9 +458,21 @@ type UpdateMovieResponse struct {
 	Error   *string `json:"error,omitempty"`
 }
 
+type UpdateProfileInput struct {
+	IsPublic *bool `json:"isPublic,omitempty"`
+}
+
+type UpdateProfileResponse struct {
+	Success bool    `json:"success"`
+	User    *User   `json:"user,omitempty"`
+	Error   *string `json:"error,omitempty"`
+}
+
 type User struct {
 	ID        string      `json:"id"`
-	Email     string      `json:"email"`
+	Email     *string     `json:"email,omitempty"`
+	IsPublic  bool        `json:"isPublic"`
+	Role      *Role       `json:"role,omitempty"`
 	CreatedAt string      `json:"createdAt"`
 	UpdatedAt string      `json:"updatedAt"`
 	Movies    []*Movie    `json:"movies"`
@@ -278,11 +480,133 @@ type User struct {
 	Cassettes []*Cassette `json:"cassettes"`
 }
 
+type UserConnection struct {
+	Items    []*User   `json:"items"`
+	PageInfo *PageInfo `json:"pageInfo"`
+}
+
 type VerifyLoginCodeResponse struct {
-	Success bool    `json:"success"`
-	Token   *string `json:"token,omitempty"`
-	User    *User   `json:"user,omitempty"`
-	Error   *string `json:"error,omitempty"`
+	Success           bool    `json:"success"`
+	Token             *string `json:"token,omitempty"`
+	ExpiresAt         *string `json:"expiresAt,omitempty"`
+	RefreshToken      *string `json:"refreshToken,omitempty"`
+	User              *User   `json:"user,omitempty"`
+	Error             *string `json:"error,omitempty"`
+	RetryAfterSeconds *int    `json:"retryAfterSeconds,omitempty"`
+}
+
+type MediaKind string
+
+const (
+	MediaKindMovie    MediaKind = "MOVIE"
+	MediaKindAlbum    MediaKind = "ALBUM"
+	MediaKindCassette MediaKind = "CASSETTE"
+)
+
+var AllMediaKind = []MediaKind{
+	MediaKindMovie,
+	MediaKindAlbum,
+	MediaKindCassette,
+}
+
+func (e MediaKind) IsValid() bool {
+	switch e {
+	case MediaKindMovie, MediaKindAlbum, MediaKindCassette:
+		return true
+	}
+	return false
+}
+
+func (e MediaKind) String() string {
+	return string(e)
+}
+
+func (e *MediaKind) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MediaKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MediaKind", str)
+	}
+	return nil
+}
+
+func (e MediaKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *MediaKind) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e MediaKind) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type Role string
+
+const (
+	RoleReadOnly Role = "READ_ONLY"
+	RoleUser     Role = "USER"
+	RoleAdmin    Role = "ADMIN"
+)
+
+var AllRole = []Role{
+	RoleReadOnly,
+	RoleUser,
+	RoleAdmin,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleReadOnly, RoleUser, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *Role) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e Role) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
 }
 
 type SortField string
@@ -398,3 +722,60 @@ func (e SortOrder) MarshalJSON() ([]byte, error) {
 	e.MarshalGQL(&buf)
 	return buf.Bytes(), nil
 }
+
+type TokenScope string
+
+const (
+	TokenScopeReadCollection  TokenScope = "READ_COLLECTION"
+	TokenScopeWriteCollection TokenScope = "WRITE_COLLECTION"
+	TokenScopeUploadImages    TokenScope = "UPLOAD_IMAGES"
+)
+
+var AllTokenScope = []TokenScope{
+	TokenScopeReadCollection,
+	TokenScopeWriteCollection,
+	TokenScopeUploadImages,
+}
+
+func (e TokenScope) IsValid() bool {
+	switch e {
+	case TokenScopeReadCollection, TokenScopeWriteCollection, TokenScopeUploadImages:
+		return true
+	}
+	return false
+}
+
+func (e TokenScope) String() string {
+	return string(e)
+}
+
+func (e *TokenScope) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TokenScope(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TokenScope", str)
+	}
+	return nil
+}
+
+func (e TokenScope) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *TokenScope) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e TokenScope) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,31 @@
+package graph
+
+import (
+	"time"
+
+	"mediacloset/api/internal/graph/model"
+	"mediacloset/api/internal/services"
+)
+
+// passkeysDisabled is returned when the server has no valid WebAuthn config
+const passkeysDisabled = "Passkeys are not configured"
+
+func toModelPasskeyOptions(c *services.PasskeyChallenge) *model.PasskeyOptions {
+	return &model.PasskeyOptions{
+		ChallengeID: c.ChallengeID,
+		Options:     c.Options,
+	}
+}
+
+func toModelPasskey(p *services.Passkey) *model.Passkey {
+	passkey := &model.Passkey{
+		ID:        p.ID,
+		Name:      p.Name,
+		CreatedAt: p.CreatedAt.Format(time.RFC3339),
+	}
+	if p.LastUsedAt != nil {
+		lastUsedAt := p.LastUsedAt.Format(time.RFC3339)
+		passkey.LastUsedAt = &lastUsedAt
+	}
+	return passkey
+}
@@ -2,6 +2,7 @@ package graph
 
 import (
 	"mediacloset/api/internal/config"
+	"mediacloset/api/internal/health"
 	"mediacloset/api/internal/ratelimit"
 	"mediacloset/api/internal/services"
 	"time"
@@ -21,7 +22,13 @@ type Resolver struct {
 	BarcodeService  *services.BarcodeService
 	HasuraClient    *services.HasuraClient
 	AuthService     *services.AuthService
-	S3Service       *services.S3Service
+	PasskeyService  *services.PasskeyService
+	AccountService  *services.AccountService
+	Storage         services.ObjectStorage
+	Duplicates      *services.DuplicateService
+	CatalogAdmin    *services.CatalogAdminService
+	AppConfig       *services.AppConfigService
 	RateLimiter     *ratelimit.ServiceLimiter
+	HealthChecker   *health.Checker
 	ServerStartTime time.Time
 }
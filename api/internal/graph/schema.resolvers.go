@@ -7,9 +7,15 @@ package graph
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"mediacloset/api/internal/buildinfo"
 	"mediacloset/api/internal/graph/model"
 	custommw "mediacloset/api/internal/middleware"
+	"mediacloset/api/internal/services"
+	"strings"
 	"time"
 )
 
@@ -23,11 +29,12 @@ func (r *mutationResolver) RequestLoginCode(ctx context.Context, email string) (
 		}, nil
 	}
 
-	err := r.AuthService.RequestLoginCode(ctx, email)
+	err := r.AuthService.RequestLoginCode(ctx, email, custommw.GetClientInfo(ctx).IPAddress)
 	if err != nil {
 		return &model.RequestLoginCodeResponse{
-			Success: false,
-			Error:   &[]string{fmt.Sprintf("Failed to request login code: %v", err)}[0],
+			Success:           false,
+			Error:             &[]string{fmt.Sprintf("Failed to request login code: %v", err)}[0],
+			RetryAfterSeconds: retryAfterSeconds(err),
 		}, nil
 	}
 
@@ -53,26 +60,423 @@ func (r *mutationResolver) VerifyLoginCode(ctx context.Context, email string, co
 		}, nil
 	}
 
-	token, user, err := r.AuthService.VerifyLoginCode(ctx, email, code)
+	pair, user, err := r.AuthService.VerifyLoginCode(ctx, email, code, sessionClient(ctx))
 	if err != nil {
 		return &model.VerifyLoginCodeResponse{
+			Success:           false,
+			Error:             &[]string{err.Error()}[0],
+			RetryAfterSeconds: retryAfterSeconds(err),
+		}, nil
+	}
+
+	return toTokenResponse(pair, user), nil
+}
+
+// RequestMagicLink is the resolver for the requestMagicLink field.
+func (r *mutationResolver) RequestMagicLink(ctx context.Context, email string) (*model.RequestLoginCodeResponse, error) {
+	if email == "" {
+		return &model.RequestLoginCodeResponse{
+			Success: false,
+			Error:   &[]string{"Email is required"}[0],
+		}, nil
+	}
+
+	err := r.AuthService.RequestMagicLink(ctx, email, custommw.GetClientInfo(ctx).IPAddress)
+	if err != nil {
+		return &model.RequestLoginCodeResponse{
+			Success:           false,
+			Error:             &[]string{fmt.Sprintf("Failed to request login link: %v", err)}[0],
+			RetryAfterSeconds: retryAfterSeconds(err),
+		}, nil
+	}
+
+	return &model.RequestLoginCodeResponse{
+		Success: true,
+		Message: "Login link sent to your email",
+	}, nil
+}
+
+// VerifyMagicLink is the resolver for the verifyMagicLink field.
+func (r *mutationResolver) VerifyMagicLink(ctx context.Context, token string) (*model.VerifyLoginCodeResponse, error) {
+	if token == "" {
+		return &model.VerifyLoginCodeResponse{
+			Success: false,
+			Error:   &[]string{"Token is required"}[0],
+		}, nil
+	}
+
+	pair, user, err := r.AuthService.VerifyMagicLink(ctx, token, sessionClient(ctx))
+	if err != nil {
+		return &model.VerifyLoginCodeResponse{
+			Success: false,
+			Error:   &[]string{err.Error()}[0],
+		}, nil
+	}
+
+	return toTokenResponse(pair, user), nil
+}
+
+// RefreshToken is the resolver for the refreshToken field.
+func (r *mutationResolver) RefreshToken(ctx context.Context, refreshToken string) (*model.VerifyLoginCodeResponse, error) {
+	if refreshToken == "" {
+		return &model.VerifyLoginCodeResponse{
+			Success: false,
+			Error:   &[]string{"Refresh token is required"}[0],
+		}, nil
+	}
+
+	pair, user, err := r.AuthService.RefreshSession(ctx, refreshToken, sessionClient(ctx))
+	if err != nil {
+		return &model.VerifyLoginCodeResponse{
+			Success: false,
+			Error:   &[]string{err.Error()}[0],
+		}, nil
+	}
+
+	return toTokenResponse(pair, user), nil
+}
+
+// BeginPasskeyRegistration is the resolver for the beginPasskeyRegistration field.
+func (r *mutationResolver) BeginPasskeyRegistration(ctx context.Context) (*model.PasskeyOptions, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("authentication required")
+	}
+	if r.PasskeyService == nil {
+		return nil, fmt.Errorf("%s", passkeysDisabled)
+	}
+
+	challenge, err := r.PasskeyService.BeginRegistration(ctx, userInfo.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start passkey registration: %w", err)
+	}
+	return toModelPasskeyOptions(challenge), nil
+}
+
+// FinishPasskeyRegistration is the resolver for the finishPasskeyRegistration field.
+func (r *mutationResolver) FinishPasskeyRegistration(ctx context.Context, challengeID string, credential string, name *string) (*model.PasskeyResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.PasskeyResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+	if r.PasskeyService == nil {
+		return &model.PasskeyResponse{
+			Success: false,
+			Error:   &[]string{passkeysDisabled}[0],
+		}, nil
+	}
+
+	passkeyName := ""
+	if name != nil {
+		passkeyName = *name
+	}
+
+	passkey, err := r.PasskeyService.FinishRegistration(ctx, userInfo.UserID, challengeID, credential, passkeyName)
+	if err != nil {
+		return &model.PasskeyResponse{
 			Success: false,
 			Error:   &[]string{err.Error()}[0],
 		}, nil
 	}
 
-	return &model.VerifyLoginCodeResponse{
+	return &model.PasskeyResponse{
 		Success: true,
-		Token:   &token,
-		User: &model.User{
-			ID:        user.ID,
-			Email:     user.Email,
-			CreatedAt: user.CreatedAt.Format(time.RFC3339),
-			UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
-		},
+		Passkey: toModelPasskey(passkey),
+	}, nil
+}
+
+// BeginPasskeyLogin is the resolver for the beginPasskeyLogin field.
+func (r *mutationResolver) BeginPasskeyLogin(ctx context.Context) (*model.PasskeyOptions, error) {
+	if r.PasskeyService == nil {
+		return nil, fmt.Errorf("%s", passkeysDisabled)
+	}
+
+	challenge, err := r.PasskeyService.BeginLogin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start passkey sign-in: %w", err)
+	}
+	return toModelPasskeyOptions(challenge), nil
+}
+
+// FinishPasskeyLogin is the resolver for the finishPasskeyLogin field.
+func (r *mutationResolver) FinishPasskeyLogin(ctx context.Context, challengeID string, credential string) (*model.VerifyLoginCodeResponse, error) {
+	if r.PasskeyService == nil {
+		return &model.VerifyLoginCodeResponse{
+			Success: false,
+			Error:   &[]string{passkeysDisabled}[0],
+		}, nil
+	}
+
+	pair, user, err := r.PasskeyService.FinishLogin(ctx, challengeID, credential, sessionClient(ctx))
+	if err != nil {
+		return &model.VerifyLoginCodeResponse{
+			Success: false,
+			Error:   &[]string{err.Error()}[0],
+		}, nil
+	}
+
+	return toTokenResponse(pair, user), nil
+}
+
+// DeletePasskey is the resolver for the deletePasskey field.
+func (r *mutationResolver) DeletePasskey(ctx context.Context, id string) (*model.DeleteResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+	if r.PasskeyService == nil {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{passkeysDisabled}[0],
+		}, nil
+	}
+
+	if err := r.PasskeyService.DeletePasskey(ctx, userInfo.UserID, id); err != nil {
+		if errors.Is(err, services.ErrPasskeyNotFound) {
+			return &model.DeleteResponse{
+				Success: false,
+				Error:   &[]string{"Passkey not found"}[0],
+			}, nil
+		}
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to delete passkey: %v", err)}[0],
+		}, nil
+	}
+
+	return &model.DeleteResponse{Success: true}, nil
+}
+
+// Logout is the resolver for the logout field.
+func (r *mutationResolver) Logout(ctx context.Context) (*model.DeleteResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+	if userInfo.SessionID == "" {
+		// Tokens from before sessions existed cannot be revoked; they expire on their own
+		return &model.DeleteResponse{Success: true}, nil
+	}
+
+	if _, err := r.AuthService.RevokeSession(ctx, userInfo.UserID, userInfo.SessionID, services.RevokedLogout); err != nil {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to log out: %v", err)}[0],
+		}, nil
+	}
+
+	return &model.DeleteResponse{Success: true}, nil
+}
+
+// RevokeSession is the resolver for the revokeSession field.
+func (r *mutationResolver) RevokeSession(ctx context.Context, id string) (*model.DeleteResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+
+	revoked, err := r.AuthService.RevokeSession(ctx, userInfo.UserID, id, services.RevokedByUser)
+	if err != nil {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to revoke session: %v", err)}[0],
+		}, nil
+	}
+	if !revoked {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{"Session not found"}[0],
+		}, nil
+	}
+
+	return &model.DeleteResponse{Success: true}, nil
+}
+
+// RevokeAllSessions is the resolver for the revokeAllSessions field.
+func (r *mutationResolver) RevokeAllSessions(ctx context.Context, keepCurrent *bool) (*model.RevokeSessionsResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.RevokeSessionsResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+
+	keep := ""
+	if keepCurrent == nil || *keepCurrent {
+		keep = userInfo.SessionID
+	}
+
+	count, err := r.AuthService.RevokeAllSessions(ctx, userInfo.UserID, keep, services.RevokedAllByUser)
+	if err != nil {
+		return &model.RevokeSessionsResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to revoke sessions: %v", err)}[0],
+		}, nil
+	}
+
+	return &model.RevokeSessionsResponse{
+		Success:      true,
+		RevokedCount: count,
+	}, nil
+}
+
+// CreatePersonalAccessToken is the resolver for the createPersonalAccessToken field.
+func (r *mutationResolver) CreatePersonalAccessToken(ctx context.Context, input model.CreatePersonalAccessTokenInput) (*model.CreatePersonalAccessTokenResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.CreatePersonalAccessTokenResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresAt != nil {
+		t, err := time.Parse(time.RFC3339, *input.ExpiresAt)
+		if err != nil {
+			return &model.CreatePersonalAccessTokenResponse{
+				Success: false,
+				Error:   &[]string{"expiresAt must be an ISO 8601 timestamp"}[0],
+			}, nil
+		}
+		expiresAt = &t
+	}
+
+	tokenScopes := make([]services.Scope, len(input.Scopes))
+	for i, scope := range input.Scopes {
+		tokenScopes[i] = toServiceScope(scope)
+	}
+
+	token, secret, err := r.AuthService.CreatePersonalAccessToken(ctx, userInfo.UserID, input.Name, tokenScopes, expiresAt)
+	if err != nil {
+		return &model.CreatePersonalAccessTokenResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to create access token: %v", err)}[0],
+		}, nil
+	}
+
+	return &model.CreatePersonalAccessTokenResponse{
+		Success:             true,
+		Token:               &secret,
+		PersonalAccessToken: toModelPersonalAccessToken(token),
+	}, nil
+}
+
+// RevokePersonalAccessToken is the resolver for the revokePersonalAccessToken field.
+func (r *mutationResolver) RevokePersonalAccessToken(ctx context.Context, id string) (*model.DeleteResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+
+	revoked, err := r.AuthService.RevokePersonalAccessToken(ctx, userInfo.UserID, id)
+	if err != nil {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to revoke access token: %v", err)}[0],
+		}, nil
+	}
+	if !revoked {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{"Access token not found"}[0],
+		}, nil
+	}
+
+	return &model.DeleteResponse{Success: true}, nil
+}
+
+// RequestEmailChange is the resolver for the requestEmailChange field.
+func (r *mutationResolver) RequestEmailChange(ctx context.Context, newEmail string) (*model.RequestLoginCodeResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.RequestLoginCodeResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+	if newEmail == "" {
+		return &model.RequestLoginCodeResponse{
+			Success: false,
+			Error:   &[]string{"Email is required"}[0],
+		}, nil
+	}
+
+	err := r.AccountService.RequestEmailChange(ctx, userInfo.UserID, newEmail, custommw.GetClientInfo(ctx).IPAddress)
+	if err != nil {
+		return &model.RequestLoginCodeResponse{
+			Success:           false,
+			Error:             &[]string{accountErrorMessage("Failed to request email change", err)}[0],
+			RetryAfterSeconds: retryAfterSeconds(err),
+		}, nil
+	}
+
+	return &model.RequestLoginCodeResponse{
+		Success: true,
+		Message: "Codes sent to your current and new email",
+	}, nil
+}
+
+// ConfirmEmailChange is the resolver for the confirmEmailChange field.
+func (r *mutationResolver) ConfirmEmailChange(ctx context.Context, currentCode string, newCode string) (*model.UpdateProfileResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.UpdateProfileResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+
+	user, err := r.AccountService.ConfirmEmailChange(ctx, userInfo.UserID, userInfo.SessionID, currentCode, newCode)
+	if err != nil {
+		return &model.UpdateProfileResponse{
+			Success: false,
+			Error:   &[]string{accountErrorMessage("Failed to change email", err)}[0],
+		}, nil
+	}
+
+	return &model.UpdateProfileResponse{
+		Success: true,
+		User:    toModelUser(user),
 	}, nil
 }
 
+// DeleteAccount is the resolver for the deleteAccount field.
+func (r *mutationResolver) DeleteAccount(ctx context.Context, confirmEmail string) (*model.DeleteResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+
+	if _, err := r.AccountService.DeleteAccount(ctx, userInfo.UserID, confirmEmail); err != nil {
+		return &model.DeleteResponse{
+			Success: false,
+			Error:   &[]string{accountErrorMessage("Failed to delete account", err)}[0],
+		}, nil
+	}
+
+	return &model.DeleteResponse{Success: true}, nil
+}
+
 // SaveMovie is the resolver for the saveMovie field.
 func (r *mutationResolver) SaveMovie(ctx context.Context, input model.SaveMovieInput) (*model.SaveMovieResponse, error) {
 	// Check authentication
@@ -112,12 +516,12 @@ func (r *mutationResolver) SaveMovie(ctx context.Context, input model.SaveMovieI
 		movieData, err := r.OMDBService.SearchMovie(ctx, input.Title, input.Director, input.Year)
 		if err != nil {
 			// Log the error but don't fail the save
-			fmt.Printf("[SaveMovie] Failed to fetch poster for '%s': %v\n", input.Title, err)
+			slog.WarnContext(ctx, "Failed to fetch poster", "provider", "omdb", "title", input.Title, "error", err)
 		} else if movieData != nil && movieData.PosterURL != nil {
 			coverURL = *movieData.PosterURL
-			fmt.Printf("[SaveMovie] Auto-fetched poster for '%s' from %s\n", input.Title, movieData.Source)
+			slog.InfoContext(ctx, "Auto-fetched poster", "provider", movieData.Source, "title", input.Title)
 		} else {
-			fmt.Printf("[SaveMovie] No poster found for '%s'\n", input.Title)
+			slog.InfoContext(ctx, "No poster found", "provider", "omdb", "title", input.Title)
 		}
 	}
 
@@ -164,6 +568,7 @@ func (r *mutationResolver) SaveMovie(ctx context.Context, input model.SaveMovieI
 			}, nil
 		}
 		vhsID = createdID
+		r.Duplicates.QueueCoverHash(services.MediaKindMovie, createdID, coverURL)
 	}
 
 	// Link movie to user via junction table (many-to-many)
@@ -249,6 +654,7 @@ func (r *mutationResolver) UpdateMovie(ctx context.Context, id string, input mod
 	if input.CoverURL != nil {
 		updates["cover_url"] = *input.CoverURL
 	}
+	withNormalizedKey(services.MediaKindMovie, movie, updates)
 
 	// Update in Hasura
 	movieData, err := r.HasuraClient.UpdateMovie(ctx, id, updates)
@@ -258,6 +664,9 @@ func (r *mutationResolver) UpdateMovie(ctx context.Context, id string, input mod
 			Error:   &[]string{fmt.Sprintf("Failed to update movie: %v", err)}[0],
 		}, nil
 	}
+	if input.CoverURL != nil {
+		r.Duplicates.QueueCoverHash(services.MediaKindMovie, id, *input.CoverURL)
+	}
 
 	// Convert to model.Movie
 	movieModel := &model.Movie{}
@@ -378,12 +787,12 @@ func (r *mutationResolver) SaveAlbum(ctx context.Context, input model.SaveAlbumI
 		albumData, err := r.MusicBrainz.SearchAlbum(ctx, input.Artist, input.Album)
 		if err != nil {
 			// Log the error but don't fail the save
-			fmt.Printf("[SaveAlbum] Failed to fetch cover for '%s - %s': %v\n", input.Artist, input.Album, err)
+			slog.WarnContext(ctx, "Failed to fetch cover", "provider", "musicbrainz", "artist", input.Artist, "album", input.Album, "error", err)
 		} else if albumData != nil && albumData.CoverURL != nil {
 			coverURL = *albumData.CoverURL
-			fmt.Printf("[SaveAlbum] Auto-fetched cover for '%s - %s' from %s\n", input.Artist, input.Album, albumData.Source)
+			slog.InfoContext(ctx, "Auto-fetched cover", "provider", albumData.Source, "artist", input.Artist, "album", input.Album)
 		} else {
-			fmt.Printf("[SaveAlbum] No cover found for '%s - %s'\n", input.Artist, input.Album)
+			slog.InfoContext(ctx, "No cover found", "provider", "musicbrainz", "artist", input.Artist, "album", input.Album)
 		}
 	}
 
@@ -430,9 +839,12 @@ func (r *mutationResolver) SaveAlbum(ctx context.Context, input model.SaveAlbumI
 		if len(updates) > 0 {
 			_, err := r.HasuraClient.UpdateAlbum(ctx, recordID, updates)
 			if err != nil {
-				fmt.Printf("[SaveAlbum] Failed to update existing album '%s - %s': %v\n", input.Artist, input.Album, err)
+				slog.ErrorContext(ctx, "Failed to update existing album", "artist", input.Artist, "album", input.Album, "error", err)
 			} else {
-				fmt.Printf("[SaveAlbum] Updated existing album '%s - %s'\n", input.Artist, input.Album)
+				slog.InfoContext(ctx, "Updated existing album", "artist", input.Artist, "album", input.Album)
+				if updates["cover_url"] != nil {
+					r.Duplicates.QueueCoverHash(services.MediaKindAlbum, recordID, coverURL)
+				}
 			}
 		}
 	} else {
@@ -470,6 +882,7 @@ func (r *mutationResolver) SaveAlbum(ctx context.Context, input model.SaveAlbumI
 			}, nil
 		}
 		recordID = createdID
+		r.Duplicates.QueueCoverHash(services.MediaKindAlbum, createdID, coverURL)
 	}
 
 	// Link record to user via junction table (many-to-many)
@@ -567,6 +980,7 @@ func (r *mutationResolver) UpdateAlbum(ctx context.Context, id string, input mod
 	if input.Size != nil {
 		updates["size"] = *input.Size
 	}
+	withNormalizedKey(services.MediaKindAlbum, album, updates)
 
 	// Update in Hasura
 	albumData, err := r.HasuraClient.UpdateAlbum(ctx, id, updates)
@@ -576,6 +990,9 @@ func (r *mutationResolver) UpdateAlbum(ctx context.Context, id string, input mod
 			Error:   &[]string{fmt.Sprintf("Failed to update album: %v", err)}[0],
 		}, nil
 	}
+	if input.CoverURL != nil {
+		r.Duplicates.QueueCoverHash(services.MediaKindAlbum, id, *input.CoverURL)
+	}
 
 	// Convert to model.Album
 	albumModel := &model.Album{}
@@ -716,12 +1133,12 @@ func (r *mutationResolver) SaveCassette(ctx context.Context, input model.SaveCas
 	} else {
 		albumData, err := r.MusicBrainz.SearchAlbum(ctx, input.Artist, input.Album)
 		if err != nil {
-			fmt.Printf("[SaveCassette] Failed to fetch cover for '%s - %s': %v\n", input.Artist, input.Album, err)
+			slog.WarnContext(ctx, "Failed to fetch cover", "provider", "musicbrainz", "artist", input.Artist, "album", input.Album, "error", err)
 		} else if albumData != nil && albumData.CoverURL != nil {
 			coverURL = *albumData.CoverURL
-			fmt.Printf("[SaveCassette] Auto-fetched cover for '%s - %s' from %s\n", input.Artist, input.Album, albumData.Source)
+			slog.InfoContext(ctx, "Auto-fetched cover", "provider", albumData.Source, "artist", input.Artist, "album", input.Album)
 		} else {
-			fmt.Printf("[SaveCassette] No cover found for '%s - %s'\n", input.Artist, input.Album)
+			slog.InfoContext(ctx, "No cover found", "provider", "musicbrainz", "artist", input.Artist, "album", input.Album)
 		}
 	}
 
@@ -754,7 +1171,9 @@ func (r *mutationResolver) SaveCassette(ctx context.Context, input model.SaveCas
 		if len(updates) > 0 {
 			_, err := r.HasuraClient.UpdateCassette(ctx, cassetteID, updates)
 			if err != nil {
-				fmt.Printf("[SaveCassette] Failed to update existing cassette '%s - %s': %v\n", input.Artist, input.Album, err)
+				slog.ErrorContext(ctx, "Failed to update existing cassette", "artist", input.Artist, "album", input.Album, "error", err)
+			} else if updates["cover_url"] != nil {
+				r.Duplicates.QueueCoverHash(services.MediaKindCassette, cassetteID, coverURL)
 			}
 		}
 	} else {
@@ -787,6 +1206,7 @@ func (r *mutationResolver) SaveCassette(ctx context.Context, input model.SaveCas
 			}, nil
 		}
 		cassetteID = createdID
+		r.Duplicates.QueueCoverHash(services.MediaKindCassette, createdID, coverURL)
 	}
 
 	err = r.HasuraClient.LinkCassetteToUser(ctx, userInfo.UserID, cassetteID)
@@ -873,6 +1293,7 @@ func (r *mutationResolver) UpdateCassette(ctx context.Context, id string, input
 	if input.TapeType != nil {
 		updates["tape_type"] = *input.TapeType
 	}
+	withNormalizedKey(services.MediaKindCassette, cassette, updates)
 
 	cassetteData, err := r.HasuraClient.UpdateCassette(ctx, id, updates)
 	if err != nil {
@@ -881,6 +1302,9 @@ func (r *mutationResolver) UpdateCassette(ctx context.Context, id string, input
 			Error:   &[]string{fmt.Sprintf("Failed to update cassette: %v", err)}[0],
 		}, nil
 	}
+	if input.CoverURL != nil {
+		r.Duplicates.QueueCoverHash(services.MediaKindCassette, id, *input.CoverURL)
+	}
 
 	cassetteModel := &model.Cassette{}
 	if cassetteID, ok := cassetteData["id"].(string); ok {
@@ -974,28 +1398,222 @@ func (r *mutationResolver) RequestImageUploadURL(ctx context.Context, contentTyp
 		return nil, fmt.Errorf("authentication required")
 	}
 
-	// Validate content type
-	validTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/png":  true,
-		"image/webp": true,
-	}
-	if !validTypes[contentType] {
-		return nil, fmt.Errorf("unsupported content type: %s (must be image/jpeg, image/png, or image/webp)", contentType)
+	// Validate content type
+	validTypes := map[string]bool{
+		"image/jpeg": true,
+		"image/png":  true,
+		"image/webp": true,
+	}
+	if !validTypes[contentType] {
+		return nil, fmt.Errorf("unsupported content type: %s (must be image/jpeg, image/png, or image/webp)", contentType)
+	}
+
+	if r.Storage == nil {
+		return nil, fmt.Errorf("image upload is not configured")
+	}
+
+	uploadURL, imageURL, err := r.Storage.GenerateUploadURL(ctx, userInfo.UserID, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate upload URL: %w", err)
+	}
+
+	return &model.ImageUploadURL{
+		UploadURL: uploadURL,
+		ImageURL:  imageURL,
+	}, nil
+}
+
+// UpdateProfile is the resolver for the updateProfile field.
+func (r *mutationResolver) UpdateProfile(ctx context.Context, input model.UpdateProfileInput) (*model.UpdateProfileResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.UpdateProfileResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+
+	user, err := r.AuthService.UpdateProfile(ctx, userInfo.UserID, input.IsPublic)
+	if err != nil {
+		return &model.UpdateProfileResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to update profile: %v", err)}[0],
+		}, nil
+	}
+
+	return &model.UpdateProfileResponse{
+		Success: true,
+		User:    toModelUser(user),
+	}, nil
+}
+
+// MergeDuplicates is the resolver for the mergeDuplicates field.
+func (r *mutationResolver) MergeDuplicates(ctx context.Context, kind model.MediaKind, canonicalID string, duplicateIds []string) (*model.MergeDuplicatesResponse, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return &model.MergeDuplicatesResponse{
+			Success: false,
+			Error:   &[]string{"Authentication required"}[0],
+		}, nil
+	}
+
+	serviceKind, err := toServiceKind(kind)
+	if err != nil {
+		return &model.MergeDuplicatesResponse{
+			Success: false,
+			Error:   &[]string{err.Error()}[0],
+		}, nil
+	}
+
+	merged, err := r.Duplicates.MergeDuplicates(ctx, userInfo.UserID, serviceKind, canonicalID, duplicateIds)
+	if err != nil {
+		return &model.MergeDuplicatesResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to merge duplicates: %v", err)}[0],
+		}, nil
+	}
+
+	return &model.MergeDuplicatesResponse{
+		Success:     true,
+		CanonicalID: &canonicalID,
+		MergedCount: merged,
+	}, nil
+}
+
+// MergeCatalogItems is the resolver for the mergeCatalogItems field.
+func (r *mutationResolver) MergeCatalogItems(ctx context.Context, kind model.MediaKind, targetID string, sourceID string, reason string) (*model.CatalogChangeResponse, error) {
+	serviceKind, err := toServiceKind(kind)
+	if err != nil {
+		return &model.CatalogChangeResponse{
+			Success: false,
+			Error:   &[]string{err.Error()}[0],
+		}, nil
+	}
+	if strings.TrimSpace(reason) == "" {
+		return &model.CatalogChangeResponse{
+			Success: false,
+			Error:   &[]string{"A reason is required"}[0],
+		}, nil
+	}
+
+	plan, err := r.CatalogAdmin.PlanMerge(ctx, serviceKind, targetID, sourceID)
+	if err != nil {
+		return &model.CatalogChangeResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to plan merge: %v", err)}[0],
+		}, nil
+	}
+
+	auditID, err := r.CatalogAdmin.ApplyMerge(ctx, plan, auditActor(ctx), reason)
+	if err != nil {
+		return &model.CatalogChangeResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to merge: %v", err)}[0],
+		}, nil
+	}
+
+	return &model.CatalogChangeResponse{
+		Success: true,
+		ItemID:  &targetID,
+		AuditID: &auditID,
+	}, nil
+}
+
+// SplitCatalogItem is the resolver for the splitCatalogItem field.
+func (r *mutationResolver) SplitCatalogItem(ctx context.Context, kind model.MediaKind, sourceID string, userIds []string, fields []*model.CatalogFieldInput, reason string) (*model.CatalogChangeResponse, error) {
+	serviceKind, err := toServiceKind(kind)
+	if err != nil {
+		return &model.CatalogChangeResponse{
+			Success: false,
+			Error:   &[]string{err.Error()}[0],
+		}, nil
+	}
+	if strings.TrimSpace(reason) == "" {
+		return &model.CatalogChangeResponse{
+			Success: false,
+			Error:   &[]string{"A reason is required"}[0],
+		}, nil
+	}
+
+	overrides := map[string]interface{}{}
+	for _, field := range fields {
+		value, err := serviceKind.ParseColumnValue(field.Column, field.Value)
+		if err != nil {
+			return &model.CatalogChangeResponse{
+				Success: false,
+				Error:   &[]string{err.Error()}[0],
+			}, nil
+		}
+		overrides[field.Column] = value
+	}
+
+	plan, err := r.CatalogAdmin.PlanSplit(ctx, serviceKind, sourceID, userIds, overrides)
+	if err != nil {
+		return &model.CatalogChangeResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to plan split: %v", err)}[0],
+		}, nil
+	}
+
+	auditID, err := r.CatalogAdmin.ApplySplit(ctx, plan, auditActor(ctx), reason)
+	if err != nil {
+		return &model.CatalogChangeResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to split: %v", err)}[0],
+		}, nil
+	}
+
+	newID, _ := plan.Object["id"].(string)
+	return &model.CatalogChangeResponse{
+		Success: true,
+		ItemID:  &newID,
+		AuditID: &auditID,
+	}, nil
+}
+
+// SetUserRole is the resolver for the setUserRole field.
+func (r *mutationResolver) SetUserRole(ctx context.Context, userID string, role model.Role) (*model.SetUserRoleResponse, error) {
+	userInfo, _ := custommw.GetUserFromContext(ctx)
+	if userInfo != nil && userInfo.UserID == userID {
+		// Keeps the last admin from locking everyone out by accident
+		return &model.SetUserRoleResponse{
+			Success: false,
+			Error:   &[]string{"You cannot change your own role"}[0],
+		}, nil
+	}
+
+	user, err := r.AuthService.SetUserRole(ctx, userID, toServiceRole(role))
+	if err != nil {
+		return &model.SetUserRoleResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to set role: %v", err)}[0],
+		}, nil
 	}
 
-	if r.S3Service == nil {
-		return nil, fmt.Errorf("image upload is not configured")
-	}
+	return &model.SetUserRoleResponse{
+		Success: true,
+		User:    toModelUser(user),
+	}, nil
+}
 
-	uploadURL, imageURL, err := r.S3Service.GenerateUploadURL(ctx, userInfo.UserID, contentType)
+// UpdateAppVersionConfig is the resolver for the updateAppVersionConfig field.
+func (r *mutationResolver) UpdateAppVersionConfig(ctx context.Context, input model.UpdateAppVersionConfigInput) (*model.UpdateAppVersionConfigResponse, error) {
+	cfg, err := r.AppConfig.UpdateAppVersionConfig(ctx, services.AppVersionConfigUpdate{
+		MinimumIOSVersion: input.MinimumIOSVersion,
+		UpdateMessage:     input.UpdateMessage,
+		ForceUpdate:       input.ForceUpdate,
+		StoreURL:          input.StoreURL,
+	}, auditActor(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate upload URL: %w", err)
+		return &model.UpdateAppVersionConfigResponse{
+			Success: false,
+			Error:   &[]string{fmt.Sprintf("Failed to update app version config: %v", err)}[0],
+		}, nil
 	}
 
-	return &model.ImageUploadURL{
-		UploadURL: uploadURL,
-		ImageURL:  imageURL,
+	return &model.UpdateAppVersionConfigResponse{
+		Success: true,
+		Config:  toModelAppVersionConfig(cfg),
 	}, nil
 }
 
@@ -1192,127 +1810,84 @@ func (r *queryResolver) Cassette(ctx context.Context, id string) (*model.Cassett
 }
 
 // Movies is the resolver for the movies field.
-func (r *queryResolver) Movies(ctx context.Context) ([]*model.Movie, error) {
-	// Fetch all movies from Hasura
-	moviesData, err := r.HasuraClient.GetAllMovies(ctx)
+func (r *queryResolver) Movies(ctx context.Context, pagination *model.PaginationInput, sort *model.SortInput, search *string) (*model.MovieConnection, error) {
+	result, pageInfo, err := r.fetchCatalogPage(ctx, services.MediaKindMovie, pagination, sort, search)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch movies: %w", err)
+		return nil, err
 	}
 
-	// Convert to model.Movie
-	movies := make([]*model.Movie, 0, len(moviesData))
-	for _, m := range moviesData {
-		movie := &model.Movie{}
+	movies := make([]*model.Movie, 0, len(result.Items))
+	for _, m := range result.Items {
+		movies = append(movies, toModelMovie(m))
+	}
 
-		// Required fields
-		if id, ok := m["id"].(string); ok {
-			movie.ID = id
-		}
-		if title, ok := m["title"].(string); ok {
-			movie.Title = title
-		}
+	return &model.MovieConnection{Items: movies, PageInfo: pageInfo}, nil
+}
 
-		// Optional fields
-		if director, ok := m["director"].(string); ok {
-			movie.Director = &director
-		}
-		if year, ok := m["year"].(float64); ok {
-			yearInt := int(year)
-			movie.Year = &yearInt
-		}
-		if genre, ok := m["genre"].(string); ok {
-			movie.Genre = &genre
-		}
-		if coverURL, ok := m["cover_url"].(string); ok {
-			movie.CoverURL = &coverURL
-		}
-		if createdAt, ok := m["created_at"].(string); ok {
-			movie.CreatedAt = &createdAt
-		}
-		if updatedAt, ok := m["updated_at"].(string); ok {
-			movie.UpdatedAt = &updatedAt
-		}
+// Albums is the resolver for the albums field.
+func (r *queryResolver) Albums(ctx context.Context, pagination *model.PaginationInput, sort *model.SortInput, search *string) (*model.AlbumConnection, error) {
+	result, pageInfo, err := r.fetchCatalogPage(ctx, services.MediaKindAlbum, pagination, sort, search)
+	if err != nil {
+		return nil, err
+	}
 
-		movies = append(movies, movie)
+	albums := make([]*model.Album, 0, len(result.Items))
+	for _, a := range result.Items {
+		albums = append(albums, toModelAlbum(a))
 	}
 
-	fmt.Printf("[Movies] Fetched %d movies from Hasura\n", len(movies))
-	return movies, nil
+	return &model.AlbumConnection{Items: albums, PageInfo: pageInfo}, nil
 }
 
-// Albums is the resolver for the albums field.
-func (r *queryResolver) Albums(ctx context.Context) ([]*model.Album, error) {
-	// Fetch all albums from Hasura
-	albumsData, err := r.HasuraClient.GetAllAlbums(ctx)
+// CatalogMovies is the resolver for the catalogMovies field.
+func (r *queryResolver) CatalogMovies(ctx context.Context, pagination *model.PaginationInput, sort *model.SortInput, search *string) (*model.CatalogMovieConnection, error) {
+	result, pageInfo, err := r.fetchCatalogPage(ctx, services.MediaKindMovie, pagination, sort, search)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch albums: %w", err)
+		return nil, err
 	}
 
-	// Convert to model.Album
-	albums := make([]*model.Album, 0, len(albumsData))
-	for _, a := range albumsData {
-		album := &model.Album{}
+	items := make([]*model.CatalogMovie, 0, len(result.Items))
+	for _, row := range result.Items {
+		item := toCatalogMovie(row)
+		item.CoverURL = r.catalogCoverURL(item.CoverURL)
+		items = append(items, item)
+	}
 
-		// Required fields
-		if id, ok := a["id"].(string); ok {
-			album.ID = id
-		}
-		if artist, ok := a["artist"].(string); ok {
-			album.Artist = artist
-		}
-		if albumName, ok := a["album"].(string); ok {
-			album.Album = albumName
-		}
+	return &model.CatalogMovieConnection{Items: items, PageInfo: pageInfo}, nil
+}
 
-		// Optional fields
-		if year, ok := a["year"].(float64); ok {
-			yearInt := int(year)
-			album.Year = &yearInt
-		}
-		if label, ok := a["label"].(string); ok {
-			album.Label = &label
-		}
-		if colorVariants, ok := a["color_variants"].([]interface{}); ok {
-			variantStrs := make([]string, 0, len(colorVariants))
-			for _, v := range colorVariants {
-				if variantStr, ok := v.(string); ok {
-					variantStrs = append(variantStrs, variantStr)
-				}
-			}
-			if len(variantStrs) > 0 {
-				album.ColorVariants = variantStrs
-			}
-		}
-		if genres, ok := a["genres"].([]interface{}); ok {
-			genreStrs := make([]string, 0, len(genres))
-			for _, g := range genres {
-				if genreStr, ok := g.(string); ok {
-					genreStrs = append(genreStrs, genreStr)
-				}
-			}
-			if len(genreStrs) > 0 {
-				album.Genres = genreStrs
-			}
-		}
-		if coverURL, ok := a["cover_url"].(string); ok {
-			album.CoverURL = &coverURL
-		}
-		if size, ok := a["size"].(float64); ok {
-			sizeInt := int(size)
-			album.Size = &sizeInt
-		}
-		if createdAt, ok := a["created_at"].(string); ok {
-			album.CreatedAt = &createdAt
-		}
-		if updatedAt, ok := a["updated_at"].(string); ok {
-			album.UpdatedAt = &updatedAt
-		}
+// CatalogAlbums is the resolver for the catalogAlbums field.
+func (r *queryResolver) CatalogAlbums(ctx context.Context, pagination *model.PaginationInput, sort *model.SortInput, search *string) (*model.CatalogAlbumConnection, error) {
+	result, pageInfo, err := r.fetchCatalogPage(ctx, services.MediaKindAlbum, pagination, sort, search)
+	if err != nil {
+		return nil, err
+	}
 
-		albums = append(albums, album)
+	items := make([]*model.CatalogAlbum, 0, len(result.Items))
+	for _, row := range result.Items {
+		item := toCatalogAlbum(row)
+		item.CoverURL = r.catalogCoverURL(item.CoverURL)
+		items = append(items, item)
 	}
 
-	fmt.Printf("[Albums] Fetched %d albums from Hasura\n", len(albums))
-	return albums, nil
+	return &model.CatalogAlbumConnection{Items: items, PageInfo: pageInfo}, nil
+}
+
+// CatalogCassettes is the resolver for the catalogCassettes field.
+func (r *queryResolver) CatalogCassettes(ctx context.Context, pagination *model.PaginationInput, sort *model.SortInput, search *string) (*model.CatalogCassetteConnection, error) {
+	result, pageInfo, err := r.fetchCatalogPage(ctx, services.MediaKindCassette, pagination, sort, search)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*model.CatalogCassette, 0, len(result.Items))
+	for _, row := range result.Items {
+		item := toCatalogCassette(row)
+		item.CoverURL = r.catalogCoverURL(item.CoverURL)
+		items = append(items, item)
+	}
+
+	return &model.CatalogCassetteConnection{Items: items, PageInfo: pageInfo}, nil
 }
 
 // Me is the resolver for the me field.
@@ -1332,12 +1907,86 @@ func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
 		return nil, fmt.Errorf("user not found")
 	}
 
-	return &model.User{
-		ID:        user.ID,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
-	}, nil
+	return toModelUser(user), nil
+}
+
+// Sessions is the resolver for the sessions field.
+func (r *queryResolver) Sessions(ctx context.Context) ([]*model.Session, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("authentication required")
+	}
+
+	sessions, err := r.AuthService.ListSessions(ctx, userInfo.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sessions: %w", err)
+	}
+
+	result := make([]*model.Session, len(sessions))
+	for i, session := range sessions {
+		result[i] = toModelSession(session, userInfo.SessionID)
+	}
+	return result, nil
+}
+
+// Passkeys is the resolver for the passkeys field.
+func (r *queryResolver) Passkeys(ctx context.Context) ([]*model.Passkey, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("authentication required")
+	}
+	if r.PasskeyService == nil {
+		return []*model.Passkey{}, nil
+	}
+
+	passkeys, err := r.PasskeyService.ListPasskeys(ctx, userInfo.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch passkeys: %w", err)
+	}
+
+	result := make([]*model.Passkey, len(passkeys))
+	for i, passkey := range passkeys {
+		result[i] = toModelPasskey(passkey)
+	}
+	return result, nil
+}
+
+// PersonalAccessTokens is the resolver for the personalAccessTokens field.
+func (r *queryResolver) PersonalAccessTokens(ctx context.Context) ([]*model.PersonalAccessToken, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("authentication required")
+	}
+
+	tokens, err := r.AuthService.ListPersonalAccessTokens(ctx, userInfo.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch access tokens: %w", err)
+	}
+
+	result := make([]*model.PersonalAccessToken, len(tokens))
+	for i, token := range tokens {
+		result[i] = toModelPersonalAccessToken(token)
+	}
+	return result, nil
+}
+
+// ExportAccountData is the resolver for the exportAccountData field.
+func (r *queryResolver) ExportAccountData(ctx context.Context) (string, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("authentication required")
+	}
+
+	export, err := r.AccountService.ExportAccountData(ctx, userInfo.UserID)
+	if err != nil {
+		return "", fmt.Errorf("failed to export account data: %w", err)
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode account data: %w", err)
+	}
+	return string(data), nil
 }
 
 // User is the resolver for the user field.
@@ -1351,11 +2000,40 @@ func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error
 		return nil, nil
 	}
 
-	return &model.User{
-		ID:        user.ID,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
+	return toModelUser(user), nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, pagination *model.PaginationInput, search *string) (*model.UserConnection, error) {
+	limit := 25
+	offset := 0
+	if pagination != nil {
+		limit = pagination.Limit
+		offset = pagination.Offset
+	}
+	if limit < 0 || offset < 0 {
+		return nil, fmt.Errorf("limit and offset must not be negative")
+	}
+	if limit > maxCatalogPageSize {
+		limit = maxCatalogPageSize
+	}
+
+	users, totalCount, err := r.AuthService.ListUsers(ctx, limit, offset, search)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	}
+
+	items := make([]*model.User, 0, len(users))
+	for _, user := range users {
+		items = append(items, toModelUser(user))
+	}
+
+	return &model.UserConnection{
+		Items: items,
+		PageInfo: &model.PageInfo{
+			HasNextPage: offset+len(items) < totalCount,
+			TotalCount:  totalCount,
+		},
 	}, nil
 }
 
@@ -1783,24 +2461,138 @@ func (r *queryResolver) UserCassettesPaginated(ctx context.Context, userID strin
 	}, nil
 }
 
+// FindDuplicates is the resolver for the findDuplicates field.
+func (r *queryResolver) FindDuplicates(ctx context.Context, kind model.MediaKind, coverThreshold *int) ([]*model.DuplicateCluster, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("authentication required")
+	}
+
+	serviceKind, err := toServiceKind(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	threshold, err := clampCoverThreshold(coverThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := r.Duplicates.FindDuplicates(ctx, userInfo.UserID, serviceKind, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicates: %w", err)
+	}
+
+	result := make([]*model.DuplicateCluster, 0, len(clusters))
+	for _, c := range clusters {
+		items := make([]*model.MediaItemSummary, 0, len(c.Items))
+		for _, item := range c.Items {
+			items = append(items, toMediaItemSummary(item))
+		}
+		result = append(result, &model.DuplicateCluster{
+			Kind:                 kind,
+			SuggestedCanonicalID: c.SuggestedCanonicalID,
+			Items:                items,
+		})
+	}
+
+	return result, nil
+}
+
+// ItemsByCover is the resolver for the itemsByCover field.
+func (r *queryResolver) ItemsByCover(ctx context.Context, kind model.MediaKind, imageURL string, threshold *int, limit *int) ([]*model.CoverMatch, error) {
+	userInfo, ok := custommw.GetUserFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("authentication required")
+	}
+
+	serviceKind, err := toServiceKind(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only hash images we host, so this can't be used to make the server fetch arbitrary URLs
+	if r.Storage == nil {
+		return nil, fmt.Errorf("image upload is not configured")
+	}
+	if _, ok := r.Storage.KeyFromURL(imageURL); !ok {
+		return nil, fmt.Errorf("imageUrl must be an uploaded image")
+	}
+
+	maxDistance, err := clampCoverThreshold(threshold)
+	if err != nil {
+		return nil, err
+	}
+	maxResults := 5
+	if limit != nil {
+		maxResults = *limit
+	}
+	if maxResults < 1 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+	if maxResults > maxCoverMatches {
+		maxResults = maxCoverMatches
+	}
+
+	matches, err := r.Duplicates.MatchCover(ctx, userInfo.UserID, serviceKind, imageURL, maxDistance, maxResults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match cover: %w", err)
+	}
+
+	result := make([]*model.CoverMatch, 0, len(matches))
+	for _, m := range matches {
+		result = append(result, &model.CoverMatch{
+			Item:     toMediaItemSummary(m.Item),
+			Distance: m.Distance,
+		})
+	}
+
+	return result, nil
+}
+
 // Health is the resolver for the health field.
 func (r *queryResolver) Health(ctx context.Context) (*model.Health, error) {
 	uptime := int(time.Since(r.ServerStartTime).Seconds())
+	build := buildinfo.Get()
 	return &model.Health{
 		Status:  "ok",
-		Version: "1.0.0",
+		Version: build.Version,
+		Commit:  build.Commit,
 		Uptime:  uptime,
 	}, nil
 }
 
+// SystemStatus is the resolver for the systemStatus field.
+func (r *queryResolver) SystemStatus(ctx context.Context) (*model.SystemStatus, error) {
+	userInfo, _ := custommw.GetUserFromContext(ctx)
+	report := r.HealthChecker.Check(ctx)
+	if userInfo == nil || !userInfo.Role.Satisfies(services.RoleAdmin) {
+		report = report.WithoutMessages()
+	}
+	return toModelSystemStatus(report, buildinfo.Get(), time.Since(r.ServerStartTime)), nil
+}
+
+// ProviderQuotas is the resolver for the providerQuotas field.
+func (r *queryResolver) ProviderQuotas(ctx context.Context) ([]*model.ProviderQuota, error) {
+	statuses := r.RateLimiter.Quotas(ctx)
+	quotas := make([]*model.ProviderQuota, 0, len(statuses))
+	for _, status := range statuses {
+		quotas = append(quotas, toModelProviderQuota(status))
+	}
+	return quotas, nil
+}
+
 // AppVersionConfig is the resolver for the appVersionConfig field.
 func (r *queryResolver) AppVersionConfig(ctx context.Context) (*model.AppVersionConfig, error) {
-	return &model.AppVersionConfig{
-		MinimumIOSVersion: r.Config.MinimumIOSVersion,
-		UpdateMessage:     r.Config.ForceUpdateMessage,
-		ForceUpdate:       true,
-		StoreURL:          r.Config.AppStoreURL,
-	}, nil
+	cfg, err := r.AppConfig.GetAppVersionConfig(ctx)
+	if err != nil {
+		// Update checks run on every launch; don't block them on the database
+		slog.WarnContext(ctx, "Using default app version config", "error", err)
+		defaults := r.AppConfig.Defaults()
+		cfg = &defaults
+	}
+
+	return toModelAppVersionConfig(cfg), nil
 }
 
 // Mutation returns MutationResolver implementation.
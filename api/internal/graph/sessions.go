@@ -0,0 +1,64 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"mediacloset/api/internal/graph/model"
+	custommw "mediacloset/api/internal/middleware"
+	"mediacloset/api/internal/services"
+)
+
+// sessionClient describes the device making the request
+func sessionClient(ctx context.Context) services.SessionClient {
+	info := custommw.GetClientInfo(ctx)
+	return services.SessionClient{
+		DeviceName: info.DeviceName,
+		UserAgent:  info.UserAgent,
+		IPAddress:  info.IPAddress,
+	}
+}
+
+// toTokenResponse builds the sign-in/refresh response for a new token pair
+func toTokenResponse(pair *services.TokenPair, user *services.User) *model.VerifyLoginCodeResponse {
+	expiresAt := pair.AccessTokenExpiresAt.Format(time.RFC3339)
+	return &model.VerifyLoginCodeResponse{
+		Success:      true,
+		Token:        &pair.AccessToken,
+		ExpiresAt:    &expiresAt,
+		RefreshToken: &pair.RefreshToken,
+		User:         toModelUser(user),
+	}
+}
+
+// retryAfterSeconds reports how long a throttled login must wait, rounded up
+func retryAfterSeconds(err error) *int {
+	var throttled *services.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return nil
+	}
+	seconds := int(math.Ceil(throttled.RetryAfter.Seconds()))
+	return &seconds
+}
+
+func toModelSession(s *services.Session, currentSessionID string) *model.Session {
+	session := &model.Session{
+		ID:         s.ID,
+		CreatedAt:  s.CreatedAt.Format(time.RFC3339),
+		LastUsedAt: s.LastUsedAt.Format(time.RFC3339),
+		ExpiresAt:  s.ExpiresAt.Format(time.RFC3339),
+		Current:    s.ID == currentSessionID,
+	}
+	if s.DeviceName != "" {
+		session.DeviceName = &s.DeviceName
+	}
+	if s.UserAgent != "" {
+		session.UserAgent = &s.UserAgent
+	}
+	if s.IPAddress != "" {
+		session.IPAddress = &s.IPAddress
+	}
+	return session
+}
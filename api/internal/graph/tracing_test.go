@@ -0,0 +1,42 @@
+package graph
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestResolverSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	c := newTestClient(t)
+	var resp map[string]interface{}
+	if err := c.Post(`query WhoAmI { me { id } }`, &resp, asUser("alice")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	operation, field, hasura := spans["graphql WhoAmI"], spans["Query.me"], spans["hasura GetUserByID"]
+	if operation == nil || field == nil || hasura == nil {
+		t.Fatalf("expected operation, resolver and Hasura spans, got %v", spans)
+	}
+	if _, ok := spans["User.id"]; ok {
+		t.Error("expected no span for a plain struct field")
+	}
+
+	if field.Parent().SpanID() != operation.SpanContext().SpanID() {
+		t.Error("expected the resolver span inside the operation span")
+	}
+	if hasura.Parent().SpanID() != field.SpanContext().SpanID() || hasura.SpanKind() != trace.SpanKindClient {
+		t.Error("expected a client span for the Hasura call inside the resolver span")
+	}
+}
@@ -0,0 +1,41 @@
+package graph
+
+import (
+	"time"
+
+	"mediacloset/api/internal/graph/model"
+	"mediacloset/api/internal/services"
+)
+
+var roles = map[model.Role]services.Role{
+	model.RoleReadOnly: services.RoleReadOnly,
+	model.RoleUser:     services.RoleUser,
+	model.RoleAdmin:    services.RoleAdmin,
+}
+
+// toServiceRole maps the GraphQL enum onto the stored role
+func toServiceRole(role model.Role) services.Role {
+	return roles[role]
+}
+
+func toModelRole(role services.Role) *model.Role {
+	for m, r := range roles {
+		if r == role {
+			return &m
+		}
+	}
+	return nil
+}
+
+// toModelUser converts a user record to its GraphQL type. Field-level
+// directives decide what other users get to see.
+func toModelUser(user *services.User) *model.User {
+	return &model.User{
+		ID:        user.ID,
+		Email:     &user.Email,
+		IsPublic:  user.IsPublic,
+		Role:      toModelRole(user.Role),
+		CreatedAt: user.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,200 @@
+// Package health runs the readiness checks behind /readyz and the
+// systemStatus query. Each component is checked concurrently with a
+// timeout, and results can be cached so frequent probes don't hammer
+// dependencies or burn provider quotas.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Status of a component or of the server as a whole
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+	StatusDisabled Status = "disabled"
+)
+
+// defaultTimeout bounds each check so one hung dependency can't stall the probe
+const defaultTimeout = 2 * time.Second
+
+// Check is one component the server depends on
+type Check struct {
+	Name string
+	// Critical components make the server unready when they are down;
+	// others only degrade it
+	Critical bool
+	// CacheFor reuses the last result for this long
+	CacheFor time.Duration
+	// Run returns nil when the component is healthy. Return Degraded or
+	// Disabled for the other states; any other error means down.
+	Run func(ctx context.Context) error
+}
+
+// ComponentStatus is the result of one check
+type ComponentStatus struct {
+	Name      string        `json:"name"`
+	Status    Status        `json:"status"`
+	Critical  bool          `json:"critical"`
+	Latency   time.Duration `json:"-"`
+	LatencyMS int64         `json:"latencyMs"`
+	Message   string        `json:"message,omitempty"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// Report is the outcome of running every check
+type Report struct {
+	Status     Status            `json:"status"`
+	Components []ComponentStatus `json:"components"`
+}
+
+// Ready reports whether every critical component is up
+func (r Report) Ready() bool {
+	return r.Status != StatusDown
+}
+
+// WithoutMessages drops error details, which can name internal hosts, for
+// reports served to anyone who asks
+func (r Report) WithoutMessages() Report {
+	components := make([]ComponentStatus, len(r.Components))
+	for i, c := range r.Components {
+		c.Message = ""
+		components[i] = c
+	}
+	r.Components = components
+	return r
+}
+
+type statusError struct {
+	status  Status
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// Degraded reports a component that works but needs attention
+func Degraded(format string, args ...interface{}) error {
+	return &statusError{status: StatusDegraded, message: fmt.Sprintf(format, args...)}
+}
+
+// Disabled reports a component that isn't configured
+func Disabled(format string, args ...interface{}) error {
+	return &statusError{status: StatusDisabled, message: fmt.Sprintf(format, args...)}
+}
+
+// Checker runs a fixed set of checks
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	cached map[string]ComponentStatus
+}
+
+// NewChecker creates a checker for checks, reported in the order given
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		timeout: defaultTimeout,
+		now:     time.Now,
+		cached:  make(map[string]ComponentStatus),
+	}
+}
+
+// Check runs every check (or reuses a cached result) and combines them. A
+// nil checker has nothing to check and reports ok.
+func (c *Checker) Check(ctx context.Context) Report {
+	if c == nil {
+		return Report{Status: StatusOK, Components: []ComponentStatus{}}
+	}
+	components := make([]ComponentStatus, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		if cached, ok := c.fromCache(check); ok {
+			components[i] = cached
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			components[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Components: components}
+	for _, component := range components {
+		switch {
+		case component.Status == StatusDown && component.Critical:
+			report.Status = StatusDown
+		case component.Status == StatusDown || component.Status == StatusDegraded:
+			if report.Status == StatusOK {
+				report.Status = StatusDegraded
+			}
+		}
+	}
+	return report
+}
+
+func (c *Checker) fromCache(check Check) (ComponentStatus, bool) {
+	if check.CacheFor <= 0 {
+		return ComponentStatus{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.cached[check.Name]
+	if !ok || c.now().Sub(cached.CheckedAt) >= check.CacheFor {
+		return ComponentStatus{}, false
+	}
+	return cached, true
+}
+
+func (c *Checker) run(parent context.Context, check Check) ComponentStatus {
+	ctx, cancel := context.WithTimeout(parent, c.timeout)
+	defer cancel()
+
+	start := c.now()
+	err := check.Run(ctx)
+	latency := c.now().Sub(start)
+
+	result := ComponentStatus{
+		Name:      check.Name,
+		Status:    StatusOK,
+		Critical:  check.Critical,
+		Latency:   latency,
+		LatencyMS: latency.Milliseconds(),
+		CheckedAt: start,
+	}
+	var se *statusError
+	switch {
+	case err == nil:
+	case errors.As(err, &se):
+		result.Status = se.status
+		result.Message = se.message
+	default:
+		result.Status = StatusDown
+		result.Message = err.Error()
+	}
+	if result.Status == StatusDown || result.Status == StatusDegraded {
+		slog.WarnContext(ctx, "Health check failed", "component", check.Name, "status", string(result.Status), "error", result.Message)
+	}
+
+	// A caller that gave up says nothing about the component
+	if check.CacheFor > 0 && parent.Err() == nil {
+		c.mu.Lock()
+		c.cached[check.Name] = result
+		c.mu.Unlock()
+	}
+	return result
+}
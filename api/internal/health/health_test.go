@@ -0,0 +1,135 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name       string
+		checks     []Check
+		wantStatus Status
+		wantReady  bool
+	}{
+		{
+			name:       "All up",
+			checks:     []Check{{Name: "hasura", Critical: true, Run: ok}, {Name: "storage", Run: ok}},
+			wantStatus: StatusOK,
+			wantReady:  true,
+		},
+		{
+			name:       "Critical component down",
+			checks:     []Check{{Name: "hasura", Critical: true, Run: down}, {Name: "storage", Run: ok}},
+			wantStatus: StatusDown,
+			wantReady:  false,
+		},
+		{
+			name:       "Optional component down only degrades",
+			checks:     []Check{{Name: "hasura", Critical: true, Run: ok}, {Name: "storage", Run: down}},
+			wantStatus: StatusDegraded,
+			wantReady:  true,
+		},
+		{
+			name: "Degraded component",
+			checks: []Check{{Name: "email", Run: func(ctx context.Context) error {
+				return Degraded("sandbox")
+			}}},
+			wantStatus: StatusDegraded,
+			wantReady:  true,
+		},
+		{
+			name: "Disabled components don't count",
+			checks: []Check{{Name: "storage", Run: func(ctx context.Context) error {
+				return Disabled("not configured")
+			}}},
+			wantStatus: StatusOK,
+			wantReady:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewChecker(tt.checks...).Check(context.Background())
+			if report.Status != tt.wantStatus || report.Ready() != tt.wantReady {
+				t.Errorf("Expected %s (ready=%v), got %s (ready=%v)", tt.wantStatus, tt.wantReady, report.Status, report.Ready())
+			}
+			if len(report.Components) != len(tt.checks) {
+				t.Fatalf("Expected %d components, got %d", len(tt.checks), len(report.Components))
+			}
+			for i, check := range tt.checks {
+				if report.Components[i].Name != check.Name {
+					t.Errorf("Expected components in order, got %s at %d", report.Components[i].Name, i)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckTimesOut(t *testing.T) {
+	checker := NewChecker(Check{Name: "hasura", Critical: true, Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	checker.timeout = 10 * time.Millisecond
+
+	report := checker.Check(context.Background())
+	if report.Status != StatusDown || report.Components[0].Message != context.DeadlineExceeded.Error() {
+		t.Errorf("Expected a hung check to time out as down, got %+v", report)
+	}
+}
+
+func TestCheckCaches(t *testing.T) {
+	var calls int32
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	checker := NewChecker(Check{Name: "musicbrainz", CacheFor: time.Minute, Run: func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}})
+	checker.now = func() time.Time { return now }
+
+	checker.Check(context.Background())
+	now = now.Add(30 * time.Second)
+	checker.Check(context.Background())
+	if calls != 1 {
+		t.Errorf("Expected the cached result to be reused, got %d calls", calls)
+	}
+
+	now = now.Add(time.Minute)
+	checker.Check(context.Background())
+	if calls != 2 {
+		t.Errorf("Expected the check to run again once the cache expired, got %d calls", calls)
+	}
+
+	t.Run("Canceled callers don't poison the cache", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		checker := NewChecker(Check{Name: "hasura", CacheFor: time.Minute, Run: func(ctx context.Context) error {
+			return ctx.Err()
+		}})
+		checker.Check(ctx)
+		if report := checker.Check(context.Background()); report.Status != StatusOK {
+			t.Errorf("Expected a fresh check after a canceled one, got %s", report.Status)
+		}
+	})
+}
+
+func TestWithoutMessages(t *testing.T) {
+	report := NewChecker(Check{Name: "hasura", Run: func(ctx context.Context) error {
+		return errors.New("dial tcp 10.0.0.5:8080: connection refused")
+	}}).Check(context.Background())
+
+	public := report.WithoutMessages()
+	if public.Components[0].Message != "" {
+		t.Errorf("Expected message removed, got %q", public.Components[0].Message)
+	}
+	if report.Components[0].Message == "" {
+		t.Error("Expected the original report to keep its message")
+	}
+}
@@ -0,0 +1,151 @@
+// Package imagehash computes perceptual hashes of cover images.
+//
+// Perceptual hashes change little when an image is resized, recompressed, or
+// slightly color-shifted, so two scans of the same album cover end up a small
+// Hamming distance apart even though their bytes differ completely.
+package imagehash
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"  // Register GIF decoder
+	_ "image/jpeg" // Register JPEG decoder
+	_ "image/png"  // Register PNG decoder
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Register WebP decoder
+)
+
+// Hash is a 64-bit perceptual hash
+type Hash uint64
+
+// String encodes the hash as 16 hex characters (the format stored in Hasura)
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Parse decodes a hash produced by Hash.String
+func Parse(s string) (Hash, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid image hash %q: %w", s, err)
+	}
+	return Hash(v), nil
+}
+
+// Distance returns the Hamming distance between two hashes (0 = identical, 64 = opposite)
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a) ^ uint64(b))
+}
+
+// Decode reads a JPEG, PNG, GIF, or WebP image
+func Decode(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// DHash computes a difference hash: the image is shrunk to 9x8 grayscale and each
+// bit records whether a pixel is brighter than its right-hand neighbour.
+// Cheap and robust to scaling and brightness changes.
+func DHash(img image.Image) Hash {
+	pixels := grayscale(img, 9, 8)
+
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if pixels[y*9+x] > pixels[y*9+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return Hash(h)
+}
+
+// PHash computes a DCT-based perceptual hash: the image is shrunk to 32x32
+// grayscale, transformed with a 2D DCT, and each bit records whether one of the
+// 64 lowest-frequency coefficients is above their median.
+// More tolerant of recompression and small edits than DHash.
+func PHash(img image.Image) Hash {
+	const size = 32
+	pixels := grayscale(img, size, size)
+
+	coeffs := dct2D(pixels, size)
+
+	// Keep the top-left 8x8 block (lowest frequencies)
+	low := make([]float64, 0, 64)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			low = append(low, coeffs[y*size+x])
+		}
+	}
+
+	// The DC term dominates and carries no structure, so leave it out of the median
+	sorted := append([]float64(nil), low[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var h uint64
+	for _, c := range low {
+		h <<= 1
+		if c > median {
+			h |= 1
+		}
+	}
+	return Hash(h)
+}
+
+// grayscale resizes img to w x h and returns its luminance values row by row
+func grayscale(img image.Image, w, h int) []float64 {
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	draw.BiLinear.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	pixels := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			pixels[y*w+x] = float64(dst.GrayAt(x, y).Y)
+		}
+	}
+	return pixels
+}
+
+// dct2D applies a separable type-II DCT to an n x n matrix
+func dct2D(pixels []float64, n int) []float64 {
+	cos := make([]float64, n*n)
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			cos[k*n+i] = math.Cos(math.Pi / float64(n) * (float64(i) + 0.5) * float64(k))
+		}
+	}
+
+	rows := make([]float64, n*n)
+	for y := 0; y < n; y++ {
+		for k := 0; k < n; k++ {
+			var sum float64
+			for x := 0; x < n; x++ {
+				sum += pixels[y*n+x] * cos[k*n+x]
+			}
+			rows[y*n+k] = sum
+		}
+	}
+
+	out := make([]float64, n*n)
+	for x := 0; x < n; x++ {
+		for k := 0; k < n; k++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				sum += rows[y*n+x] * cos[k*n+y]
+			}
+			out[k*n+x] = sum
+		}
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package imagehash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+// testCover draws a simple synthetic "cover". Variant 0 is a diagonal gradient
+// with a dark square in the upper left; variant 1 is bold vertical stripes
+// with a bright square in the lower right.
+func testCover(w, h int, variant int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var c color.RGBA
+			if variant == 0 {
+				c = color.RGBA{uint8(255 * x / w), uint8(255 * y / h), 128, 255}
+				if x > w/8 && x < w/3 && y > h/8 && y < h/3 {
+					c = color.RGBA{10, 10, 10, 255}
+				}
+			} else {
+				v := uint8(30)
+				if (x/(w/6))%2 == 0 {
+					v = 220
+				}
+				c = color.RGBA{v, v / 2, 255 - v, 255}
+				if x > w*2/3 && y > h*2/3 {
+					c = color.RGBA{250, 250, 250, 255}
+				}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func resize(img image.Image, w, h int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+func reencodeJPEG(t *testing.T, img image.Image, quality int) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatalf("failed to encode JPEG: %v", err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("failed to decode JPEG: %v", err)
+	}
+	return decoded
+}
+
+func TestHashes_SimilarImages(t *testing.T) {
+	original := testCover(600, 600, 0)
+	variants := map[string]image.Image{
+		"downscaled":      resize(original, 250, 250),
+		"low quality":     reencodeJPEG(t, original, 40),
+		"small and lossy": reencodeJPEG(t, resize(original, 120, 120), 60),
+	}
+
+	for name, variant := range variants {
+		t.Run(name, func(t *testing.T) {
+			if d := Distance(PHash(original), PHash(variant)); d > 6 {
+				t.Errorf("expected pHash distance <= 6, got %d", d)
+			}
+			if d := Distance(DHash(original), DHash(variant)); d > 6 {
+				t.Errorf("expected dHash distance <= 6, got %d", d)
+			}
+		})
+	}
+}
+
+func TestHashes_DifferentImages(t *testing.T) {
+	a := testCover(400, 400, 0)
+	b := testCover(400, 400, 1)
+
+	if d := Distance(PHash(a), PHash(b)); d < 16 {
+		t.Errorf("expected pHash distance >= 16 for different images, got %d", d)
+	}
+	if d := Distance(DHash(a), DHash(b)); d < 16 {
+		t.Errorf("expected dHash distance >= 16 for different images, got %d", d)
+	}
+}
+
+func TestHash_StringRoundTrip(t *testing.T) {
+	h := PHash(testCover(64, 64, 0))
+
+	parsed, err := Parse(h.String())
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if parsed != h {
+		t.Errorf("round trip mismatch: %s != %s", parsed, h)
+	}
+	if len(h.String()) != 16 {
+		t.Errorf("expected 16 hex characters, got %q", h.String())
+	}
+
+	if _, err := Parse("not-hex"); err == nil {
+		t.Error("expected error for invalid hash")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b Hash
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0xFFFFFFFFFFFFFFFF, 0, 64},
+		{0xF0, 0x0F, 8},
+	}
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%x, %x) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDecode_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testCover(32, 32, 0)); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	if _, err := Decode(&buf); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if _, err := Decode(bytes.NewReader([]byte("not an image"))); err == nil {
+		t.Error("expected error for invalid image data")
+	}
+}
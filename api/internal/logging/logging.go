@@ -0,0 +1,132 @@
+// Package logging sets up structured logging with log/slog. Records carry
+// the request ID, user, GraphQL operation, and any other fields attached to
+// the request's context, and sensitive values are redacted before output.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Setup makes a logger writing to w the slog default, which also routes
+// the standard log package through it. level is debug, info, warn or error
+// (default info); format is json (default) or text.
+func Setup(w io.Writer, level, format string) *slog.Logger {
+	logger := New(w, level, format)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// New creates a logger without installing it
+func New(w io.Writer, level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       ParseLevel(level),
+		ReplaceAttr: redactAttr,
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "text") {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// ParseLevel reads a level name, defaulting to info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// fieldsKey is the context key for a request's fields
+type fieldsKey struct{}
+
+// fields collects attributes learned while handling a request. Middleware
+// deeper in the chain add to it, and every record logged with the request's
+// context includes them.
+type fields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// WithFields gives ctx an empty set of request fields. Records logged with
+// the returned context, or any context derived from it, include fields
+// added later with AddFields.
+func WithFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &fields{})
+}
+
+// AddFields attaches attributes to the request, replacing any with the same
+// key. It does nothing when ctx has no request fields.
+func AddFields(ctx context.Context, attrs ...slog.Attr) {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, attr := range attrs {
+		replaced := false
+		for i := range f.attrs {
+			if f.attrs[i].Key == attr.Key {
+				f.attrs[i] = attr
+				replaced = true
+			}
+		}
+		if !replaced {
+			f.attrs = append(f.attrs, attr)
+		}
+	}
+}
+
+func requestFields(ctx context.Context) []slog.Attr {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]slog.Attr(nil), f.attrs...)
+}
+
+// contextHandler adds the request ID and request fields to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if id := middleware.GetReqID(ctx); id != "" {
+			r.AddAttrs(slog.String("request_id", id))
+		}
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+		}
+		r.AddAttrs(requestFields(ctx)...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,160 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logRecord logs one record and returns it decoded
+func logRecord(t *testing.T, ctx context.Context, level string, log func(ctx context.Context, logger *slog.Logger)) map[string]interface{} {
+	t.Helper()
+	var buf bytes.Buffer
+	log(ctx, New(&buf, level, "json"))
+	if buf.Len() == 0 {
+		return nil
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON record, got %q", buf.String())
+	}
+	return record
+}
+
+func TestRedaction(t *testing.T) {
+	tests := []struct {
+		name  string
+		attr  slog.Attr
+		want  string
+		leaks string
+	}{
+		{"Login codes", slog.String("code", "123456"), redacted, "123456"},
+		{"Refresh tokens", slog.String("refresh_token", "abc"), redacted, "abc"},
+		{"Keys ending in _token", slog.String("session_token", "abc"), redacted, "abc"},
+		{"Sign-in links", slog.String("link", "https://x/auth?token=abc"), redacted, "abc"},
+		{"Emails are masked", slog.String("email", "someone@example.com"), "s***@example.com", "someone@"},
+		{"Emails inside text", slog.String("detail", "sent to someone@example.com"), "sent to s***@example.com", "someone@"},
+		{"Emails inside errors", slog.Any("error", errors.New("user someone@example.com not found")), "user s***@example.com not found", "someone@"},
+		{"JWTs inside text", slog.String("header", "Bearer eyJhbGciOi.eyJzdWIiOi.c2lnbmF0dXJl"), "Bearer " + redacted, "eyJ"},
+		{"Personal access tokens", slog.String("detail", "mcp_0123456789abcdef0123"), redacted, "mcp_"},
+		{"Query string keys", slog.Any("error", errors.New(`Get "https://www.omdbapi.com/?apikey=abc123&t=Alien": timeout`)), `Get "https://www.omdbapi.com/?apikey=` + redacted + `&t=Alien": timeout`, "abc123"},
+		{"Query string secrets", slog.String("detail", "/database/search?barcode=1&key=k123&secret=s456"), "/database/search?barcode=1&key=" + redacted + "&secret=" + redacted, "s456"},
+		{"Revealed values are kept", slog.Any("dev_code", Revealed("123456")), "123456", ""},
+		{"Ordinary values are kept", slog.Int("status", 200), "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			New(&buf, "info", "json").LogAttrs(context.Background(), slog.LevelInfo, "test", tt.attr)
+			line := buf.String()
+
+			var record map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("Expected a JSON record, got %q", line)
+			}
+			if tt.want != "" && record[tt.attr.Key] != tt.want {
+				t.Errorf("Expected %s=%q, got %v", tt.attr.Key, tt.want, record[tt.attr.Key])
+			}
+			if tt.leaks != "" && strings.Contains(line, tt.leaks) {
+				t.Errorf("Expected %q to be redacted, got %s", tt.leaks, line)
+			}
+		})
+	}
+
+	t.Run("Messages are scrubbed", func(t *testing.T) {
+		record := logRecord(t, context.Background(), "info", func(ctx context.Context, logger *slog.Logger) {
+			logger.InfoContext(ctx, "Sent code to someone@example.com")
+		})
+		if record["msg"] != "Sent code to s***@example.com" {
+			t.Errorf("Expected email masked in message, got %v", record["msg"])
+		}
+	})
+}
+
+func TestRequestFields(t *testing.T) {
+	t.Run("Records carry the request ID and fields added later", func(t *testing.T) {
+		var record map[string]interface{}
+		handler := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithFields(r.Context())
+			AddFields(ctx, slog.String("user_id", "user-1"))
+			AddFields(ctx, slog.String("operation", "Me"), slog.String("user_id", "user-2"))
+
+			record = logRecord(t, ctx, "info", func(ctx context.Context, logger *slog.Logger) {
+				logger.InfoContext(ctx, "handled")
+			})
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/query", nil))
+
+		if record["request_id"] == nil || record["request_id"] == "" {
+			t.Errorf("Expected request_id, got %v", record)
+		}
+		if record["user_id"] != "user-2" || record["operation"] != "Me" {
+			t.Errorf("Expected latest user_id and operation, got %v", record)
+		}
+	})
+
+	t.Run("Records inside a trace carry its ID", func(t *testing.T) {
+		traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+		spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+		record := logRecord(t, ctx, "info", func(ctx context.Context, logger *slog.Logger) {
+			logger.InfoContext(ctx, "handled")
+		})
+		if record["trace_id"] != traceID.String() {
+			t.Errorf("Expected trace_id %s, got %v", traceID, record["trace_id"])
+		}
+	})
+
+	t.Run("AddFields without request fields is a no-op", func(t *testing.T) {
+		ctx := context.Background()
+		AddFields(ctx, slog.String("user_id", "user-1"))
+		record := logRecord(t, ctx, "info", func(ctx context.Context, logger *slog.Logger) {
+			logger.InfoContext(ctx, "handled")
+		})
+		if _, ok := record["user_id"]; ok {
+			t.Errorf("Expected no user_id, got %v", record)
+		}
+	})
+}
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		level     string
+		debugKept bool
+		infoKept  bool
+	}{
+		{"debug", true, true},
+		{"", false, true},
+		{"info", false, true},
+		{"WARN", false, false},
+		{"error", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			debug := logRecord(t, context.Background(), tt.level, func(ctx context.Context, logger *slog.Logger) {
+				logger.DebugContext(ctx, "debug")
+			})
+			info := logRecord(t, context.Background(), tt.level, func(ctx context.Context, logger *slog.Logger) {
+				logger.InfoContext(ctx, "info")
+			})
+			if (debug != nil) != tt.debugKept {
+				t.Errorf("Expected debug kept=%v", tt.debugKept)
+			}
+			if (info != nil) != tt.infoKept {
+				t.Errorf("Expected info kept=%v", tt.infoKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces secret values in output
+const redacted = "[REDACTED]"
+
+// secretKeys are attribute keys whose values are never logged
+var secretKeys = map[string]bool{
+	"code":          true,
+	"login_code":    true,
+	"current_code":  true,
+	"new_code":      true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"password":      true,
+	"secret":        true,
+	"api_key":       true,
+	"authorization": true,
+	"link":          true, // Sign-in links carry a token
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@([A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+	// JWTs, personal access tokens, and client keys
+	tokenPattern = regexp.MustCompile(`\b(eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+|mcp_[A-Za-z0-9_\-]{16,}|mck_[A-Za-z0-9_\-]{16,})`)
+	// Credentials in URL query strings, like OMDB's apikey or Discogs' key
+	// and secret, which show up in the errors of failed requests
+	queryPattern = regexp.MustCompile(`(?i)([?&][A-Za-z0-9_.\-]*(?:key|secret|token)=)[^&#\s"']+`)
+)
+
+// Revealed marks a value the redactor leaves alone. It exists for
+// development conveniences, like printing login codes when no email
+// service is configured; never use it outside development.
+type Revealed string
+
+// redactAttr hides secrets: values under secret keys, email addresses
+// (keeping the first letter and domain), and anything shaped like a token,
+// wherever they appear, including in messages and errors
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if revealed, ok := a.Value.Any().(Revealed); ok {
+		return slog.String(a.Key, string(revealed))
+	}
+
+	key := strings.ToLower(a.Key)
+	if secretKeys[key] || strings.HasSuffix(key, "_token") || strings.HasSuffix(key, "_secret") {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, RedactString(err.Error()))
+		}
+	}
+	return a
+}
+
+// RedactString masks email addresses, tokens and query string credentials
+// in s
+func RedactString(s string) string {
+	s = queryPattern.ReplaceAllString(s, "${1}"+redacted)
+	s = tokenPattern.ReplaceAllString(s, redacted)
+	return emailPattern.ReplaceAllStringFunc(s, maskEmail)
+}
+
+// maskEmail turns someone@example.com into s***@example.com
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return redacted
+	}
+	return email[:1] + "***" + email[at:]
+}
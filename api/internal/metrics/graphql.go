@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// GraphQL is a gqlgen extension that counts and times operations and
+// counts resolver errors. Add it with the server's Use.
+type GraphQL struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+} = GraphQL{}
+
+func (GraphQL) ExtensionName() string {
+	return "Metrics"
+}
+
+func (GraphQL) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptResponse times each operation. Operations are labeled by their
+// first root field, which comes from the schema, rather than the
+// client-chosen operation name.
+func (GraphQL) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	start := time.Now()
+	resp := next(ctx)
+
+	operation := rootField(ctx)
+	outcome := "ok"
+	if resp == nil || len(resp.Errors) > 0 {
+		outcome = "error"
+	}
+	GraphQLOperations.WithLabelValues(operation, outcome).Inc()
+	GraphQLDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	return resp
+}
+
+// InterceptField counts errors from resolvers (not plain struct fields)
+func (GraphQL) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	res, err := next(ctx)
+	if err != nil {
+		if fc := graphql.GetFieldContext(ctx); fc != nil && fc.IsResolver {
+			ResolverErrors.WithLabelValues(fc.Object + "." + fc.Field.Name).Inc()
+		}
+	}
+	return res, err
+}
+
+func rootField(ctx context.Context) string {
+	if !graphql.HasOperationContext(ctx) {
+		return "unknown"
+	}
+	oc := graphql.GetOperationContext(ctx)
+	if oc.Operation == nil {
+		return "unknown"
+	}
+	for _, selection := range oc.Operation.SelectionSet {
+		if field, ok := selection.(*ast.Field); ok {
+			return field.Name
+		}
+	}
+	return "unknown"
+}
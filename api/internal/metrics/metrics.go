@@ -0,0 +1,124 @@
+// Package metrics defines the Prometheus metrics the API exports on
+// /metrics. Label values are kept to bounded sets (schema field names,
+// route patterns, provider names) so series can't grow without limit.
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "mediacloset"
+
+// latencyBuckets cover fast cache hits through slow upstream lookups
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route pattern.",
+		Buckets:   latencyBuckets,
+	}, []string{"method", "route"})
+
+	GraphQLOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "graphql_operations_total",
+		Help:      "GraphQL operations by root field and outcome (ok or error).",
+	}, []string{"operation", "outcome"})
+
+	GraphQLDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "graphql_operation_duration_seconds",
+		Help:      "GraphQL operation latency by root field.",
+		Buckets:   latencyBuckets,
+	}, []string{"operation"})
+
+	ResolverErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "graphql_resolver_errors_total",
+		Help:      "Errors returned by resolvers, by Type.field.",
+	}, []string{"field"})
+
+	UpstreamRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_total",
+		Help:      "Requests to external providers by status code, \"error\" for transport failures or \"circuit_open\" when the breaker refused them.",
+	}, []string{"provider", "status"})
+
+	UpstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of requests to external providers, per attempt.",
+		Buckets:   latencyBuckets,
+	}, []string{"provider"})
+
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "In-process cache lookups by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	RateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the API rate limiter, by operation class.",
+	}, []string{"class"})
+
+	ProviderLimiterWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provider_limiter_wait_seconds",
+		Help:      "Time spent waiting for a provider's rate limit before calling it.",
+		Buckets:   []float64{0, .1, .25, .5, 1, 2, 5, 10, 30},
+	}, []string{"provider"})
+)
+
+// CacheLookup counts a cache lookup as a hit or miss
+func CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// ObserveUpstream records one attempt at calling provider. status is the
+// HTTP status, or 0 when the request failed before a response.
+func ObserveUpstream(provider string, status int, elapsed time.Duration) {
+	label := "error"
+	if status > 0 {
+		label = strconv.Itoa(status)
+	}
+	UpstreamRequests.WithLabelValues(provider, label).Inc()
+	UpstreamDuration.WithLabelValues(provider).Observe(elapsed.Seconds())
+}
+
+// Handler serves the metrics. When token is set, scrapers must send it as
+// a bearer token.
+func Handler(token string) http.Handler {
+	handler := promhttp.Handler()
+	if token == "" {
+		return handler
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/uploads/*", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name   string
+		path   string
+		route  string
+		status string
+	}{
+		{"Requests are labeled by route pattern", "/uploads/covers/a.jpg", "/uploads/*", "404"},
+		{"Handlers that never write count as 200", "/health", "/health", "200"},
+		{"Unknown paths share one series", "/wp-login.php", "unmatched", "404"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := HTTPRequests.WithLabelValues("GET", tt.route, tt.status)
+			before := testutil.ToFloat64(counter)
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("Expected 1 request for route %s status %s, got %v", tt.route, tt.status, got)
+			}
+		})
+	}
+}
+
+func TestObserveUpstream(t *testing.T) {
+	ok := testutil.ToFloat64(UpstreamRequests.WithLabelValues("test", "200"))
+	failed := testutil.ToFloat64(UpstreamRequests.WithLabelValues("test", "error"))
+
+	ObserveUpstream("test", http.StatusOK, 0)
+	ObserveUpstream("test", 0, 0)
+
+	if got := testutil.ToFloat64(UpstreamRequests.WithLabelValues("test", "200")) - ok; got != 1 {
+		t.Errorf("Expected 1 request with status 200, got %v", got)
+	}
+	if got := testutil.ToFloat64(UpstreamRequests.WithLabelValues("test", "error")) - failed; got != 1 {
+		t.Errorf("Expected 1 failed request, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	CacheLookup("sessions", true)
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		expectedCode  int
+	}{
+		{"Open without a token", "", "", http.StatusOK},
+		{"Token accepted", "secret", "Bearer secret", http.StatusOK},
+		{"Missing token rejected", "secret", "", http.StatusUnauthorized},
+		{"Wrong token rejected", "secret", "Bearer nope", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			Handler(tt.token).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if rr.Code == http.StatusOK && !strings.Contains(rr.Body.String(), `mediacloset_cache_requests_total{cache="sessions",result="hit"}`) {
+				t.Errorf("Expected cache metrics in the exposition")
+			}
+		})
+	}
+}
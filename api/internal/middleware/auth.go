@@ -1,19 +1,47 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
+
+	"mediacloset/api/internal/services"
 )
 
-// APIKeyAuth validates the X-API-Key header against the configured API key.
+// operationalPaths are called by load balancers, orchestrators and
+// Prometheus, which have neither a client key nor a user
+var operationalPaths = map[string]bool{
+	"/health":  true,
+	"/livez":   true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// APIKeyAuth validates the X-API-Key header against the active client keys.
 // This provides client authentication to prevent unauthorized access and DDoS attacks.
+// The matching key's ID is added to the request log line.
 // In development mode, authentication is skipped for the GraphQL playground only.
-func APIKeyAuth(apiKey string, isDevelopment bool) func(http.Handler) http.Handler {
+// localUploads is set when the local storage backend serves /uploads/.
+func APIKeyAuth(clientKeys *services.ClientKeyService, isDevelopment, localUploads bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Allow health check without authentication
-			if r.URL.Path == "/health" {
+			// Allow health checks and metrics scrapes without a client key;
+			// /metrics checks its own token
+			if operationalPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Locally stored images are public, and uploads are authorized by
+			// their signed URL (mirrors S3 presigned URLs)
+			if localUploads && strings.HasPrefix(r.URL.Path, services.LocalUploadsPath) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Pages opened from sign-in emails and the universal link
+			// association are fetched by browsers and iOS, not the app
+			if r.URL.Path == services.MagicLinkPath || strings.HasPrefix(r.URL.Path, "/.well-known/") {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -28,17 +56,19 @@ func APIKeyAuth(apiKey string, isDevelopment bool) func(http.Handler) http.Handl
 			// Get API key from header
 			providedKey := r.Header.Get("X-API-Key")
 			if providedKey == "" {
-				log.Printf("[API Key Auth] Missing X-API-Key header for %s %s", r.Method, r.URL.Path)
+				slog.InfoContext(r.Context(), "Missing X-API-Key header")
 				http.Error(w, `{"error":"Missing X-API-Key header"}`, http.StatusUnauthorized)
 				return
 			}
 
 			// Validate API key
-			if !strings.EqualFold(providedKey, apiKey) {
-				log.Printf("[API Key Auth] Invalid API key for %s %s", r.Method, r.URL.Path)
+			clientKey := clientKeys.Verify(r.Context(), providedKey)
+			if clientKey == nil {
+				slog.InfoContext(r.Context(), "Invalid API key")
 				http.Error(w, `{"error":"Invalid API key"}`, http.StatusUnauthorized)
 				return
 			}
+			SetLogClientKey(r, clientKey.ID)
 
 			// API key is valid, continue
 			next.ServeHTTP(w, r)
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"mediacloset/api/internal/services"
 )
 
 func TestAPIKeyAuth(t *testing.T) {
@@ -16,7 +18,7 @@ func TestAPIKeyAuth(t *testing.T) {
 	})
 
 	// Wrap with auth middleware (production mode - isDevelopment=false)
-	authMiddleware := APIKeyAuth(apiKey, false)
+	authMiddleware := APIKeyAuth(services.NewClientKeyService(nil, apiKey), false, true)
 	handler := authMiddleware(testHandler)
 
 	tests := []struct {
@@ -55,12 +57,47 @@ func TestAPIKeyAuth(t *testing.T) {
 			expectedBody:   "OK",
 		},
 		{
-			name:           "Case insensitive API key comparison",
-			path:           "/query",
-			apiKeyHeader:   "TEST-API-KEY-12345",
+			name:           "Readiness probe bypasses auth",
+			path:           "/readyz",
+			apiKeyHeader:   "",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "OK",
+		},
+		{
+			name:           "Metrics endpoint bypasses auth",
+			path:           "/metrics",
+			apiKeyHeader:   "",
 			expectedStatus: http.StatusOK,
 			expectedBody:   "OK",
 		},
+		{
+			name:           "Local uploads bypass auth",
+			path:           "/uploads/covers/user-1/cover.jpg",
+			apiKeyHeader:   "",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "OK",
+		},
+		{
+			name:           "Magic link page bypasses auth",
+			path:           "/auth/magic?token=abc",
+			apiKeyHeader:   "",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "OK",
+		},
+		{
+			name:           "Universal link association bypasses auth",
+			path:           "/.well-known/apple-app-site-association",
+			apiKeyHeader:   "",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "OK",
+		},
+		{
+			name:           "API key comparison is case sensitive",
+			path:           "/query",
+			apiKeyHeader:   "TEST-API-KEY-12345",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "{\"error\":\"Invalid API key\"}\n",
+		},
 	}
 
 	for _, tt := range tests {
@@ -84,6 +121,22 @@ func TestAPIKeyAuth(t *testing.T) {
 	}
 }
 
+func TestAPIKeyAuthWithoutLocalUploads(t *testing.T) {
+	handler := APIKeyAuth(services.NewClientKeyService(nil, "test-api-key"), false, false)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/uploads/covers/user-1/cover.jpg", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected uploads to need a key without local storage, got %d", rr.Code)
+	}
+}
+
 func TestAPIKeyAuthDevelopmentMode(t *testing.T) {
 	apiKey := "test-api-key-12345"
 
@@ -94,7 +147,7 @@ func TestAPIKeyAuthDevelopmentMode(t *testing.T) {
 	})
 
 	// Wrap with auth middleware (development mode - isDevelopment=true)
-	authMiddleware := APIKeyAuth(apiKey, true)
+	authMiddleware := APIKeyAuth(services.NewClientKeyService(nil, apiKey), true, false)
 	handler := authMiddleware(testHandler)
 
 	tests := []struct {
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// MaxBodySize rejects request bodies larger than limit bytes. Requests that
+// declare a larger Content-Length get 413 straight away; streamed bodies
+// fail to read once they pass the limit.
+func MaxBodySize(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				slog.InfoContext(r.Context(), "Request body too large", "bytes", r.ContentLength, "limit", limit)
+				http.Error(w, `{"error":"Request body too large"}`, http.StatusRequestEntityTooLarge)
+				return
+			}
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
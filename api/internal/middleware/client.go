@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DeviceNameHeader lets apps name the device a session belongs to
+// (e.g. "Sam's iPhone") so it can be recognized in the sessions list
+const DeviceNameHeader = "X-Device-Name"
+
+// maxClientFieldLength bounds client-supplied values stored with a session
+const maxClientFieldLength = 200
+
+// clientInfoKey is the context key for ClientInfo
+type clientInfoKey struct{}
+
+// ClientInfo describes the device a request came from
+type ClientInfo struct {
+	IPAddress  string
+	UserAgent  string
+	DeviceName string
+}
+
+// ClientInfoMiddleware records the caller's IP address, user agent, and
+// device name. Run it after RealIP so proxies are accounted for.
+func ClientInfoMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+
+		ctx := context.WithValue(r.Context(), clientInfoKey{}, ClientInfo{
+			IPAddress:  ip,
+			UserAgent:  truncate(r.UserAgent()),
+			DeviceName: truncate(strings.TrimSpace(r.Header.Get(DeviceNameHeader))),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// GetClientInfo returns the request's client info, or an empty value when
+// the middleware did not run
+func GetClientInfo(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
+
+func truncate(s string) string {
+	if len(s) > maxClientFieldLength {
+		return strings.ToValidUTF8(s[:maxClientFieldLength], "")
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientInfoMiddleware(t *testing.T) {
+	var got ClientInfo
+	handler := ClientInfoMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetClientInfo(r.Context())
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		userAgent  string
+		deviceName string
+		expected   ClientInfo
+	}{
+		{
+			name:       "IPv4 with port",
+			remoteAddr: "203.0.113.7:51234",
+			userAgent:  "MediaCloset/2.1 iOS/18.0",
+			deviceName: "  Sam's iPhone ",
+			expected:   ClientInfo{IPAddress: "203.0.113.7", UserAgent: "MediaCloset/2.1 iOS/18.0", DeviceName: "Sam's iPhone"},
+		},
+		{
+			name:       "IPv6 with port",
+			remoteAddr: "[2001:db8::1]:443",
+			expected:   ClientInfo{IPAddress: "2001:db8::1"},
+		},
+		{
+			name:       "address without port (set by RealIP)",
+			remoteAddr: "198.51.100.4",
+			expected:   ClientInfo{IPAddress: "198.51.100.4"},
+		},
+		{
+			name:       "long device name is truncated",
+			remoteAddr: "198.51.100.4",
+			deviceName: strings.Repeat("x", 500),
+			expected:   ClientInfo{IPAddress: "198.51.100.4", DeviceName: strings.Repeat("x", maxClientFieldLength)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/query", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("User-Agent", tt.userAgent)
+			if tt.deviceName != "" {
+				req.Header.Set(DeviceNameHeader, tt.deviceName)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
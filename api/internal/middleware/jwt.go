@@ -2,30 +2,63 @@ package middleware
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"mediacloset/api/internal/logging"
 	"mediacloset/api/internal/services"
 )
 
 // UserContextKey is the key used to store user info in the request context
 type UserContextKey struct{}
 
-// UserInfo contains user information from the JWT token
+// UserInfo contains user information from the JWT token or personal access token
 type UserInfo struct {
-	UserID string
-	Email  string
+	UserID    string
+	Email     string
+	Role      services.Role
+	SessionID string // empty for tokens issued before sessions existed
+
+	// Scopes is set only for personal access tokens; JWTs carry the full
+	// access of the user's role
+	Scopes []services.Scope
+}
+
+// IsAccessToken reports whether the caller used a personal access token
+func (u *UserInfo) IsAccessToken() bool {
+	return u.Scopes != nil
+}
+
+// HasScope reports whether the caller may act within scope
+func (u *UserInfo) HasScope(scope services.Scope) bool {
+	if !u.IsAccessToken() {
+		return true
+	}
+	for _, s := range u.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
-// JWTAuth validates JWT tokens and extracts user information (if present)
+// JWTAuth validates JWT tokens and personal access tokens and extracts user
+// information (if present)
 // This middleware is permissive - it doesn't require auth, but extracts it if provided
 // Individual resolvers will enforce authentication as needed
 func JWTAuth(authService *services.AuthService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Allow health check without authentication
-			if r.URL.Path == "/health" {
+			// Allow health checks without authentication, and don't mistake
+			// the metrics scrape token for a user token
+			if operationalPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Sign-in links carry a magic-link token, not an access token
+			if r.URL.Path == services.MagicLinkPath {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -56,20 +89,43 @@ func JWTAuth(authService *services.AuthService) func(http.Handler) http.Handler
 				tokenString = strings.TrimPrefix(authHeader, "Bearer ")
 			}
 
+			// Personal access tokens are recognised by their prefix
+			if strings.HasPrefix(tokenString, services.PersonalAccessTokenPrefix) {
+				user, token, err := authService.ValidatePersonalAccessToken(r.Context(), tokenString)
+				if err != nil {
+					slog.InfoContext(r.Context(), "Invalid personal access token", "error", err)
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), UserContextKey{}, UserInfo{
+					UserID: user.ID,
+					Email:  user.Email,
+					Role:   user.Role,
+					Scopes: token.Scopes,
+				})
+				logging.AddFields(ctx, slog.String("user_id", user.ID), slog.String("token_id", token.ID))
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			// Validate token
-			userID, email, err := authService.ValidateToken(tokenString)
+			claims, err := authService.ValidateToken(r.Context(), tokenString)
 			if err != nil {
 				// Invalid token, but continue anyway - resolver will handle auth errors
-				log.Printf("[JWT Auth] Invalid token for %s %s: %v", r.Method, r.URL.Path, err)
+				slog.InfoContext(r.Context(), "Invalid access token", "error", err)
 				next.ServeHTTP(w, r)
 				return
 			}
 
 			// Add user info to context
 			ctx := context.WithValue(r.Context(), UserContextKey{}, UserInfo{
-				UserID: userID,
-				Email:  email,
+				UserID:    claims.UserID,
+				Email:     claims.Email,
+				Role:      claims.Role,
+				SessionID: claims.ID,
 			})
+			logging.AddFields(ctx, slog.String("user_id", claims.UserID), slog.String("session_id", claims.ID))
 
 			// Continue with authenticated request
 			next.ServeHTTP(w, r.WithContext(ctx))
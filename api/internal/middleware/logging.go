@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"mediacloset/api/internal/logging"
+)
+
+// RequestLogger logs each finished request as a structured record. It also
+// gives the request its log fields, so everything logged while handling it
+// shares the request ID, client key, user, and GraphQL operation. Run it
+// after chi's RequestID and ClientInfoMiddleware.
+func RequestLogger() func(http.Handler) http.Handler {
+	return requestLogger(nil)
+}
+
+// requestLogger logs to logger, or to the slog default when it is nil
+func requestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := logging.WithFields(r.Context())
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				level := slog.LevelInfo
+				if status >= http.StatusInternalServerError {
+					level = slog.LevelError
+				}
+
+				l := logger
+				if l == nil {
+					l = slog.Default()
+				}
+				l.LogAttrs(ctx, level, "request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Int("status", status),
+					slog.Int("bytes", ww.BytesWritten()),
+					slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+					slog.String("ip", GetClientInfo(ctx).IPAddress),
+				)
+			}()
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+		})
+	}
+}
+
+// SetLogClientKey records which client key made the request
+func SetLogClientKey(r *http.Request, keyID string) {
+	logging.AddFields(r.Context(), slog.String("client_key", keyID))
+}
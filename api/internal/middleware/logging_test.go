@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"mediacloset/api/internal/logging"
+	"mediacloset/api/internal/services"
+)
+
+func TestRequestLogger_ClientKey(t *testing.T) {
+	var buf bytes.Buffer
+	logger := requestLogger(logging.New(&buf, "info", "json"))
+	handler := middleware.RequestID(logger(APIKeyAuth(services.NewClientKeyService(nil, "test-api-key"), false, false)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)))
+
+	tests := []struct {
+		name      string
+		apiKey    string
+		expectKey bool
+	}{
+		{name: "valid key is logged", apiKey: "test-api-key", expectKey: true},
+		{name: "invalid key", apiKey: "wrong-key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest("POST", "/query", nil)
+			req.Header.Set("X-API-Key", tt.apiKey)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var record map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("expected a JSON request record, got %q", buf.String())
+			}
+			if record["msg"] != "request" || record["method"] != "POST" || record["request_id"] == nil {
+				t.Errorf("expected a request record with method and request ID, got %v", record)
+			}
+			if got := record["client_key"] == services.LegacyClientKeyID; got != tt.expectKey {
+				t.Errorf("expected key logged=%v, got %v", tt.expectKey, record)
+			}
+		})
+	}
+}
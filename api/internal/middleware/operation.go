@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// maxClassifiedBody is how much of a GraphQL request is read to find its
+// operation unless the rate limiter is given the /query body limit. Larger
+// requests get the strictest budget, so padding a query can't move it to a
+// more generous one.
+const maxClassifiedBody = 1 << 20
+
+// operationClasses maps GraphQL root fields to their budget. Fields not
+// listed use ClassDefault.
+var operationClasses = map[string]OperationClass{
+	"requestLoginCode":   ClassLogin,
+	"verifyLoginCode":    ClassLogin,
+	"requestMagicLink":   ClassLogin,
+	"verifyMagicLink":    ClassLogin,
+	"refreshToken":       ClassLogin,
+	"beginPasskeyLogin":  ClassLogin,
+	"finishPasskeyLogin": ClassLogin,
+	"requestEmailChange": ClassLogin,
+	"confirmEmailChange": ClassLogin,
+
+	"movieByTitle":             ClassLookup,
+	"movieByBarcode":           ClassLookup,
+	"albumByArtistAndTitle":    ClassLookup,
+	"albumByBarcode":           ClassLookup,
+	"cassetteByArtistAndTitle": ClassLookup,
+	"cassetteByBarcode":        ClassLookup,
+	"itemsByCover":             ClassLookup,
+	"findDuplicates":           ClassLookup,
+
+	"movies":                 ClassList,
+	"albums":                 ClassList,
+	"catalogMovies":          ClassList,
+	"catalogAlbums":          ClassList,
+	"catalogCassettes":       ClassList,
+	"users":                  ClassList,
+	"userMovies":             ClassList,
+	"userAlbums":             ClassList,
+	"userCassettes":          ClassList,
+	"userMoviesPaginated":    ClassList,
+	"userAlbumsPaginated":    ClassList,
+	"userCassettesPaginated": ClassList,
+	"exportAccountData":      ClassList,
+}
+
+// classStrictness orders classes from the smallest budget to the largest;
+// an operation touching several classes is charged to the strictest
+var classStrictness = []OperationClass{ClassLogin, ClassLookup, ClassList, ClassDefault}
+
+// classifyGraphQLRequest finds the operation class of a GraphQL request,
+// reading at most limit bytes and leaving the body readable for the handler
+func classifyGraphQLRequest(r *http.Request, limit int64) OperationClass {
+	var params struct {
+		Query         string `json:"query"`
+		OperationName string `json:"operationName"`
+	}
+
+	if r.Method == http.MethodGet {
+		params.Query = r.URL.Query().Get("query")
+		params.OperationName = r.URL.Query().Get("operationName")
+	} else if r.Body != nil {
+		if r.ContentLength > limit {
+			return classStrictness[0]
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil {
+			return ClassDefault
+		}
+		if int64(len(body)) > limit {
+			return classStrictness[0]
+		}
+		if json.Unmarshal(body, &params) != nil {
+			return ClassDefault
+		}
+	}
+
+	// Unparseable queries are rejected by the handler without doing any work
+	doc, err := parser.ParseQuery(&ast.Source{Input: params.Query})
+	if err != nil {
+		return ClassDefault
+	}
+	op := doc.Operations.ForName(params.OperationName)
+	if op == nil {
+		return ClassDefault
+	}
+
+	found := map[OperationClass]bool{}
+	collectRootClasses(doc, op.SelectionSet, found, map[string]bool{})
+	for _, class := range classStrictness {
+		if found[class] {
+			return class
+		}
+	}
+	return ClassDefault
+}
+
+// collectRootClasses records the class of every root field, following
+// fragments (each at most once)
+func collectRootClasses(doc *ast.QueryDocument, set ast.SelectionSet, found map[OperationClass]bool, seen map[string]bool) {
+	for _, selection := range set {
+		switch s := selection.(type) {
+		case *ast.Field:
+			if class, ok := operationClasses[s.Name]; ok {
+				found[class] = true
+			}
+		case *ast.InlineFragment:
+			collectRootClasses(doc, s.SelectionSet, found, seen)
+		case *ast.FragmentSpread:
+			if seen[s.Name] {
+				continue
+			}
+			seen[s.Name] = true
+			if fragment := doc.Fragments.ForName(s.Name); fragment != nil {
+				collectRootClasses(doc, fragment.SelectionSet, found, seen)
+			}
+		}
+	}
+}
+
+// readCloser replays the part of a body already read, then the rest
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
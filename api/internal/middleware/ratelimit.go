@@ -1,94 +1,145 @@
 package middleware
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
 	"golang.org/x/time/rate"
+
+	"mediacloset/api/internal/metrics"
+	"mediacloset/api/internal/ratelimit"
 )
 
-// RateLimiter manages rate limits for API clients
+// OperationClass groups GraphQL root fields that share a rate limit budget
+type OperationClass string
+
+const (
+	ClassDefault OperationClass = "default"
+	ClassList    OperationClass = "list"   // Paginated and collection queries
+	ClassLookup  OperationClass = "lookup" // Metadata lookups that call external APIs
+	ClassLogin   OperationClass = "login"  // Sign-in and verification codes
+)
+
+// RateBudget allows Requests per Per on average, with bursts of up to Burst
+type RateBudget struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func (b RateBudget) limit() rate.Limit {
+	return rate.Limit(float64(b.Requests) / b.Per.Seconds())
+}
+
+// DefaultRateBudgets are the per-caller budgets for each operation class
+var DefaultRateBudgets = map[OperationClass]RateBudget{
+	ClassDefault: {Requests: 100, Per: time.Minute, Burst: 20},
+	ClassList:    {Requests: 60, Per: time.Minute, Burst: 20},
+	ClassLookup:  {Requests: 30, Per: time.Minute, Burst: 10},
+	ClassLogin:   {Requests: 10, Per: time.Minute, Burst: 5},
+}
+
+// RateLimiter enforces a token bucket per caller and operation class.
+// Callers are identified by user ID when signed in and by IP otherwise, so
+// apps sharing one client key no longer share a budget. Buckets live in a
+// ratelimit.Store; use a shared one to limit across replicas.
 type RateLimiter struct {
-	limiters map[string]*rate.Limiter
-	mu       sync.RWMutex
-	rate     rate.Limit
-	burst    int
+	budgets map[OperationClass]RateBudget
+	store   ratelimit.Store
+	maxBody int64
 }
 
-// NewRateLimiter creates a new rate limiter for API clients
-// Default: 100 requests per minute (burst of 20)
-func NewRateLimiter() *RateLimiter {
+// NewRateLimiter creates a rate limiter with DefaultRateBudgets
+func NewRateLimiter(store ratelimit.Store) *RateLimiter {
+	return NewRateLimiterWithBudgets(store, DefaultRateBudgets)
+}
+
+// NewRateLimiterWithBudgets creates a rate limiter with custom budgets.
+// Classes missing from budgets use the ClassDefault budget.
+func NewRateLimiterWithBudgets(store ratelimit.Store, budgets map[OperationClass]RateBudget) *RateLimiter {
 	return &RateLimiter{
-		limiters: make(map[string]*rate.Limiter),
-		rate:     rate.Limit(100.0 / 60.0), // 100 requests per minute
-		burst:    20,
+		budgets: budgets,
+		store:   store,
+		maxBody: maxClassifiedBody,
 	}
 }
 
-// getLimiter gets or creates a rate limiter for a specific API key
-func (rl *RateLimiter) getLimiter(apiKey string) *rate.Limiter {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// SetMaxBodySize caps how much of a GraphQL request is read to classify it.
+// Pass the /query body limit: the limiter runs first, and anything larger
+// is rejected by MaxBodySize anyway.
+func (rl *RateLimiter) SetMaxBodySize(limit int64) {
+	rl.maxBody = limit
+}
 
-	limiter, exists := rl.limiters[apiKey]
-	if !exists {
-		limiter = rate.NewLimiter(rl.rate, rl.burst)
-		rl.limiters[apiKey] = limiter
+func (rl *RateLimiter) budget(class OperationClass) RateBudget {
+	if budget, ok := rl.budgets[class]; ok {
+		return budget
 	}
-
-	return limiter
+	return rl.budgets[ClassDefault]
 }
 
-// Middleware returns a middleware that enforces rate limiting per API key
+// Middleware returns a middleware that enforces the budgets. Run it after
+// JWTAuth so signed-in callers are limited by user ID. Every limited
+// response carries RateLimit-Limit, RateLimit-Remaining, and RateLimit-Reset
+// headers; rejected requests also get Retry-After.
 func (rl *RateLimiter) Middleware() func(http.Handler) http.Handler {
-	// Start cleanup goroutine to remove old limiters
-	go rl.cleanup()
-
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Skip rate limiting for health check
-			if r.URL.Path == "/health" {
+			// Skip rate limiting for health checks and metrics scrapes
+			if operationalPaths[r.URL.Path] {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			// Get API key from header (should be set by auth middleware)
-			apiKey := r.Header.Get("X-API-Key")
-			if apiKey == "" {
-				// If no API key, allow request (auth middleware will handle it)
-				next.ServeHTTP(w, r)
-				return
+			class := ClassDefault
+			if r.URL.Path == "/query" {
+				class = classifyGraphQLRequest(r, rl.maxBody)
 			}
+			budget := rl.budget(class)
+			caller := rateLimitCaller(r)
+			result := rl.store.Take(r.Context(), "api:"+string(class)+":"+caller, budget.limit(), budget.Burst)
 
-			// Get limiter for this API key
-			limiter := rl.getLimiter(apiKey)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(budget.Requests))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(result.Remaining)))))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(secondsUntil(float64(budget.Burst)-result.Remaining, budget)))
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", budget.Requests, int(budget.Per.Seconds()), budget.Burst))
 
-			// Check if request is allowed
-			if !limiter.Allow() {
-				log.Printf("[RateLimit] Rate limit exceeded for API key ending in ...%s", apiKey[len(apiKey)-4:])
+			if !result.Allowed {
+				retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+				slog.InfoContext(r.Context(), "Rate limit exceeded", "class", string(class), "caller", caller)
+				metrics.RateLimitRejections.WithLabelValues(string(class)).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusTooManyRequests)
-				w.Write([]byte(`{"error":"Rate limit exceeded. Maximum 100 requests per minute."}`))
+				fmt.Fprintf(w, `{"error":"Rate limit exceeded. Try again in %ds."}`, retryAfter)
 				return
 			}
 
-			// Request is allowed
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// cleanup periodically removes unused limiters to prevent memory leaks
-func (rl *RateLimiter) cleanup() {
-	ticker := time.NewTicker(10 * time.Minute)
-	defer ticker.Stop()
+// rateLimitCaller identifies who a request counts against
+func rateLimitCaller(r *http.Request) string {
+	if user, ok := GetUserFromContext(r.Context()); ok {
+		return "user:" + user.UserID
+	}
+	ip := GetClientInfo(r.Context()).IPAddress
+	if ip == "" {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip
+}
 
-	for range ticker.C {
-		rl.mu.Lock()
-		// In a production system, you might track last access time
-		// For now, we keep all limiters (single-user app)
-		rl.mu.Unlock()
+// secondsUntil is how long the budget takes to refill tokens, rounded up
+func secondsUntil(tokens float64, budget RateBudget) int {
+	if tokens <= 0 {
+		return 0
 	}
+	return int(math.Ceil(tokens / float64(budget.limit())))
 }
@@ -1,12 +1,43 @@
 package middleware
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
-	"golang.org/x/time/rate"
+	"mediacloset/api/internal/ratelimit"
+)
+
+// testBudgets are small enough to exhaust in a few requests
+var testBudgets = map[OperationClass]RateBudget{
+	ClassDefault: {Requests: 60, Per: time.Minute, Burst: 2},
+	ClassLogin:   {Requests: 6, Per: time.Minute, Burst: 1},
+	ClassList:    {Requests: 600, Per: time.Minute, Burst: 1}, // Refills in 100ms
+}
+
+func newTestRateLimiter() *RateLimiter {
+	return NewRateLimiterWithBudgets(ratelimit.NewMemoryStore(), testBudgets)
+}
+
+// rateLimitRequest builds a /query request from ip, signed in as userID
+// when it is set
+func rateLimitRequest(ip, userID, body string) *http.Request {
+	req := httptest.NewRequest("POST", "/query", strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), clientInfoKey{}, ClientInfo{IPAddress: ip})
+	if userID != "" {
+		ctx = context.WithValue(ctx, UserContextKey{}, UserInfo{UserID: userID})
+	}
+	return req.WithContext(ctx)
+}
+
+const (
+	meQuery    = `{"query":"{ me { id } }"}`
+	listQuery  = `{"query":"{ catalogMovies { pageInfo { totalCount } } }"}`
+	loginQuery = `{"query":"mutation { requestLoginCode(email: \"a@example.com\") { success } }"}`
 )
 
 func TestRateLimiter(t *testing.T) {
@@ -16,158 +47,188 @@ func TestRateLimiter(t *testing.T) {
 		w.Write([]byte("OK"))
 	})
 
+	serve := func(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
 	t.Run("Health endpoint bypasses rate limiting", func(t *testing.T) {
-		rl := NewRateLimiter()
+		rl := newTestRateLimiter()
 		handler := rl.Middleware()(testHandler)
 
-		// Make many requests to /health
 		for i := 0; i < 30; i++ {
-			req := httptest.NewRequest("GET", "/health", nil)
-			rr := httptest.NewRecorder()
-			handler.ServeHTTP(rr, req)
-
-			if rr.Code != http.StatusOK {
+			if rr := serve(handler, httptest.NewRequest("GET", "/health", nil)); rr.Code != http.StatusOK {
 				t.Errorf("Request %d: Expected status 200, got %d", i, rr.Code)
 			}
 		}
 	})
 
-	t.Run("Rate limit enforced per API key", func(t *testing.T) {
-		// Create a custom rate limiter with very low limits for testing
-		rl := &RateLimiter{
-			limiters: make(map[string]*rate.Limiter),
-			rate:     rate.Limit(1.0), // 1 request per second
-			burst:    2,               // Allow burst of 2
-		}
-
+	t.Run("Rate limit enforced per user with headers", func(t *testing.T) {
+		rl := newTestRateLimiter()
 		handler := rl.Middleware()(testHandler)
-		apiKey := "test-key-123"
 
-		// First 2 requests should succeed (burst capacity)
 		for i := 0; i < 2; i++ {
-			req := httptest.NewRequest("GET", "/query", nil)
-			req.Header.Set("X-API-Key", apiKey)
-			rr := httptest.NewRecorder()
-			handler.ServeHTTP(rr, req)
-
+			rr := serve(handler, rateLimitRequest("10.0.0.1", "user-1", meQuery))
 			if rr.Code != http.StatusOK {
 				t.Errorf("Request %d: Expected status 200, got %d", i, rr.Code)
 			}
 		}
 
-		// Next request should be rate limited
-		req := httptest.NewRequest("GET", "/query", nil)
-		req.Header.Set("X-API-Key", apiKey)
-		rr := httptest.NewRecorder()
-		handler.ServeHTTP(rr, req)
-
+		rr := serve(handler, rateLimitRequest("10.0.0.1", "user-1", meQuery))
 		if rr.Code != http.StatusTooManyRequests {
-			t.Errorf("Expected status 429, got %d", rr.Code)
+			t.Fatalf("Expected status 429, got %d", rr.Code)
 		}
-
-		expectedBody := `{"error":"Rate limit exceeded. Maximum 100 requests per minute."}`
-		if rr.Body.String() != expectedBody {
-			t.Errorf("Expected body %q, got %q", expectedBody, rr.Body.String())
+		expectHeaders := map[string]string{
+			"RateLimit-Limit":     "60",
+			"RateLimit-Remaining": "0",
+			"RateLimit-Reset":     "2",
+			"RateLimit-Policy":    "60;w=60;burst=2",
+			"Retry-After":         "1",
 		}
-	})
-
-	t.Run("Different API keys have separate rate limits", func(t *testing.T) {
-		// Create a custom rate limiter with very low limits
-		rl := &RateLimiter{
-			limiters: make(map[string]*rate.Limiter),
-			rate:     rate.Limit(1.0), // 1 request per second
-			burst:    1,               // Allow burst of 1
+		for header, expected := range expectHeaders {
+			if got := rr.Header().Get(header); got != expected {
+				t.Errorf("Expected %s %q, got %q", header, expected, got)
+			}
+		}
+		if expected := `{"error":"Rate limit exceeded. Try again in 1s."}`; rr.Body.String() != expected {
+			t.Errorf("Expected body %q, got %q", expected, rr.Body.String())
 		}
+	})
 
+	t.Run("Users sharing an IP and API key have separate limits", func(t *testing.T) {
+		rl := newTestRateLimiter()
 		handler := rl.Middleware()(testHandler)
 
-		// First API key - use up burst
-		req1 := httptest.NewRequest("GET", "/query", nil)
-		req1.Header.Set("X-API-Key", "key-1")
-		rr1 := httptest.NewRecorder()
-		handler.ServeHTTP(rr1, req1)
-
-		if rr1.Code != http.StatusOK {
-			t.Errorf("Expected key-1 first request to succeed, got status %d", rr1.Code)
+		for i := 0; i < 2; i++ {
+			serve(handler, rateLimitRequest("10.0.0.1", "user-1", meQuery))
 		}
-
-		// Second API key should still have burst available
-		req2 := httptest.NewRequest("GET", "/query", nil)
-		req2.Header.Set("X-API-Key", "key-2")
-		rr2 := httptest.NewRecorder()
-		handler.ServeHTTP(rr2, req2)
-
-		if rr2.Code != http.StatusOK {
-			t.Errorf("Expected key-2 first request to succeed, got status %d", rr2.Code)
+		if rr := serve(handler, rateLimitRequest("10.0.0.1", "user-2", meQuery)); rr.Code != http.StatusOK {
+			t.Errorf("Expected user-2 to have its own budget, got status %d", rr.Code)
 		}
-
-		// First API key should now be rate limited
-		req3 := httptest.NewRequest("GET", "/query", nil)
-		req3.Header.Set("X-API-Key", "key-1")
-		rr3 := httptest.NewRecorder()
-		handler.ServeHTTP(rr3, req3)
-
-		if rr3.Code != http.StatusTooManyRequests {
-			t.Errorf("Expected key-1 second request to be rate limited, got status %d", rr3.Code)
+		if rr := serve(handler, rateLimitRequest("10.0.0.1", "", meQuery)); rr.Code != http.StatusOK {
+			t.Errorf("Expected an anonymous caller to be limited by IP, got status %d", rr.Code)
+		}
+		if rr := serve(handler, rateLimitRequest("10.0.0.1", "user-1", meQuery)); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected user-1 to be rate limited, got status %d", rr.Code)
 		}
 	})
 
-	t.Run("Rate limit allows request without API key", func(t *testing.T) {
-		rl := NewRateLimiter()
+	t.Run("Operations have separate budgets", func(t *testing.T) {
+		rl := newTestRateLimiter()
 		handler := rl.Middleware()(testHandler)
 
-		// Request without API key should pass through (auth middleware will handle it)
-		req := httptest.NewRequest("GET", "/query", nil)
-		rr := httptest.NewRecorder()
-		handler.ServeHTTP(rr, req)
+		if rr := serve(handler, rateLimitRequest("10.0.0.2", "", loginQuery)); rr.Code != http.StatusOK {
+			t.Fatalf("Expected first login request to succeed, got status %d", rr.Code)
+		}
+		rr := serve(handler, rateLimitRequest("10.0.0.2", "", loginQuery))
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected second login request to be rate limited, got status %d", rr.Code)
+		}
+		if got := rr.Header().Get("Retry-After"); got != "10" {
+			t.Errorf("Expected Retry-After 10 for the login budget, got %q", got)
+		}
 
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status 200, got %d", rr.Code)
+		// The handler still sees the whole body after classification
+		var body string
+		bodyHandler := rl.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b := new(strings.Builder)
+			if _, err := io.Copy(b, r.Body); err != nil {
+				t.Errorf("failed to read body: %v", err)
+			}
+			body = b.String()
+		}))
+		if rr := serve(bodyHandler, rateLimitRequest("10.0.0.2", "", meQuery)); rr.Code != http.StatusOK {
+			t.Errorf("Expected other operations to keep their budget, got status %d", rr.Code)
+		}
+		if body != meQuery {
+			t.Errorf("Expected the handler to read %q, got %q", meQuery, body)
 		}
 	})
 
 	t.Run("Rate limit refills over time", func(t *testing.T) {
-		// Create a custom rate limiter with quick refill for testing
-		rl := &RateLimiter{
-			limiters: make(map[string]*rate.Limiter),
-			rate:     rate.Limit(10.0), // 10 requests per second
-			burst:    1,                // Allow burst of 1
-		}
-
+		rl := newTestRateLimiter()
 		handler := rl.Middleware()(testHandler)
-		apiKey := "test-refill-key"
-
-		// First request succeeds
-		req1 := httptest.NewRequest("GET", "/query", nil)
-		req1.Header.Set("X-API-Key", apiKey)
-		rr1 := httptest.NewRecorder()
-		handler.ServeHTTP(rr1, req1)
-
-		if rr1.Code != http.StatusOK {
-			t.Errorf("First request: Expected status 200, got %d", rr1.Code)
-		}
-
-		// Second request immediately after should be rate limited
-		req2 := httptest.NewRequest("GET", "/query", nil)
-		req2.Header.Set("X-API-Key", apiKey)
-		rr2 := httptest.NewRecorder()
-		handler.ServeHTTP(rr2, req2)
 
-		if rr2.Code != http.StatusTooManyRequests {
-			t.Errorf("Second request: Expected status 429, got %d", rr2.Code)
+		serve(handler, rateLimitRequest("10.0.0.3", "", listQuery))
+		if rr := serve(handler, rateLimitRequest("10.0.0.3", "", listQuery)); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected second request to be rate limited, got status %d", rr.Code)
 		}
 
 		// Wait for token to refill (100ms at 10 req/sec)
 		time.Sleep(150 * time.Millisecond)
 
-		// Third request after wait should succeed
-		req3 := httptest.NewRequest("GET", "/query", nil)
-		req3.Header.Set("X-API-Key", apiKey)
-		rr3 := httptest.NewRecorder()
-		handler.ServeHTTP(rr3, req3)
+		if rr := serve(handler, rateLimitRequest("10.0.0.3", "", listQuery)); rr.Code != http.StatusOK {
+			t.Errorf("Expected request after refill to succeed, got status %d", rr.Code)
+		}
+	})
+}
+
+func TestClassifyGraphQLRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		expect OperationClass
+	}{
+		{name: "login mutation", method: "POST", body: loginQuery, expect: ClassLogin},
+		{name: "lookup query", method: "POST", body: `{"query":"{ albumByBarcode(barcode: \"1\") { album } }"}`, expect: ClassLookup},
+		{name: "list query", method: "POST", body: `{"query":"query { catalogMovies { pageInfo { totalCount } } }"}`, expect: ClassList},
+		{name: "unlisted field", method: "POST", body: meQuery, expect: ClassDefault},
+		{name: "strictest field wins", method: "POST", body: `{"query":"{ catalogMovies { pageInfo { totalCount } } movieByTitle(title: \"x\") { title } }"}`, expect: ClassLookup},
+		{name: "named operation", method: "POST", body: `{"query":"query A { me { id } } query B { users { pageInfo { totalCount } } }","operationName":"B"}`, expect: ClassList},
+		{name: "fragment", method: "POST", body: `{"query":"mutation { ...F } fragment F on Mutation { verifyLoginCode(email: \"a\", code: \"1\") { success } }"}`, expect: ClassLogin},
+		{name: "invalid query", method: "POST", body: `{"query":"{"}`, expect: ClassDefault},
+		{name: "oversized body", method: "POST", body: `{"query":"{ me { id } }` + strings.Repeat(" ", maxClassifiedBody) + `"}`, expect: ClassLogin},
+		{name: "GET query", method: "GET", expect: ClassLookup},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/query", strings.NewReader(tt.body))
+			if tt.method == "GET" {
+				req = httptest.NewRequest("GET", "/query?query=%7B+movieByBarcode%28barcode%3A+%221%22%29+%7B+title+%7D+%7D", nil)
+			}
+			if got := classifyGraphQLRequest(req, maxClassifiedBody); got != tt.expect {
+				t.Errorf("expected %s, got %s", tt.expect, got)
+			}
+		})
+	}
+
+	t.Run("reads no more than the body limit", func(t *testing.T) {
+		body := `{"query":"{ me { id } }"}` + strings.Repeat(" ", 1000)
+		for _, declared := range []bool{true, false} {
+			source := &countingReader{Reader: strings.NewReader(body)}
+			req := httptest.NewRequest("POST", "/query", source)
+			req.ContentLength = -1
+			if declared {
+				req.ContentLength = int64(len(body))
+			}
 
-		if rr3.Code != http.StatusOK {
-			t.Errorf("Third request after wait: Expected status 200, got %d", rr3.Code)
+			if got := classifyGraphQLRequest(req, 64); got != ClassLogin {
+				t.Errorf("expected %s for an oversized body, got %s", ClassLogin, got)
+			}
+			if declared && source.read != 0 {
+				t.Errorf("expected a declared oversized body to be left unread, read %d bytes", source.read)
+			}
+			if !declared && source.read > 65 {
+				t.Errorf("expected at most 65 bytes read, read %d", source.read)
+			}
+			if rest, _ := io.ReadAll(req.Body); string(rest) != body {
+				t.Error("expected the whole body to stay readable for the handler")
+			}
 		}
 	})
 }
+
+// countingReader records how many bytes have been read through it
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.read += n
+	return n, err
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fc00::/7"),
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		otherHeaders map[string]string
+		expectedAddr string
+	}{
+		{
+			name:         "direct client ignores forwarded headers",
+			remoteAddr:   "203.0.113.7:51234",
+			forwardedFor: []string{"198.51.100.1"},
+			otherHeaders: map[string]string{"X-Real-IP": "198.51.100.2", "True-Client-IP": "198.51.100.3"},
+			expectedAddr: "203.0.113.7",
+		},
+		{
+			name:         "trusted proxy uses the hop it appended",
+			remoteAddr:   "10.1.2.3:443",
+			forwardedFor: []string{"203.0.113.7"},
+			expectedAddr: "203.0.113.7",
+		},
+		{
+			name:         "client-written hops are skipped",
+			remoteAddr:   "10.1.2.3:443",
+			forwardedFor: []string{"198.51.100.1, 198.51.100.2", "203.0.113.7"},
+			expectedAddr: "203.0.113.7",
+		},
+		{
+			name:         "chained trusted proxies are walked past",
+			remoteAddr:   "10.1.2.3:443",
+			forwardedFor: []string{"198.51.100.1, 203.0.113.7, 10.9.9.9"},
+			expectedAddr: "203.0.113.7",
+		},
+		{
+			name:         "other headers are never used",
+			remoteAddr:   "10.1.2.3:443",
+			otherHeaders: map[string]string{"X-Real-IP": "198.51.100.2", "True-Client-IP": "198.51.100.3"},
+			expectedAddr: "10.1.2.3",
+		},
+		{
+			name:         "garbage hop stops the walk",
+			remoteAddr:   "10.1.2.3:443",
+			forwardedFor: []string{"198.51.100.1, not-an-ip"},
+			expectedAddr: "10.1.2.3",
+		},
+		{
+			name:         "hop with a port",
+			remoteAddr:   "[fd00::1]:443",
+			forwardedFor: []string{"203.0.113.7:9000"},
+			expectedAddr: "203.0.113.7",
+		},
+		{
+			name:         "no trusted proxies",
+			remoteAddr:   "10.1.2.3:443",
+			forwardedFor: []string{"203.0.113.7"},
+			expectedAddr: "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies := trusted
+			if tt.name == "no trusted proxies" {
+				proxies = nil
+			}
+
+			var got string
+			handler := RealIP(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/query", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			for key, value := range tt.otherHeaders {
+				req.Header.Set(key, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.expectedAddr {
+				t.Errorf("expected %s, got %s", tt.expectedAddr, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Package normalize reduces artist and title strings to a canonical form so
+// that spelling variants of the same release ("The Beatles" / "Beatles, The",
+// "Abbey Road (Remastered)", "Sigur Rós" / "Sigur Ros") compare equal.
+package normalize
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// keySeparator joins the parts of a catalog key; it never survives Name or Title
+const keySeparator = "|"
+
+// Letters that don't decompose into a base letter plus combining marks
+var foldReplacer = strings.NewReplacer(
+	"æ", "ae", "Æ", "ae",
+	"œ", "oe", "Œ", "oe",
+	"ø", "o", "Ø", "o",
+	"ß", "ss",
+	"ł", "l", "Ł", "l",
+	"đ", "d", "Đ", "d",
+	"þ", "th", "Þ", "th",
+	"ð", "d", "Ð", "d",
+)
+
+// editionWords mark a parenthetical or dash suffix as describing an edition
+// rather than the release itself
+const editionWords = `remaster(?:ed)?|deluxe|expanded|anniversary|edition|reissue|re-issue|bonus|mono|stereo|collector'?s|special|limited|widescreen|full ?screen|director'?s cut|unrated|extended`
+
+var (
+	// "(2009 Remaster)", "[Deluxe Edition]", "(Special Edition, Widescreen)"
+	editionParens = regexp.MustCompile(`\s*[(\[][^)\]]*\b(?:` + editionWords + `)\b[^)\]]*[)\]]`)
+	// "Abbey Road - Remastered 2019", "Rumours - Super Deluxe"
+	editionDash = regexp.MustCompile(`\s+[-–—]\s+[^-–—]*\b(?:` + editionWords + `)\b.*$`)
+	// "Beatles, The"
+	trailingArticle = regexp.MustCompile(`,\s*(?:the|a|an)$`)
+	leadingArticle  = regexp.MustCompile(`^(?:the|a|an)\s+`)
+	apostrophes     = strings.NewReplacer("'", "", "’", "", "‘", "", "`", "")
+)
+
+// Fold lowercases s and strips diacritics, so "Ágætis Byrjun" becomes "agaetis byrjun"
+func Fold(s string) string {
+	s = foldReplacer.Replace(s)
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return strings.ToLower(folded)
+}
+
+// Name normalizes an artist or director name: folded, articles moved or
+// dropped, "&" spelled out, and punctuation removed
+func Name(s string) string {
+	s = strings.TrimSpace(Fold(s))
+	s = trailingArticle.ReplaceAllString(s, "")
+	return clean(s)
+}
+
+// Title normalizes an album or movie title like Name and additionally drops
+// edition markers such as "(Remastered)" or "- Deluxe Edition"
+func Title(s string) string {
+	s = strings.TrimSpace(Fold(s))
+	s = editionParens.ReplaceAllString(s, "")
+	s = editionDash.ReplaceAllString(s, "")
+	s = trailingArticle.ReplaceAllString(s, "")
+	return clean(s)
+}
+
+// MovieKey is the stored lookup key for a movie. Director and year stay
+// separate columns because they are optional on both sides of a lookup.
+func MovieKey(title string) string {
+	return Title(title)
+}
+
+// AlbumKey is the stored lookup key for a record or cassette
+func AlbumKey(artist, album string) string {
+	return Name(artist) + keySeparator + Title(album)
+}
+
+// clean spells out "&", removes punctuation, collapses whitespace, and drops
+// a leading article
+func clean(s string) string {
+	s = strings.ReplaceAll(s, "&", " and ")
+	s = apostrophes.Replace(s)
+
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+
+	s = strings.Join(strings.Fields(b.String()), " ")
+	if stripped := leadingArticle.ReplaceAllString(s, ""); stripped != "" {
+		s = stripped
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+package normalize
+
+import "testing"
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"The Beatles", "beatles"},
+		{"Beatles, The", "beatles"},
+		{"  the   BEATLES ", "beatles"},
+		{"Sigur Rós", "sigur ros"},
+		{"Björk", "bjork"},
+		{"Mötley Crüe", "motley crue"},
+		{"Simon & Garfunkel", "simon and garfunkel"},
+		{"Simon and Garfunkel", "simon and garfunkel"},
+		{"Guns N' Roses", "guns n roses"},
+		{"AC/DC", "ac dc"},
+		{"The The", "the"},
+		{"A", "a"},
+		{"Røyksopp", "royksopp"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := Name(tt.input); got != tt.expected {
+				t.Errorf("Name(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTitle(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Abbey Road", "abbey road"},
+		{"Abbey Road (Remastered)", "abbey road"},
+		{"Abbey Road (2019 Remaster)", "abbey road"},
+		{"Abbey Road [Super Deluxe Edition]", "abbey road"},
+		{"Abbey Road - Remastered 2009", "abbey road"},
+		{"Rumours (Expanded Edition)", "rumours"},
+		{"Ágætis byrjun", "agaetis byrjun"},
+		{"Don't Look Back", "dont look back"},
+		{"Aliens (Special Edition) (Widescreen)", "aliens"},
+		{"Blade Runner - The Director's Cut", "blade runner"},
+		{"The Wall", "wall"},
+		{"Live at Leeds", "live at leeds"},
+		{"Kid A", "kid a"},
+		{"Pet Sounds (Mono)", "pet sounds"},
+		{"Sgt. Pepper's Lonely Hearts Club Band", "sgt peppers lonely hearts club band"},
+		{"Alive - Live at Wembley", "alive live at wembley"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := Title(tt.input); got != tt.expected {
+				t.Errorf("Title(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAlbumKey(t *testing.T) {
+	same := [][2]string{
+		{"The Beatles", "Abbey Road"},
+		{"Beatles, The", "Abbey Road (Remastered)"},
+		{"the beatles", "ABBEY ROAD - 2019 Remaster"},
+	}
+
+	expected := AlbumKey(same[0][0], same[0][1])
+	if expected != "beatles|abbey road" {
+		t.Fatalf("unexpected key %q", expected)
+	}
+	for _, pair := range same[1:] {
+		if got := AlbumKey(pair[0], pair[1]); got != expected {
+			t.Errorf("AlbumKey(%q, %q) = %q, expected %q", pair[0], pair[1], got, expected)
+		}
+	}
+
+	if AlbumKey("Radiohead", "Kid A") == AlbumKey("Radiohead", "Amnesiac") {
+		t.Error("expected different albums to have different keys")
+	}
+}
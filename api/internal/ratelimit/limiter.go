@@ -2,32 +2,143 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
+
+	"mediacloset/api/internal/metrics"
+	"mediacloset/api/internal/tracing"
+)
+
+// Provider names an external API the server calls
+type Provider string
+
+const (
+	ProviderMusicBrainz Provider = "musicbrainz"
+	ProviderDiscogs     Provider = "discogs"
+	ProviderOMDB        Provider = "omdb"
+	ProviderITunes      Provider = "itunes"
 )
 
-// ServiceLimiter manages rate limits for different external APIs
+// Providers lists every provider, in the order diagnostics report them
+var Providers = []Provider{ProviderMusicBrainz, ProviderDiscogs, ProviderOMDB, ProviderITunes}
+
+// ErrQuotaExhausted is returned once a provider's daily quota is used up
+var ErrQuotaExhausted = errors.New("daily quota exhausted")
+
+// ProviderLimit caps calls to a provider. Zero fields mean no limit.
+type ProviderLimit struct {
+	RequestsPerMinute int
+	DailyQuota        int // Requests per UTC day
+}
+
+// QuotaStatus is a provider's limits and today's usage
+type QuotaStatus struct {
+	Provider  Provider
+	Limit     ProviderLimit
+	UsedToday int
+	Remaining int // Requests left today, when the provider has a daily quota
+	ResetsAt  time.Time
+}
+
+// ServiceLimiter manages rate limits and daily quotas for external APIs.
+// Buckets and counters live in the store, so replicas sharing a store share
+// the budgets.
 type ServiceLimiter struct {
-	musicBrainz *rate.Limiter
+	store  Store
+	limits map[Provider]ProviderLimit
+	now    func() time.Time
 }
 
-// NewServiceLimiter creates a new rate limiter with appropriate limits for each service
-func NewServiceLimiter() *ServiceLimiter {
+// NewServiceLimiter creates a limiter enforcing limits, keeping its state in
+// store. Providers missing from limits are not limited.
+func NewServiceLimiter(store Store, limits map[Provider]ProviderLimit) *ServiceLimiter {
 	return &ServiceLimiter{
-		// MusicBrainz API allows 1 request per second
-		musicBrainz: rate.NewLimiter(rate.Every(1*time.Second), 1),
+		store:  store,
+		limits: limits,
+		now:    time.Now,
 	}
 }
 
-// WaitMusicBrainz blocks until the MusicBrainz rate limit allows a request
-// Returns an error if the context is canceled
-func (sl *ServiceLimiter) WaitMusicBrainz(ctx context.Context) error {
-	return sl.musicBrainz.Wait(ctx)
+// Wait counts a request towards provider's usage today and blocks until its
+// rate limit allows it. Returns ErrQuotaExhausted without waiting when the
+// quota is used up, or the context's error if it is canceled; neither is
+// counted. A nil limiter allows everything.
+func (sl *ServiceLimiter) Wait(ctx context.Context, provider Provider) error {
+	if sl == nil {
+		return nil
+	}
+	limit := sl.limits[provider]
+
+	// Counting first claims a slot atomically, so concurrent callers on any
+	// replica can't all pass the check before one of them counts
+	key, ttl := sl.quotaKey(provider)
+	used := sl.store.Add(ctx, key, 1, ttl)
+	if limit.DailyQuota > 0 && used > int64(limit.DailyQuota) {
+		sl.store.Add(ctx, key, -1, ttl)
+		return fmt.Errorf("%s: %w", provider, ErrQuotaExhausted)
+	}
+
+	if limit.RequestsPerMinute > 0 {
+		start := time.Now()
+		ctx, span := tracing.Start(ctx, "ratelimit wait "+string(provider), trace.SpanKindInternal,
+			attribute.String("provider", string(provider)),
+		)
+		defer func() {
+			metrics.ProviderLimiterWait.WithLabelValues(string(provider)).Observe(time.Since(start).Seconds())
+			span.End()
+		}()
+		perSecond := rate.Limit(float64(limit.RequestsPerMinute) / 60)
+		for {
+			result := sl.store.Take(ctx, "service:"+string(provider), perSecond, 1)
+			if result.Allowed {
+				break
+			}
+
+			timer := time.NewTimer(result.RetryAfter)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				sl.store.Add(context.WithoutCancel(ctx), key, -1, ttl)
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+
+	return nil
+}
+
+// Quotas reports every provider's limits and usage today
+func (sl *ServiceLimiter) Quotas(ctx context.Context) []QuotaStatus {
+	statuses := make([]QuotaStatus, 0, len(Providers))
+	for _, provider := range Providers {
+		limit := sl.limits[provider]
+		key, ttl := sl.quotaKey(provider)
+		used := int(sl.store.Add(ctx, key, 0, ttl))
+
+		status := QuotaStatus{
+			Provider:  provider,
+			Limit:     limit,
+			UsedToday: used,
+			ResetsAt:  sl.now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour),
+		}
+		if limit.DailyQuota > 0 {
+			status.Remaining = max(0, limit.DailyQuota-used)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
 }
 
-// AllowMusicBrainz checks if a MusicBrainz request can proceed without blocking
-// Returns true if allowed, false otherwise
-func (sl *ServiceLimiter) AllowMusicBrainz() bool {
-	return sl.musicBrainz.Allow()
+// quotaKey names today's counter for provider. It outlives the day by an
+// hour so a slow clock on one replica still finds it.
+func (sl *ServiceLimiter) quotaKey(provider Provider) (string, time.Duration) {
+	now := sl.now().UTC()
+	midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+	return "quota:" + string(provider) + ":" + now.Format("2006-01-02"), midnight.Sub(now) + time.Hour
 }
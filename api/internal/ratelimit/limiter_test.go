@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestServiceLimiter(limits map[Provider]ProviderLimit) *ServiceLimiter {
+	sl := NewServiceLimiter(NewMemoryStore(), limits)
+	sl.now = func() time.Time { return time.Date(2026, 3, 14, 22, 0, 0, 0, time.UTC) }
+	return sl
+}
+
+func TestServiceLimiterWait(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Throttles to requests per minute", func(t *testing.T) {
+		sl := newTestServiceLimiter(map[Provider]ProviderLimit{
+			ProviderMusicBrainz: {RequestsPerMinute: 60},
+		})
+
+		if err := sl.Wait(ctx, ProviderMusicBrainz); err != nil {
+			t.Fatalf("Expected first wait to return immediately, got %v", err)
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		if err := sl.Wait(waitCtx, ProviderMusicBrainz); err != context.DeadlineExceeded {
+			t.Errorf("Expected DeadlineExceeded while waiting, got %v", err)
+		}
+	})
+
+	t.Run("Stops at the daily quota", func(t *testing.T) {
+		sl := newTestServiceLimiter(map[Provider]ProviderLimit{
+			ProviderOMDB: {DailyQuota: 2},
+		})
+
+		for i := 0; i < 2; i++ {
+			if err := sl.Wait(ctx, ProviderOMDB); err != nil {
+				t.Fatalf("Expected request %d within quota, got %v", i+1, err)
+			}
+		}
+		if err := sl.Wait(ctx, ProviderOMDB); !errors.Is(err, ErrQuotaExhausted) {
+			t.Errorf("Expected ErrQuotaExhausted, got %v", err)
+		}
+
+		// Quotas are per provider
+		if err := sl.Wait(ctx, ProviderITunes); err != nil {
+			t.Errorf("Expected unlimited provider to be allowed, got %v", err)
+		}
+	})
+
+	t.Run("Concurrent callers stay within the quota", func(t *testing.T) {
+		sl := newTestServiceLimiter(map[Provider]ProviderLimit{
+			ProviderOMDB: {DailyQuota: 5},
+		})
+
+		var allowed atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if sl.Wait(ctx, ProviderOMDB) == nil {
+					allowed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if n := allowed.Load(); n != 5 {
+			t.Errorf("Expected 5 requests allowed, got %d", n)
+		}
+		key, ttl := sl.quotaKey(ProviderOMDB)
+		if used := sl.store.Add(ctx, key, 0, ttl); used != 5 {
+			t.Errorf("Expected refused requests not to count, got %d used", used)
+		}
+	})
+
+	t.Run("A canceled wait does not count", func(t *testing.T) {
+		sl := newTestServiceLimiter(map[Provider]ProviderLimit{
+			ProviderMusicBrainz: {RequestsPerMinute: 1, DailyQuota: 1},
+		})
+		sl.store.Take(ctx, "service:"+string(ProviderMusicBrainz), 1.0/60, 1)
+
+		waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := sl.Wait(waitCtx, ProviderMusicBrainz); err != context.DeadlineExceeded {
+			t.Fatalf("Expected DeadlineExceeded while waiting, got %v", err)
+		}
+		key, ttl := sl.quotaKey(ProviderMusicBrainz)
+		if used := sl.store.Add(ctx, key, 0, ttl); used != 0 {
+			t.Errorf("Expected the canceled wait to be rolled back, got %d used", used)
+		}
+	})
+
+	t.Run("Quota resets the next day", func(t *testing.T) {
+		sl := newTestServiceLimiter(map[Provider]ProviderLimit{
+			ProviderOMDB: {DailyQuota: 1},
+		})
+
+		sl.Wait(ctx, ProviderOMDB)
+		if err := sl.Wait(ctx, ProviderOMDB); !errors.Is(err, ErrQuotaExhausted) {
+			t.Fatalf("Expected ErrQuotaExhausted, got %v", err)
+		}
+
+		sl.now = func() time.Time { return time.Date(2026, 3, 15, 0, 0, 1, 0, time.UTC) }
+		if err := sl.Wait(ctx, ProviderOMDB); err != nil {
+			t.Errorf("Expected a new day's quota, got %v", err)
+		}
+	})
+
+	t.Run("Nil limiter allows everything", func(t *testing.T) {
+		var sl *ServiceLimiter
+		if err := sl.Wait(ctx, ProviderDiscogs); err != nil {
+			t.Errorf("Expected nil limiter to allow, got %v", err)
+		}
+	})
+}
+
+func TestServiceLimiterQuotas(t *testing.T) {
+	ctx := context.Background()
+	sl := newTestServiceLimiter(map[Provider]ProviderLimit{
+		ProviderDiscogs: {RequestsPerMinute: 600},
+		ProviderOMDB:    {DailyQuota: 1000},
+	})
+
+	for i := 0; i < 3; i++ {
+		sl.Wait(ctx, ProviderOMDB)
+	}
+	sl.Wait(ctx, ProviderDiscogs)
+
+	quotas := sl.Quotas(ctx)
+	if len(quotas) != len(Providers) {
+		t.Fatalf("Expected %d providers, got %d", len(Providers), len(quotas))
+	}
+
+	byProvider := make(map[Provider]QuotaStatus)
+	for _, q := range quotas {
+		byProvider[q.Provider] = q
+	}
+
+	omdb := byProvider[ProviderOMDB]
+	if omdb.UsedToday != 3 || omdb.Remaining != 997 {
+		t.Errorf("Expected OMDB 3 used, 997 remaining; got %d used, %d remaining", omdb.UsedToday, omdb.Remaining)
+	}
+	if want := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC); !omdb.ResetsAt.Equal(want) {
+		t.Errorf("Expected reset at %v, got %v", want, omdb.ResetsAt)
+	}
+
+	discogs := byProvider[ProviderDiscogs]
+	if discogs.UsedToday != 1 || discogs.Limit.RequestsPerMinute != 600 {
+		t.Errorf("Expected Discogs 1 used at 600/min, got %d used at %d/min", discogs.UsedToday, discogs.Limit.RequestsPerMinute)
+	}
+}
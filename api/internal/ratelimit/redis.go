@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+// redisKeyPrefix namespaces bucket keys in a shared Redis
+const redisKeyPrefix = "ratelimit:"
+
+// redisWarnInterval bounds how often an unreachable Redis is logged
+const redisWarnInterval = time.Minute
+
+// takeScript refills and takes from a bucket atomically. Redis's clock is
+// used so replicas with drifting clocks agree. Buckets expire once they
+// would be full again, so idle callers cost nothing.
+var takeScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) + tonumber(clock[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * limit)
+
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / limit * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// addScript increments a counter, starting its expiry when it is created
+var addScript = redis.NewScript(`
+local value = redis.call('INCRBY', KEYS[1], ARGV[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return value
+`)
+
+// RedisStore keeps buckets and counters in Redis (or anything speaking its protocol), so
+// every replica draws from the same budget. While Redis is unreachable it
+// falls back to per-process buckets rather than failing requests.
+type RedisStore struct {
+	client   redis.UniversalClient
+	fallback *MemoryStore
+
+	mu       sync.Mutex
+	lastWarn time.Time
+}
+
+// NewRedisStore creates a store backed by client
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{
+		client:   client,
+		fallback: NewMemoryStore(),
+	}
+}
+
+// NewRedisStoreFromURL connects to a redis:// or rediss:// URL and checks
+// the server is reachable
+func NewRedisStoreFromURL(ctx context.Context, redisURL string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return NewRedisStore(client), nil
+}
+
+// Take implements Store
+func (s *RedisStore) Take(ctx context.Context, key string, limit rate.Limit, burst int) Result {
+	reply, err := takeScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, float64(limit), burst).Slice()
+	if err == nil && len(reply) == 2 {
+		allowed, _ := reply[0].(int64)
+		remaining, _ := reply[1].(string)
+		result := Result{Allowed: allowed == 1}
+		result.Remaining, err = strconv.ParseFloat(remaining, 64)
+		if err == nil {
+			if !result.Allowed {
+				result.RetryAfter = refillTime(1-result.Remaining, limit)
+			}
+			return result
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("unexpected reply %v", reply)
+	}
+
+	s.warn(err)
+	return s.fallback.Take(ctx, key, limit, burst)
+}
+
+// Add implements Store
+func (s *RedisStore) Add(ctx context.Context, key string, n int64, ttl time.Duration) int64 {
+	value, err := addScript.Run(ctx, s.client, []string{redisKeyPrefix + key}, n, ttl.Milliseconds()).Int64()
+	if err != nil {
+		s.warn(err)
+		return s.fallback.Add(ctx, key, n, ttl)
+	}
+	return value
+}
+
+// Close closes the Redis connection
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisStore) warn(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.lastWarn) < redisWarnInterval {
+		return
+	}
+	s.lastWarn = time.Now()
+	slog.Warn("Redis unavailable, using per-instance rate limits", "error", err)
+}
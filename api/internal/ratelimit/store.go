@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"golang.org/x/time/rate"
+)
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Remaining  float64       // Tokens left in the bucket afterwards
+	RetryAfter time.Duration // Until the next token, when not allowed
+}
+
+// Store holds token buckets. Limiters sharing a Store share their budgets,
+// so a store every replica talks to gives cluster-wide limits.
+type Store interface {
+	// Take removes one token from the bucket named key, which refills at
+	// limit tokens per second up to burst
+	Take(ctx context.Context, key string, limit rate.Limit, burst int) Result
+
+	// Add adds n to the counter named key and returns its new total. A new
+	// counter expires after ttl; adding zero reads it.
+	Add(ctx context.Context, key string, n int64, ttl time.Duration) int64
+}
+
+const (
+	// memoryIdleTTL drops buckets unused for this long. It exceeds the time
+	// any bucket takes to refill, so eviction never resets one early.
+	memoryIdleTTL = 10 * time.Minute
+	memorySize    = 50000
+)
+
+// MemoryStore keeps buckets and counters in this process, evicting idle
+// buckets and expired counters
+type MemoryStore struct {
+	mu       sync.Mutex
+	limiters *expirable.LRU[string, *rate.Limiter]
+	counters map[string]counter
+	now      func() time.Time
+}
+
+type counter struct {
+	value   int64
+	expires time.Time
+}
+
+// NewMemoryStore creates an in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		limiters: expirable.NewLRU[string, *rate.Limiter](memorySize, nil, memoryIdleTTL),
+		counters: make(map[string]counter),
+		now:      time.Now,
+	}
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(ctx context.Context, key string, limit rate.Limit, burst int) Result {
+	limiter := s.limiter(key, limit, burst)
+
+	now := s.now()
+	allowed := limiter.AllowN(now, 1)
+	result := Result{Allowed: allowed, Remaining: limiter.TokensAt(now)}
+	if !allowed {
+		result.RetryAfter = refillTime(1-result.Remaining, limit)
+	}
+	return result
+}
+
+// Add implements Store
+func (s *MemoryStore) Add(ctx context.Context, key string, n int64, ttl time.Duration) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, c := range s.counters {
+		if !now.Before(c.expires) {
+			delete(s.counters, k)
+		}
+	}
+
+	c, ok := s.counters[key]
+	if !ok {
+		c.expires = now.Add(ttl)
+	}
+	c.value += n
+	s.counters[key] = c
+	return c.value
+}
+
+// limiter gets or creates the bucket for key. Re-adding it on every use
+// makes the cache TTL an idle timeout.
+func (s *MemoryStore) limiter(key string, limit rate.Limit, burst int) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limiter, ok := s.limiters.Get(key)
+	if !ok {
+		limiter = rate.NewLimiter(limit, burst)
+	}
+	s.limiters.Add(key, limiter)
+	return limiter
+}
+
+// refillTime is how long a bucket takes to gain tokens at limit
+func refillTime(tokens float64, limit rate.Limit) time.Duration {
+	if tokens <= 0 || limit <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / float64(limit) * float64(time.Second))
+}
@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+// storeClock advances the clock a store refills against
+type storeClock func(d time.Duration)
+
+func newTestMemoryStore() (Store, storeClock) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	return store, func(d time.Duration) { now = now.Add(d) }
+}
+
+func newTestRedisStore(t *testing.T) (Store, storeClock) {
+	m := miniredis.RunT(t)
+	now := time.Now()
+	m.SetTime(now)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStore(client), func(d time.Duration) {
+		now = now.Add(d)
+		m.SetTime(now)
+		m.FastForward(d)
+	}
+}
+
+func TestStores(t *testing.T) {
+	stores := []struct {
+		name  string
+		store func(t *testing.T) (Store, storeClock)
+	}{
+		{"memory", func(t *testing.T) (Store, storeClock) { return newTestMemoryStore() }},
+		{"redis", newTestRedisStore},
+	}
+
+	ctx := context.Background()
+	limit := rate.Limit(1) // 1 token per second
+
+	for _, tt := range stores {
+		t.Run(tt.name+"/Allows burst then rejects", func(t *testing.T) {
+			store, _ := tt.store(t)
+
+			for i := 0; i < 3; i++ {
+				result := store.Take(ctx, "k", limit, 3)
+				if !result.Allowed {
+					t.Fatalf("Expected request %d to be allowed", i+1)
+				}
+				if want := float64(2 - i); result.Remaining < want || result.Remaining >= want+0.5 {
+					t.Errorf("Expected about %v tokens remaining after request %d, got %v", want, i+1, result.Remaining)
+				}
+			}
+
+			result := store.Take(ctx, "k", limit, 3)
+			if result.Allowed {
+				t.Fatal("Expected request over burst to be rejected")
+			}
+			if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+				t.Errorf("Expected retry within a second, got %v", result.RetryAfter)
+			}
+		})
+
+		t.Run(tt.name+"/Refills over time", func(t *testing.T) {
+			store, advance := tt.store(t)
+
+			store.Take(ctx, "k", limit, 1)
+			if store.Take(ctx, "k", limit, 1).Allowed {
+				t.Fatal("Expected second request to be rejected")
+			}
+
+			advance(1100 * time.Millisecond)
+
+			if !store.Take(ctx, "k", limit, 1).Allowed {
+				t.Error("Expected request after refill to be allowed")
+			}
+		})
+
+		t.Run(tt.name+"/Counters add up and expire", func(t *testing.T) {
+			store, advance := tt.store(t)
+
+			store.Add(ctx, "c", 1, time.Minute)
+			store.Add(ctx, "c", 2, time.Minute)
+			if got := store.Add(ctx, "c", 0, time.Minute); got != 3 {
+				t.Errorf("Expected counter to be 3, got %d", got)
+			}
+
+			advance(61 * time.Second)
+
+			if got := store.Add(ctx, "c", 0, time.Minute); got != 0 {
+				t.Errorf("Expected expired counter to restart at 0, got %d", got)
+			}
+		})
+
+		t.Run(tt.name+"/Keys are independent", func(t *testing.T) {
+			store, _ := tt.store(t)
+
+			store.Take(ctx, "a", limit, 1)
+			if !store.Take(ctx, "b", limit, 1).Allowed {
+				t.Error("Expected a different key to have its own bucket")
+			}
+		})
+	}
+}
+
+func TestRedisStoreSharedAcrossInstances(t *testing.T) {
+	m := miniredis.RunT(t)
+	ctx := context.Background()
+
+	first := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	second := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer first.Close()
+	defer second.Close()
+
+	if !first.Take(ctx, "shared", 1, 1).Allowed {
+		t.Fatal("Expected first replica's request to be allowed")
+	}
+	if second.Take(ctx, "shared", 1, 1).Allowed {
+		t.Error("Expected second replica to see the bucket the first emptied")
+	}
+}
+
+func TestRedisStoreFallsBackWhenUnavailable(t *testing.T) {
+	m := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr(), MaxRetries: -1}))
+	defer store.Close()
+	m.Close()
+
+	ctx := context.Background()
+	if !store.Take(ctx, "k", 1, 1).Allowed {
+		t.Fatal("Expected request to be allowed by the in-memory fallback")
+	}
+	if store.Take(ctx, "k", 1, 1).Allowed {
+		t.Error("Expected the fallback to still enforce the limit")
+	}
+}
+
+func TestMemoryStoreStaysBounded(t *testing.T) {
+	store := NewMemoryStore()
+	store.limiters.Resize(1)
+	ctx := context.Background()
+
+	store.Take(ctx, "a", 1, 1)
+	store.Take(ctx, "b", 1, 1)
+
+	if store.limiters.Len() != 1 {
+		t.Errorf("Expected 1 cached bucket, got %d", store.limiters.Len())
+	}
+}
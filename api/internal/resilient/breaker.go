@@ -0,0 +1,117 @@
+package resilient
+
+import (
+	"sync"
+	"time"
+)
+
+// State is a circuit breaker's position
+type State string
+
+const (
+	StateClosed   State = "closed"    // Requests flow normally
+	StateOpen     State = "open"      // Requests fail fast until the cooldown ends
+	StateHalfOpen State = "half_open" // One trial request decides whether to close
+)
+
+// Breaker stops calls to a provider after repeated failures, then lets a
+// single trial request through once the cooldown has passed
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int // Consecutive failures while closed
+	openedAt time.Time
+	trial    bool // A half-open trial request is in flight
+}
+
+// NewBreaker creates a breaker that opens after threshold consecutive
+// failures and stays open for cooldown
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     StateClosed,
+	}
+}
+
+// Allow reports whether a request may be sent. A true result must be
+// followed by Record or Cancel.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.trial = true
+	}
+	return true
+}
+
+// Record reports the outcome of a request Allow let through
+func (b *Breaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.trial = false
+		if failed {
+			b.open()
+		} else {
+			b.state = StateClosed
+			b.failures = 0
+		}
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == StateClosed && b.failures >= b.threshold {
+		b.open()
+	}
+}
+
+// Cancel reports that a request Allow let through was abandoned before it
+// had an outcome, such as when the caller went away
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen {
+		b.trial = false
+	}
+}
+
+// State returns the breaker's current position
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState()
+}
+
+// currentState is the state with an expired cooldown counted as half-open.
+// Callers must hold mu.
+func (b *Breaker) currentState() State {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) open() {
+	b.state = StateOpen
+	b.openedAt = b.now()
+	b.failures = 0
+}
@@ -0,0 +1,76 @@
+package resilient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(2, 30*time.Second)
+	b.now = func() time.Time { return now }
+
+	t.Run("Opens after consecutive failures", func(t *testing.T) {
+		b.Allow()
+		b.Record(true)
+		if b.State() != StateClosed {
+			t.Fatalf("Expected closed after one failure, got %s", b.State())
+		}
+		b.Allow()
+		b.Record(true)
+		if b.State() != StateOpen {
+			t.Fatalf("Expected open after two failures, got %s", b.State())
+		}
+		if b.Allow() {
+			t.Error("Expected open breaker to reject requests")
+		}
+	})
+
+	t.Run("Lets one trial through after the cooldown", func(t *testing.T) {
+		now = now.Add(31 * time.Second)
+		if b.State() != StateHalfOpen {
+			t.Fatalf("Expected half-open after cooldown, got %s", b.State())
+		}
+		if !b.Allow() {
+			t.Fatal("Expected trial request to be allowed")
+		}
+		if b.Allow() {
+			t.Error("Expected only one trial request at a time")
+		}
+	})
+
+	t.Run("Failed trial reopens", func(t *testing.T) {
+		b.Record(true)
+		if b.State() != StateOpen {
+			t.Fatalf("Expected open after failed trial, got %s", b.State())
+		}
+	})
+
+	t.Run("Canceled trial frees the slot", func(t *testing.T) {
+		now = now.Add(31 * time.Second)
+		b.Allow()
+		b.Cancel()
+		if !b.Allow() {
+			t.Error("Expected another trial after the first was canceled")
+		}
+	})
+
+	t.Run("Successful trial closes", func(t *testing.T) {
+		b.Record(false)
+		if b.State() != StateClosed {
+			t.Fatalf("Expected closed after successful trial, got %s", b.State())
+		}
+	})
+
+	t.Run("Success resets the failure count", func(t *testing.T) {
+		b.Allow()
+		b.Record(true)
+		b.Allow()
+		b.Record(false)
+		b.Allow()
+		b.Record(true)
+		if b.State() != StateClosed {
+			t.Errorf("Expected failures separated by a success to keep it closed, got %s", b.State())
+		}
+	})
+}
@@ -0,0 +1,390 @@
+// Package resilient wraps HTTP clients for external APIs with retries,
+// circuit breakers, and hedged requests.
+package resilient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"mediacloset/api/internal/metrics"
+	"mediacloset/api/internal/tracing"
+)
+
+// ErrCircuitOpen is returned without calling the provider while its
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Config tunes a Client. Zero values disable the matching behavior.
+type Config struct {
+	MaxRetries int           // Extra attempts after a failed GET
+	BaseDelay  time.Duration // First backoff; doubles each retry, jittered down by up to half
+	MaxDelay   time.Duration // Longest backoff, and longest Retry-After honored
+
+	// HedgeDelay sends a second copy of a GET still unanswered after this
+	// long and uses whichever answers first. Leave it off for providers with
+	// strict quotas, since every hedge spends from them.
+	HedgeDelay time.Duration
+
+	// BeforeAttempt runs before every request sent, retries and hedges
+	// included, typically to wait for the provider's rate limiter. An error
+	// ends the call without sending the request.
+	BeforeAttempt func(req *http.Request) error
+
+	FailureThreshold int           // Consecutive failures that open the breaker
+	Cooldown         time.Duration // How long the breaker stays open
+}
+
+// DefaultConfig suits most metadata APIs
+var DefaultConfig = Config{
+	MaxRetries:       2,
+	BaseDelay:        200 * time.Millisecond,
+	MaxDelay:         5 * time.Second,
+	FailureThreshold: 5,
+	Cooldown:         30 * time.Second,
+}
+
+// Client sends requests to one provider through its breaker, retrying
+// server errors and timeouts. Only GET and HEAD requests are retried or
+// hedged; anything else is sent once.
+type Client struct {
+	name    string
+	client  *http.Client
+	config  Config
+	breaker *Breaker
+	jitter  func(d time.Duration) time.Duration
+}
+
+// New creates a client for the provider called name and registers its
+// breaker for BreakerStates
+func New(name string, client *http.Client, config Config) *Client {
+	threshold := config.FailureThreshold
+	if threshold <= 0 {
+		threshold = 1 << 30 // Never opens
+	}
+	c := &Client{
+		name:    name,
+		client:  client,
+		config:  config,
+		breaker: NewBreaker(threshold, config.Cooldown),
+		// Waits between half and all of the backoff, so retries spread out
+		// but never come sooner than half of it
+		jitter: func(d time.Duration) time.Duration {
+			return d/2 + time.Duration(rand.Int64N(int64(d/2)+1))
+		},
+	}
+	register(c)
+	return c
+}
+
+// Breaker returns the client's circuit breaker
+func (c *Client) Breaker() *Breaker {
+	return c.breaker
+}
+
+// Do sends req like http.Client.Do. It fails fast with ErrCircuitOpen while
+// the breaker is open and retries 5xx, 429, and transport errors with
+// jittered exponential backoff, waiting for Retry-After when the provider
+// sends one.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.Allow() {
+			metrics.UpstreamRequests.WithLabelValues(c.name, "circuit_open").Inc()
+			return nil, fmt.Errorf("%s: %w", c.name, ErrCircuitOpen)
+		}
+		// Only after the breaker, so an outage doesn't queue or spend quota
+		if err := c.beforeAttempt(req); err != nil {
+			c.breaker.Cancel()
+			return nil, err
+		}
+
+		resp, err := c.attempt(req, attempt, idempotent)
+
+		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about the provider
+			c.breaker.Cancel()
+			return resp, err
+		}
+		c.breaker.Record(failed(resp, err))
+		if failed(resp, err) && c.breaker.State() == StateOpen {
+			slog.WarnContext(ctx, "Circuit breaker opened", "provider", c.name, "cooldown", c.config.Cooldown.String())
+		}
+
+		if !idempotent || attempt >= c.config.MaxRetries || !retryable(resp, err) {
+			return resp, err
+		}
+
+		delay := c.backoff(attempt)
+		if wait, ok := retryAfter(resp); ok {
+			if c.config.MaxDelay > 0 && wait > c.config.MaxDelay {
+				return resp, err
+			}
+			delay = wait
+		}
+		attrs := []any{"provider", c.name, "attempt", attempt + 1, "delay", delay.String()}
+		if resp != nil {
+			attrs = append(attrs, "status", resp.StatusCode)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			attrs = append(attrs, "error", err)
+		}
+		slog.WarnContext(ctx, "Retrying provider request", attrs...)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends req once (hedged if configured), recording a client span
+// and metrics. Trace context isn't forwarded: providers are third parties.
+func (c *Client) attempt(req *http.Request, attempt int, idempotent bool) (*http.Response, error) {
+	_, span := tracing.Start(req.Context(), req.Method+" "+c.name, trace.SpanKindClient,
+		attribute.String("provider", c.name),
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+		attribute.String("url.path", req.URL.Path),
+		attribute.Int("http.request.resend_count", attempt),
+	)
+	defer span.End()
+
+	var resp *http.Response
+	var err error
+	start := time.Now()
+	if idempotent && c.config.HedgeDelay > 0 {
+		resp, err = c.hedged(req)
+	} else {
+		resp, err = c.client.Do(req)
+	}
+	err = withoutQuery(err)
+
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+	metrics.ObserveUpstream(c.name, status, time.Since(start))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if failed(resp, err) {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, err
+}
+
+func (c *Client) beforeAttempt(req *http.Request) error {
+	if c.config.BeforeAttempt == nil {
+		return nil
+	}
+	return c.config.BeforeAttempt(req)
+}
+
+// withoutQuery drops the query string from the URL in a request error.
+// Providers take API keys there, and the error ends up in logs, spans and
+// sometimes responses.
+func withoutQuery(err error) error {
+	urlErr, ok := err.(*url.Error)
+	if !ok {
+		return err
+	}
+	u, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil || (u.RawQuery == "" && !u.ForceQuery) {
+		return err
+	}
+	u.RawQuery = ""
+	u.ForceQuery = false
+	return &url.Error{Op: urlErr.Op, URL: u.String(), Err: urlErr.Err}
+}
+
+// backoff is the jittered delay before retry number attempt+1
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.config.BaseDelay << attempt
+	if c.config.MaxDelay > 0 && (delay > c.config.MaxDelay || delay <= 0) {
+		delay = c.config.MaxDelay
+	}
+	return c.jitter(delay)
+}
+
+type attemptResult struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+// hedged sends req, and a copy of it if the first has not answered within
+// HedgeDelay. The first good answer wins and the other attempt is canceled.
+// The hedge goes through BeforeAttempt like any other request; Do already
+// ran it for the first.
+func (c *Client) hedged(req *http.Request) (*http.Response, error) {
+	results := make(chan attemptResult, 2)
+	var cancels []context.CancelFunc
+	launch := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			attemptReq := req.Clone(ctx)
+			if index > 0 {
+				if err := c.beforeAttempt(attemptReq); err != nil {
+					results <- attemptResult{index: index, err: err}
+					return
+				}
+			}
+			resp, err := c.client.Do(attemptReq)
+			results <- attemptResult{index: index, resp: resp, err: err}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(c.config.HedgeDelay)
+	defer timer.Stop()
+
+	pending := 1
+	var last *attemptResult
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) == 1 {
+				launch()
+				pending++
+			}
+			continue
+		case result := <-results:
+			pending--
+			if !failed(result.resp, result.err) || pending == 0 {
+				for i, cancel := range cancels {
+					if i != result.index {
+						cancel()
+					}
+				}
+				if last != nil {
+					discard(last.resp)
+				}
+				go drain(results, pending)
+				return keepAlive(result, cancels[result.index])
+			}
+			// Wait for the other attempt, keeping this answer in case it fails too
+			if last != nil {
+				discard(last.resp)
+			}
+			last = &result
+		}
+	}
+}
+
+// keepAlive ties an attempt's context to its response body, so reading the
+// body is not cut short and closing it releases the context
+func keepAlive(result attemptResult, cancel context.CancelFunc) (*http.Response, error) {
+	if result.resp == nil {
+		cancel()
+		return nil, result.err
+	}
+	result.resp.Body = &cancelOnClose{ReadCloser: result.resp.Body, cancel: cancel}
+	return result.resp, result.err
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// drain closes the responses of attempts that lost the race
+func drain(results <-chan attemptResult, pending int) {
+	for ; pending > 0; pending-- {
+		discard((<-results).resp)
+	}
+}
+
+func discard(resp *http.Response) {
+	if resp != nil {
+		resp.Body.Close()
+	}
+}
+
+// failed reports whether an outcome counts against the provider's health.
+// Client errors such as 404 mean the provider is working.
+func failed(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= 500
+}
+
+// retryable reports whether the same request might succeed later
+func retryable(resp *http.Response, err error) bool {
+	return failed(resp, err) || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(0, time.Until(date)), true
+	}
+	return 0, false
+}
+
+// BreakerStatus is one provider's breaker position
+type BreakerStatus struct {
+	Provider string
+	State    State
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Breaker)
+)
+
+func register(c *Client) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[c.name] = c.breaker
+}
+
+// BreakerStates reports the breaker of every client created with New, by
+// provider name
+func BreakerStates() []BreakerStatus {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	statuses := make([]BreakerStatus, 0, len(registry))
+	for name, breaker := range registry {
+		statuses = append(statuses, BreakerStatus{Provider: name, State: breaker.State()})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Provider < statuses[j].Provider })
+	return statuses
+}
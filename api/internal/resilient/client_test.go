@@ -0,0 +1,395 @@
+package resilient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var testConfig = Config{
+	MaxRetries:       2,
+	BaseDelay:        time.Millisecond,
+	MaxDelay:         50 * time.Millisecond,
+	FailureThreshold: 3,
+	Cooldown:         time.Minute,
+}
+
+// statusServer answers with statuses in order, repeating the last one
+func statusServer(t *testing.T, calls *int32, headers map[string]string, statuses ...int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(calls, 1))
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(statuses[min(n, len(statuses))-1])
+		w.Write([]byte("body"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func get(t *testing.T, c *Client, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Do(req)
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		statuses  []int
+		headers   map[string]string
+		wantCode  int
+		wantCalls int32
+	}{
+		{"Retries server errors", http.MethodGet, []int{503, 502, 200}, nil, 200, 3},
+		{"Gives up after MaxRetries", http.MethodGet, []int{500}, nil, 500, 3},
+		{"Retries 429", http.MethodGet, []int{429, 200}, nil, 200, 2},
+		{"Does not retry client errors", http.MethodGet, []int{404}, nil, 404, 1},
+		{"Does not retry POST", http.MethodPost, []int{503, 200}, nil, 503, 1},
+		{"Honors a short Retry-After", http.MethodGet, []int{429, 200}, map[string]string{"Retry-After": "0"}, 200, 2},
+		{"Returns when Retry-After is too long", http.MethodGet, []int{429, 200}, map[string]string{"Retry-After": "120"}, 429, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := statusServer(t, &calls, tt.headers, tt.statuses...)
+			c := New("test-retries", server.Client(), testConfig)
+
+			req, _ := http.NewRequest(tt.method, server.URL, strings.NewReader(""))
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, resp.StatusCode)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestClientBreaker(t *testing.T) {
+	t.Run("Fails fast once open", func(t *testing.T) {
+		var calls int32
+		server := statusServer(t, &calls, nil, 500)
+		config := testConfig
+		config.MaxRetries = 0
+		c := New("test-breaker", server.Client(), config)
+
+		for i := 0; i < 3; i++ {
+			resp, err := get(t, c, server.URL)
+			if err != nil {
+				t.Fatalf("Expected request %d to reach the server, got %v", i+1, err)
+			}
+			resp.Body.Close()
+		}
+
+		if _, err := get(t, c, server.URL); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("Expected ErrCircuitOpen, got %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("Expected 3 calls, got %d", calls)
+		}
+
+		var found bool
+		for _, status := range BreakerStates() {
+			if status.Provider == "test-breaker" {
+				found = true
+				if status.State != StateOpen {
+					t.Errorf("Expected reported state open, got %s", status.State)
+				}
+			}
+		}
+		if !found {
+			t.Error("Expected breaker to be reported by BreakerStates")
+		}
+	})
+
+	t.Run("Caller cancellation is not a failure", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer server.Close()
+		config := testConfig
+		config.FailureThreshold = 1
+		c := New("test-cancel", server.Client(), config)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if _, err := c.Do(req); err == nil {
+			t.Fatal("Expected an error after the caller canceled")
+		}
+
+		if state := c.Breaker().State(); state != StateClosed {
+			t.Errorf("Expected breaker to stay closed, got %s", state)
+		}
+	})
+}
+
+func TestClientHedging(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// The first copy stalls until it is canceled
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(2 * time.Second):
+			}
+		}
+		w.Write([]byte("hedged"))
+	}))
+	defer server.Close()
+
+	config := testConfig
+	config.HedgeDelay = 20 * time.Millisecond
+	c := New("test-hedge", server.Client(), config)
+
+	start := time.Now()
+	resp, err := get(t, c, server.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to read hedged response: %v", err)
+	}
+
+	if string(body) != "hedged" {
+		t.Errorf("Expected the hedged response, got %q", body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the hedge to answer quickly, took %v", elapsed)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls)
+	}
+}
+
+func TestClientBeforeAttempt(t *testing.T) {
+	t.Run("Runs before every retry", func(t *testing.T) {
+		var calls, takes int32
+		server := statusServer(t, &calls, nil, 503, 502, 200)
+		config := testConfig
+		config.BeforeAttempt = func(req *http.Request) error {
+			atomic.AddInt32(&takes, 1)
+			return nil
+		}
+		c := New("test-before-retries", server.Client(), config)
+
+		resp, err := get(t, c, server.URL)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		resp.Body.Close()
+
+		if calls != 3 || takes != 3 {
+			t.Errorf("Expected 3 calls and 3 limiter takes, got %d and %d", calls, takes)
+		}
+	})
+
+	t.Run("Runs before a hedge", func(t *testing.T) {
+		var calls, takes int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-r.Context().Done()
+				return
+			}
+			w.Write([]byte("hedged"))
+		}))
+		defer server.Close()
+		config := testConfig
+		config.HedgeDelay = 20 * time.Millisecond
+		config.BeforeAttempt = func(req *http.Request) error {
+			atomic.AddInt32(&takes, 1)
+			return nil
+		}
+		c := New("test-before-hedge", server.Client(), config)
+
+		resp, err := get(t, c, server.URL)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		resp.Body.Close()
+
+		if got := atomic.LoadInt32(&takes); got != 2 {
+			t.Errorf("Expected 2 limiter takes, got %d", got)
+		}
+	})
+
+	t.Run("Not run while the breaker is open", func(t *testing.T) {
+		var calls, takes int32
+		server := statusServer(t, &calls, nil, 500)
+		config := testConfig
+		config.MaxRetries = 0
+		config.FailureThreshold = 1
+		config.BeforeAttempt = func(req *http.Request) error {
+			atomic.AddInt32(&takes, 1)
+			return nil
+		}
+		c := New("test-before-open", server.Client(), config)
+
+		resp, err := get(t, c, server.URL)
+		if err != nil {
+			t.Fatalf("Expected the first request to reach the server, got %v", err)
+		}
+		resp.Body.Close()
+
+		if _, err := get(t, c, server.URL); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("Expected ErrCircuitOpen, got %v", err)
+		}
+		if takes != 1 {
+			t.Errorf("Expected no limiter take while open, got %d takes", takes)
+		}
+	})
+
+	t.Run("An error releases the half-open trial", func(t *testing.T) {
+		var calls int32
+		server := statusServer(t, &calls, nil, 200)
+		errQuota := errors.New("quota exhausted")
+		fail := true
+		config := testConfig
+		config.BeforeAttempt = func(req *http.Request) error {
+			if fail {
+				return errQuota
+			}
+			return nil
+		}
+		c := New("test-before-trial", server.Client(), config)
+		c.Breaker().state = StateHalfOpen
+
+		if _, err := get(t, c, server.URL); !errors.Is(err, errQuota) {
+			t.Fatalf("Expected the limiter error, got %v", err)
+		}
+		fail = false
+		resp, err := get(t, c, server.URL)
+		if err != nil {
+			t.Fatalf("Expected the trial slot to be free again, got %v", err)
+		}
+		resp.Body.Close()
+	})
+
+	t.Run("An error stops the retries", func(t *testing.T) {
+		var calls int32
+		server := statusServer(t, &calls, nil, 503)
+		errQuota := errors.New("quota exhausted")
+		var takes int32
+		config := testConfig
+		config.BeforeAttempt = func(req *http.Request) error {
+			if atomic.AddInt32(&takes, 1) > 1 {
+				return errQuota
+			}
+			return nil
+		}
+		c := New("test-before-error", server.Client(), config)
+
+		if _, err := get(t, c, server.URL); !errors.Is(err, errQuota) {
+			t.Errorf("Expected the limiter error, got %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("Expected 1 call, got %d", calls)
+		}
+	})
+}
+
+func TestClientSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	var calls int32
+	server := statusServer(t, &calls, nil, http.StatusBadGateway, http.StatusOK)
+	c := New("test-spans", server.Client(), testConfig)
+	resp, err := get(t, c, server.URL+"/lookup?apikey=secret")
+	if err != nil {
+		t.Fatalf("Expected success, got %v", err)
+	}
+	resp.Body.Close()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected a span per attempt, got %d", len(spans))
+	}
+	for i, span := range spans {
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range span.Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		if span.Name() != "GET test-spans" || attrs["http.request.resend_count"].AsInt64() != int64(i) {
+			t.Errorf("Attempt %d: unexpected span %q with %v", i, span.Name(), attrs)
+		}
+		if attrs["url.path"].AsString() != "/lookup" {
+			t.Errorf("Attempt %d: expected path without query, got %q", i, attrs["url.path"].AsString())
+		}
+	}
+	if spans[0].Status().Code != codes.Error || spans[1].Status().Code == codes.Error {
+		t.Errorf("Expected only the 502 attempt marked failed, got %v and %v", spans[0].Status().Code, spans[1].Status().Code)
+	}
+}
+
+func TestClientErrorsHideQuery(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	client := server.Client()
+	client.Timeout = 20 * time.Millisecond
+	config := testConfig
+	config.MaxRetries = 0
+	c := New("test-query", client, config)
+
+	_, err := get(t, c, server.URL+"/lookup?apikey=hunter2")
+	if err == nil {
+		t.Fatal("Expected the request to time out")
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) || !urlErr.Timeout() {
+		t.Errorf("Expected a timeout *url.Error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "hunter2") || !strings.Contains(err.Error(), "/lookup") {
+		t.Errorf("Expected the error to keep the path but not the query, got %v", err)
+	}
+
+	for _, span := range recorder.Ended() {
+		if strings.Contains(span.Status().Description, "hunter2") {
+			t.Errorf("Expected the span status without the query, got %q", span.Status().Description)
+		}
+		for _, event := range span.Events() {
+			for _, kv := range event.Attributes {
+				if strings.Contains(kv.Value.Emit(), "hunter2") {
+					t.Errorf("Expected the recorded error without the query, got %s=%q", kv.Key, kv.Value.Emit())
+				}
+			}
+		}
+	}
+}
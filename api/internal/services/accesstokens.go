@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mediacloset/api/internal/metrics"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, so JWTAuth
+// can tell them from JWTs and secret scanners can spot leaked ones
+const PersonalAccessTokenPrefix = "mcp_"
+
+const maxAccessTokenNameLength = 100
+
+// Scope limits what a personal access token can do. Session tokens carry no
+// scopes and can do everything the user's role allows.
+type Scope string
+
+const (
+	// ScopeReadCollection reads the user's profile and collection
+	ScopeReadCollection Scope = "collection:read"
+	// ScopeWriteCollection adds, edits, and removes collection items
+	ScopeWriteCollection Scope = "collection:write"
+	// ScopeUploadImages requests cover image upload URLs
+	ScopeUploadImages Scope = "images:upload"
+)
+
+var validScopes = map[Scope]bool{
+	ScopeReadCollection:  true,
+	ScopeWriteCollection: true,
+	ScopeUploadImages:    true,
+}
+
+var ErrInvalidAccessToken = errors.New("invalid, expired, or revoked access token")
+
+// PersonalAccessToken is a long-lived credential a user creates for scripts
+// and integrations. Only a hash of the token itself is stored.
+type PersonalAccessToken struct {
+	ID         string
+	UserID     string
+	Name       string
+	Scopes     []Scope
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time // nil never expires
+	LastUsedAt *time.Time
+}
+
+// HasScope reports whether the token grants scope
+func (t *PersonalAccessToken) HasScope(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// accessTokenStatus is the cached result of a token lookup; a nil user means
+// the token was rejected
+type accessTokenStatus struct {
+	user  *User
+	token *PersonalAccessToken
+}
+
+// CreatePersonalAccessToken issues a token for the user. The token is
+// returned only here; afterwards it can be listed and revoked but not read.
+func (a *AuthService) CreatePersonalAccessToken(ctx context.Context, userID, name string, scopes []Scope, expiresAt *time.Time) (*PersonalAccessToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+	if len(name) > maxAccessTokenNameLength {
+		return nil, "", fmt.Errorf("name must be at most %d characters", maxAccessTokenNameLength)
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return nil, "", fmt.Errorf("unknown scope: %q", scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("expiry must be in the future")
+	}
+
+	secret, err := generateRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := PersonalAccessTokenPrefix + secret
+
+	object := map[string]interface{}{
+		"user_id":    userID,
+		"name":       name,
+		"token_hash": hashRefreshToken(token),
+		"scopes":     scopes,
+	}
+	if expiresAt != nil {
+		object["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+
+	query := `
+		mutation InsertPersonalAccessToken($object: personal_access_tokens_insert_input!) {
+			insert_personal_access_tokens_one(object: $object) {
+				id
+				user_id
+				name
+				scopes
+				created_at
+				expires_at
+				last_used_at
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "InsertPersonalAccessToken",
+		Variables: map[string]interface{}{
+			"object": object,
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to store access token: %w", err)
+	}
+
+	row, ok := resp.Data["insert_personal_access_tokens_one"].(map[string]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("failed to store access token: empty response")
+	}
+
+	return accessTokenFromMap(row), token, nil
+}
+
+// ListPersonalAccessTokens returns the user's unrevoked tokens, newest first
+func (a *AuthService) ListPersonalAccessTokens(ctx context.Context, userID string) ([]*PersonalAccessToken, error) {
+	query := `
+		query GetPersonalAccessTokens($user_id: uuid!) {
+			personal_access_tokens(
+				where: {user_id: {_eq: $user_id}, revoked_at: {_is_null: true}}
+				order_by: {created_at: desc}
+			) {
+				id
+				user_id
+				name
+				scopes
+				created_at
+				expires_at
+				last_used_at
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetPersonalAccessTokens",
+		Variables: map[string]interface{}{
+			"user_id": userID,
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	list, _ := resp.Data["personal_access_tokens"].([]interface{})
+	tokens := make([]*PersonalAccessToken, 0, len(list))
+	for _, entry := range list {
+		if row, ok := entry.(map[string]interface{}); ok {
+			tokens = append(tokens, accessTokenFromMap(row))
+		}
+	}
+	return tokens, nil
+}
+
+// RevokePersonalAccessToken revokes one of the user's tokens. It reports
+// false when the user has no such token.
+func (a *AuthService) RevokePersonalAccessToken(ctx context.Context, userID, tokenID string) (bool, error) {
+	query := `
+		mutation RevokePersonalAccessToken($id: uuid!, $user_id: uuid!, $now: timestamptz!) {
+			update_personal_access_tokens(
+				where: {id: {_eq: $id}, user_id: {_eq: $user_id}, revoked_at: {_is_null: true}}
+				_set: {revoked_at: $now}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "RevokePersonalAccessToken",
+		Variables: map[string]interface{}{
+			"id":      tokenID,
+			"user_id": userID,
+			"now":     time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	a.forgetAccessTokens(func(token *PersonalAccessToken) bool { return token.ID == tokenID })
+
+	return affectedRows(resp, "update_personal_access_tokens") == 1, nil
+}
+
+// revokeAllPersonalAccessTokens revokes every token the user holds and
+// returns how many were revoked
+func (a *AuthService) revokeAllPersonalAccessTokens(ctx context.Context, userID string) (int, error) {
+	query := `
+		mutation RevokeAllPersonalAccessTokens($user_id: uuid!, $now: timestamptz!) {
+			update_personal_access_tokens(
+				where: {user_id: {_eq: $user_id}, revoked_at: {_is_null: true}}
+				_set: {revoked_at: $now}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "RevokeAllPersonalAccessTokens",
+		Variables: map[string]interface{}{
+			"user_id": userID,
+			"now":     time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+
+	a.forgetAccessTokens(func(token *PersonalAccessToken) bool { return token.UserID == userID })
+
+	return affectedRows(resp, "update_personal_access_tokens"), nil
+}
+
+// forgetAccessTokens drops cached lookups of the matching tokens. Other
+// instances notice within sessionCacheTTL, like revoked sessions.
+func (a *AuthService) forgetAccessTokens(match func(*PersonalAccessToken) bool) {
+	for _, hash := range a.accessTokenCache.Keys() {
+		if status, ok := a.accessTokenCache.Peek(hash); ok && status.token != nil && match(status.token) {
+			a.accessTokenCache.Remove(hash)
+		}
+	}
+}
+
+// ValidatePersonalAccessToken returns the user and token behind a personal
+// access token. The user's current role applies, not the role at creation.
+// Lookups are cached like sessions, so a revoked token stops working on
+// every instance within sessionCacheTTL.
+func (a *AuthService) ValidatePersonalAccessToken(ctx context.Context, token string) (*User, *PersonalAccessToken, error) {
+	if !strings.HasPrefix(token, PersonalAccessTokenPrefix) {
+		return nil, nil, ErrInvalidAccessToken
+	}
+	hash := hashRefreshToken(token)
+
+	status, ok := a.accessTokenCache.Get(hash)
+	metrics.CacheLookup("access_tokens", ok)
+	if !ok {
+		var err error
+		status, err = a.useAccessToken(ctx, hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		a.accessTokenCache.Add(hash, status)
+	}
+
+	if status.user == nil {
+		return nil, nil, ErrInvalidAccessToken
+	}
+	if status.token.ExpiresAt != nil && time.Now().After(*status.token.ExpiresAt) {
+		return nil, nil, ErrInvalidAccessToken
+	}
+	return status.user, status.token, nil
+}
+
+// useAccessToken looks a token up by hash and records its use in one round trip
+func (a *AuthService) useAccessToken(ctx context.Context, hash string) (accessTokenStatus, error) {
+	query := `
+		mutation UsePersonalAccessToken($hash: String!, $now: timestamptz!) {
+			update_personal_access_tokens(
+				where: {token_hash: {_eq: $hash}, revoked_at: {_is_null: true}}
+				_set: {last_used_at: $now}
+			) {
+				returning {
+					id
+					user_id
+					name
+					scopes
+					created_at
+					expires_at
+					last_used_at
+					user {
+						id
+						email
+						is_public
+						role
+						created_at
+						updated_at
+					}
+				}
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "UsePersonalAccessToken",
+		Variables: map[string]interface{}{
+			"hash": hash,
+			"now":  time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return accessTokenStatus{}, fmt.Errorf("failed to check access token: %w", err)
+	}
+
+	result, _ := resp.Data["update_personal_access_tokens"].(map[string]interface{})
+	returning, _ := result["returning"].([]interface{})
+	if len(returning) != 1 {
+		return accessTokenStatus{}, nil
+	}
+	row, ok := returning[0].(map[string]interface{})
+	if !ok {
+		return accessTokenStatus{}, nil
+	}
+	userMap, ok := row["user"].(map[string]interface{})
+	if !ok {
+		return accessTokenStatus{}, nil
+	}
+
+	return accessTokenStatus{user: userFromMap(userMap), token: accessTokenFromMap(row)}, nil
+}
+
+func accessTokenFromMap(row map[string]interface{}) *PersonalAccessToken {
+	token := &PersonalAccessToken{}
+	token.ID, _ = row["id"].(string)
+	token.UserID, _ = row["user_id"].(string)
+	token.Name, _ = row["name"].(string)
+
+	// Never nil, so a token without scopes can't pass for a session token
+	token.Scopes = []Scope{}
+	scopes, _ := row["scopes"].([]interface{})
+	for _, scope := range scopes {
+		if s, ok := scope.(string); ok {
+			token.Scopes = append(token.Scopes, Scope(s))
+		}
+	}
+
+	if value, ok := row["created_at"].(string); ok {
+		token.CreatedAt, _ = time.Parse(time.RFC3339, value)
+	}
+	for key, field := range map[string]**time.Time{
+		"expires_at":   &token.ExpiresAt,
+		"last_used_at": &token.LastUsedAt,
+	} {
+		if value, ok := row[key].(string); ok {
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				*field = &t
+			}
+		}
+	}
+	return token
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAccessTokenHasura stores personal_access_tokens rows in memory
+type fakeAccessTokenHasura struct {
+	mu      sync.Mutex
+	rows    map[string]map[string]interface{} // by token_hash
+	lookups int
+}
+
+func (f *fakeAccessTokenHasura) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "InsertPersonalAccessToken":
+			row := req.Variables["object"].(map[string]interface{})
+			row["id"] = "t1"
+			row["created_at"] = "2024-01-01T00:00:00Z"
+			f.rows[row["token_hash"].(string)] = row
+			data["insert_personal_access_tokens_one"] = row
+		case "UsePersonalAccessToken":
+			f.lookups++
+			returning := []interface{}{}
+			if row, ok := f.rows[req.Variables["hash"].(string)]; ok && row["revoked_at"] == nil {
+				row["last_used_at"] = req.Variables["now"]
+				row["user"] = map[string]interface{}{"id": row["user_id"], "email": "a@example.com", "role": "read_only"}
+				returning = append(returning, row)
+			}
+			data["update_personal_access_tokens"] = map[string]interface{}{"returning": returning}
+		case "RevokePersonalAccessToken":
+			affected := 0
+			for _, row := range f.rows {
+				if row["id"] == req.Variables["id"] && row["user_id"] == req.Variables["user_id"] && row["revoked_at"] == nil {
+					row["revoked_at"] = req.Variables["now"]
+					affected++
+				}
+			}
+			data["update_personal_access_tokens"] = map[string]interface{}{"affected_rows": affected}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+}
+
+func newAccessTokenTestService(t *testing.T) (*AuthService, *fakeAccessTokenHasura) {
+	t.Helper()
+	fake := &fakeAccessTokenHasura{rows: map[string]map[string]interface{}{}}
+	server := httptest.NewServer(fake.handler(t))
+	t.Cleanup(server.Close)
+	return NewAuthService(NewHasuraClient(server.URL, ""), nil, "test-secret", true), fake
+}
+
+func TestAuthService_PersonalAccessTokens(t *testing.T) {
+	auth, fake := newAccessTokenTestService(t)
+	ctx := context.Background()
+
+	created, token, err := auth.CreatePersonalAccessToken(ctx, "u1", " shelf lights ", []Scope{ScopeReadCollection}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(token, PersonalAccessTokenPrefix) || created.Name != "shelf lights" {
+		t.Errorf("unexpected token %q, %+v", token, created)
+	}
+	for _, row := range fake.rows {
+		if strings.Contains(row["token_hash"].(string), token) {
+			t.Error("expected only a hash of the token to be stored")
+		}
+	}
+
+	user, validated, err := auth.ValidatePersonalAccessToken(ctx, token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.ID != "u1" || user.Role != RoleReadOnly {
+		t.Errorf("expected u1 with their current role, got %+v", user)
+	}
+	if !validated.HasScope(ScopeReadCollection) || validated.HasScope(ScopeWriteCollection) {
+		t.Errorf("unexpected scopes %v", validated.Scopes)
+	}
+
+	// Lookups are cached
+	auth.ValidatePersonalAccessToken(ctx, token)
+	if fake.lookups != 1 {
+		t.Errorf("expected one lookup, got %d", fake.lookups)
+	}
+
+	if revoked, err := auth.RevokePersonalAccessToken(ctx, "someone-else", created.ID); err != nil || revoked {
+		t.Errorf("expected another user's revoke to miss, got %v, %v", revoked, err)
+	}
+	if revoked, err := auth.RevokePersonalAccessToken(ctx, "u1", created.ID); err != nil || !revoked {
+		t.Fatalf("expected the token to be revoked, got %v, %v", revoked, err)
+	}
+	if _, _, err := auth.ValidatePersonalAccessToken(ctx, token); !errors.Is(err, ErrInvalidAccessToken) {
+		t.Errorf("expected a revoked token to be rejected, got %v", err)
+	}
+}
+
+func TestAuthService_PersonalAccessTokenExpiry(t *testing.T) {
+	auth, fake := newAccessTokenTestService(t)
+	ctx := context.Background()
+
+	expiresAt := time.Now().Add(time.Hour)
+	_, token, err := auth.CreatePersonalAccessToken(ctx, "u1", "ci", []Scope{ScopeUploadImages}, &expiresAt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := auth.ValidatePersonalAccessToken(ctx, token); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, row := range fake.rows {
+		row["expires_at"] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	}
+	auth.accessTokenCache.Purge()
+	if _, _, err := auth.ValidatePersonalAccessToken(ctx, token); !errors.Is(err, ErrInvalidAccessToken) {
+		t.Errorf("expected an expired token to be rejected, got %v", err)
+	}
+
+	for _, token := range []string{"mcp_unknown", "not-a-token"} {
+		if _, _, err := auth.ValidatePersonalAccessToken(ctx, token); !errors.Is(err, ErrInvalidAccessToken) {
+			t.Errorf("expected %q to be rejected, got %v", token, err)
+		}
+	}
+}
+
+func TestAuthService_CreatePersonalAccessTokenValidation(t *testing.T) {
+	auth, _ := newAccessTokenTestService(t)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		tokenName string
+		scopes    []Scope
+		expiresAt *time.Time
+		expectErr string
+	}{
+		{name: "empty name", tokenName: "  ", scopes: []Scope{ScopeReadCollection}, expectErr: "name is required"},
+		{name: "long name", tokenName: strings.Repeat("x", maxAccessTokenNameLength+1), scopes: []Scope{ScopeReadCollection}, expectErr: "at most"},
+		{name: "no scopes", tokenName: "ci", expectErr: "at least one scope"},
+		{name: "unknown scope", tokenName: "ci", scopes: []Scope{"admin"}, expectErr: "unknown scope"},
+		{name: "past expiry", tokenName: "ci", scopes: []Scope{ScopeReadCollection}, expiresAt: &past, expectErr: "in the future"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := auth.CreatePersonalAccessToken(context.Background(), "u1", tt.tokenName, tt.scopes, tt.expiresAt)
+			if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+				t.Errorf("expected error containing %q, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
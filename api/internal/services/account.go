@@ -0,0 +1,526 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"mediacloset/api/internal/logging"
+)
+
+const (
+	emailChangeExpiry      = 15 * time.Minute
+	maxEmailChangeAttempts = 5
+)
+
+var (
+	ErrEmailInUse             = errors.New("that email is already used by another account")
+	ErrInvalidEmailChangeCode = errors.New("invalid or expired email change codes")
+	ErrConfirmEmailMismatch   = errors.New("confirmation email does not match the account")
+)
+
+// AccountService lets users change their email, download their data, and
+// delete their account
+type AccountService struct {
+	hasuraClient *HasuraClient
+	auth         *AuthService
+	storage      ObjectStorage // nil when image storage is not configured
+	codeKey      []byte        // HMAC key for stored email change codes
+}
+
+// AccountDeletion summarizes what DeleteAccount removed
+type AccountDeletion struct {
+	ItemsUnlinked int // Links removed from user_vhs, user_records, and user_cassettes
+	CoversDeleted int // Uploaded objects removed under covers/{userID}/
+}
+
+// AccountExport is everything stored about a user, as returned by
+// ExportAccountData. Rows are kept as Hasura returns them; secrets such as
+// token hashes and passkey keys are never selected.
+type AccountExport struct {
+	ExportedAt           time.Time                   `json:"exportedAt"`
+	Profile              map[string]interface{}      `json:"profile"`
+	Collection           map[MediaKind][]interface{} `json:"collection"`
+	Sessions             []interface{}               `json:"sessions"`
+	PersonalAccessTokens []interface{}               `json:"personalAccessTokens"`
+	Passkeys             []interface{}               `json:"passkeys"`
+}
+
+// NewAccountService creates an account service. storage may be nil, in which
+// case DeleteAccount has no uploaded covers to remove.
+func NewAccountService(hasuraClient *HasuraClient, auth *AuthService, storage ObjectStorage) *AccountService {
+	return &AccountService{
+		hasuraClient: hasuraClient,
+		auth:         auth,
+		storage:      storage,
+		codeKey:      emailChangeCodeKey(auth.jwtSecret),
+	}
+}
+
+// RequestEmailChange emails one code to the user's current address and
+// another to newEmail. ConfirmEmailChange needs both, so the change proves
+// control of both addresses. A new request replaces any pending one, and
+// requests share the login code throttling for the new address.
+func (s *AccountService) RequestEmailChange(ctx context.Context, userID, newEmail, ipAddress string) error {
+	newEmail = normalizeEmail(newEmail)
+	if !strings.Contains(newEmail, "@") {
+		return fmt.Errorf("a valid email is required")
+	}
+
+	user, err := s.auth.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return fmt.Errorf("user not found")
+	}
+	if user.Email == newEmail {
+		return fmt.Errorf("that is already your email")
+	}
+
+	if err := s.auth.loginGuard.AllowRequest(ctx, newEmail, ipAddress); err != nil {
+		return err
+	}
+
+	existing, err := s.auth.GetUserByEmail(ctx, newEmail)
+	if err != nil {
+		return fmt.Errorf("failed to check email: %w", err)
+	}
+	if existing != nil {
+		return ErrEmailInUse
+	}
+
+	currentCode := generateLoginCode()
+	newCode := generateLoginCode()
+	if err := s.storeEmailChange(ctx, userID, newEmail, currentCode, newCode, time.Now().Add(emailChangeExpiry)); err != nil {
+		return err
+	}
+
+	if s.auth.isDev {
+		slog.InfoContext(ctx, "Email change codes issued (development only)",
+			"email", user.Email, "new_email", newEmail,
+			"dev_current_code", logging.Revealed(currentCode), "dev_new_code", logging.Revealed(newCode),
+			"expires_in", emailChangeExpiry.String())
+	}
+
+	if s.auth.emailService == nil {
+		slog.WarnContext(ctx, "Email service not configured, skipping email send")
+		return nil
+	}
+	if err := s.auth.emailService.SendEmailChangeCode(ctx, user.Email, currentCode, newEmail); err != nil {
+		return fmt.Errorf("failed to send code to current email: %w", err)
+	}
+	if err := s.auth.emailService.SendEmailChangeCode(ctx, newEmail, newCode, newEmail); err != nil {
+		return fmt.Errorf("failed to send code to new email: %w", err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange checks the codes sent by RequestEmailChange and moves
+// the account to the new address. Every other session is signed out, since
+// their tokens still carry the old email. A pending change allows
+// maxEmailChangeAttempts guesses before it has to be requested again.
+func (s *AccountService) ConfirmEmailChange(ctx context.Context, userID, keepSessionID, currentCode, newCode string) (*User, error) {
+	pending, err := s.claimEmailChangeAttempt(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if pending == nil {
+		return nil, ErrInvalidEmailChangeCode
+	}
+
+	currentHash, _ := pending["current_code_hash"].(string)
+	newHash, _ := pending["new_code_hash"].(string)
+	currentOK := subtle.ConstantTimeCompare([]byte(s.hashCode(strings.TrimSpace(currentCode))), []byte(currentHash)) == 1
+	newOK := subtle.ConstantTimeCompare([]byte(s.hashCode(strings.TrimSpace(newCode))), []byte(newHash)) == 1
+	if !currentOK || !newOK {
+		return nil, ErrInvalidEmailChangeCode
+	}
+
+	user, err := s.auth.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	oldEmail := user.Email
+
+	newEmail, _ := pending["new_email"].(string)
+	user, err = s.completeEmailChange(ctx, userID, newEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	// The change is done; what follows only tidies up after the old address
+	if err := s.auth.invalidateLoginCodes(ctx, oldEmail); err != nil {
+		slog.WarnContext(ctx, "Failed to invalidate login codes after email change", "email", oldEmail, "error", err)
+	}
+	if _, err := s.auth.RevokeAllSessions(ctx, userID, keepSessionID, RevokedEmailChange); err != nil {
+		slog.WarnContext(ctx, "Failed to revoke sessions after email change", "user_id", userID, "error", err)
+	}
+
+	return user, nil
+}
+
+// DeleteAccount permanently removes a user. confirmEmail must match the
+// account's email. Tokens are revoked first, so a failure part way leaves
+// the account signed out everywhere but still able to sign in and retry.
+// Uploaded covers are deleted and cleared from any catalog row showing them;
+// the shared catalog rows themselves stay.
+func (s *AccountService) DeleteAccount(ctx context.Context, userID, confirmEmail string) (*AccountDeletion, error) {
+	user, err := s.auth.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	if normalizeEmail(confirmEmail) != user.Email {
+		return nil, ErrConfirmEmailMismatch
+	}
+
+	if _, err := s.auth.RevokeAllSessions(ctx, userID, "", RevokedAccountDelete); err != nil {
+		return nil, err
+	}
+	if _, err := s.auth.revokeAllPersonalAccessTokens(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	deletion := &AccountDeletion{}
+	deletion.CoversDeleted, err = s.deleteCovers(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	deletion.ItemsUnlinked, err = s.hasuraClient.UnlinkAllItemsFromUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.deleteUser(ctx, userID, user.Email); err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Deleted account", "user_id", userID, "items_unlinked", deletion.ItemsUnlinked, "covers_deleted", deletion.CoversDeleted)
+	return deletion, nil
+}
+
+// ExportAccountData collects the user's profile, collection, sessions,
+// personal access tokens, and passkeys in one request
+func (s *AccountService) ExportAccountData(ctx context.Context, userID string) (*AccountExport, error) {
+	kinds := []MediaKind{MediaKindMovie, MediaKindAlbum, MediaKindCassette}
+
+	var collection strings.Builder
+	for _, kind := range kinds {
+		t := mediaTables[kind]
+		fmt.Fprintf(&collection, `
+			%s(where: {user_id: {_eq: $user_id}}, order_by: {created_at: asc}) {
+				created_at
+				%s {
+					id
+					%s
+				}
+			}`, t.junction, t.relation, t.columnSelection("\t\t\t\t\t"))
+	}
+
+	query := fmt.Sprintf(`
+		query ExportAccountData($user_id: uuid!) {
+			users_by_pk(id: $user_id) {
+				id
+				email
+				is_public
+				role
+				created_at
+				updated_at
+			}%s
+			sessions(where: {user_id: {_eq: $user_id}}, order_by: {created_at: asc}) {
+				id
+				device_name
+				user_agent
+				ip_address
+				created_at
+				last_used_at
+				expires_at
+				revoked_at
+				revoked_reason
+			}
+			personal_access_tokens(where: {user_id: {_eq: $user_id}}, order_by: {created_at: asc}) {
+				id
+				name
+				scopes
+				created_at
+				expires_at
+				last_used_at
+				revoked_at
+			}
+			webauthn_credentials(where: {user_id: {_eq: $user_id}}, order_by: {created_at: asc}) {
+				id
+				name
+				created_at
+				last_used_at
+			}
+		}
+	`, collection.String())
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "ExportAccountData",
+		Variables: map[string]interface{}{
+			"user_id": userID,
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	profile, ok := resp.Data["users_by_pk"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	list := func(field string) []interface{} {
+		rows, _ := resp.Data[field].([]interface{})
+		if rows == nil {
+			rows = []interface{}{}
+		}
+		return rows
+	}
+
+	export := &AccountExport{
+		ExportedAt:           time.Now().UTC(),
+		Profile:              profile,
+		Collection:           map[MediaKind][]interface{}{},
+		Sessions:             list("sessions"),
+		PersonalAccessTokens: list("personal_access_tokens"),
+		Passkeys:             list("webauthn_credentials"),
+	}
+	for _, kind := range kinds {
+		export.Collection[kind] = list(mediaTables[kind].junction)
+	}
+
+	return export, nil
+}
+
+// emailChangeCodeKey is derived from the JWT secret, so the code hashes and a
+// token never share a key
+func emailChangeCodeKey(secret string) []byte {
+	sum := sha256.Sum256([]byte("email-change-code:" + secret))
+	return sum[:]
+}
+
+// hashCode keys the hash of an email change code with the server secret. A
+// six-digit code has too few values for a plain hash to hide it, so a leaked
+// table would otherwise give the codes away.
+func (s *AccountService) hashCode(code string) string {
+	mac := hmac.New(sha256.New, s.codeKey)
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *AccountService) storeEmailChange(ctx context.Context, userID, newEmail, currentCode, newCode string, expiresAt time.Time) error {
+	query := `
+		mutation StoreEmailChange($object: email_changes_insert_input!) {
+			insert_email_changes_one(
+				object: $object
+				on_conflict: {
+					constraint: email_changes_pkey
+					update_columns: [new_email, current_code_hash, new_code_hash, attempts, expires_at, created_at]
+				}
+			) {
+				user_id
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "StoreEmailChange",
+		Variables: map[string]interface{}{
+			"object": map[string]interface{}{
+				"user_id":           userID,
+				"new_email":         newEmail,
+				"current_code_hash": s.hashCode(currentCode),
+				"new_code_hash":     s.hashCode(newCode),
+				"attempts":          0,
+				"expires_at":        expiresAt.UTC().Format(time.RFC3339),
+				"created_at":        time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	}
+
+	if _, err := s.hasuraClient.Execute(ctx, req); err != nil {
+		return fmt.Errorf("failed to store email change: %w", err)
+	}
+
+	return nil
+}
+
+// claimEmailChangeAttempt uses up one guess on the user's pending change and
+// returns it, or nil when there is none left to guess at. Counting before
+// comparing keeps concurrent guesses within the limit.
+func (s *AccountService) claimEmailChangeAttempt(ctx context.Context, userID string) (map[string]interface{}, error) {
+	query := `
+		mutation ClaimEmailChangeAttempt($user_id: uuid!, $max: Int!, $now: timestamptz!) {
+			update_email_changes(
+				where: {user_id: {_eq: $user_id}, attempts: {_lt: $max}, expires_at: {_gt: $now}}
+				_inc: {attempts: 1}
+			) {
+				returning {
+					new_email
+					current_code_hash
+					new_code_hash
+				}
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "ClaimEmailChangeAttempt",
+		Variables: map[string]interface{}{
+			"user_id": userID,
+			"max":     maxEmailChangeAttempts,
+			"now":     time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check email change: %w", err)
+	}
+
+	result, _ := resp.Data["update_email_changes"].(map[string]interface{})
+	returning, _ := result["returning"].([]interface{})
+	if len(returning) != 1 {
+		return nil, nil
+	}
+	row, _ := returning[0].(map[string]interface{})
+	return row, nil
+}
+
+// completeEmailChange sets the new email and drops the pending change
+func (s *AccountService) completeEmailChange(ctx context.Context, userID, newEmail string) (*User, error) {
+	query := `
+		mutation CompleteEmailChange($user_id: uuid!, $email: String!) {
+			update_users_by_pk(pk_columns: {id: $user_id}, _set: {email: $email}) {
+				id
+				email
+				is_public
+				role
+				created_at
+				updated_at
+			}
+			delete_email_changes_by_pk(user_id: $user_id) {
+				user_id
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "CompleteEmailChange",
+		Variables: map[string]interface{}{
+			"user_id": userID,
+			"email":   newEmail,
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		// Someone signed up with the address after the codes were sent
+		if strings.Contains(err.Error(), "Uniqueness violation") {
+			return nil, ErrEmailInUse
+		}
+		return nil, fmt.Errorf("failed to change email: %w", err)
+	}
+
+	userMap, ok := resp.Data["update_users_by_pk"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return userFromMap(userMap), nil
+}
+
+// deleteCovers removes every object the user uploaded, first clearing the
+// catalog rows that show one so no client is left with a broken image
+func (s *AccountService) deleteCovers(ctx context.Context, userID string) (int, error) {
+	if s.storage == nil {
+		return 0, nil
+	}
+	prefix := coverKeyPrefix + userID + "/"
+
+	// Rows nobody owns count too: find-or-insert can relink them later
+	refs, err := s.hasuraClient.GetCoverReferences(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load referenced covers: %w", err)
+	}
+	var owned []string
+	for _, coverURL := range refs.All() {
+		if key, ok := s.storage.KeyFromURL(coverURL); ok && strings.HasPrefix(key, prefix) {
+			owned = append(owned, coverURL)
+		}
+	}
+	if len(owned) > 0 {
+		if _, err := s.hasuraClient.ClearCoverURLs(ctx, owned); err != nil {
+			return 0, err
+		}
+	}
+
+	objects, err := s.storage.ListObjects(ctx, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list cover objects: %w", err)
+	}
+	for i, obj := range objects {
+		if err := s.storage.DeleteObject(ctx, obj.Key); err != nil {
+			return i, fmt.Errorf("failed to delete cover %s: %w", obj.Key, err)
+		}
+	}
+
+	return len(objects), nil
+}
+
+// deleteUser removes the users row, which cascades to sessions, tokens,
+// passkeys, and any pending email change, along with the address's login codes
+func (s *AccountService) deleteUser(ctx context.Context, userID, email string) error {
+	query := `
+		mutation DeleteUser($id: uuid!, $email: String!) {
+			delete_login_codes(where: {email: {_eq: $email}}) {
+				affected_rows
+			}
+			delete_users_by_pk(id: $id) {
+				id
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "DeleteUser",
+		Variables: map[string]interface{}{
+			"id":    userID,
+			"email": email,
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if resp.Data["delete_users_by_pk"] == nil {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
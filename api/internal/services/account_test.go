@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAccountHasura holds one user, their pending email change, and the
+// catalog cover URLs, recording every operation it receives
+type fakeAccountHasura struct {
+	mu         sync.Mutex
+	user       map[string]interface{}
+	otherEmail string // Address already taken by another account
+	change     map[string]interface{}
+	coverURLs  []string
+	ops        []string
+	variables  map[string]map[string]interface{} // Last variables by operation
+}
+
+func (f *fakeAccountHasura) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.ops = append(f.ops, req.OperationName)
+		f.variables[req.OperationName] = req.Variables
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "GetUserByID":
+			data["users_by_pk"] = f.user
+		case "GetUserByEmail":
+			users := []interface{}{}
+			if req.Variables["email"] == f.otherEmail {
+				users = append(users, map[string]interface{}{"id": "someone-else", "email": f.otherEmail})
+			}
+			data["users"] = users
+		case "StoreEmailChange":
+			f.change = req.Variables["object"].(map[string]interface{})
+		case "ClaimEmailChangeAttempt":
+			returning := []interface{}{}
+			if f.change != nil && f.change["attempts"].(float64) < req.Variables["max"].(float64) {
+				f.change["attempts"] = f.change["attempts"].(float64) + 1
+				returning = append(returning, f.change)
+			}
+			data["update_email_changes"] = map[string]interface{}{"returning": returning}
+		case "CompleteEmailChange":
+			f.user["email"] = req.Variables["email"]
+			f.change = nil
+			data["update_users_by_pk"] = f.user
+		case "InvalidateLoginCodes":
+			data["update_login_codes"] = map[string]interface{}{"affected_rows": 0}
+		case "RevokeSessions":
+			data["update_sessions"] = map[string]interface{}{"affected_rows": 1, "returning": []interface{}{}}
+		case "RevokeAllPersonalAccessTokens":
+			data["update_personal_access_tokens"] = map[string]interface{}{"affected_rows": 2}
+		case "GetCoverReferences":
+			rows := []interface{}{}
+			for _, u := range f.coverURLs {
+				rows = append(rows, map[string]interface{}{"cover_url": u})
+			}
+			data["vhs"] = rows
+		case "ClearCoverURLs":
+			data["update_vhs"] = map[string]interface{}{"affected_rows": 1}
+		case "UnlinkAllItemsFromUser":
+			data["delete_user_vhs"] = map[string]interface{}{"affected_rows": 3}
+			data["delete_user_records"] = map[string]interface{}{"affected_rows": 2}
+			data["delete_user_cassettes"] = map[string]interface{}{"affected_rows": 0}
+		case "DeleteUser":
+			data["delete_users_by_pk"] = map[string]interface{}{"id": f.user["id"]}
+		case "ExportAccountData":
+			data["users_by_pk"] = f.user
+			data["user_vhs"] = []interface{}{map[string]interface{}{"created_at": "2024-01-01T00:00:00Z", "vhs": map[string]interface{}{"id": "v1", "title": "Alien"}}}
+			data["sessions"] = []interface{}{map[string]interface{}{"id": "s1"}}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+}
+
+func newAccountTestService(t *testing.T, storage ObjectStorage) (*AccountService, *fakeAccountHasura) {
+	t.Helper()
+	fake := &fakeAccountHasura{
+		user:      map[string]interface{}{"id": "u1", "email": "old@example.com", "role": "user"},
+		variables: map[string]map[string]interface{}{},
+	}
+	server := httptest.NewServer(fake.handler(t))
+	t.Cleanup(server.Close)
+
+	hasura := NewHasuraClient(server.URL, "")
+	auth := NewAuthService(hasura, nil, "test-secret", true)
+	return NewAccountService(hasura, auth, storage), fake
+}
+
+func TestAccountService_EmailChange(t *testing.T) {
+	accounts, fake := newAccountTestService(t, nil)
+	fake.otherEmail = "taken@example.com"
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		newEmail  string
+		expectErr string
+	}{
+		{newEmail: "not-an-email", expectErr: "valid email"},
+		{newEmail: " OLD@example.com ", expectErr: "already your email"},
+		{newEmail: "taken@example.com", expectErr: ErrEmailInUse.Error()},
+	} {
+		if err := accounts.RequestEmailChange(ctx, "u1", tt.newEmail, "10.0.0.1"); err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.newEmail, tt.expectErr, err)
+		}
+	}
+
+	if err := accounts.RequestEmailChange(ctx, "u1", "New@Example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.change["new_email"] != "new@example.com" {
+		t.Errorf("expected a pending change to new@example.com, got %+v", fake.change)
+	}
+	for key, value := range fake.change {
+		if s, ok := value.(string); ok && len(s) == 6 {
+			t.Errorf("expected only code hashes to be stored, %s holds %q", key, s)
+		}
+	}
+
+	// The codes are random, so give the pending change known ones
+	if accounts.hashCode("111111") == hashRefreshToken("111111") {
+		t.Error("expected code hashes to be keyed with the server secret")
+	}
+	fake.change["current_code_hash"] = accounts.hashCode("111111")
+	fake.change["new_code_hash"] = accounts.hashCode("222222")
+
+	if _, err := accounts.ConfirmEmailChange(ctx, "u1", "s1", "111111", "111111"); !errors.Is(err, ErrInvalidEmailChangeCode) {
+		t.Errorf("expected one wrong code to be rejected, got %v", err)
+	}
+	if fake.user["email"] != "old@example.com" {
+		t.Fatalf("expected the email to be unchanged, got %v", fake.user["email"])
+	}
+
+	user, err := accounts.ConfirmEmailChange(ctx, "u1", "s1", "111111", " 222222 ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Email != "new@example.com" {
+		t.Errorf("expected new@example.com, got %s", user.Email)
+	}
+	if got := fake.variables["InvalidateLoginCodes"]["email"]; got != "old@example.com" {
+		t.Errorf("expected login codes for the old address to be invalidated, got %v", got)
+	}
+	where := fake.variables["RevokeSessions"]["where"].(map[string]interface{})
+	if !reflect.DeepEqual(where["id"], map[string]interface{}{"_neq": "s1"}) {
+		t.Errorf("expected every other session to be revoked, got %v", where)
+	}
+
+	if _, err := accounts.ConfirmEmailChange(ctx, "u1", "s1", "111111", "222222"); !errors.Is(err, ErrInvalidEmailChangeCode) {
+		t.Errorf("expected a completed change to be unusable, got %v", err)
+	}
+}
+
+func TestAccountService_EmailChangeAttemptLimit(t *testing.T) {
+	accounts, fake := newAccountTestService(t, nil)
+	ctx := context.Background()
+
+	if err := accounts.RequestEmailChange(ctx, "u1", "new@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fake.change["current_code_hash"] = accounts.hashCode("111111")
+	fake.change["new_code_hash"] = accounts.hashCode("222222")
+
+	for i := 0; i < maxEmailChangeAttempts; i++ {
+		accounts.ConfirmEmailChange(ctx, "u1", "", "000000", "000000")
+	}
+	if _, err := accounts.ConfirmEmailChange(ctx, "u1", "", "111111", "222222"); !errors.Is(err, ErrInvalidEmailChangeCode) {
+		t.Errorf("expected the right codes to fail once attempts are used up, got %v", err)
+	}
+}
+
+func TestAccountService_DeleteAccount(t *testing.T) {
+	fakeStorage := newFakeS3(t, "covers-bucket")
+	storage := newS3ServiceWithClient(fakeStorage.client(), S3Options{
+		Bucket:    "covers-bucket",
+		URLPrefix: "https://cdn.example.com",
+	})
+	accounts, fake := newAccountTestService(t, storage)
+	fake.coverURLs = []string{
+		"https://cdn.example.com/covers/u1/shown.jpg",
+		"https://cdn.example.com/covers/u2/theirs.jpg",
+		"https://coverartarchive.org/release/abc/front.jpg",
+	}
+	old := time.Now().Add(-time.Hour)
+	fakeStorage.put("covers/u1/shown.jpg", []byte("a"), old)
+	fakeStorage.put("covers/u1/abandoned.png", []byte("b"), old)
+	fakeStorage.put("covers/u2/theirs.jpg", []byte("c"), old)
+	ctx := context.Background()
+
+	if _, err := accounts.DeleteAccount(ctx, "u1", "someone@example.com"); !errors.Is(err, ErrConfirmEmailMismatch) {
+		t.Fatalf("expected a mismatched confirmation to be rejected, got %v", err)
+	}
+	if len(fake.ops) != 1 {
+		t.Fatalf("expected nothing to change after a mismatch, got %v", fake.ops)
+	}
+	fake.ops = nil
+
+	deletion, err := accounts.DeleteAccount(ctx, "u1", " Old@Example.com ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deletion.ItemsUnlinked != 5 || deletion.CoversDeleted != 2 {
+		t.Errorf("expected 5 items and 2 covers, got %+v", deletion)
+	}
+
+	expectOps := []string{
+		"GetUserByID",
+		"RevokeSessions",
+		"RevokeAllPersonalAccessTokens",
+		"GetCoverReferences",
+		"ClearCoverURLs",
+		"UnlinkAllItemsFromUser",
+		"DeleteUser",
+	}
+	if !reflect.DeepEqual(fake.ops, expectOps) {
+		t.Errorf("expected operations %v, got %v", expectOps, fake.ops)
+	}
+	if got := fake.variables["ClearCoverURLs"]["urls"]; !reflect.DeepEqual(got, []interface{}{"https://cdn.example.com/covers/u1/shown.jpg"}) {
+		t.Errorf("expected only the user's shown cover to be cleared, got %v", got)
+	}
+	if fakeStorage.has("covers/u1/shown.jpg") || fakeStorage.has("covers/u1/abandoned.png") {
+		t.Error("expected the user's uploads to be deleted")
+	}
+	if !fakeStorage.has("covers/u2/theirs.jpg") {
+		t.Error("expected another user's upload to be kept")
+	}
+	if got := fake.variables["DeleteUser"]["email"]; got != "old@example.com" {
+		t.Errorf("expected login codes for old@example.com to be deleted, got %v", got)
+	}
+}
+
+func TestAccountService_ExportAccountData(t *testing.T) {
+	accounts, _ := newAccountTestService(t, nil)
+
+	export, err := accounts.ExportAccountData(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if export.Profile["email"] != "old@example.com" || len(export.Sessions) != 1 {
+		t.Errorf("unexpected export %+v", export)
+	}
+	if len(export.Collection[MediaKindMovie]) != 1 || export.Collection[MediaKindAlbum] == nil || export.PersonalAccessTokens == nil {
+		t.Errorf("expected every section to be present, got %+v", export)
+	}
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"collection":{"cassettes":[],"records":[],"vhs":[`) {
+		t.Errorf("unexpected JSON %s", data)
+	}
+}
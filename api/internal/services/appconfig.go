@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// app_config keys for the forced update settings
+const (
+	appConfigMinimumIOSVersion = "minimum_ios_version"
+	appConfigUpdateMessage     = "force_update_message"
+	appConfigForceUpdate       = "force_update"
+	appConfigStoreURL          = "app_store_url"
+)
+
+var versionPattern = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
+
+// AppVersionConfig gates outdated iOS builds
+type AppVersionConfig struct {
+	MinimumIOSVersion string
+	UpdateMessage     string
+	ForceUpdate       bool
+	StoreURL          string
+}
+
+// AppVersionConfigUpdate changes some of the settings; nil fields are kept
+type AppVersionConfigUpdate struct {
+	MinimumIOSVersion *string
+	UpdateMessage     *string
+	ForceUpdate       *bool
+	StoreURL          *string
+}
+
+// AppConfigService reads and writes app settings stored in the app_config
+// table. Settings that were never written fall back to the defaults, which
+// come from environment variables.
+type AppConfigService struct {
+	hasuraClient *HasuraClient
+	defaults     AppVersionConfig
+}
+
+// NewAppConfigService creates an app config service
+func NewAppConfigService(hasuraClient *HasuraClient, defaults AppVersionConfig) *AppConfigService {
+	return &AppConfigService{
+		hasuraClient: hasuraClient,
+		defaults:     defaults,
+	}
+}
+
+// Defaults returns the settings used when nothing has been stored
+func (s *AppConfigService) Defaults() AppVersionConfig {
+	return s.defaults
+}
+
+// GetAppVersionConfig returns the stored settings over the defaults
+func (s *AppConfigService) GetAppVersionConfig(ctx context.Context) (*AppVersionConfig, error) {
+	query := `
+		query GetAppConfig($keys: [String!]!) {
+			app_config(where: {key: {_in: $keys}}) {
+				key
+				value
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetAppConfig",
+		Variables: map[string]interface{}{
+			"keys": []string{appConfigMinimumIOSVersion, appConfigUpdateMessage, appConfigForceUpdate, appConfigStoreURL},
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	cfg := s.defaults
+	list, _ := resp.Data["app_config"].([]interface{})
+	for _, entry := range list {
+		row, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		key, _ := row["key"].(string)
+		value, _ := row["value"].(string)
+
+		switch key {
+		case appConfigMinimumIOSVersion:
+			cfg.MinimumIOSVersion = value
+		case appConfigUpdateMessage:
+			cfg.UpdateMessage = value
+		case appConfigForceUpdate:
+			if b, err := strconv.ParseBool(value); err == nil {
+				cfg.ForceUpdate = b
+			}
+		case appConfigStoreURL:
+			cfg.StoreURL = value
+		}
+	}
+
+	return &cfg, nil
+}
+
+// UpdateAppVersionConfig stores the given settings and returns the result.
+// actor is recorded on each changed row.
+func (s *AppConfigService) UpdateAppVersionConfig(ctx context.Context, update AppVersionConfigUpdate, actor string) (*AppVersionConfig, error) {
+	values := map[string]string{}
+	if update.MinimumIOSVersion != nil {
+		if !versionPattern.MatchString(*update.MinimumIOSVersion) {
+			return nil, fmt.Errorf("minimum iOS version must look like 1.2.3, got %q", *update.MinimumIOSVersion)
+		}
+		values[appConfigMinimumIOSVersion] = *update.MinimumIOSVersion
+	}
+	if update.UpdateMessage != nil {
+		values[appConfigUpdateMessage] = *update.UpdateMessage
+	}
+	if update.ForceUpdate != nil {
+		values[appConfigForceUpdate] = strconv.FormatBool(*update.ForceUpdate)
+	}
+	if update.StoreURL != nil {
+		values[appConfigStoreURL] = *update.StoreURL
+	}
+	if len(values) == 0 {
+		return s.GetAppVersionConfig(ctx)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	objects := make([]map[string]interface{}, 0, len(values))
+	for key, value := range values {
+		objects = append(objects, map[string]interface{}{
+			"key":        key,
+			"value":      value,
+			"updated_by": actor,
+			"updated_at": now,
+		})
+	}
+
+	query := `
+		mutation UpsertAppConfig($objects: [app_config_insert_input!]!) {
+			insert_app_config(
+				objects: $objects
+				on_conflict: {constraint: app_config_pkey, update_columns: [value, updated_by, updated_at]}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "UpsertAppConfig",
+		Variables: map[string]interface{}{
+			"objects": objects,
+		},
+	}
+
+	if _, err := s.hasuraClient.Execute(ctx, req); err != nil {
+		return nil, fmt.Errorf("failed to save app config: %w", err)
+	}
+
+	return s.GetAppVersionConfig(ctx)
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeAppConfigHasura stores app_config rows in memory
+type fakeAppConfigHasura struct {
+	rows map[string]map[string]interface{}
+}
+
+func (f *fakeAppConfigHasura) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "GetAppConfig":
+			rows := []map[string]interface{}{}
+			for _, row := range f.rows {
+				rows = append(rows, row)
+			}
+			data["app_config"] = rows
+		case "UpsertAppConfig":
+			for _, object := range req.Variables["objects"].([]interface{}) {
+				row := object.(map[string]interface{})
+				f.rows[row["key"].(string)] = row
+			}
+			data["insert_app_config"] = map[string]interface{}{"affected_rows": len(f.rows)}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+}
+
+func TestAppConfigService(t *testing.T) {
+	fake := &fakeAppConfigHasura{rows: map[string]map[string]interface{}{
+		"force_update_message": {"key": "force_update_message", "value": "Stored message"},
+	}}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	defaults := AppVersionConfig{
+		MinimumIOSVersion: "1.0.0",
+		UpdateMessage:     "Env message",
+		ForceUpdate:       true,
+		StoreURL:          "https://apps.example.com/mediacloset",
+	}
+	service := NewAppConfigService(NewHasuraClient(server.URL, ""), defaults)
+	ctx := context.Background()
+
+	cfg, err := service.GetAppVersionConfig(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := defaults
+	expected.UpdateMessage = "Stored message"
+	if *cfg != expected {
+		t.Errorf("expected stored values over defaults %+v, got %+v", expected, *cfg)
+	}
+
+	if _, err := service.UpdateAppVersionConfig(ctx, AppVersionConfigUpdate{MinimumIOSVersion: stringPtr("two")}, "user:admin"); err == nil {
+		t.Error("expected an invalid version to be rejected")
+	}
+
+	forceUpdate := false
+	cfg, err = service.UpdateAppVersionConfig(ctx, AppVersionConfigUpdate{
+		MinimumIOSVersion: stringPtr("2.3"),
+		ForceUpdate:       &forceUpdate,
+	}, "user:admin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MinimumIOSVersion != "2.3" || cfg.ForceUpdate || cfg.UpdateMessage != "Stored message" {
+		t.Errorf("unexpected config after update: %+v", *cfg)
+	}
+	if fake.rows["minimum_ios_version"]["updated_by"] != "user:admin" {
+		t.Errorf("expected actor to be recorded, got %v", fake.rows["minimum_ios_version"])
+	}
+}
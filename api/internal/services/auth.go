@@ -4,10 +4,15 @@ import (
 	"context"
 	"crypto/rand"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+
+	"mediacloset/api/internal/logging"
+	"mediacloset/api/internal/ratelimit"
 )
 
 // AuthService handles user authentication with login codes
@@ -17,6 +22,14 @@ type AuthService struct {
 	jwtSecret    string
 	codeExpiry   time.Duration // Default: 5 minutes
 	isDev        bool          // Skip email sending in development
+	loginGuard   *LoginGuard
+	magicLinkURL string // Where sign-in links point; empty disables them
+
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	sessionCache    *expirable.LRU[string, sessionStatus]
+
+	accessTokenCache *expirable.LRU[string, accessTokenStatus]
 }
 
 // NewAuthService creates a new authentication service
@@ -27,13 +40,28 @@ func NewAuthService(hasuraClient *HasuraClient, emailService *EmailService, jwtS
 		jwtSecret:    jwtSecret,
 		codeExpiry:   5 * time.Minute, // Industry standard: 5-10 minutes
 		isDev:        isDev,
+		loginGuard:   NewLoginGuard(ratelimit.NewMemoryStore()),
+
+		accessTokenTTL:  DefaultAccessTokenTTL,
+		refreshTokenTTL: DefaultRefreshTokenTTL,
+		sessionCache:    expirable.NewLRU[string, sessionStatus](sessionCacheSize, nil, sessionCacheTTL),
+
+		accessTokenCache: expirable.NewLRU[string, accessTokenStatus](sessionCacheSize, nil, sessionCacheTTL),
 	}
 }
 
+// SetLoginStore keeps login throttling counters in store instead of this
+// process, so replicas sharing it enforce one set of limits
+func (a *AuthService) SetLoginStore(store ratelimit.Store) {
+	a.loginGuard = NewLoginGuard(store)
+}
+
 // User represents a user in the system
 type User struct {
 	ID        string    `json:"id"`
 	Email     string    `json:"email"`
+	IsPublic  bool      `json:"isPublic"`
+	Role      Role      `json:"role"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
@@ -50,14 +78,20 @@ type LoginCode struct {
 type Claims struct {
 	UserID string `json:"userId"`
 	Email  string `json:"email"`
+	Role   Role   `json:"role"`
 	jwt.RegisteredClaims
 }
 
-// RequestLoginCode generates a login code for the given email
-func (a *AuthService) RequestLoginCode(ctx context.Context, email string) error {
+// RequestLoginCode generates a login code for the given email. Requests are
+// throttled per address and per IP (see LoginGuard).
+func (a *AuthService) RequestLoginCode(ctx context.Context, email string, ipAddress string) error {
 	// Normalize email (lowercase)
 	email = normalizeEmail(email)
 
+	if err := a.loginGuard.AllowRequest(ctx, email, ipAddress); err != nil {
+		return err
+	}
+
 	// Check if user exists, create if not
 	_, err := a.getOrCreateUser(ctx, email)
 	if err != nil {
@@ -77,7 +111,7 @@ func (a *AuthService) RequestLoginCode(ctx context.Context, email string) error
 	}
 
 	if a.isDev {
-		fmt.Printf("[Auth] Login code for %s: %s (expires in %v)\n", email, code, a.codeExpiry)
+		slog.InfoContext(ctx, "Login code issued (development only)", "email", email, "dev_code", logging.Revealed(code), "expires_in", a.codeExpiry.String())
 	}
 
 	if a.emailService != nil {
@@ -86,53 +120,68 @@ func (a *AuthService) RequestLoginCode(ctx context.Context, email string) error
 			return fmt.Errorf("failed to send login code email: %w", err)
 		}
 	} else {
-		fmt.Printf("Email service not configured, skipping email send\n")
+		slog.WarnContext(ctx, "Email service not configured, skipping email send")
 	}
 
 	return nil
 }
 
-// VerifyLoginCode validates a login code and returns a JWT token
-func (a *AuthService) VerifyLoginCode(ctx context.Context, email string, code string) (string, *User, error) {
+// VerifyLoginCode validates a login code and starts a session for the device
+func (a *AuthService) VerifyLoginCode(ctx context.Context, email string, code string, client SessionClient) (*TokenPair, *User, error) {
 	// Normalize email
 	email = normalizeEmail(email)
 
+	if err := a.loginGuard.BeginVerify(ctx, email, client.IPAddress); err != nil {
+		return nil, nil, err
+	}
+
 	// Verify the code
 	valid, err := a.verifyLoginCode(ctx, email, code)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to verify login code: %w", err)
+		a.loginGuard.CancelVerify(ctx, email, client.IPAddress)
+		return nil, nil, fmt.Errorf("failed to verify login code: %w", err)
 	}
 	if !valid {
-		return "", nil, fmt.Errorf("invalid or expired login code")
+		if a.loginGuard.RecordFailure(ctx, email, client.IPAddress) {
+			slog.WarnContext(ctx, "Too many failed login codes, locking out and invalidating outstanding codes", "email", email)
+			if err := a.invalidateLoginCodes(ctx, email); err != nil {
+				slog.WarnContext(ctx, "Failed to invalidate login codes", "error", err)
+			}
+		}
+		return nil, nil, fmt.Errorf("invalid or expired login code")
 	}
+	a.loginGuard.RecordSuccess(ctx, email, client.IPAddress)
 
 	// Get user
-	user, err := a.getUserByEmail(ctx, email)
+	user, err := a.GetUserByEmail(ctx, email)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return "", nil, fmt.Errorf("user not found")
+		return nil, nil, fmt.Errorf("user not found")
 	}
 
 	// Mark code as used
 	err = a.markCodeAsUsed(ctx, email, code)
 	if err != nil {
 		// Log but don't fail - code is already validated
-		fmt.Printf("[Auth] Warning: failed to mark code as used: %v\n", err)
+		slog.WarnContext(ctx, "Failed to mark login code as used", "error", err)
 	}
 
-	// Generate JWT token
-	token, err := a.generateToken(user.ID, user.Email)
+	pair, err := a.createSession(ctx, user, client)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+		return nil, nil, err
 	}
 
-	return token, user, nil
+	return pair, user, nil
 }
 
-// ValidateToken validates a JWT token and returns the user ID
-func (a *AuthService) ValidateToken(tokenString string) (string, string, error) {
+// ValidateToken validates a JWT token and returns its claims. The token's
+// session (jti) must not be revoked; tokens issued before sessions existed
+// carry no jti and stay valid until they expire. Tokens issued before roles
+// existed are treated as RoleUser. Changing a user's role revokes their
+// sessions, so a token never outlives the role it carries.
+func (a *AuthService) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// Validate signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -142,14 +191,26 @@ func (a *AuthService) ValidateToken(tokenString string) (string, string, error)
 	})
 
 	if err != nil {
-		return "", "", fmt.Errorf("failed to parse token: %w", err)
+		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims.UserID, claims.Email, nil
+		if claims.Role == "" {
+			claims.Role = RoleUser
+		}
+		if claims.ID != "" {
+			active, err := a.checkSession(ctx, claims.ID, claims.UserID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check session: %w", err)
+			}
+			if !active {
+				return nil, ErrSessionRevoked
+			}
+		}
+		return claims, nil
 	}
 
-	return "", "", fmt.Errorf("invalid token")
+	return nil, fmt.Errorf("invalid token")
 }
 
 // GetUserByID fetches a user by ID
@@ -159,6 +220,8 @@ func (a *AuthService) GetUserByID(ctx context.Context, userID string) (*User, er
 			users_by_pk(id: $id) {
 				id
 				email
+				is_public
+				role
 				created_at
 				updated_at
 			}
@@ -188,49 +251,172 @@ func (a *AuthService) GetUserByID(ctx context.Context, userID string) (*User, er
 		return nil, fmt.Errorf("unexpected user data type")
 	}
 
-	user := &User{}
-	if id, ok := userMap["id"].(string); ok {
-		user.ID = id
+	return userFromMap(userMap), nil
+}
+
+// UpdateProfile changes a user's profile settings. Nil fields are left as they are.
+func (a *AuthService) UpdateProfile(ctx context.Context, userID string, isPublic *bool) (*User, error) {
+	changes := map[string]interface{}{}
+	if isPublic != nil {
+		changes["is_public"] = *isPublic
 	}
-	if email, ok := userMap["email"].(string); ok {
-		user.Email = email
+	if len(changes) == 0 {
+		return a.GetUserByID(ctx, userID)
 	}
-	if createdAt, ok := userMap["created_at"].(string); ok {
-		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
-			user.CreatedAt = t
+
+	query := `
+		mutation UpdateProfile($id: uuid!, $changes: users_set_input!) {
+			update_users_by_pk(pk_columns: {id: $id}, _set: $changes) {
+				id
+				email
+				is_public
+				role
+				created_at
+				updated_at
+			}
 		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "UpdateProfile",
+		Variables: map[string]interface{}{
+			"id":      userID,
+			"changes": changes,
+		},
 	}
-	if updatedAt, ok := userMap["updated_at"].(string); ok {
-		if t, err := time.Parse(time.RFC3339, updatedAt); err == nil {
-			user.UpdatedAt = t
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute mutation: %w", err)
+	}
+
+	userMap, ok := resp.Data["update_users_by_pk"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return userFromMap(userMap), nil
+}
+
+// ListUsers pages through all users, newest first, optionally filtered by
+// an email substring. Returns the page and the total matching count.
+func (a *AuthService) ListUsers(ctx context.Context, limit, offset int, search *string) ([]*User, int, error) {
+	where := map[string]interface{}{}
+	if search != nil && *search != "" {
+		where["email"] = map[string]interface{}{"_ilike": "%" + normalizeEmail(*search) + "%"}
+	}
+
+	query := `
+		query ListUsers($where: users_bool_exp!, $limit: Int!, $offset: Int!) {
+			users(where: $where, order_by: [{created_at: desc}, {id: asc}], limit: $limit, offset: $offset) {
+				id
+				email
+				is_public
+				role
+				created_at
+				updated_at
+			}
+			users_aggregate(where: $where) {
+				aggregate {
+					count
+				}
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "ListUsers",
+		Variables: map[string]interface{}{
+			"where":  where,
+			"limit":  limit,
+			"offset": offset,
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	list, _ := resp.Data["users"].([]interface{})
+	users := make([]*User, 0, len(list))
+	for _, entry := range list {
+		if userMap, ok := entry.(map[string]interface{}); ok {
+			users = append(users, userFromMap(userMap))
 		}
 	}
 
-	return user, nil
+	totalCount := 0
+	if aggData, ok := resp.Data["users_aggregate"].(map[string]interface{}); ok {
+		if agg, ok := aggData["aggregate"].(map[string]interface{}); ok {
+			if count, ok := agg["count"].(float64); ok {
+				totalCount = int(count)
+			}
+		}
+	}
+
+	return users, totalCount, nil
 }
 
-// Private helper methods
+// SetUserRole changes a user's role and signs the user out everywhere, since
+// access tokens carry the role they were issued with
+func (a *AuthService) SetUserRole(ctx context.Context, userID string, role Role) (*User, error) {
+	if _, ok := roleRanks[role]; !ok {
+		return nil, fmt.Errorf("unknown role: %q", role)
+	}
 
-func (a *AuthService) getOrCreateUser(ctx context.Context, email string) (*User, error) {
-	// Try to get existing user
-	user, err := a.getUserByEmail(ctx, email)
+	query := `
+		mutation SetUserRole($id: uuid!, $role: String!) {
+			update_users_by_pk(pk_columns: {id: $id}, _set: {role: $role}) {
+				id
+				email
+				is_public
+				role
+				created_at
+				updated_at
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "SetUserRole",
+		Variables: map[string]interface{}{
+			"id":   userID,
+			"role": string(role),
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to execute mutation: %w", err)
 	}
-	if user != nil {
-		return user, nil
+
+	userMap, ok := resp.Data["update_users_by_pk"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("user not found")
 	}
 
-	// Create new user
-	return a.createUser(ctx, email)
+	if _, err := a.RevokeAllSessions(ctx, userID, "", RevokedRoleChange); err != nil {
+		return nil, fmt.Errorf("role changed but failed to sign out the user: %w", err)
+	}
+
+	return userFromMap(userMap), nil
 }
 
-func (a *AuthService) getUserByEmail(ctx context.Context, email string) (*User, error) {
+// GetUserByEmail fetches a user by email address
+func (a *AuthService) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	email = normalizeEmail(email)
+
 	query := `
 		query GetUserByEmail($email: String!) {
 			users(where: {email: {_eq: $email}}, limit: 1) {
 				id
 				email
+				is_public
+				role
 				created_at
 				updated_at
 			}
@@ -265,25 +451,23 @@ func (a *AuthService) getUserByEmail(ctx context.Context, email string) (*User,
 		return nil, fmt.Errorf("unexpected user data type")
 	}
 
-	user := &User{}
-	if id, ok := userMap["id"].(string); ok {
-		user.ID = id
-	}
-	if email, ok := userMap["email"].(string); ok {
-		user.Email = email
-	}
-	if createdAt, ok := userMap["created_at"].(string); ok {
-		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
-			user.CreatedAt = t
-		}
+	return userFromMap(userMap), nil
+}
+
+// Private helper methods
+
+func (a *AuthService) getOrCreateUser(ctx context.Context, email string) (*User, error) {
+	// Try to get existing user
+	user, err := a.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
 	}
-	if updatedAt, ok := userMap["updated_at"].(string); ok {
-		if t, err := time.Parse(time.RFC3339, updatedAt); err == nil {
-			user.UpdatedAt = t
-		}
+	if user != nil {
+		return user, nil
 	}
 
-	return user, nil
+	// Create new user
+	return a.createUser(ctx, email)
 }
 
 func (a *AuthService) createUser(ctx context.Context, email string) (*User, error) {
@@ -292,6 +476,8 @@ func (a *AuthService) createUser(ctx context.Context, email string) (*User, erro
 			insert_users_one(object: {email: $email}) {
 				id
 				email
+				is_public
+				role
 				created_at
 				updated_at
 			}
@@ -321,25 +507,7 @@ func (a *AuthService) createUser(ctx context.Context, email string) (*User, erro
 		return nil, fmt.Errorf("unexpected user data type")
 	}
 
-	user := &User{}
-	if id, ok := userMap["id"].(string); ok {
-		user.ID = id
-	}
-	if email, ok := userMap["email"].(string); ok {
-		user.Email = email
-	}
-	if createdAt, ok := userMap["created_at"].(string); ok {
-		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
-			user.CreatedAt = t
-		}
-	}
-	if updatedAt, ok := userMap["updated_at"].(string); ok {
-		if t, err := time.Parse(time.RFC3339, updatedAt); err == nil {
-			user.UpdatedAt = t
-		}
-	}
-
-	return user, nil
+	return userFromMap(userMap), nil
 }
 
 func (a *AuthService) storeLoginCode(ctx context.Context, email string, code string, expiresAt time.Time) error {
@@ -452,14 +620,46 @@ func (a *AuthService) markCodeAsUsed(ctx context.Context, email string, code str
 	return nil
 }
 
-func (a *AuthService) generateToken(userID string, email string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // Token expires in 24 hours
+// invalidateLoginCodes marks every unused code for the email as used
+func (a *AuthService) invalidateLoginCodes(ctx context.Context, email string) error {
+	query := `
+		mutation InvalidateLoginCodes($email: String!) {
+			update_login_codes(
+				where: {
+					email: {_eq: $email}
+					used_at: {_is_null: true}
+				}
+				_set: {used_at: "now()"}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "InvalidateLoginCodes",
+		Variables: map[string]interface{}{
+			"email": email,
+		},
+	}
 
+	_, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate login codes: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AuthService) generateToken(user *User, sessionID string, expiresAt time.Time) (string, error) {
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID: user.ID,
+		Email:  user.Email,
+		Role:   user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "mediacloset",
 		},
@@ -476,6 +676,34 @@ func (a *AuthService) generateToken(userID string, email string) (string, error)
 
 // Helper functions
 
+func userFromMap(userMap map[string]interface{}) *User {
+	user := &User{}
+	if id, ok := userMap["id"].(string); ok {
+		user.ID = id
+	}
+	if email, ok := userMap["email"].(string); ok {
+		user.Email = email
+	}
+	if isPublic, ok := userMap["is_public"].(bool); ok {
+		user.IsPublic = isPublic
+	}
+	user.Role = RoleUser
+	if role, ok := userMap["role"].(string); ok && role != "" {
+		user.Role = Role(role)
+	}
+	if createdAt, ok := userMap["created_at"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			user.CreatedAt = t
+		}
+	}
+	if updatedAt, ok := userMap["updated_at"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, updatedAt); err == nil {
+			user.UpdatedAt = t
+		}
+	}
+	return user
+}
+
 func generateLoginCode() string {
 	// Generate a 6-digit code (000000-999999)
 	// Use crypto/rand for secure random number generation
@@ -2,11 +2,16 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"regexp"
 	"strings"
 
+	"golang.org/x/sync/singleflight"
+
 	"mediacloset/api/internal/graph/model"
+	"mediacloset/api/internal/ratelimit"
 )
 
 // BarcodeService orchestrates barcode lookups across multiple services
@@ -15,6 +20,8 @@ type BarcodeService struct {
 	itunes      *ITunesService
 	musicBrainz *MusicBrainzService
 	omdb        *OMDBService
+
+	lookups singleflight.Group // Coalesces concurrent lookups of one barcode
 }
 
 // NewBarcodeService creates a new barcode orchestration service
@@ -37,7 +44,15 @@ func NewBarcodeService(
 // 1. Discogs (if configured) - Best music database
 // 2. iTunes - Good fallback, no auth required
 // 3. MusicBrainz - Comprehensive but may require multiple lookups
+// Services whose daily quota is used up are skipped.
+// Concurrent lookups of the same barcode share one search.
 func (s *BarcodeService) LookupAlbum(ctx context.Context, barcode string) (*model.AlbumData, error) {
+	return coalesce(ctx, &s.lookups, barcode, func(ctx context.Context) (*model.AlbumData, error) {
+		return s.lookupAlbum(ctx, barcode)
+	})
+}
+
+func (s *BarcodeService) lookupAlbum(ctx context.Context, barcode string) (*model.AlbumData, error) {
 	// Clean the barcode
 	cleanedBarcode := cleanBarcode(barcode)
 
@@ -74,8 +89,12 @@ func (s *BarcodeService) LookupAlbum(ctx context.Context, barcode string) (*mode
 	for _, service := range services {
 		// Try with original barcode
 		if data, err := service.fn(ctx, barcode); err == nil && data != nil {
-			fmt.Printf("[BarcodeService] Found album via %s (original barcode)\n", service.name)
+			slog.InfoContext(ctx, "Found album by barcode", "provider", strings.ToLower(service.name), "barcode", barcode)
 			return data, nil
+		} else if errors.Is(err, ratelimit.ErrQuotaExhausted) {
+			// Out of requests for today; move on rather than retrying
+			slog.WarnContext(ctx, "Skipping provider", "provider", strings.ToLower(service.name), "error", err)
+			continue
 		} else if err != nil {
 			lastErr = err
 		}
@@ -83,7 +102,7 @@ func (s *BarcodeService) LookupAlbum(ctx context.Context, barcode string) (*mode
 		// Try with cleaned barcode if different
 		if cleanedBarcode != barcode {
 			if data, err := service.fn(ctx, cleanedBarcode); err == nil && data != nil {
-				fmt.Printf("[BarcodeService] Found album via %s (cleaned barcode)\n", service.name)
+				slog.InfoContext(ctx, "Found album by barcode", "provider", strings.ToLower(service.name), "barcode", cleanedBarcode)
 				return data, nil
 			} else if err != nil {
 				lastErr = err
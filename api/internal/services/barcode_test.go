@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"mediacloset/api/internal/ratelimit"
+	"mediacloset/api/internal/resilient"
 )
 
 func TestCleanBarcode(t *testing.T) {
@@ -170,6 +171,66 @@ func TestBarcodeService_LookupAlbum_FallbackToITunes(t *testing.T) {
 	}
 }
 
+func TestBarcodeService_LookupAlbum_SkipsExhaustedQuota(t *testing.T) {
+	// Discogs must not be called once its quota is used up
+	discogsCalls := 0
+	discogsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		discogsCalls++
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results": []}`))
+	}))
+	defer discogsServer.Close()
+
+	itunesServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{
+			"resultCount": 1,
+			"results": [{
+				"artistName": "iTunes Artist",
+				"collectionName": "iTunes Album"
+			}]
+		}`))
+	}))
+	defer itunesServer.Close()
+
+	limiter := ratelimit.NewServiceLimiter(ratelimit.NewMemoryStore(), map[ratelimit.Provider]ratelimit.ProviderLimit{
+		ratelimit.ProviderDiscogs: {DailyQuota: 1},
+	})
+	if err := limiter.Wait(context.Background(), ratelimit.ProviderDiscogs); err != nil {
+		t.Fatalf("Failed to use up quota: %v", err)
+	}
+
+	discogs := &DiscogsService{
+		client: resilient.New("test-discogs-quota", &http.Client{Timeout: 1 * time.Second}, resilient.Config{
+			BeforeAttempt: waitForLimit(limiter, ratelimit.ProviderDiscogs),
+		}),
+		consumerKey:    "test-key",
+		consumerSecret: "test-secret",
+		baseURL:        discogsServer.URL,
+	}
+
+	itunes := &ITunesService{
+		client:  &http.Client{Timeout: 1 * time.Second},
+		baseURL: itunesServer.URL,
+	}
+
+	barcodeService := NewBarcodeService(discogs, itunes, nil, nil)
+
+	// "0123456" cleans to a different barcode, which must not retry Discogs either
+	result, err := barcodeService.LookupAlbum(context.Background(), "0123456")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result.Source != "itunes" {
+		t.Errorf("Source = %s, want itunes", result.Source)
+	}
+
+	if discogsCalls != 0 {
+		t.Errorf("Expected no Discogs calls, got %d", discogsCalls)
+	}
+}
+
 func TestBarcodeService_LookupAlbum_AllServicesFail(t *testing.T) {
 	// Create mock Discogs server that returns no results
 	discogsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -261,10 +322,8 @@ func TestBarcodeService_LookupAlbum_FallbackToMusicBrainz(t *testing.T) {
 		baseURL: itunesServer.URL,
 	}
 
-	limiter := ratelimit.NewServiceLimiter()
 	musicBrainz := &MusicBrainzService{
 		client:          musicBrainzServer.Client(),
-		limiter:         limiter,
 		baseURL:         musicBrainzServer.URL,
 		coverArtBaseURL: musicBrainzServer.URL,
 	}
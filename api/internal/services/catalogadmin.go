@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// Audit log actions
+const (
+	CatalogActionMerge = "merge"
+	CatalogActionSplit = "split"
+)
+
+// coverHashColumns travel with cover_url when a cover is copied between rows
+var coverHashColumns = []string{"cover_phash", "cover_dhash", "cover_hash_url"}
+
+// CatalogAdminService repairs the shared catalog: merging duplicate rows and
+// splitting rows that conflate two releases. Every change is recorded in
+// catalog_audit_log along with the rows as they were before.
+type CatalogAdminService struct {
+	hasuraClient *HasuraClient
+}
+
+// NewCatalogAdminService creates a catalog admin service
+func NewCatalogAdminService(hasuraClient *HasuraClient) *CatalogAdminService {
+	return &CatalogAdminService{hasuraClient: hasuraClient}
+}
+
+// CatalogMergePlan describes folding Source into Target
+type CatalogMergePlan struct {
+	Kind   MediaKind
+	Target map[string]interface{}
+	Source map[string]interface{}
+	// Changes are the fields target takes from source (plus a refreshed
+	// normalized key)
+	Changes map[string]interface{}
+	// MovedLinks counts source links that will be re-pointed to target
+	MovedLinks int
+	// DropLinkIDs are source links for users who already have target
+	DropLinkIDs []string
+}
+
+// CatalogSplitPlan describes carving a new row out of Source for some users
+type CatalogSplitPlan struct {
+	Kind    MediaKind
+	Source  map[string]interface{}
+	Object  map[string]interface{} // the new row, including its generated id
+	UserIDs []string
+}
+
+// PlanMerge works out how source would be folded into target without
+// changing anything
+func (s *CatalogAdminService) PlanMerge(ctx context.Context, kind MediaKind, targetID, sourceID string) (*CatalogMergePlan, error) {
+	t, err := kind.table()
+	if err != nil {
+		return nil, err
+	}
+	if targetID == sourceID {
+		return nil, fmt.Errorf("cannot merge a row into itself")
+	}
+
+	target, err := s.getRow(ctx, kind, targetID)
+	if err != nil {
+		return nil, err
+	}
+	source, err := s.getRow(ctx, kind, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := s.hasuraClient.GetCatalogLinks(ctx, kind, []string{targetID, sourceID})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &CatalogMergePlan{
+		Kind:        kind,
+		Target:      target,
+		Source:      source,
+		Changes:     mergeColumns(t.columns, target, source),
+		DropLinkIDs: []string{},
+	}
+
+	if _, ok := plan.Changes["cover_url"]; ok {
+		for _, column := range coverHashColumns {
+			if v, ok := source[column]; ok && v != nil {
+				plan.Changes[column] = v
+			}
+		}
+	}
+
+	merged := make(map[string]interface{}, len(target))
+	for k, v := range target {
+		merged[k] = v
+	}
+	for k, v := range plan.Changes {
+		merged[k] = v
+	}
+	if key := kind.NormalizedKey(merged); key != target["normalized_key"] {
+		plan.Changes["normalized_key"] = key
+	}
+
+	hasTarget := map[string]bool{}
+	for _, link := range links {
+		if link[t.fkColumn] == targetID {
+			userID, _ := link["user_id"].(string)
+			hasTarget[userID] = true
+		}
+	}
+	for _, link := range links {
+		if link[t.fkColumn] != sourceID {
+			continue
+		}
+		userID, _ := link["user_id"].(string)
+		if hasTarget[userID] {
+			id, _ := link["id"].(string)
+			plan.DropLinkIDs = append(plan.DropLinkIDs, id)
+		} else {
+			plan.MovedLinks++
+		}
+	}
+
+	return plan, nil
+}
+
+// ApplyMerge executes a merge plan atomically and returns the audit entry ID.
+// If links changed since the plan was made the transaction fails on the
+// junction table's unique constraint rather than losing data.
+func (s *CatalogAdminService) ApplyMerge(ctx context.Context, plan *CatalogMergePlan, actor, reason string) (string, error) {
+	targetID, _ := plan.Target["id"].(string)
+	sourceID, _ := plan.Source["id"].(string)
+
+	audit := map[string]interface{}{
+		"action":    CatalogActionMerge,
+		"kind":      string(plan.Kind),
+		"target_id": targetID,
+		"source_id": sourceID,
+		"actor":     actor,
+		"reason":    reason,
+		"details": map[string]interface{}{
+			"target_before":    plan.Target,
+			"source_before":    plan.Source,
+			"changes":          plan.Changes,
+			"moved_links":      plan.MovedLinks,
+			"dropped_link_ids": plan.DropLinkIDs,
+		},
+	}
+
+	return s.hasuraClient.ExecuteCatalogMerge(ctx, plan.Kind, targetID, sourceID, plan.Changes, plan.DropLinkIDs, audit)
+}
+
+// PlanSplit works out a new row copied from source with overrides applied,
+// to which the given users' links will move. At least one field must differ,
+// and at least one user must stay on the original row.
+func (s *CatalogAdminService) PlanSplit(ctx context.Context, kind MediaKind, sourceID string, userIDs []string, overrides map[string]interface{}) (*CatalogSplitPlan, error) {
+	t, err := kind.table()
+	if err != nil {
+		return nil, err
+	}
+	if len(userIDs) == 0 {
+		return nil, fmt.Errorf("at least one user must move to the new row")
+	}
+	if len(overrides) == 0 {
+		return nil, fmt.Errorf("at least one field must differ from the original row")
+	}
+
+	source, err := s.getRow(ctx, kind, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := s.hasuraClient.GetCatalogLinks(ctx, kind, []string{sourceID})
+	if err != nil {
+		return nil, err
+	}
+	linked := map[string]bool{}
+	for _, link := range links {
+		userID, _ := link["user_id"].(string)
+		linked[userID] = true
+	}
+
+	moving := map[string]bool{}
+	for _, userID := range userIDs {
+		if !linked[userID] {
+			return nil, fmt.Errorf("user %s does not have %s %s", userID, kind, sourceID)
+		}
+		moving[userID] = true
+	}
+	if len(moving) == len(linked) {
+		return nil, fmt.Errorf("every user would move; update the row instead of splitting it")
+	}
+
+	object := map[string]interface{}{}
+	for _, c := range t.columns {
+		if v, ok := source[c.name]; ok && v != nil {
+			object[c.name] = v
+		}
+	}
+	for column, value := range overrides {
+		if !hasColumn(t.columns, column) {
+			return nil, fmt.Errorf("%s has no editable column %q", kind, column)
+		}
+		object[column] = value
+	}
+	if object["cover_url"] == source["cover_url"] {
+		for _, column := range coverHashColumns {
+			if v, ok := source[column]; ok && v != nil {
+				object[column] = v
+			}
+		}
+	}
+	object["id"] = uuid.NewString()
+	object["normalized_key"] = kind.NormalizedKey(object)
+
+	users := make([]string, 0, len(moving))
+	for userID := range moving {
+		users = append(users, userID)
+	}
+	sort.Strings(users)
+
+	return &CatalogSplitPlan{
+		Kind:    kind,
+		Source:  source,
+		Object:  object,
+		UserIDs: users,
+	}, nil
+}
+
+// ApplySplit executes a split plan atomically and returns the audit entry ID
+func (s *CatalogAdminService) ApplySplit(ctx context.Context, plan *CatalogSplitPlan, actor, reason string) (string, error) {
+	sourceID, _ := plan.Source["id"].(string)
+	newID, _ := plan.Object["id"].(string)
+
+	audit := map[string]interface{}{
+		"action":    CatalogActionSplit,
+		"kind":      string(plan.Kind),
+		"target_id": newID,
+		"source_id": sourceID,
+		"actor":     actor,
+		"reason":    reason,
+		"details": map[string]interface{}{
+			"source_before": plan.Source,
+			"new_row":       plan.Object,
+			"moved_users":   plan.UserIDs,
+		},
+	}
+
+	return s.hasuraClient.ExecuteCatalogSplit(ctx, plan.Kind, sourceID, plan.Object, plan.UserIDs, audit)
+}
+
+func (s *CatalogAdminService) getRow(ctx context.Context, kind MediaKind, id string) (map[string]interface{}, error) {
+	row, err := s.hasuraClient.GetCatalogRow(ctx, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	if row == nil {
+		return nil, fmt.Errorf("%s %s not found", kind, id)
+	}
+	return row, nil
+}
+
+// mergeColumns picks the fields target should take from source: anything
+// target is missing, plus the union of array columns. Target wins otherwise.
+func mergeColumns(columns []catalogColumn, target, source map[string]interface{}) map[string]interface{} {
+	changes := map[string]interface{}{}
+	for _, c := range columns {
+		sourceValue := source[c.name]
+		if isEmptyValue(sourceValue) {
+			continue
+		}
+		targetValue := target[c.name]
+
+		if c.typ == columnTextArray {
+			union := unionValues(targetValue, sourceValue)
+			if len(union) != lenValues(targetValue) {
+				changes[c.name] = union
+			}
+			continue
+		}
+
+		if isEmptyValue(targetValue) {
+			changes[c.name] = sourceValue
+		}
+	}
+	return changes
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return val == ""
+	case []interface{}:
+		return len(val) == 0
+	}
+	return false
+}
+
+func lenValues(v interface{}) int {
+	list, _ := v.([]interface{})
+	return len(list)
+}
+
+// unionValues appends values from b that are not already in a, keeping order
+func unionValues(a, b interface{}) []interface{} {
+	union := []interface{}{}
+	seen := map[interface{}]bool{}
+	for _, list := range []interface{}{a, b} {
+		values, _ := list.([]interface{})
+		for _, v := range values {
+			if !seen[v] {
+				seen[v] = true
+				union = append(union, v)
+			}
+		}
+	}
+	return union
+}
+
+func hasColumn(columns []catalogColumn, name string) bool {
+	for _, c := range columns {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeCatalogAdminHasura serves catalog rows and junction links and captures
+// the merge/split mutations
+type fakeCatalogAdminHasura struct {
+	rows     map[string]map[string]interface{}
+	links    []map[string]interface{}
+	executed *GraphQLRequest
+}
+
+func (f *fakeCatalogAdminHasura) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "GetCatalogRow":
+			data["records_by_pk"] = f.rows[req.Variables["id"].(string)]
+		case "GetCatalogLinks":
+			ids := map[string]bool{}
+			for _, id := range req.Variables["ids"].([]interface{}) {
+				ids[id.(string)] = true
+			}
+			links := []map[string]interface{}{}
+			for _, link := range f.links {
+				if ids[link["record_id"].(string)] {
+					links = append(links, link)
+				}
+			}
+			data["user_records"] = links
+		case "ExecuteCatalogMerge":
+			f.executed = &req
+			if strings.Contains(req.Query, "update_target") {
+				data["update_target"] = map[string]interface{}{"id": req.Variables["target"]}
+			}
+			data["delete_source"] = map[string]interface{}{"id": req.Variables["source"]}
+			data["insert_catalog_audit_log_one"] = map[string]interface{}{"id": "audit-1"}
+		case "ExecuteCatalogSplit":
+			f.executed = &req
+			data["insert_catalog_audit_log_one"] = map[string]interface{}{"id": "audit-2"}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+}
+
+func newTestCatalogAdmin(t *testing.T) (*CatalogAdminService, *fakeCatalogAdminHasura) {
+	t.Helper()
+
+	fake := &fakeCatalogAdminHasura{
+		rows: map[string]map[string]interface{}{
+			"keep": {
+				"id": "keep", "artist": "The Beatles", "album": "Abbey Road", "year": 1969,
+				"label": nil, "genres": []interface{}{"Rock"}, "cover_url": nil,
+				"normalized_key": "beatles|abbey road",
+			},
+			"dupe": {
+				"id": "dupe", "artist": "Beatles", "album": "Abbey Road (Remastered)", "year": 2019,
+				"label": "Apple", "genres": []interface{}{"Pop", "Rock"},
+				"cover_url": "https://cdn.example.com/covers/abbey.jpg", "cover_phash": "00ff00ff00ff00ff",
+			},
+		},
+		links: []map[string]interface{}{
+			{"id": "l1", "user_id": "alice", "record_id": "keep"},
+			{"id": "l2", "user_id": "alice", "record_id": "dupe"},
+			{"id": "l3", "user_id": "bob", "record_id": "dupe"},
+			{"id": "l4", "user_id": "carol", "record_id": "dupe"},
+		},
+	}
+	server := httptest.NewServer(fake.handler(t))
+	t.Cleanup(server.Close)
+
+	return NewCatalogAdminService(NewHasuraClient(server.URL, "")), fake
+}
+
+func TestCatalogAdminService_Merge(t *testing.T) {
+	admin, fake := newTestCatalogAdmin(t)
+	ctx := context.Background()
+
+	plan, err := admin.PlanMerge(ctx, MediaKindAlbum, "keep", "dupe")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedChanges := map[string]interface{}{
+		"label":       "Apple",
+		"genres":      []interface{}{"Rock", "Pop"},
+		"cover_url":   "https://cdn.example.com/covers/abbey.jpg",
+		"cover_phash": "00ff00ff00ff00ff",
+	}
+	if !reflect.DeepEqual(plan.Changes, expectedChanges) {
+		t.Errorf("expected changes %v, got %v", expectedChanges, plan.Changes)
+	}
+	if plan.MovedLinks != 2 {
+		t.Errorf("expected 2 moved links, got %d", plan.MovedLinks)
+	}
+	if !reflect.DeepEqual(plan.DropLinkIDs, []string{"l2"}) {
+		t.Errorf("expected alice's duplicate link to be dropped, got %v", plan.DropLinkIDs)
+	}
+	if fake.executed != nil {
+		t.Fatal("expected planning not to execute anything")
+	}
+
+	auditID, err := admin.ApplyMerge(ctx, plan, "cli:ops", "same pressing")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auditID != "audit-1" {
+		t.Errorf("expected audit-1, got %s", auditID)
+	}
+
+	vars := fake.executed.Variables
+	if vars["target"] != "keep" || vars["source"] != "dupe" {
+		t.Errorf("unexpected target/source: %v / %v", vars["target"], vars["source"])
+	}
+	audit := vars["audit"].(map[string]interface{})
+	if audit["action"] != "merge" || audit["actor"] != "cli:ops" || audit["reason"] != "same pressing" {
+		t.Errorf("unexpected audit entry: %v", audit)
+	}
+	details := audit["details"].(map[string]interface{})
+	if before := details["source_before"].(map[string]interface{}); before["album"] != "Abbey Road (Remastered)" {
+		t.Errorf("expected source snapshot in audit details, got %v", before)
+	}
+	for _, field := range []string{"delete_user_records", "update_user_records", "update_records_by_pk", "delete_records_by_pk", "insert_catalog_audit_log_one"} {
+		if !strings.Contains(fake.executed.Query, field) {
+			t.Errorf("expected merge mutation to include %s", field)
+		}
+	}
+}
+
+func TestCatalogAdminService_MergeWithoutChanges(t *testing.T) {
+	admin, fake := newTestCatalogAdmin(t)
+	fake.rows["copy"] = map[string]interface{}{
+		"id": "copy", "artist": "The Beatles", "album": "Abbey Road", "year": 1969,
+		"label": nil, "genres": []interface{}{"Rock"}, "cover_url": nil,
+		"normalized_key": "beatles|abbey road",
+	}
+
+	plan, err := admin.PlanMerge(context.Background(), MediaKindAlbum, "keep", "copy")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Fatalf("expected no changes, got %v", plan.Changes)
+	}
+
+	if _, err := admin.ApplyMerge(context.Background(), plan, "cli:ops", "exact copy"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(fake.executed.Query, "update_target") || strings.Contains(fake.executed.Query, "$changes") {
+		t.Errorf("expected no target update without changes, got %s", fake.executed.Query)
+	}
+	if _, ok := fake.executed.Variables["changes"]; ok {
+		t.Error("expected no changes variable")
+	}
+}
+
+func TestCatalogAdminService_PlanMergeErrors(t *testing.T) {
+	admin, _ := newTestCatalogAdmin(t)
+
+	tests := []struct {
+		name   string
+		target string
+		source string
+	}{
+		{name: "same row", target: "keep", source: "keep"},
+		{name: "missing target", target: "nope", source: "dupe"},
+		{name: "missing source", target: "keep", source: "nope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := admin.PlanMerge(context.Background(), MediaKindAlbum, tt.target, tt.source); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestCatalogAdminService_Split(t *testing.T) {
+	tests := []struct {
+		name      string
+		users     []string
+		overrides map[string]interface{}
+		expectErr string
+	}{
+		{
+			name:      "moves users onto corrected row",
+			users:     []string{"carol"},
+			overrides: map[string]interface{}{"year": 1969, "album": "Abbey Road"},
+		},
+		{
+			name:      "requires users",
+			overrides: map[string]interface{}{"year": 1969},
+			expectErr: "at least one user",
+		},
+		{
+			name:      "requires a changed field",
+			users:     []string{"carol"},
+			expectErr: "at least one field",
+		},
+		{
+			name:      "rejects users without the row",
+			users:     []string{"dave"},
+			overrides: map[string]interface{}{"year": 1969},
+			expectErr: "does not have",
+		},
+		{
+			name:      "refuses to move every user",
+			users:     []string{"alice", "bob", "carol"},
+			overrides: map[string]interface{}{"year": 1969},
+			expectErr: "every user",
+		},
+		{
+			name:      "rejects unknown columns",
+			users:     []string{"carol"},
+			overrides: map[string]interface{}{"id": "forged"},
+			expectErr: "no editable column",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin, fake := newTestCatalogAdmin(t)
+			ctx := context.Background()
+
+			plan, err := admin.PlanSplit(ctx, MediaKindAlbum, "dupe", tt.users, tt.overrides)
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if plan.Object["id"] == "" || plan.Object["id"] == "dupe" {
+				t.Errorf("expected a fresh id, got %v", plan.Object["id"])
+			}
+			if plan.Object["label"] != "Apple" || plan.Object["year"] != 1969 {
+				t.Errorf("expected source fields with overrides applied, got %v", plan.Object)
+			}
+			if plan.Object["normalized_key"] != "beatles|abbey road" {
+				t.Errorf("expected key recomputed for the new row, got %v", plan.Object["normalized_key"])
+			}
+			if plan.Object["cover_phash"] != "00ff00ff00ff00ff" {
+				t.Error("expected cover hash to carry over when the cover is unchanged")
+			}
+
+			if _, err := admin.ApplySplit(ctx, plan, "cli:ops", "two pressings"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			vars := fake.executed.Variables
+			if vars["new_id"] != plan.Object["id"] {
+				t.Errorf("expected links moved to %v, got %v", plan.Object["id"], vars["new_id"])
+			}
+			if !reflect.DeepEqual(vars["user_ids"], []interface{}{"carol"}) {
+				t.Errorf("expected carol to move, got %v", vars["user_ids"])
+			}
+		})
+	}
+}
+
+func TestParseColumnValue(t *testing.T) {
+	tests := []struct {
+		column    string
+		raw       string
+		expected  interface{}
+		expectErr bool
+	}{
+		{column: "year", raw: "1999", expected: 1999},
+		{column: "year", raw: "nineteen", expectErr: true},
+		{column: "genres", raw: "Rock, Pop,,", expected: []interface{}{"Rock", "Pop"}},
+		{column: "label", raw: "Apple", expected: "Apple"},
+		{column: "tape_type", raw: "Chrome", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.column+"="+tt.raw, func(t *testing.T) {
+			value, err := MediaKindAlbum.ParseColumnValue(tt.column, tt.raw)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(value, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ClientKeyPrefix starts every issued client key
+const ClientKeyPrefix = "mck_"
+
+// LegacyClientKeyID identifies the API_KEY environment variable, which is
+// still accepted alongside issued keys so existing installs keep working
+const LegacyClientKeyID = "env"
+
+const (
+	// clientKeyRefreshInterval bounds how long an issued or revoked key takes
+	// to reach every server instance
+	clientKeyRefreshInterval = time.Minute
+
+	// clientKeyLoadTimeout bounds one reload, which runs apart from the
+	// request that triggered it
+	clientKeyLoadTimeout = 10 * time.Second
+
+	// DefaultClientKeyOverlap is how long a rotated key keeps working, long
+	// enough for an app release carrying the new key to reach most users
+	DefaultClientKeyOverlap = 30 * 24 * time.Hour
+)
+
+// ClientKey identifies one app build or integration allowed to call the API.
+// Only a hash of the key itself is stored.
+type ClientKey struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+	RotatedAt *time.Time // When a newer key with the same name was issued
+	ExpiresAt *time.Time // nil never expires
+	RevokedAt *time.Time
+}
+
+// Active reports whether the key is accepted at now
+func (k *ClientKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+type storedClientKey struct {
+	key  ClientKey
+	hash [sha256.Size]byte
+}
+
+// ClientKeyService checks X-API-Key values against the client keys in the
+// api_client_keys table. Keys are held in memory and reloaded every
+// clientKeyRefreshInterval; if a reload fails the previous set stays in use.
+type ClientKeyService struct {
+	hasuraClient *HasuraClient
+	legacy       *storedClientKey
+	reloads      singleflight.Group
+
+	mu          sync.Mutex
+	keys        []storedClientKey
+	loadedAt    time.Time
+	invalidated int // Bumped by invalidate, so a reload already running doesn't count as fresh
+	now         func() time.Time
+}
+
+// NewClientKeyService creates a client key service. legacyKey, when set, is
+// accepted as the key LegacyClientKeyID. A nil hasuraClient accepts only the
+// legacy key.
+func NewClientKeyService(hasuraClient *HasuraClient, legacyKey string) *ClientKeyService {
+	s := &ClientKeyService{
+		hasuraClient: hasuraClient,
+		now:          time.Now,
+	}
+	if legacyKey != "" {
+		s.legacy = &storedClientKey{
+			key:  ClientKey{ID: LegacyClientKeyID, Name: "API_KEY"},
+			hash: sha256.Sum256([]byte(legacyKey)),
+		}
+	}
+	return s
+}
+
+// Verify returns the client key matching key, or nil if none is active.
+// Every known key is compared in constant time, so response timing says
+// nothing about how close a guess was.
+func (s *ClientKeyService) Verify(ctx context.Context, key string) *ClientKey {
+	hash := sha256.Sum256([]byte(key))
+	now := s.now()
+
+	var match *ClientKey
+	for _, stored := range s.currentKeys(ctx) {
+		if subtle.ConstantTimeCompare(hash[:], stored.hash[:]) == 1 && stored.key.Active(now) {
+			k := stored.key
+			match = &k
+		}
+	}
+	return match
+}
+
+// currentKeys returns the legacy key and the issued keys, reloading the
+// issued keys when they are stale. Concurrent callers share one reload, and
+// a caller that gives up waiting gets the current set while the reload
+// carries on without it.
+func (s *ClientKeyService) currentKeys(ctx context.Context) []storedClientKey {
+	s.mu.Lock()
+	stale := s.hasuraClient != nil && s.now().Sub(s.loadedAt) >= clientKeyRefreshInterval
+	s.mu.Unlock()
+
+	if stale {
+		done := s.reloads.DoChan("keys", func() (interface{}, error) {
+			s.reload(ctx)
+			return nil, nil
+		})
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := s.keys
+	if s.legacy != nil {
+		keys = append([]storedClientKey{*s.legacy}, keys...)
+	}
+	return keys
+}
+
+// reload fetches the issued keys with a context detached from the request
+// that asked for them, then swaps them in
+func (s *ClientKeyService) reload(ctx context.Context) {
+	s.mu.Lock()
+	invalidated := s.invalidated
+	s.mu.Unlock()
+
+	loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), clientKeyLoadTimeout)
+	defer cancel()
+	keys, err := s.load(loadCtx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to reload client keys, keeping the current set", "keys", len(s.keys), "error", err)
+	} else {
+		s.keys = keys
+	}
+	// Retry at the next interval either way, so an outage can't pile up
+	// reloads on every request
+	if s.invalidated == invalidated {
+		s.loadedAt = s.now()
+	}
+}
+
+func (s *ClientKeyService) load(ctx context.Context) ([]storedClientKey, error) {
+	query := `
+		query GetActiveClientKeys($now: timestamptz!) {
+			api_client_keys(where: {
+				revoked_at: {_is_null: true}
+				_or: [{expires_at: {_is_null: true}}, {expires_at: {_gt: $now}}]
+			}) {
+				id
+				name
+				key_hash
+				created_at
+				rotated_at
+				expires_at
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetActiveClientKeys",
+		Variables: map[string]interface{}{
+			"now": s.now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	list, _ := resp.Data["api_client_keys"].([]interface{})
+	keys := make([]storedClientKey, 0, len(list))
+	for _, entry := range list {
+		row, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		hash, _ := row["key_hash"].(string)
+		decoded, err := hex.DecodeString(hash)
+		if err != nil || len(decoded) != sha256.Size {
+			continue
+		}
+		stored := storedClientKey{key: *clientKeyFromMap(row)}
+		copy(stored.hash[:], decoded)
+		keys = append(keys, stored)
+	}
+	return keys, nil
+}
+
+// ListClientKeys returns every issued key, including revoked and expired
+// ones, oldest first
+func (s *ClientKeyService) ListClientKeys(ctx context.Context) ([]*ClientKey, error) {
+	query := `
+		query GetClientKeys {
+			api_client_keys(order_by: {created_at: asc}) {
+				id
+				name
+				created_at
+				rotated_at
+				expires_at
+				revoked_at
+			}
+		}
+	`
+
+	resp, err := s.hasuraClient.Execute(ctx, GraphQLRequest{Query: query, OperationName: "GetClientKeys"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	list, _ := resp.Data["api_client_keys"].([]interface{})
+	keys := make([]*ClientKey, 0, len(list))
+	for _, entry := range list {
+		if row, ok := entry.(map[string]interface{}); ok {
+			keys = append(keys, clientKeyFromMap(row))
+		}
+	}
+	return keys, nil
+}
+
+// IssueClientKey creates a key. The key is returned only here.
+func (s *ClientKeyService) IssueClientKey(ctx context.Context, name string, expiresAt *time.Time) (*ClientKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+	if expiresAt != nil && !expiresAt.After(s.now()) {
+		return nil, "", fmt.Errorf("expiry must be in the future")
+	}
+
+	secret, err := generateRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+	key := ClientKeyPrefix + secret
+
+	object := map[string]interface{}{
+		"name":     name,
+		"key_hash": hashRefreshToken(key),
+	}
+	if expiresAt != nil {
+		object["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+
+	query := `
+		mutation InsertClientKey($object: api_client_keys_insert_input!) {
+			insert_api_client_keys_one(object: $object) {
+				id
+				name
+				created_at
+				rotated_at
+				expires_at
+				revoked_at
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "InsertClientKey",
+		Variables: map[string]interface{}{
+			"object": object,
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to store client key: %w", err)
+	}
+
+	row, ok := resp.Data["insert_api_client_keys_one"].(map[string]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("failed to store client key: empty response")
+	}
+
+	s.invalidate()
+	return clientKeyFromMap(row), key, nil
+}
+
+// RotateClientKey issues a new key named name and lets the active keys with
+// that name expire after overlap, so installed apps keep working until an
+// update with the new key reaches them. It returns the new key and the keys
+// it rotated out.
+func (s *ClientKeyService) RotateClientKey(ctx context.Context, name string, overlap time.Duration) (*ClientKey, string, []*ClientKey, error) {
+	name = strings.TrimSpace(name)
+	keys, err := s.ListClientKeys(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	now := s.now()
+	graceEnds := now.Add(overlap)
+	var previous []*ClientKey
+	for _, k := range keys {
+		if k.Name == name && k.Active(now) {
+			previous = append(previous, k)
+		}
+	}
+	if len(previous) == 0 {
+		return nil, "", nil, fmt.Errorf("no active client key named %q", name)
+	}
+
+	issued, secret, err := s.IssueClientKey(ctx, name, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	for _, k := range previous {
+		expiresAt := graceEnds
+		if k.ExpiresAt != nil && k.ExpiresAt.Before(graceEnds) {
+			expiresAt = *k.ExpiresAt
+		}
+		if err := s.markRotated(ctx, k.ID, now, expiresAt); err != nil {
+			return nil, "", nil, fmt.Errorf("issued %s but failed to rotate %s: %w", issued.ID, k.ID, err)
+		}
+		k.RotatedAt = &now
+		k.ExpiresAt = &expiresAt
+	}
+
+	s.invalidate()
+	return issued, secret, previous, nil
+}
+
+// RevokeClientKey stops a key from working at once. It reports false when
+// the key does not exist or was already revoked.
+func (s *ClientKeyService) RevokeClientKey(ctx context.Context, id string) (bool, error) {
+	query := `
+		mutation RevokeClientKey($id: uuid!, $now: timestamptz!) {
+			update_api_client_keys(
+				where: {id: {_eq: $id}, revoked_at: {_is_null: true}}
+				_set: {revoked_at: $now}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "RevokeClientKey",
+		Variables: map[string]interface{}{
+			"id":  id,
+			"now": s.now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke client key: %w", err)
+	}
+
+	s.invalidate()
+	return affectedRows(resp, "update_api_client_keys") == 1, nil
+}
+
+func (s *ClientKeyService) markRotated(ctx context.Context, id string, rotatedAt, expiresAt time.Time) error {
+	query := `
+		mutation RotateClientKey($id: uuid!, $rotated_at: timestamptz!, $expires_at: timestamptz!) {
+			update_api_client_keys_by_pk(
+				pk_columns: {id: $id}
+				_set: {rotated_at: $rotated_at, expires_at: $expires_at}
+			) {
+				id
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "RotateClientKey",
+		Variables: map[string]interface{}{
+			"id":         id,
+			"rotated_at": rotatedAt.UTC().Format(time.RFC3339),
+			"expires_at": expiresAt.UTC().Format(time.RFC3339),
+		},
+	}
+
+	_, err := s.hasuraClient.Execute(ctx, req)
+	return err
+}
+
+// invalidate makes the next Verify on this instance reload the keys
+func (s *ClientKeyService) invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.invalidated++
+	s.mu.Unlock()
+}
+
+func clientKeyFromMap(row map[string]interface{}) *ClientKey {
+	key := &ClientKey{}
+	key.ID, _ = row["id"].(string)
+	key.Name, _ = row["name"].(string)
+	if value, ok := row["created_at"].(string); ok {
+		key.CreatedAt, _ = time.Parse(time.RFC3339, value)
+	}
+	for name, field := range map[string]**time.Time{
+		"rotated_at": &key.RotatedAt,
+		"expires_at": &key.ExpiresAt,
+		"revoked_at": &key.RevokedAt,
+	} {
+		if value, ok := row[name].(string); ok {
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				*field = &t
+			}
+		}
+	}
+	return key
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClientKeyHasura stores api_client_keys rows in memory
+type fakeClientKeyHasura struct {
+	mu    sync.Mutex
+	rows  []map[string]interface{}
+	loads int
+}
+
+func (f *fakeClientKeyHasura) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "GetActiveClientKeys":
+			// The service re-checks expiry, so returning every unrevoked
+			// row is enough here
+			f.loads++
+			active := []map[string]interface{}{}
+			for _, row := range f.rows {
+				if row["revoked_at"] == nil {
+					active = append(active, row)
+				}
+			}
+			data["api_client_keys"] = active
+		case "GetClientKeys":
+			data["api_client_keys"] = f.rows
+		case "InsertClientKey":
+			row := req.Variables["object"].(map[string]interface{})
+			row["id"] = fmt.Sprintf("k%d", len(f.rows)+1)
+			row["created_at"] = "2024-01-01T00:00:00Z"
+			f.rows = append(f.rows, row)
+			data["insert_api_client_keys_one"] = row
+		case "RotateClientKey":
+			for _, row := range f.rows {
+				if row["id"] == req.Variables["id"] {
+					row["rotated_at"] = req.Variables["rotated_at"]
+					row["expires_at"] = req.Variables["expires_at"]
+				}
+			}
+			data["update_api_client_keys_by_pk"] = map[string]interface{}{"id": req.Variables["id"]}
+		case "RevokeClientKey":
+			affected := 0
+			for _, row := range f.rows {
+				if row["id"] == req.Variables["id"] && row["revoked_at"] == nil {
+					row["revoked_at"] = req.Variables["now"]
+					affected++
+				}
+			}
+			data["update_api_client_keys"] = map[string]interface{}{"affected_rows": affected}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+}
+
+func TestClientKeyService_Verify(t *testing.T) {
+	fake := &fakeClientKeyHasura{}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	keys := NewClientKeyService(NewHasuraClient(server.URL, ""), "legacy-key")
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	issued, secret, err := keys.IssueClientKey(ctx, " ios ", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if issued.Name != "ios" || !strings.HasPrefix(secret, ClientKeyPrefix) {
+		t.Errorf("unexpected key %q, %+v", secret, issued)
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		expect string
+	}{
+		{name: "issued key", key: secret, expect: issued.ID},
+		{name: "legacy key", key: "legacy-key", expect: LegacyClientKeyID},
+		{name: "legacy key in another case", key: "LEGACY-KEY"},
+		{name: "unknown key", key: "mck_unknown"},
+		{name: "empty key", key: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := keys.Verify(ctx, tt.key)
+			if tt.expect == "" {
+				if got != nil {
+					t.Errorf("expected no match, got %+v", got)
+				}
+				return
+			}
+			if got == nil || got.ID != tt.expect {
+				t.Errorf("expected key %s, got %+v", tt.expect, got)
+			}
+		})
+	}
+
+	// Keys are reloaded once per interval
+	loads := fake.loads
+	keys.Verify(ctx, secret)
+	if fake.loads != loads {
+		t.Errorf("expected cached keys within the refresh interval")
+	}
+	now = now.Add(clientKeyRefreshInterval)
+	keys.Verify(ctx, secret)
+	if fake.loads != loads+1 {
+		t.Errorf("expected a reload after the refresh interval")
+	}
+
+	// A failed reload keeps the previous keys
+	server.Close()
+	now = now.Add(clientKeyRefreshInterval)
+	if keys.Verify(ctx, secret) == nil {
+		t.Error("expected the last loaded keys to stay in use")
+	}
+}
+
+func TestClientKeyService_VerifyWithCanceledRequest(t *testing.T) {
+	fake := &fakeClientKeyHasura{}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	keys := NewClientKeyService(NewHasuraClient(server.URL, ""), "")
+	_, secret, err := keys.IssueClientKey(context.Background(), "ios", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A request that is gone before the reload finishes must not leave the
+	// instance without keys until the next interval
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	keys.Verify(canceled, secret)
+
+	if keys.Verify(context.Background(), secret) == nil {
+		t.Error("expected the issued key to be accepted after a canceled request")
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.loads != 1 {
+		t.Errorf("expected one shared reload, got %d", fake.loads)
+	}
+}
+
+func TestClientKeyService_RotateAndRevoke(t *testing.T) {
+	fake := &fakeClientKeyHasura{}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	keys := NewClientKeyService(NewHasuraClient(server.URL, ""), "")
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, _, _, err := keys.RotateClientKey(ctx, "ios", time.Hour); err == nil {
+		t.Error("expected rotating an unknown name to fail")
+	}
+
+	_, oldSecret, _ := keys.IssueClientKey(ctx, "ios", nil)
+	issued, newSecret, previous, err := keys.RotateClientKey(ctx, "ios", time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(previous) != 1 || previous[0].RotatedAt == nil || !previous[0].ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected the old key to expire after the overlap, got %+v", previous)
+	}
+
+	// Both keys work during the overlap, only the new one after it
+	if keys.Verify(ctx, oldSecret) == nil || keys.Verify(ctx, newSecret) == nil {
+		t.Error("expected both keys to work during the overlap")
+	}
+	now = now.Add(time.Hour + time.Second)
+	if keys.Verify(ctx, oldSecret) != nil {
+		t.Error("expected the rotated key to stop working after the overlap")
+	}
+
+	if revoked, err := keys.RevokeClientKey(ctx, issued.ID); err != nil || !revoked {
+		t.Fatalf("expected the key to be revoked, got %v, %v", revoked, err)
+	}
+	if keys.Verify(ctx, newSecret) != nil {
+		t.Error("expected a revoked key to stop working at once on this instance")
+	}
+	if revoked, _ := keys.RevokeClientKey(ctx, issued.ID); revoked {
+		t.Error("expected a second revoke to report nothing changed")
+	}
+}
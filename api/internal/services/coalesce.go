@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// coalesceTimeout bounds a shared lookup, which no longer has a caller's
+// deadline: retries, backoff and limiter waits included, a lookup that
+// takes this long won't produce an answer anyone still wants
+var coalesceTimeout = 60 * time.Second
+
+// coalesce runs fn once for concurrent calls with the same key and hands
+// every caller its result, so duplicate lookups share one upstream request.
+// The shared call ignores the callers' cancellation but gives up after
+// coalesceTimeout; each caller still stops waiting when its own context ends.
+func coalesce[T any](ctx context.Context, group *singleflight.Group, key string, fn func(context.Context) (T, error)) (T, error) {
+	ch := group.DoChan(key, func() (interface{}, error) {
+		shared, cancel := context.WithTimeout(context.WithoutCancel(ctx), coalesceTimeout)
+		defer cancel()
+		return fn(shared)
+	})
+
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case result := <-ch:
+		value, _ := result.Val.(T)
+		return value, result.Err
+	}
+}
+
+// lookupKey joins lookup arguments into a singleflight key
+func lookupKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// optionalInt formats an optional number for lookupKey
+func optionalInt(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescedLookups(t *testing.T) {
+	t.Run("Concurrent identical searches share one request", func(t *testing.T) {
+		var calls int32
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			w.Write([]byte(`{"Title": "The Matrix", "Year": "1999", "Response": "True"}`))
+		}))
+		defer server.Close()
+
+		service := &OMDBService{
+			client:  server.Client(),
+			apiKey:  "test-api-key",
+			baseURL: server.URL,
+		}
+
+		const callers = 5
+		var wg sync.WaitGroup
+		errs := make(chan error, callers)
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := service.SearchMovie(context.Background(), "The Matrix", nil, nil)
+				if err == nil && result.Title != "The Matrix" {
+					t.Errorf("Title = %s, want The Matrix", result.Title)
+				}
+				errs <- err
+			}()
+		}
+
+		// Let every caller join the in-flight search before it finishes
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		}
+		if calls != 1 {
+			t.Errorf("Expected 1 upstream request, got %d", calls)
+		}
+	})
+
+	t.Run("Different searches are not shared", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Write([]byte(`{"Title": "Alien", "Response": "True"}`))
+		}))
+		defer server.Close()
+
+		service := &OMDBService{
+			client:  server.Client(),
+			apiKey:  "test-api-key",
+			baseURL: server.URL,
+		}
+
+		service.SearchMovie(context.Background(), "Alien", nil, intPtr(1979))
+		service.SearchMovie(context.Background(), "Alien", nil, intPtr(1986))
+
+		if calls != 2 {
+			t.Errorf("Expected 2 upstream requests, got %d", calls)
+		}
+	})
+
+	t.Run("A caller giving up doesn't cancel the others", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.Write([]byte(`{"resultCount": 1, "results": [{"artistName": "Artist", "collectionName": "Album"}]}`))
+		}))
+		defer server.Close()
+
+		service := &ITunesService{
+			client:  server.Client(),
+			baseURL: server.URL,
+		}
+		barcodeService := NewBarcodeService(nil, service, nil, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		impatient := make(chan error, 1)
+		go func() {
+			_, err := barcodeService.LookupAlbum(ctx, "123456")
+			impatient <- err
+		}()
+
+		patient := make(chan error, 1)
+		go func() {
+			_, err := barcodeService.LookupAlbum(context.Background(), "123456")
+			patient <- err
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		if err := <-impatient; err != context.Canceled {
+			t.Errorf("Expected canceled caller to get context.Canceled, got %v", err)
+		}
+
+		close(release)
+		if err := <-patient; err != nil {
+			t.Errorf("Expected remaining caller to get the result, got %v", err)
+		}
+	})
+	t.Run("The shared lookup has a deadline of its own", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer server.Close()
+
+		service := &OMDBService{
+			client:  server.Client(),
+			apiKey:  "test-api-key",
+			baseURL: server.URL,
+		}
+
+		previous := coalesceTimeout
+		coalesceTimeout = 50 * time.Millisecond
+		defer func() { coalesceTimeout = previous }()
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := service.SearchMovie(context.Background(), "Stalled", nil, nil)
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Expected the lookup to time out, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected the shared lookup to give up")
+		}
+	})
+}
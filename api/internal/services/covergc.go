@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// coverKeyPrefix is the object key prefix used for user-uploaded cover images
+const coverKeyPrefix = "covers/"
+
+// CoverGCService reconciles uploaded cover images against the catalog and removes
+// objects that are no longer referenced by any VHS, record, or cassette.
+//
+// Orphans come from abandoned uploads (a presigned URL was requested but the item was
+// never saved), replaced covers, and items that were removed from every collection.
+type CoverGCService struct {
+	hasuraClient *HasuraClient
+	storage      ObjectStorage
+	gracePeriod  time.Duration
+}
+
+// CoverGCReport summarizes a reconciliation run
+type CoverGCReport struct {
+	DryRun     bool
+	Scanned    int            // Objects found under covers/
+	Referenced int            // Objects still referenced by a catalog row
+	TooRecent  int            // Unreferenced objects still inside the grace period
+	Orphaned   []StoredObject // Unreferenced objects older than the grace period
+	Cleared    int            // Rows nobody owns whose cover_url pointed at a deleted orphan
+	Deleted    int            // Orphans actually removed (always 0 in dry-run mode)
+	Failed     map[string]error
+}
+
+// NewCoverGCService creates a new cover image garbage collector.
+// Unreferenced objects younger than gracePeriod are kept so that in-flight uploads
+// (presigned URL issued, item not yet saved) are never removed.
+func NewCoverGCService(hasuraClient *HasuraClient, storage ObjectStorage, gracePeriod time.Duration) *CoverGCService {
+	return &CoverGCService{
+		hasuraClient: hasuraClient,
+		storage:      storage,
+		gracePeriod:  gracePeriod,
+	}
+}
+
+// Run lists every object under covers/, compares it against the cover URLs referenced
+// in Hasura, and deletes unreferenced objects older than the grace period.
+// Rows nobody owns don't keep their cover alive, but their cover_url is cleared
+// before the object goes, so relinking such a row later never shows a broken image.
+// When dryRun is true nothing is deleted and the report lists what would be removed.
+func (g *CoverGCService) Run(ctx context.Context, dryRun bool) (*CoverGCReport, error) {
+	return g.run(ctx, dryRun, time.Now())
+}
+
+func (g *CoverGCService) run(ctx context.Context, dryRun bool, now time.Time) (*CoverGCReport, error) {
+	if g.storage == nil {
+		return nil, fmt.Errorf("image storage is not configured")
+	}
+
+	// Load references before listing objects: an upload that lands between the two
+	// calls is then at worst "unreferenced but too recent", never wrongly deleted.
+	refs, err := g.hasuraClient.GetCoverReferences(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load referenced covers: %w", err)
+	}
+
+	referenced := make(map[string]bool, len(refs.Owned))
+	for _, coverURL := range refs.Owned {
+		if key, ok := g.storage.KeyFromURL(coverURL); ok {
+			referenced[key] = true
+		}
+	}
+	unowned := map[string][]string{}
+	for _, coverURL := range refs.Unowned {
+		if key, ok := g.storage.KeyFromURL(coverURL); ok {
+			unowned[key] = append(unowned[key], coverURL)
+		}
+	}
+
+	objects, err := g.storage.ListObjects(ctx, coverKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cover objects: %w", err)
+	}
+
+	report := &CoverGCReport{
+		DryRun:  dryRun,
+		Scanned: len(objects),
+		Failed:  map[string]error{},
+	}
+
+	cutoff := now.Add(-g.gracePeriod)
+	for _, obj := range objects {
+		if referenced[obj.Key] {
+			report.Referenced++
+			continue
+		}
+		if obj.LastModified.After(cutoff) {
+			report.TooRecent++
+			continue
+		}
+		report.Orphaned = append(report.Orphaned, obj)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	var stale []string
+	for _, obj := range report.Orphaned {
+		stale = append(stale, unowned[obj.Key]...)
+	}
+	if len(stale) > 0 {
+		report.Cleared, err = g.hasuraClient.ClearCoverURLs(ctx, stale)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, obj := range report.Orphaned {
+		if err := g.storage.DeleteObject(ctx, obj.Key); err != nil {
+			report.Failed[obj.Key] = err
+			continue
+		}
+		report.Deleted++
+	}
+
+	return report, nil
+}
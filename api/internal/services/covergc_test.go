@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// coverGCHasura fakes the catalog with the covers of linked rows and of
+// rows nobody owns, recording which cover URLs get cleared
+type coverGCHasura struct {
+	mu      sync.Mutex
+	cleared []string
+}
+
+// newTestCoverGC fakes Hasura with the covers of linked catalog rows, plus
+// those of unlinked rows
+func newTestCoverGC(t *testing.T, referenced map[string][]string, unlinked map[string][]string, gracePeriod time.Duration) (*CoverGCService, *fakeS3, *coverGCHasura) {
+	t.Helper()
+
+	fake := newFakeS3(t, "covers-bucket")
+	catalog := &coverGCHasura{}
+
+	hasura := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "GetCoverReferences":
+			for _, table := range []string{"vhs", "records", "cassettes"} {
+				data[table] = coverRows(referenced[table])
+				data["unowned_"+table] = coverRows(unlinked[table])
+			}
+		case "ClearCoverURLs":
+			catalog.mu.Lock()
+			for _, u := range req.Variables["urls"].([]interface{}) {
+				catalog.cleared = append(catalog.cleared, u.(string))
+			}
+			catalog.mu.Unlock()
+			data["update_vhs"] = map[string]interface{}{"affected_rows": len(req.Variables["urls"].([]interface{}))}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(hasura.Close)
+
+	s3Service := newS3ServiceWithClient(fake.client(), S3Options{
+		Bucket:    "covers-bucket",
+		URLPrefix: "https://cdn.example.com",
+	})
+
+	return NewCoverGCService(NewHasuraClient(hasura.URL, ""), s3Service, gracePeriod), fake, catalog
+}
+
+func coverRows(urls []string) []map[string]string {
+	rows := []map[string]string{}
+	for _, u := range urls {
+		rows = append(rows, map[string]string{"cover_url": u})
+	}
+	return rows
+}
+
+func TestCoverGCService_Run(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-72 * time.Hour)
+
+	referenced := map[string][]string{
+		"vhs":       {"https://cdn.example.com/covers/user-1/kept-vhs.jpg"},
+		"records":   {"https://cdn.example.com/covers/user-1/kept-record.png", "https://coverartarchive.org/release/abc/front.jpg"},
+		"cassettes": {"https://cdn.example.com/covers/user-2/kept-cassette.webp?v=2"},
+	}
+
+	t.Run("dry run reports orphans without deleting", func(t *testing.T) {
+		gc, fake, _ := newTestCoverGC(t, referenced, nil, 24*time.Hour)
+		fake.put("covers/user-1/kept-vhs.jpg", []byte("a"), old)
+		fake.put("covers/user-1/kept-record.png", []byte("b"), old)
+		fake.put("covers/user-2/kept-cassette.webp", []byte("c"), old)
+		fake.put("covers/user-1/orphan.jpg", []byte("d"), old)
+		fake.put("covers/user-3/in-flight.jpg", []byte("e"), now.Add(-time.Hour))
+		fake.put("other/not-a-cover.jpg", []byte("f"), old)
+
+		report, err := gc.Run(context.Background(), true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !report.DryRun {
+			t.Error("expected report to be marked as dry run")
+		}
+		if report.Scanned != 5 {
+			t.Errorf("expected 5 scanned objects, got %d", report.Scanned)
+		}
+		if report.Referenced != 3 {
+			t.Errorf("expected 3 referenced objects, got %d", report.Referenced)
+		}
+		if report.TooRecent != 1 {
+			t.Errorf("expected 1 object inside grace period, got %d", report.TooRecent)
+		}
+		if len(report.Orphaned) != 1 || report.Orphaned[0].Key != "covers/user-1/orphan.jpg" {
+			t.Errorf("expected only covers/user-1/orphan.jpg to be orphaned, got %+v", report.Orphaned)
+		}
+		if report.Deleted != 0 {
+			t.Errorf("expected nothing deleted in dry run, got %d", report.Deleted)
+		}
+		if !fake.has("covers/user-1/orphan.jpg") {
+			t.Error("dry run must not delete objects")
+		}
+	})
+
+	t.Run("deletes orphans older than grace period", func(t *testing.T) {
+		gc, fake, _ := newTestCoverGC(t, referenced, nil, 24*time.Hour)
+		fake.put("covers/user-1/kept-vhs.jpg", []byte("a"), old)
+		fake.put("covers/user-1/orphan.jpg", []byte("d"), old)
+		fake.put("covers/user-3/in-flight.jpg", []byte("e"), now.Add(-time.Hour))
+
+		report, err := gc.Run(context.Background(), false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if report.Deleted != 1 {
+			t.Errorf("expected 1 deleted object, got %d", report.Deleted)
+		}
+		if len(report.Failed) != 0 {
+			t.Errorf("expected no failures, got %v", report.Failed)
+		}
+		if fake.has("covers/user-1/orphan.jpg") {
+			t.Error("expected orphan to be deleted")
+		}
+		if !fake.has("covers/user-1/kept-vhs.jpg") {
+			t.Error("referenced cover must be kept")
+		}
+		if !fake.has("covers/user-3/in-flight.jpg") {
+			t.Error("recent upload must be kept")
+		}
+	})
+
+	t.Run("covers of items nobody owns are collected", func(t *testing.T) {
+		unlinked := map[string][]string{
+			"vhs":     {"https://cdn.example.com/covers/user-1/removed.jpg"},
+			"records": {"https://cdn.example.com/covers/user-1/kept-vhs.jpg", "https://cdn.example.com/covers/user-1/new.jpg"},
+		}
+		gc, fake, catalog := newTestCoverGC(t, referenced, unlinked, 24*time.Hour)
+		fake.put("covers/user-1/kept-vhs.jpg", []byte("a"), old)
+		fake.put("covers/user-1/removed.jpg", []byte("b"), old)
+		fake.put("covers/user-1/new.jpg", []byte("c"), now.Add(-time.Hour))
+
+		report, err := gc.Run(context.Background(), false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if report.Referenced != 1 || report.Deleted != 1 {
+			t.Errorf("expected 1 referenced and 1 deleted object, got %+v", report)
+		}
+		if fake.has("covers/user-1/removed.jpg") {
+			t.Error("expected the cover of an unlinked row to be deleted")
+		}
+		if !fake.has("covers/user-1/kept-vhs.jpg") {
+			t.Error("referenced cover must be kept")
+		}
+
+		// Only rows pointing at a deleted object lose their cover
+		if !reflect.DeepEqual(catalog.cleared, []string{"https://cdn.example.com/covers/user-1/removed.jpg"}) || report.Cleared != 1 {
+			t.Errorf("expected only the removed cover to be cleared, got %v (%d rows)", catalog.cleared, report.Cleared)
+		}
+	})
+
+	t.Run("storage not configured", func(t *testing.T) {
+		gc := NewCoverGCService(NewHasuraClient("http://unused", ""), nil, time.Hour)
+		if _, err := gc.Run(context.Background(), true); err == nil {
+			t.Error("expected error when storage is not configured")
+		}
+	})
+}
+
+func TestS3Service_KeyFromURL(t *testing.T) {
+	s := &S3Service{urlPrefix: "https://bucket.s3.amazonaws.com"}
+
+	tests := []struct {
+		name    string
+		url     string
+		wantKey string
+		wantOK  bool
+	}{
+		{"uploaded cover", "https://bucket.s3.amazonaws.com/covers/u/1.jpg", "covers/u/1.jpg", true},
+		{"query string stripped", "https://bucket.s3.amazonaws.com/covers/u/1.jpg?x=1", "covers/u/1.jpg", true},
+		{"external url", "https://coverartarchive.org/release/1/front", "", false},
+		{"prefix only", "https://bucket.s3.amazonaws.com/", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := s.KeyFromURL(tt.url)
+			if ok != tt.wantOK || key != tt.wantKey {
+				t.Errorf("KeyFromURL(%q) = (%q, %v), want (%q, %v)", tt.url, key, ok, tt.wantKey, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"mediacloset/api/internal/imagehash"
+)
+
+// maxCoverImageBytes caps how much of a remote cover image is read for hashing
+const maxCoverImageBytes = 10 << 20
+
+var errBlockedAddress = errors.New("cover image host resolves to a non-public address")
+
+// blockedNetworks are special-purpose ranges the net.IP helpers don't cover:
+// carrier-grade NAT, benchmarking and documentation ranges, and IPv6 prefixes
+// that embed an IPv4 address (NAT64, 6to4, Teredo)
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+	"64:ff9b:1::/48",
+	"100::/64",
+	"2001::/32",
+	"2001:db8::/32",
+	"2002::/16",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// CoverHashes holds the perceptual hashes of a single cover image
+type CoverHashes struct {
+	PHash imagehash.Hash
+	DHash imagehash.Hash
+}
+
+// CoverHashService downloads cover images and computes their perceptual hashes
+type CoverHashService struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// NewCoverHashService creates a cover hasher. Cover URLs are user supplied, so
+// unless allowPrivate is set (development, local storage) connections to
+// loopback, private, and link-local addresses are refused.
+func NewCoverHashService(allowPrivate bool) *CoverHashService {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = rejectNonPublicAddress
+	}
+
+	return &CoverHashService{
+		client: &http.Client{
+			Timeout: 15 * time.Second,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 5 * time.Second,
+			},
+		},
+		maxBytes: maxCoverImageBytes,
+	}
+}
+
+// Compute fetches the image at imageURL and returns its pHash and dHash
+func (s *CoverHashService) Compute(ctx context.Context, imageURL string) (*CoverHashes, error) {
+	parsed, err := url.Parse(imageURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid cover URL: %q", imageURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch cover: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cover fetch returned status %d", resp.StatusCode)
+	}
+
+	img, err := imagehash.Decode(io.LimitReader(resp.Body, s.maxBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover: %w", err)
+	}
+
+	return &CoverHashes{
+		PHash: imagehash.PHash(img),
+		DHash: imagehash.DHash(img),
+	}, nil
+}
+
+// rejectNonPublicAddress is a net.Dialer control hook that runs after DNS
+// resolution, so it also catches public hostnames pointing at internal hosts
+func rejectNonPublicAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errBlockedAddress
+	}
+	// Check IPv4-mapped addresses (::ffff:169.254.169.254) as plain IPv4
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errBlockedAddress
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return errBlockedAddress
+		}
+	}
+
+	return nil
+}
@@ -11,22 +11,27 @@ import (
 	"time"
 
 	"mediacloset/api/internal/graph/model"
+	"mediacloset/api/internal/ratelimit"
+	"mediacloset/api/internal/resilient"
 )
 
 // DiscogsService handles requests to the Discogs API
 type DiscogsService struct {
-	client         *http.Client
+	client         httpDoer // Waits for the Discogs rate limit before each attempt
 	consumerKey    string
 	consumerSecret string
 	baseURL        string
 }
 
-// NewDiscogsService creates a new Discogs API client
-func NewDiscogsService(consumerKey, consumerSecret string) *DiscogsService {
+// NewDiscogsService creates a new Discogs API client with rate limiting
+func NewDiscogsService(consumerKey, consumerSecret string, limiter *ratelimit.ServiceLimiter) *DiscogsService {
+	config := resilient.DefaultConfig
+	config.BeforeAttempt = waitForLimit(limiter, ratelimit.ProviderDiscogs)
+
 	return &DiscogsService{
-		client: &http.Client{
+		client: resilient.New("discogs", &http.Client{
 			Timeout: 5 * time.Second,
-		},
+		}, config),
 		consumerKey:    consumerKey,
 		consumerSecret: consumerSecret,
 		baseURL:        "https://api.discogs.com",
@@ -164,3 +169,8 @@ func (s *DiscogsService) SearchByBarcode(ctx context.Context, barcode string) (*
 
 	return albumData, nil
 }
+
+// Ping checks that Discogs is reachable without calling its API
+func (s *DiscogsService) Ping(ctx context.Context) error {
+	return pingHost(ctx, s.baseURL)
+}
@@ -0,0 +1,476 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/agnivade/levenshtein"
+
+	"mediacloset/api/internal/imagehash"
+	"mediacloset/api/internal/normalize"
+)
+
+const (
+	// DefaultCoverThreshold is the maximum Hamming distance (out of 64 bits)
+	// at which two cover hashes are considered the same artwork
+	DefaultCoverThreshold = 10
+
+	// MaxCoverThreshold is the loosest threshold callers may ask for; beyond
+	// it unrelated covers start to match
+	MaxCoverThreshold = 20
+
+	// Items whose covers match only need loosely similar titles; without a
+	// cover match the titles alone have to be nearly identical
+	coverMatchTitleSimilarity = 0.6
+	titleOnlySimilarity       = 0.9
+
+	// hashConcurrency bounds how many covers the background hasher fetches
+	// at once
+	hashConcurrency = 4
+
+	// hashQueueSize bounds how many covers wait to be hashed. Covers dropped
+	// when it is full are queued again the next time their items are loaded.
+	hashQueueSize = 1000
+)
+
+// DuplicateItem is a collection item reduced to what duplicate detection needs
+type DuplicateItem struct {
+	ID        string
+	Kind      MediaKind
+	Title     string // movie title or album name
+	Creator   string // director for movies, artist for albums and cassettes
+	CoverURL  string
+	CreatedAt string
+	PHash     *imagehash.Hash
+	DHash     *imagehash.Hash
+}
+
+// DuplicateCluster groups items that look like copies of the same release
+type DuplicateCluster struct {
+	Kind                 MediaKind
+	SuggestedCanonicalID string
+	Items                []DuplicateItem
+}
+
+// CoverMatch is a collection item whose cover resembles a looked-up image
+type CoverMatch struct {
+	Item     DuplicateItem
+	Distance int
+}
+
+// coverHashJob is a cover waiting to be hashed for one catalog row
+type coverHashJob struct {
+	kind     MediaKind
+	id       string
+	coverURL string
+}
+
+// DuplicateService finds and merges duplicate items in a user's collection
+type DuplicateService struct {
+	hasuraClient *HasuraClient
+	hasher       *CoverHashService
+
+	queue   chan coverHashJob
+	mu      sync.Mutex
+	pending map[string]bool // kind/id of queued jobs
+}
+
+// NewDuplicateService creates a duplicate finder. hasher may be nil, in which
+// case only hashes already stored in Hasura are used. Covers are hashed by
+// RunHasher, never while a query waits.
+func NewDuplicateService(hasuraClient *HasuraClient, hasher *CoverHashService) *DuplicateService {
+	return &DuplicateService{
+		hasuraClient: hasuraClient,
+		hasher:       hasher,
+		queue:        make(chan coverHashJob, hashQueueSize),
+		pending:      map[string]bool{},
+	}
+}
+
+// QueueCoverHash schedules a row's cover to be hashed in the background.
+// Call it whenever a cover is saved. It never blocks: when the queue is full
+// the cover is skipped until its item is next loaded.
+func (s *DuplicateService) QueueCoverHash(kind MediaKind, id, coverURL string) {
+	if s == nil || s.hasher == nil || id == "" || coverURL == "" {
+		return
+	}
+
+	key := string(kind) + "/" + id
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending[key] {
+		return
+	}
+	select {
+	case s.queue <- coverHashJob{kind: kind, id: id, coverURL: coverURL}:
+		s.pending[key] = true
+	default:
+		slog.Warn("Cover hash queue full, skipping cover", "kind", kind, "item_id", id)
+	}
+}
+
+// RunHasher hashes queued covers until ctx is canceled
+func (s *DuplicateService) RunHasher(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < hashConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-s.queue:
+					s.hashCover(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// hashCover computes and stores one cover's hashes. Failures are logged and
+// the item simply takes part in matching by title only.
+func (s *DuplicateService) hashCover(ctx context.Context, job coverHashJob) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, string(job.kind)+"/"+job.id)
+		s.mu.Unlock()
+	}()
+
+	hashes, err := s.hasher.Compute(ctx, job.coverURL)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to hash cover", "kind", job.kind, "item_id", job.id, "error", err)
+		return
+	}
+	// The hashes are stored against the URL they came from, so a cover
+	// replaced in the meantime reads as stale and is queued again
+	if err := s.hasuraClient.SetCoverHash(ctx, job.kind, job.id, job.coverURL, hashes.PHash.String(), hashes.DHash.String()); err != nil {
+		slog.WarnContext(ctx, "Failed to store cover hash", "kind", job.kind, "item_id", job.id, "error", err)
+	}
+}
+
+// FindDuplicates clusters a user's items of one kind by cover similarity and
+// fuzzy title match. Items whose cover isn't hashed yet are matched by title
+// and their covers queued for hashing.
+func (s *DuplicateService) FindDuplicates(ctx context.Context, userID string, kind MediaKind, coverThreshold int) ([]DuplicateCluster, error) {
+	items, err := s.loadItems(ctx, userID, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := clusterDuplicates(items, coverThreshold)
+	clusters := make([]DuplicateCluster, 0, len(groups))
+	for _, group := range groups {
+		clusters = append(clusters, DuplicateCluster{
+			Kind:                 kind,
+			SuggestedCanonicalID: suggestCanonical(group).ID,
+			Items:                group,
+		})
+	}
+
+	return clusters, nil
+}
+
+// MatchCover hashes imageURL and returns the user's items of one kind whose
+// covers are within threshold, closest first
+func (s *DuplicateService) MatchCover(ctx context.Context, userID string, kind MediaKind, imageURL string, threshold, limit int) ([]CoverMatch, error) {
+	if s.hasher == nil {
+		return nil, fmt.Errorf("cover hashing is not configured")
+	}
+
+	target, err := s.hasher.Compute(ctx, imageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.loadItems(ctx, userID, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []CoverMatch{}
+	for _, item := range items {
+		if item.PHash == nil {
+			continue
+		}
+		if d := imagehash.Distance(target.PHash, *item.PHash); d <= threshold {
+			matches = append(matches, CoverMatch{Item: item, Distance: d})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Distance < matches[j].Distance
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches, nil
+}
+
+// MergeDuplicates moves the user's links to the duplicates onto the canonical
+// row. As with a catalog merge, a user can only hold one link to a row, so the
+// first duplicate's link is re-pointed when the user doesn't have the
+// canonical item yet and the rest are deleted. Shared catalog rows are left
+// alone because other users may still reference them. Returns the number of
+// links merged.
+func (s *DuplicateService) MergeDuplicates(ctx context.Context, userID string, kind MediaKind, canonicalID string, duplicateIDs []string) (int, error) {
+	rows, err := s.hasuraClient.GetUserItemsForDedup(ctx, kind, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	owned := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if id, ok := row["id"].(string); ok {
+			owned[id] = true
+		}
+	}
+
+	ids := []string{}
+	seen := map[string]bool{canonicalID: true}
+	for _, id := range duplicateIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if !owned[id] {
+			return 0, fmt.Errorf("item %s is not in your collection", id)
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	moveIDs, dropIDs := []string{}, ids
+	if !owned[canonicalID] {
+		row, err := s.hasuraClient.GetCatalogRow(ctx, kind, canonicalID)
+		if err != nil {
+			return 0, err
+		}
+		if row == nil {
+			return 0, fmt.Errorf("canonical item %s not found", canonicalID)
+		}
+		moveIDs, dropIDs = ids[:1], ids[1:]
+	}
+
+	return s.hasuraClient.MergeUserLinks(ctx, kind, userID, canonicalID, dropIDs, moveIDs)
+}
+
+// loadItems fetches a user's items with their stored cover hashes, queueing
+// covers that are missing one
+func (s *DuplicateService) loadItems(ctx context.Context, userID string, kind MediaKind) ([]DuplicateItem, error) {
+	rows, err := s.hasuraClient.GetUserItemsForDedup(ctx, kind, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]DuplicateItem, 0, len(rows))
+	for _, row := range rows {
+		item := duplicateItemFromRow(kind, row)
+		if item.PHash == nil {
+			s.QueueCoverHash(kind, item.ID, item.CoverURL)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// duplicateItemFromRow converts a Hasura row, keeping stored hashes only if
+// they were computed from the current cover
+func duplicateItemFromRow(kind MediaKind, row map[string]interface{}) DuplicateItem {
+	str := func(key string) string {
+		v, _ := row[key].(string)
+		return v
+	}
+
+	item := DuplicateItem{
+		ID:        str("id"),
+		Kind:      kind,
+		CoverURL:  str("cover_url"),
+		CreatedAt: str("created_at"),
+	}
+	if kind == MediaKindMovie {
+		item.Title = str("title")
+		item.Creator = str("director")
+	} else {
+		item.Title = str("album")
+		item.Creator = str("artist")
+	}
+
+	if item.CoverURL != "" && str("cover_hash_url") == item.CoverURL {
+		phash, perr := imagehash.Parse(str("cover_phash"))
+		dhash, derr := imagehash.Parse(str("cover_dhash"))
+		if perr == nil && derr == nil {
+			item.PHash = &phash
+			item.DHash = &dhash
+		}
+	}
+
+	return item
+}
+
+// clusterDuplicates groups items that match pairwise, transitively. Only
+// groups with more than one item are returned.
+func clusterDuplicates(items []DuplicateItem, coverThreshold int) [][]DuplicateItem {
+	parent := make([]int, len(items))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	// Normalizing is the expensive part of comparing titles, so do it once per item
+	keys := make([]titleKey, len(items))
+	for i, item := range items {
+		keys[i] = newTitleKey(item)
+	}
+
+	for i := range items {
+		for j := i + 1; j < len(items); j++ {
+			if isDuplicate(items[i], items[j], keys[i], keys[j], coverThreshold) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	byRoot := map[int][]DuplicateItem{}
+	roots := []int{}
+	for i, item := range items {
+		root := find(i)
+		if _, ok := byRoot[root]; !ok {
+			roots = append(roots, root)
+		}
+		byRoot[root] = append(byRoot[root], item)
+	}
+
+	clusters := [][]DuplicateItem{}
+	for _, root := range roots {
+		if group := byRoot[root]; len(group) > 1 {
+			sort.SliceStable(group, func(i, j int) bool {
+				return group[i].CreatedAt < group[j].CreatedAt
+			})
+			clusters = append(clusters, group)
+		}
+	}
+
+	return clusters
+}
+
+// isDuplicate reports whether two items look like the same release. When both
+// covers are hashed and clearly differ, only an exact title match counts, so
+// "Kid A" and "Kid B" with their own artwork stay apart.
+func isDuplicate(a, b DuplicateItem, ka, kb titleKey, coverThreshold int) bool {
+	x, y := ka.compareWith(kb)
+	if coversMatch(a, b, coverThreshold) {
+		return stringSimilarity(x, y) >= coverMatchTitleSimilarity
+	}
+	if hasHashes(a) && hasHashes(b) {
+		return x != "" && x == y
+	}
+	return similarAtLeast(x, y, titleOnlySimilarity)
+}
+
+func hasHashes(item DuplicateItem) bool {
+	return item.PHash != nil && item.DHash != nil
+}
+
+// coversMatch requires both hashes to agree, which keeps unrelated covers with
+// similar layouts (plain text on a flat background) from matching
+func coversMatch(a, b DuplicateItem, threshold int) bool {
+	if !hasHashes(a) || !hasHashes(b) {
+		return false
+	}
+	return imagehash.Distance(*a.PHash, *b.PHash) <= threshold &&
+		imagehash.Distance(*a.DHash, *b.DHash) <= threshold
+}
+
+// titleKey holds an item's normalized title, with and without its creator
+type titleKey struct {
+	title string
+	full  string // creator and title; empty when the item has no creator
+}
+
+func newTitleKey(item DuplicateItem) titleKey {
+	key := titleKey{title: normalize.Title(item.Title)}
+	if item.Creator != "" {
+		key.full = normalize.Name(item.Creator) + " " + key.title
+	}
+	return key
+}
+
+// compareWith picks the strings to compare: creator and title together,
+// falling back to the title alone when either item is missing a creator
+func (k titleKey) compareWith(other titleKey) (string, string) {
+	if k.full == "" || other.full == "" {
+		return k.title, other.title
+	}
+	return k.full, other.full
+}
+
+// similarAtLeast reports whether stringSimilarity(a, b) >= min, skipping the
+// edit distance when the lengths alone rule it out
+func similarAtLeast(a, b string, min float64) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	if a == b {
+		return true
+	}
+
+	la, lb := utf8.RuneCountInString(a), utf8.RuneCountInString(b)
+	longest, diff := la, la-lb
+	if lb > la {
+		longest, diff = lb, lb-la
+	}
+	// The edit distance is at least the difference in length
+	if 1-float64(diff)/float64(longest) < min {
+		return false
+	}
+	return stringSimilarity(a, b) >= min
+}
+
+// stringSimilarity is 1 minus the Levenshtein distance between a and b
+// relative to the longer string
+func stringSimilarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+
+	longest := utf8.RuneCountInString(a)
+	if n := utf8.RuneCountInString(b); n > longest {
+		longest = n
+	}
+	return 1 - float64(levenshtein.ComputeDistance(a, b))/float64(longest)
+}
+
+// suggestCanonical prefers an item with a cover, then the oldest
+func suggestCanonical(items []DuplicateItem) DuplicateItem {
+	best := items[0]
+	for _, item := range items[1:] {
+		if best.CoverURL == "" && item.CoverURL != "" {
+			best = item
+			continue
+		}
+		if (best.CoverURL == "") == (item.CoverURL == "") && item.CreatedAt < best.CreatedAt {
+			best = item
+		}
+	}
+	return best
+}
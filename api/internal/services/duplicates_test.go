@@ -0,0 +1,513 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mediacloset/api/internal/imagehash"
+)
+
+// testCoverImage draws a simple synthetic cover. Different variants produce
+// unrelated artwork; the same variant at another size is a near duplicate.
+func testCoverImage(w, h, variant int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v uint8
+			if variant == 0 {
+				v = uint8(255 * x / w)
+				if x > w/4 && x < w/2 && y > h/4 && y < h/2 {
+					v = 20
+				}
+			} else {
+				v = 40
+				if (x*8/w)%2 == 0 {
+					v = 200
+				}
+			}
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 70}); err != nil {
+		t.Fatalf("failed to encode jpeg: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func hashPtr(t *testing.T, img image.Image) (*imagehash.Hash, *imagehash.Hash) {
+	t.Helper()
+	p, d := imagehash.PHash(img), imagehash.DHash(img)
+	return &p, &d
+}
+
+func TestClusterDuplicates(t *testing.T) {
+	coverA1, coverA1d := hashPtr(t, testCoverImage(600, 600, 0))
+	coverA2, coverA2d := hashPtr(t, testCoverImage(300, 300, 0))
+	coverB, coverBd := hashPtr(t, testCoverImage(600, 600, 1))
+
+	tests := []struct {
+		name     string
+		items    []DuplicateItem
+		expected [][]string
+	}{
+		{
+			name: "same cover with artist misspelling",
+			items: []DuplicateItem{
+				{ID: "1", Creator: "Radiohead", Title: "OK Computer", PHash: coverA1, DHash: coverA1d},
+				{ID: "2", Creator: "Radio Head", Title: "OK Computor", PHash: coverA2, DHash: coverA2d},
+				{ID: "3", Creator: "Portishead", Title: "Dummy", PHash: coverB, DHash: coverBd},
+			},
+			expected: [][]string{{"1", "2"}},
+		},
+		{
+			name: "identical titles without covers",
+			items: []DuplicateItem{
+				{ID: "1", Creator: "The Cure", Title: "Disintegration"},
+				{ID: "2", Creator: "the cure", Title: "Disintegration!"},
+			},
+			expected: [][]string{{"1", "2"}},
+		},
+		{
+			name: "matching covers but unrelated titles",
+			items: []DuplicateItem{
+				{ID: "1", Creator: "Various Artists", Title: "Now 12", PHash: coverA1, DHash: coverA1d},
+				{ID: "2", Creator: "Bjork", Title: "Homogenic", PHash: coverA2, DHash: coverA2d},
+			},
+			expected: [][]string{},
+		},
+		{
+			name: "similar titles but different covers",
+			items: []DuplicateItem{
+				{ID: "1", Creator: "Radiohead", Title: "Kid A", PHash: coverA1, DHash: coverA1d},
+				{ID: "2", Creator: "Radiohead", Title: "Kid B", PHash: coverB, DHash: coverBd},
+			},
+			expected: [][]string{},
+		},
+		{
+			name: "missing creator falls back to title",
+			items: []DuplicateItem{
+				{ID: "1", Title: "The Thing"},
+				{ID: "2", Creator: "John Carpenter", Title: "The Thing"},
+			},
+			expected: [][]string{{"1", "2"}},
+		},
+		{
+			name: "transitive matches form one cluster",
+			items: []DuplicateItem{
+				{ID: "1", Creator: "Sigur Ros", Title: "Agaetis Byrjun", PHash: coverA1, DHash: coverA1d},
+				{ID: "2", Creator: "Sigur Rós", Title: "Ágætis byrjun"},
+				{ID: "3", Creator: "Sigur Ros", Title: "Agaetis Byrjun (Remaster)", PHash: coverA2, DHash: coverA2d},
+			},
+			expected: [][]string{{"1", "2", "3"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusters := clusterDuplicates(tt.items, DefaultCoverThreshold)
+			if len(clusters) != len(tt.expected) {
+				t.Fatalf("expected %d clusters, got %d: %+v", len(tt.expected), len(clusters), clusters)
+			}
+			for i, cluster := range clusters {
+				ids := []string{}
+				for _, item := range cluster {
+					ids = append(ids, item.ID)
+				}
+				if strings.Join(ids, ",") != strings.Join(tt.expected[i], ",") {
+					t.Errorf("cluster %d: expected %v, got %v", i, tt.expected[i], ids)
+				}
+			}
+		})
+	}
+}
+
+func TestSuggestCanonical(t *testing.T) {
+	items := []DuplicateItem{
+		{ID: "newest-with-cover", CoverURL: "https://example.com/a.jpg", CreatedAt: "2024-03-01T00:00:00Z"},
+		{ID: "oldest-no-cover", CreatedAt: "2023-01-01T00:00:00Z"},
+		{ID: "older-with-cover", CoverURL: "https://example.com/b.jpg", CreatedAt: "2024-01-01T00:00:00Z"},
+	}
+
+	if got := suggestCanonical(items).ID; got != "older-with-cover" {
+		t.Errorf("expected older-with-cover, got %s", got)
+	}
+}
+
+// fakeDedupHasura answers the dedup queries from an in-memory item list and
+// records hashes written back, applying them to the items. Catalog rows
+// outside the user's collection are looked up in catalog.
+type fakeDedupHasura struct {
+	mu      sync.Mutex
+	items   []map[string]interface{}
+	catalog []string
+	stored  map[string]map[string]interface{}
+	dropped []string
+	moved   []string
+}
+
+func (f *fakeDedupHasura) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		var data map[string]interface{}
+		switch req.OperationName {
+		case "GetUserItemsForDedup":
+			entries := []map[string]interface{}{}
+			for _, item := range f.items {
+				entries = append(entries, map[string]interface{}{"record": item})
+			}
+			data = map[string]interface{}{"user_records": entries}
+		case "SetCoverHash":
+			id := req.Variables["id"].(string)
+			changes := req.Variables["changes"].(map[string]interface{})
+			f.stored[id] = changes
+			for _, item := range f.items {
+				if item["id"] == id {
+					for k, v := range changes {
+						item[k] = v
+					}
+				}
+			}
+			data = map[string]interface{}{"update_records_by_pk": map[string]interface{}{"id": id}}
+		case "GetCatalogRow":
+			var row interface{}
+			for _, id := range f.catalog {
+				if id == req.Variables["id"] {
+					row = map[string]interface{}{"id": id}
+				}
+			}
+			data = map[string]interface{}{"records_by_pk": row}
+		case "MergeUserLinks":
+			for _, id := range req.Variables["drop_ids"].([]interface{}) {
+				f.dropped = append(f.dropped, id.(string))
+			}
+			for _, id := range req.Variables["move_ids"].([]interface{}) {
+				f.moved = append(f.moved, id.(string))
+			}
+			data = map[string]interface{}{
+				"drop_links": map[string]interface{}{"affected_rows": len(f.dropped)},
+				"move_links": map[string]interface{}{"affected_rows": len(f.moved)},
+			}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+}
+
+func newTestDuplicateService(t *testing.T, items []map[string]interface{}) (*DuplicateService, *fakeDedupHasura) {
+	t.Helper()
+
+	fake := &fakeDedupHasura{items: items, stored: map[string]map[string]interface{}{}}
+	hasura := httptest.NewServer(fake.handler(t))
+	t.Cleanup(hasura.Close)
+
+	return NewDuplicateService(NewHasuraClient(hasura.URL, ""), NewCoverHashService(true)), fake
+}
+
+func TestDuplicateService_FindDuplicates(t *testing.T) {
+	covers := map[string][]byte{
+		"/original.png": encodePNG(t, testCoverImage(600, 600, 0)),
+		"/rescan.jpg":   encodeJPEG(t, testCoverImage(350, 350, 0)),
+		"/other.png":    encodePNG(t, testCoverImage(600, 600, 1)),
+	}
+	var fetches atomic.Int32
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		body, ok := covers[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(body)
+	}))
+	defer images.Close()
+
+	otherHash := imagehash.PHash(testCoverImage(600, 600, 1)).String()
+	items := []map[string]interface{}{
+		{"id": "r1", "artist": "Radiohead", "album": "OK Computer", "cover_url": images.URL + "/original.png", "created_at": "2023-01-01T00:00:00Z"},
+		{"id": "r2", "artist": "Radio Head", "album": "OK Computor", "cover_url": images.URL + "/rescan.jpg", "created_at": "2024-01-01T00:00:00Z"},
+		// Stored hash for a different cover URL is stale and must be recomputed
+		{"id": "r3", "artist": "Portishead", "album": "Dummy", "cover_url": images.URL + "/other.png", "cover_phash": otherHash, "cover_dhash": otherHash, "cover_hash_url": images.URL + "/old.png", "created_at": "2023-06-01T00:00:00Z"},
+		{"id": "r4", "artist": "Portishead", "album": "Third", "cover_url": images.URL + "/missing.png", "created_at": "2023-07-01T00:00:00Z"},
+	}
+
+	service, fake := newTestDuplicateService(t, items)
+
+	// The query must not wait on cover downloads; it queues them instead
+	if _, err := service.FindDuplicates(context.Background(), "user-1", MediaKindAlbum, DefaultCoverThreshold); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := fetches.Load(); n != 0 {
+		t.Errorf("expected no cover fetches during the query, got %d", n)
+	}
+
+	runHasherUntilIdle(t, service)
+
+	clusters, err := service.FindDuplicates(context.Background(), "user-1", MediaKindAlbum, DefaultCoverThreshold)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(clusters) != 1 {
+		t.Fatalf("expected 1 cluster, got %d: %+v", len(clusters), clusters)
+	}
+	if clusters[0].SuggestedCanonicalID != "r1" {
+		t.Errorf("expected r1 as canonical, got %s", clusters[0].SuggestedCanonicalID)
+	}
+	if len(clusters[0].Items) != 2 || clusters[0].Items[0].ID != "r1" || clusters[0].Items[1].ID != "r2" {
+		t.Errorf("expected cluster [r1 r2], got %+v", clusters[0].Items)
+	}
+
+	for _, id := range []string{"r1", "r2", "r3"} {
+		changes, ok := fake.stored[id]
+		if !ok {
+			t.Errorf("expected hash to be stored for %s", id)
+			continue
+		}
+		if changes["cover_hash_url"] == nil || !strings.HasPrefix(changes["cover_hash_url"].(string), images.URL) {
+			t.Errorf("expected cover_hash_url to be recorded for %s, got %v", id, changes["cover_hash_url"])
+		}
+	}
+	if _, ok := fake.stored["r4"]; ok {
+		t.Error("expected no hash stored for a cover that failed to download")
+	}
+}
+
+// runHasherUntilIdle runs the background hasher until every queued cover is done
+func runHasherUntilIdle(t *testing.T, service *DuplicateService) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		service.RunHasher(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		service.mu.Lock()
+		idle := len(service.pending) == 0
+		service.mu.Unlock()
+		if idle {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for covers to be hashed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDuplicateService_QueueCoverHash(t *testing.T) {
+	service, _ := newTestDuplicateService(t, nil)
+
+	service.QueueCoverHash(MediaKindAlbum, "r1", "https://example.com/a.jpg")
+	service.QueueCoverHash(MediaKindAlbum, "r1", "https://example.com/a.jpg")
+	service.QueueCoverHash(MediaKindAlbum, "r2", "")
+	if n := len(service.queue); n != 1 {
+		t.Errorf("expected one queued cover, got %d", n)
+	}
+
+	for i := 0; i < hashQueueSize+10; i++ {
+		service.QueueCoverHash(MediaKindMovie, fmt.Sprintf("m%d", i), "https://example.com/m.jpg")
+	}
+	if n := len(service.queue); n != hashQueueSize {
+		t.Errorf("expected the queue to stop at %d, got %d", hashQueueSize, n)
+	}
+
+	var unset *DuplicateService
+	unset.QueueCoverHash(MediaKindAlbum, "r1", "https://example.com/a.jpg")
+}
+
+func TestDuplicateService_MergeDuplicates(t *testing.T) {
+	items := []map[string]interface{}{
+		{"id": "r1", "artist": "Radiohead", "album": "OK Computer"},
+		{"id": "r2", "artist": "Radio Head", "album": "OK Computer"},
+		{"id": "r3", "artist": "radiohead", "album": "ok computer"},
+	}
+
+	tests := []struct {
+		name         string
+		canonicalID  string
+		duplicateIDs []string
+		expectErr    bool
+		expectDrop   []string
+		expectMove   []string
+	}{
+		{
+			name:         "drops duplicates when the canonical item is owned",
+			canonicalID:  "r1",
+			duplicateIDs: []string{"r2", "r1", "r3", "r2"},
+			expectDrop:   []string{"r2", "r3"},
+		},
+		{
+			name:         "moves the first link onto a canonical row outside the collection",
+			canonicalID:  "shared",
+			duplicateIDs: []string{"r2", "r3"},
+			expectDrop:   []string{"r3"},
+			expectMove:   []string{"r2"},
+		},
+		{
+			name:         "rejects a canonical row that doesn't exist",
+			canonicalID:  "missing",
+			duplicateIDs: []string{"r2"},
+			expectErr:    true,
+		},
+		{
+			name:         "rejects duplicate outside the collection",
+			canonicalID:  "r1",
+			duplicateIDs: []string{"r2", "someone-elses"},
+			expectErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, fake := newTestDuplicateService(t, items)
+			fake.catalog = []string{"shared"}
+
+			merged, err := service.MergeDuplicates(context.Background(), "user-1", MediaKindAlbum, tt.canonicalID, tt.duplicateIDs)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				if len(fake.dropped)+len(fake.moved) != 0 {
+					t.Errorf("expected no links changed, got dropped %v moved %v", fake.dropped, fake.moved)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if expected := len(tt.expectDrop) + len(tt.expectMove); merged != expected {
+				t.Errorf("expected %d merged, got %d", expected, merged)
+			}
+			if strings.Join(fake.dropped, ",") != strings.Join(tt.expectDrop, ",") {
+				t.Errorf("expected %v dropped, got %v", tt.expectDrop, fake.dropped)
+			}
+			if strings.Join(fake.moved, ",") != strings.Join(tt.expectMove, ",") {
+				t.Errorf("expected %v moved, got %v", tt.expectMove, fake.moved)
+			}
+		})
+	}
+}
+
+func TestCoverHashService_Compute(t *testing.T) {
+	cover := encodePNG(t, testCoverImage(400, 400, 0))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cover.png":
+			w.Write(cover)
+		case "/not-an-image":
+			io.WriteString(w, "<html></html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	expected := imagehash.PHash(testCoverImage(400, 400, 0))
+
+	tests := []struct {
+		name         string
+		allowPrivate bool
+		url          string
+		expectErr    bool
+	}{
+		{name: "hashes image", allowPrivate: true, url: server.URL + "/cover.png"},
+		{name: "not found", allowPrivate: true, url: server.URL + "/missing.png", expectErr: true},
+		{name: "not an image", allowPrivate: true, url: server.URL + "/not-an-image", expectErr: true},
+		{name: "unsupported scheme", allowPrivate: true, url: "file:///etc/passwd", expectErr: true},
+		{name: "loopback blocked outside development", allowPrivate: false, url: server.URL + "/cover.png", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashes, err := NewCoverHashService(tt.allowPrivate).Compute(context.Background(), tt.url)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if hashes.PHash != expected {
+				t.Errorf("expected pHash %s, got %s", expected, hashes.PHash)
+			}
+		})
+	}
+}
+
+func TestRejectNonPublicAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		blocked bool
+	}{
+		{"93.184.216.34:443", false},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", false},
+		{"127.0.0.1:80", true},
+		{"10.0.0.5:80", true},
+		{"169.254.169.254:80", true},
+		{"[::ffff:169.254.169.254]:80", true},
+		{"[::ffff:10.0.0.5]:80", true},
+		{"100.64.0.1:80", true},
+		{"198.18.0.1:80", true},
+		{"0.0.0.0:80", true},
+		{"[::1]:80", true},
+		{"[fd00:ec2::254]:80", true},
+		{"[64:ff9b::a9fe:a9fe]:80", true},
+		{"[2002:a9fe:a9fe::1]:80", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := rejectNonPublicAddress("tcp", tt.address, nil)
+			if blocked := err != nil; blocked != tt.blocked {
+				t.Errorf("expected blocked=%v, got error %v", tt.blocked, err)
+			}
+		})
+	}
+}
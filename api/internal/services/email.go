@@ -2,8 +2,11 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"html"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -39,9 +42,23 @@ func NewEmailService(ctx context.Context, region, accessKeyID, secretAccessKey,
 // SendLoginCode sends a login code email to the user
 func (e *EmailService) SendLoginCode(ctx context.Context, toEmail, code string) error {
 	subject := fmt.Sprintf("Your %s login code: %s", e.appName, code)
-	htmlBody := e.buildLoginCodeHTML(code)
-	textBody := e.buildLoginCodeText(code)
+	return e.send(ctx, toEmail, subject, e.buildLoginCodeHTML(code), e.buildLoginCodeText(code))
+}
+
+// SendMagicLink sends a one-tap sign-in link to the user
+func (e *EmailService) SendMagicLink(ctx context.Context, toEmail, link string) error {
+	subject := fmt.Sprintf("Sign in to %s", e.appName)
+	return e.send(ctx, toEmail, subject, e.buildMagicLinkHTML(link), e.buildMagicLinkText(link))
+}
+
+// SendEmailChangeCode sends one of the two codes that confirm an email
+// change. Both the current and the new address get their own code.
+func (e *EmailService) SendEmailChangeCode(ctx context.Context, toEmail, code, newEmail string) error {
+	subject := fmt.Sprintf("Confirm your %s email change: %s", e.appName, code)
+	return e.send(ctx, toEmail, subject, e.buildEmailChangeHTML(code, newEmail), e.buildEmailChangeText(code, newEmail))
+}
 
+func (e *EmailService) send(ctx context.Context, toEmail, subject, htmlBody, textBody string) error {
 	input := &sesv2.SendEmailInput{
 		FromEmailAddress: aws.String(e.fromEmail),
 		Destination: &types.Destination{
@@ -75,6 +92,25 @@ func (e *EmailService) SendLoginCode(ctx context.Context, toEmail, code string)
 	return nil
 }
 
+// ErrEmailSandbox means SES only delivers to verified addresses
+var ErrEmailSandbox = errors.New("SES account is in the sandbox")
+
+// Ping checks SES accepts the credentials and can send. Returns
+// ErrEmailSandbox when it can only send to verified addresses.
+func (e *EmailService) Ping(ctx context.Context) error {
+	account, err := e.sesClient.GetAccount(ctx, &sesv2.GetAccountInput{})
+	if err != nil {
+		return fmt.Errorf("failed to get SES account: %w", err)
+	}
+	if !account.SendingEnabled {
+		return errors.New("SES sending is paused for this account")
+	}
+	if !account.ProductionAccessEnabled {
+		return ErrEmailSandbox
+	}
+	return nil
+}
+
 // buildLoginCodeHTML creates a beautiful, responsive HTML email
 func (e *EmailService) buildLoginCodeHTML(code string) string {
 	// Format the code with spaces for readability (e.g., "123 456")
@@ -159,6 +195,176 @@ If you didn't request this code, you can safely ignore this email.
 - The %s Team`, e.appName, code, e.appName)
 }
 
+// buildMagicLinkHTML matches the login code email, with a button instead of the code
+func (e *EmailService) buildMagicLinkHTML(link string) string {
+	escaped := html.EscapeString(link)
+
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1.0">
+  <meta http-equiv="X-UA-Compatible" content="IE=edge">
+  <title>Sign in to %s</title>
+</head>
+<body style="margin: 0; padding: 0; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; background-color: #f5f5f7; -webkit-font-smoothing: antialiased;">
+  <table role="presentation" width="100%%" cellpadding="0" cellspacing="0" style="background-color: #f5f5f7;">
+    <tr>
+      <td align="center" style="padding: 40px 20px;">
+        <table role="presentation" width="100%%" cellpadding="0" cellspacing="0" style="max-width: 440px; background-color: #ffffff; border-radius: 16px; box-shadow: 0 4px 6px rgba(0, 0, 0, 0.05);">
+          <!-- Header -->
+          <tr>
+            <td style="padding: 40px 40px 24px 40px; text-align: center;">
+              <div style="display: inline-block; background: linear-gradient(135deg, #6366f1 0%%, #8b5cf6 100%%); width: 56px; height: 56px; border-radius: 14px; line-height: 56px;">
+                <span style="font-size: 28px;">📦</span>
+              </div>
+              <h1 style="margin: 20px 0 0 0; font-size: 22px; font-weight: 600; color: #1a1a1a;">%s</h1>
+            </td>
+          </tr>
+
+          <!-- Main Content -->
+          <tr>
+            <td style="padding: 0 40px;">
+              <p style="margin: 0 0 24px 0; font-size: 15px; line-height: 24px; color: #666666; text-align: center;">
+                Tap the button on your iPhone to sign in. The link works once and expires in 15 minutes.
+              </p>
+            </td>
+          </tr>
+
+          <!-- Button -->
+          <tr>
+            <td style="padding: 0 40px; text-align: center;">
+              <a href="%s" style="display: inline-block; background-color: #6366f1; color: #ffffff; font-size: 16px; font-weight: 600; text-decoration: none; padding: 14px 32px; border-radius: 12px;">Sign in to %s</a>
+            </td>
+          </tr>
+
+          <!-- Security Notice -->
+          <tr>
+            <td style="padding: 24px 40px 40px 40px;">
+              <p style="margin: 0; font-size: 13px; line-height: 20px; color: #999999; text-align: center;">
+                If you didn't request this link, you can safely ignore this email. Someone may have entered your email by mistake.
+              </p>
+            </td>
+          </tr>
+
+          <!-- Footer -->
+          <tr>
+            <td style="padding: 24px 40px; border-top: 1px solid #f0f0f0; text-align: center;">
+              <p style="margin: 0; font-size: 12px; color: #999999;">
+                © %d %s. All rights reserved.
+              </p>
+            </td>
+          </tr>
+        </table>
+      </td>
+    </tr>
+  </table>
+</body>
+</html>`, e.appName, e.appName, escaped, e.appName, time.Now().Year(), e.appName)
+}
+
+// buildMagicLinkText creates a plain text version for email clients that don't support HTML
+func (e *EmailService) buildMagicLinkText(link string) string {
+	return fmt.Sprintf(`%s - Sign in
+
+Open this link on your iPhone to sign in:
+
+%s
+
+The link works once and expires in 15 minutes.
+
+If you didn't request this link, you can safely ignore this email.
+
+- The %s Team`, e.appName, link, e.appName)
+}
+
+// buildEmailChangeHTML matches the login code email, explaining which
+// address the account is moving to
+func (e *EmailService) buildEmailChangeHTML(code, newEmail string) string {
+	formattedCode := formatCodeWithSpaces(code)
+	escaped := html.EscapeString(newEmail)
+
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1.0">
+  <meta http-equiv="X-UA-Compatible" content="IE=edge">
+  <title>Confirm your email change</title>
+</head>
+<body style="margin: 0; padding: 0; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; background-color: #f5f5f7; -webkit-font-smoothing: antialiased;">
+  <table role="presentation" width="100%%" cellpadding="0" cellspacing="0" style="background-color: #f5f5f7;">
+    <tr>
+      <td align="center" style="padding: 40px 20px;">
+        <table role="presentation" width="100%%" cellpadding="0" cellspacing="0" style="max-width: 440px; background-color: #ffffff; border-radius: 16px; box-shadow: 0 4px 6px rgba(0, 0, 0, 0.05);">
+          <!-- Header -->
+          <tr>
+            <td style="padding: 40px 40px 24px 40px; text-align: center;">
+              <div style="display: inline-block; background: linear-gradient(135deg, #6366f1 0%%, #8b5cf6 100%%); width: 56px; height: 56px; border-radius: 14px; line-height: 56px;">
+                <span style="font-size: 28px;">📦</span>
+              </div>
+              <h1 style="margin: 20px 0 0 0; font-size: 22px; font-weight: 600; color: #1a1a1a;">%s</h1>
+            </td>
+          </tr>
+
+          <!-- Main Content -->
+          <tr>
+            <td style="padding: 0 40px;">
+              <p style="margin: 0 0 24px 0; font-size: 15px; line-height: 24px; color: #666666; text-align: center;">
+                Someone asked to change your account email to <strong>%s</strong>. Enter this code along with the one sent to the other address. It expires in 15 minutes.
+              </p>
+            </td>
+          </tr>
+
+          <!-- Code Box -->
+          <tr>
+            <td style="padding: 0 40px;">
+              <div style="background-color: #f8f9fa; border-radius: 12px; padding: 24px; text-align: center; border: 1px solid #e9ecef;">
+                <span style="font-family: 'SF Mono', SFMono-Regular, Consolas, 'Liberation Mono', Menlo, monospace; font-size: 36px; font-weight: 600; letter-spacing: 8px; color: #1a1a1a;">%s</span>
+              </div>
+            </td>
+          </tr>
+
+          <!-- Security Notice -->
+          <tr>
+            <td style="padding: 24px 40px 40px 40px;">
+              <p style="margin: 0; font-size: 13px; line-height: 20px; color: #999999; text-align: center;">
+                If you didn't ask for this, don't share the code. Your email stays the same unless both codes are entered.
+              </p>
+            </td>
+          </tr>
+
+          <!-- Footer -->
+          <tr>
+            <td style="padding: 24px 40px; border-top: 1px solid #f0f0f0; text-align: center;">
+              <p style="margin: 0; font-size: 12px; color: #999999;">
+                © %d %s. All rights reserved.
+              </p>
+            </td>
+          </tr>
+        </table>
+      </td>
+    </tr>
+  </table>
+</body>
+</html>`, e.appName, escaped, formattedCode, time.Now().Year(), e.appName)
+}
+
+// buildEmailChangeText creates a plain text version for email clients that don't support HTML
+func (e *EmailService) buildEmailChangeText(code, newEmail string) string {
+	return fmt.Sprintf(`%s - Confirm your email change
+
+Someone asked to change your account email to %s.
+
+Your confirmation code is: %s
+
+Enter it along with the code sent to the other address. It expires in 15 minutes.
+
+If you didn't ask for this, don't share the code. Your email stays the same unless both codes are entered.
+
+- The %s Team`, e.appName, newEmail, code, e.appName)
+}
+
 // formatCodeWithSpaces adds a space in the middle of the code for readability
 func formatCodeWithSpaces(code string) string {
 	if len(code) <= 3 {
@@ -7,8 +7,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"mediacloset/api/internal/normalize"
+	"mediacloset/api/internal/tracing"
 )
 
 // HasuraClient handles requests to Hasura GraphQL API
@@ -44,6 +51,15 @@ type GraphQLResponse struct {
 
 // Execute executes a GraphQL query/mutation against Hasura
 func (h *HasuraClient) Execute(ctx context.Context, req GraphQLRequest) (*GraphQLResponse, error) {
+	ctx, span := tracing.Start(ctx, "hasura "+req.OperationName, trace.SpanKindClient,
+		attribute.String("graphql.operation.name", req.OperationName),
+	)
+	resp, err := h.execute(ctx, req)
+	tracing.End(span, err)
+	return resp, err
+}
+
+func (h *HasuraClient) execute(ctx context.Context, req GraphQLRequest) (*GraphQLResponse, error) {
 	// Marshal request to JSON
 	reqBody, err := json.Marshal(req)
 	if err != nil {
@@ -61,6 +77,7 @@ func (h *HasuraClient) Execute(ctx context.Context, req GraphQLRequest) (*GraphQ
 	if h.adminSecret != "" {
 		httpReq.Header.Set("x-hasura-admin-secret", h.adminSecret)
 	}
+	tracing.Inject(ctx, httpReq.Header)
 
 	// Execute request
 	resp, err := h.client.Do(httpReq)
@@ -94,8 +111,18 @@ func (h *HasuraClient) Execute(ctx context.Context, req GraphQLRequest) (*GraphQ
 	return &graphQLResp, nil
 }
 
+// Ping checks that Hasura answers queries
+func (h *HasuraClient) Ping(ctx context.Context) error {
+	_, err := h.Execute(ctx, GraphQLRequest{Query: "query Ping { __typename }", OperationName: "Ping"})
+	return err
+}
+
 // InsertVHS inserts a new VHS record into Hasura
 func (h *HasuraClient) InsertVHS(ctx context.Context, vhs map[string]interface{}) (string, error) {
+	if _, ok := vhs["normalized_key"]; !ok {
+		vhs["normalized_key"] = MediaKindMovie.NormalizedKey(vhs)
+	}
+
 	query := `
 		mutation InsertVHS($object: vhs_insert_input!) {
 			insert_vhs_one(object: $object) {
@@ -134,6 +161,10 @@ func (h *HasuraClient) InsertVHS(ctx context.Context, vhs map[string]interface{}
 
 // InsertRecord inserts a new record into Hasura
 func (h *HasuraClient) InsertRecord(ctx context.Context, record map[string]interface{}) (string, error) {
+	if _, ok := record["normalized_key"]; !ok {
+		record["normalized_key"] = MediaKindAlbum.NormalizedKey(record)
+	}
+
 	query := `
 		mutation InsertRecord($object: records_insert_input!) {
 			insert_records_one(object: $object) {
@@ -173,55 +204,6 @@ func (h *HasuraClient) InsertRecord(ctx context.Context, record map[string]inter
 	return "", fmt.Errorf("failed to extract record ID from response")
 }
 
-// GetAllMovies fetches all VHS movies from Hasura
-func (h *HasuraClient) GetAllMovies(ctx context.Context) ([]map[string]interface{}, error) {
-	query := `
-		query GetAllMovies {
-			vhs(order_by: {created_at: desc}) {
-				id
-				title
-				director
-				year
-				genre
-				cover_url
-				created_at
-				updated_at
-			}
-		}
-	`
-
-	req := GraphQLRequest{
-		Query:         query,
-		OperationName: "GetAllMovies",
-	}
-
-	resp, err := h.Execute(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
-	}
-
-	// Extract vhs array from response
-	vhsData, ok := resp.Data["vhs"]
-	if !ok {
-		return []map[string]interface{}{}, nil // No movies found
-	}
-
-	vhsList, ok := vhsData.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("unexpected vhs data type")
-	}
-
-	// Convert to []map[string]interface{}
-	movies := make([]map[string]interface{}, 0, len(vhsList))
-	for _, v := range vhsList {
-		if movie, ok := v.(map[string]interface{}); ok {
-			movies = append(movies, movie)
-		}
-	}
-
-	return movies, nil
-}
-
 // GetMoviesByUserID fetches all VHS movies for a specific user (via junction table)
 func (h *HasuraClient) GetMoviesByUserID(ctx context.Context, userID string) ([]map[string]interface{}, error) {
 	query := `
@@ -278,58 +260,6 @@ func (h *HasuraClient) GetMoviesByUserID(ctx context.Context, userID string) ([]
 	return movies, nil
 }
 
-// GetAllAlbums fetches all records/albums from Hasura
-func (h *HasuraClient) GetAllAlbums(ctx context.Context) ([]map[string]interface{}, error) {
-	query := `
-		query GetAllAlbums {
-			records(order_by: {created_at: desc}) {
-				id
-				artist
-				album
-				year
-				label
-				color_variants
-				genres
-				cover_url
-				size
-				created_at
-				updated_at
-			}
-		}
-	`
-
-	req := GraphQLRequest{
-		Query:         query,
-		OperationName: "GetAllAlbums",
-	}
-
-	resp, err := h.Execute(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
-	}
-
-	// Extract records array from response
-	recordsData, ok := resp.Data["records"]
-	if !ok {
-		return []map[string]interface{}{}, nil // No albums found
-	}
-
-	recordsList, ok := recordsData.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("unexpected records data type")
-	}
-
-	// Convert to []map[string]interface{}
-	albums := make([]map[string]interface{}, 0, len(recordsList))
-	for _, r := range recordsList {
-		if album, ok := r.(map[string]interface{}); ok {
-			albums = append(albums, album)
-		}
-	}
-
-	return albums, nil
-}
-
 // GetAlbumsByUserID fetches all albums for a specific user (via junction table)
 func (h *HasuraClient) GetAlbumsByUserID(ctx context.Context, userID string) ([]map[string]interface{}, error) {
 	query := `
@@ -573,21 +503,23 @@ func (h *HasuraClient) UpdateAlbum(ctx context.Context, id string, updates map[s
 	return album, nil
 }
 
-// FindMovieByTitle searches for an existing movie by title, director, and year
+// FindMovieByTitle searches for an existing movie by normalized title, narrowed by
+// director and year when given. Rows saved before normalized keys existed are
+// matched on the exact title until they are backfilled.
 func (h *HasuraClient) FindMovieByTitle(ctx context.Context, title string, director *string, year *int) (map[string]interface{}, error) {
-	// Build where clause
-	whereParts := []string{fmt.Sprintf(`title: {_eq: "%s"}`, title)}
-	if director != nil && *director != "" {
-		whereParts = append(whereParts, fmt.Sprintf(`director: {_eq: "%s"}`, *director))
+	where := map[string]interface{}{
+		"_or": []interface{}{
+			map[string]interface{}{"normalized_key": map[string]interface{}{"_eq": normalize.MovieKey(title)}},
+			map[string]interface{}{"normalized_key": map[string]interface{}{"_is_null": true}, "title": map[string]interface{}{"_eq": title}},
+		},
 	}
 	if year != nil {
-		whereParts = append(whereParts, fmt.Sprintf(`year: {_eq: %d}`, *year))
+		where["year"] = map[string]interface{}{"_eq": *year}
 	}
-	whereClause := strings.Join(whereParts, ", ")
 
-	query := fmt.Sprintf(`
-		query FindMovieByTitle {
-			vhs(where: {%s}, limit: 1) {
+	query := `
+		query FindMovieByTitle($where: vhs_bool_exp!) {
+			vhs(where: $where, order_by: {created_at: asc}) {
 				id
 				title
 				director
@@ -598,11 +530,14 @@ func (h *HasuraClient) FindMovieByTitle(ctx context.Context, title string, direc
 				updated_at
 			}
 		}
-	`, whereClause)
+	`
 
 	req := GraphQLRequest{
 		Query:         query,
 		OperationName: "FindMovieByTitle",
+		Variables: map[string]interface{}{
+			"where": where,
+		},
 	}
 
 	resp, err := h.Execute(ctx, req)
@@ -620,18 +555,39 @@ func (h *HasuraClient) FindMovieByTitle(ctx context.Context, title string, direc
 		return nil, nil // Movie not found
 	}
 
-	if movie, ok := vhsList[0].(map[string]interface{}); ok {
+	// Director spellings vary too, so compare them normalized rather than in the
+	// query. That is also why the query has no limit: a cut-off list could miss
+	// the matching row and cause a duplicate to be created.
+	for _, entry := range vhsList {
+		movie, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if director != nil && *director != "" {
+			existing, _ := movie["director"].(string)
+			if normalize.Name(existing) != normalize.Name(*director) {
+				continue
+			}
+		}
 		return movie, nil
 	}
 
 	return nil, nil
 }
 
-// FindRecordByArtistAlbum searches for an existing record by artist and album
+// FindRecordByArtistAlbum searches for an existing record by normalized artist and album.
+// Rows saved before normalized keys existed are matched exactly until backfilled.
 func (h *HasuraClient) FindRecordByArtistAlbum(ctx context.Context, artist string, album string) (map[string]interface{}, error) {
-	query := fmt.Sprintf(`
-		query FindRecordByArtistAlbum {
-			records(where: {artist: {_eq: "%s"}, album: {_eq: "%s"}}, limit: 1) {
+	query := `
+		query FindRecordByArtistAlbum($key: String!, $artist: String!, $album: String!) {
+			records(
+				where: {_or: [
+					{normalized_key: {_eq: $key}},
+					{normalized_key: {_is_null: true}, artist: {_eq: $artist}, album: {_eq: $album}}
+				]}
+				order_by: {created_at: asc}
+				limit: 1
+			) {
 				id
 				artist
 				album
@@ -639,17 +595,22 @@ func (h *HasuraClient) FindRecordByArtistAlbum(ctx context.Context, artist strin
 				label
 				color_variants
 				genres
-				cover_url
 				size
+				cover_url
 				created_at
 				updated_at
 			}
 		}
-	`, artist, album)
+	`
 
 	req := GraphQLRequest{
 		Query:         query,
 		OperationName: "FindRecordByArtistAlbum",
+		Variables: map[string]interface{}{
+			"key":    normalize.AlbumKey(artist, album),
+			"artist": artist,
+			"album":  album,
+		},
 	}
 
 	resp, err := h.Execute(ctx, req)
@@ -1086,6 +1047,10 @@ func (h *HasuraClient) buildMovieOrderBy(sortField, sortOrder string) string {
 
 // InsertCassette inserts a new cassette into Hasura
 func (h *HasuraClient) InsertCassette(ctx context.Context, cassette map[string]interface{}) (string, error) {
+	if _, ok := cassette["normalized_key"]; !ok {
+		cassette["normalized_key"] = MediaKindCassette.NormalizedKey(cassette)
+	}
+
 	query := `
 		mutation InsertCassette($object: cassettes_insert_input!) {
 			insert_cassettes_one(object: $object) {
@@ -1123,55 +1088,6 @@ func (h *HasuraClient) InsertCassette(ctx context.Context, cassette map[string]i
 	return "", fmt.Errorf("failed to extract cassette ID from response")
 }
 
-// GetAllCassettes fetches all cassettes from Hasura
-func (h *HasuraClient) GetAllCassettes(ctx context.Context) ([]map[string]interface{}, error) {
-	query := `
-		query GetAllCassettes {
-			cassettes(order_by: {created_at: desc}) {
-				id
-				artist
-				album
-				year
-				label
-				genres
-				cover_url
-				tape_type
-				created_at
-				updated_at
-			}
-		}
-	`
-
-	req := GraphQLRequest{
-		Query:         query,
-		OperationName: "GetAllCassettes",
-	}
-
-	resp, err := h.Execute(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
-	}
-
-	cassettesData, ok := resp.Data["cassettes"]
-	if !ok {
-		return []map[string]interface{}{}, nil
-	}
-
-	cassettesList, ok := cassettesData.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("unexpected cassettes data type")
-	}
-
-	cassettes := make([]map[string]interface{}, 0, len(cassettesList))
-	for _, c := range cassettesList {
-		if cassette, ok := c.(map[string]interface{}); ok {
-			cassettes = append(cassettes, cassette)
-		}
-	}
-
-	return cassettes, nil
-}
-
 // GetCassettesByUserID fetches all cassettes for a specific user (via junction table)
 func (h *HasuraClient) GetCassettesByUserID(ctx context.Context, userID string) ([]map[string]interface{}, error) {
 	query := `
@@ -1319,28 +1235,41 @@ func (h *HasuraClient) UpdateCassette(ctx context.Context, id string, updates ma
 	return cassette, nil
 }
 
-// FindCassetteByArtistAlbum searches for an existing cassette by artist and album
+// FindCassetteByArtistAlbum searches for an existing cassette by normalized artist and album.
+// Rows saved before normalized keys existed are matched exactly until backfilled.
 func (h *HasuraClient) FindCassetteByArtistAlbum(ctx context.Context, artist string, album string) (map[string]interface{}, error) {
-	query := fmt.Sprintf(`
-		query FindCassetteByArtistAlbum {
-			cassettes(where: {artist: {_eq: "%s"}, album: {_eq: "%s"}}, limit: 1) {
+	query := `
+		query FindCassetteByArtistAlbum($key: String!, $artist: String!, $album: String!) {
+			cassettes(
+				where: {_or: [
+					{normalized_key: {_eq: $key}},
+					{normalized_key: {_is_null: true}, artist: {_eq: $artist}, album: {_eq: $album}}
+				]}
+				order_by: {created_at: asc}
+				limit: 1
+			) {
 				id
 				artist
 				album
 				year
 				label
 				genres
-				cover_url
 				tape_type
+				cover_url
 				created_at
 				updated_at
 			}
 		}
-	`, artist, album)
+	`
 
 	req := GraphQLRequest{
 		Query:         query,
 		OperationName: "FindCassetteByArtistAlbum",
+		Variables: map[string]interface{}{
+			"key":    normalize.AlbumKey(artist, album),
+			"artist": artist,
+			"album":  album,
+		},
 	}
 
 	resp, err := h.Execute(ctx, req)
@@ -1592,3 +1521,694 @@ func (h *HasuraClient) buildAlbumOrderBy(sortField, sortOrder string) string {
 		return fmt.Sprintf(`{created_at: %s}`, order)
 	}
 }
+
+// GetCatalogPaginated pages through a whole catalog table regardless of who
+// owns the rows. Sorting and search mirror the user collection queries.
+func (h *HasuraClient) GetCatalogPaginated(ctx context.Context, kind MediaKind, limit, offset int, sortField, sortOrder string, search *string) (*PaginatedResult, error) {
+	t, err := kind.table()
+	if err != nil {
+		return nil, err
+	}
+
+	where := map[string]interface{}{}
+	if search != nil && *search != "" {
+		pattern := map[string]interface{}{"_ilike": "%" + *search + "%"}
+		if kind == MediaKindMovie {
+			where["title"] = pattern
+		} else {
+			where["_or"] = []map[string]interface{}{
+				{"artist": pattern},
+				{"album": pattern},
+			}
+		}
+	}
+
+	query := fmt.Sprintf(`
+		query GetCatalogPaginated($where: %s_bool_exp!, $order_by: [%s_order_by!]!, $limit: Int!, $offset: Int!) {
+			%s(where: $where, order_by: $order_by, limit: $limit, offset: $offset) {
+				id
+				%s
+				created_at
+				updated_at
+			}
+			%s_aggregate(where: $where) {
+				aggregate {
+					count
+				}
+			}
+		}
+	`, t.name, t.name, t.name, t.columnSelection("\t\t\t\t"), t.name)
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetCatalogPaginated",
+		Variables: map[string]interface{}{
+			"where":    where,
+			"order_by": catalogOrderBy(kind, sortField, sortOrder),
+			"limit":    limit,
+			"offset":   offset,
+		},
+	}
+
+	resp, err := h.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	list, ok := resp.Data[t.name].([]interface{})
+	if !ok {
+		return &PaginatedResult{Items: []map[string]interface{}{}, TotalCount: 0}, nil
+	}
+
+	rows := make([]map[string]interface{}, 0, len(list))
+	for _, entry := range list {
+		if row, ok := entry.(map[string]interface{}); ok {
+			rows = append(rows, row)
+		}
+	}
+
+	totalCount := 0
+	if aggData, ok := resp.Data[t.name+"_aggregate"].(map[string]interface{}); ok {
+		if agg, ok := aggData["aggregate"].(map[string]interface{}); ok {
+			if count, ok := agg["count"].(float64); ok {
+				totalCount = int(count)
+			}
+		}
+	}
+
+	return &PaginatedResult{Items: rows, TotalCount: totalCount}, nil
+}
+
+// catalogOrderBy builds the order_by variable for catalog table queries. The
+// id tiebreak keeps offset pages stable when the sort column has duplicates.
+func catalogOrderBy(kind MediaKind, sortField, sortOrder string) []map[string]interface{} {
+	order := "desc"
+	if sortOrder == "ASC" {
+		order = "asc"
+	}
+
+	column := "created_at"
+	switch sortField {
+	case "TITLE":
+		column = "album"
+		if kind == MediaKindMovie {
+			column = "title"
+		}
+	case "ARTIST":
+		if kind != MediaKindMovie {
+			column = "artist"
+		}
+	case "YEAR":
+		column = "year"
+	}
+
+	return []map[string]interface{}{
+		{column: order},
+		{"id": "asc"},
+	}
+}
+
+// CoverReferences are the cover URLs of catalog rows (VHS, records, and
+// cassettes), split by whether the row is still in at least one collection.
+// Removing an item only unlinks it, so rows nobody owns keep their cover_url.
+type CoverReferences struct {
+	Owned   []string
+	Unowned []string
+}
+
+// All returns every referenced cover URL, owned or not
+func (r *CoverReferences) All() []string {
+	return append(append([]string{}, r.Owned...), r.Unowned...)
+}
+
+// GetCoverReferences returns the cover URL of every catalog row, reading
+// owned and unowned rows in one query so they agree with each other
+func (h *HasuraClient) GetCoverReferences(ctx context.Context) (*CoverReferences, error) {
+	query := `
+		query GetCoverReferences {
+			vhs(where: {cover_url: {_is_null: false}, user_vhs: {}}) {
+				cover_url
+			}
+			records(where: {cover_url: {_is_null: false}, user_records: {}}) {
+				cover_url
+			}
+			cassettes(where: {cover_url: {_is_null: false}, user_cassettes: {}}) {
+				cover_url
+			}
+			unowned_vhs: vhs(where: {cover_url: {_is_null: false}, _not: {user_vhs: {}}}) {
+				cover_url
+			}
+			unowned_records: records(where: {cover_url: {_is_null: false}, _not: {user_records: {}}}) {
+				cover_url
+			}
+			unowned_cassettes: cassettes(where: {cover_url: {_is_null: false}, _not: {user_cassettes: {}}}) {
+				cover_url
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetCoverReferences",
+	}
+
+	resp, err := h.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	refs := &CoverReferences{Owned: []string{}, Unowned: []string{}}
+	for _, table := range []string{"vhs", "records", "cassettes"} {
+		refs.Owned = append(refs.Owned, coverURLsFromRows(resp.Data[table])...)
+		refs.Unowned = append(refs.Unowned, coverURLsFromRows(resp.Data["unowned_"+table])...)
+	}
+
+	return refs, nil
+}
+
+func coverURLsFromRows(value interface{}) []string {
+	rows, _ := value.([]interface{})
+	urls := []string{}
+	for _, row := range rows {
+		if rowMap, ok := row.(map[string]interface{}); ok {
+			if coverURL, ok := rowMap["cover_url"].(string); ok && coverURL != "" {
+				urls = append(urls, coverURL)
+			}
+		}
+	}
+	return urls
+}
+
+// GetUserItemsForDedup fetches a user's items of one kind along with their stored cover hashes
+func (h *HasuraClient) GetUserItemsForDedup(ctx context.Context, kind MediaKind, userID string) ([]map[string]interface{}, error) {
+	t, err := kind.table()
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		query GetUserItemsForDedup($user_id: uuid!) {
+			%s(where: {user_id: {_eq: $user_id}}) {
+				%s {
+					id
+					%s
+					cover_url
+					cover_phash
+					cover_dhash
+					cover_hash_url
+					created_at
+				}
+			}
+		}
+	`, t.junction, t.relation, t.titleFields)
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetUserItemsForDedup",
+		Variables: map[string]interface{}{
+			"user_id": userID,
+		},
+	}
+
+	resp, err := h.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	entries, ok := resp.Data[t.junction].([]interface{})
+	if !ok {
+		return []map[string]interface{}{}, nil
+	}
+
+	items := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		if entryMap, ok := entry.(map[string]interface{}); ok {
+			if item, ok := entryMap[t.relation].(map[string]interface{}); ok {
+				items = append(items, item)
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// SetCoverHash stores the perceptual hashes computed for a row's cover.
+// cover_hash_url records which cover the hashes belong to so they can be
+// recomputed when the cover changes.
+func (h *HasuraClient) SetCoverHash(ctx context.Context, kind MediaKind, id, coverURL, phash, dhash string) error {
+	t, err := kind.table()
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		mutation SetCoverHash($id: uuid!, $changes: %s_set_input!) {
+			update_%s_by_pk(pk_columns: {id: $id}, _set: $changes) {
+				id
+			}
+		}
+	`, t.name, t.name)
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "SetCoverHash",
+		Variables: map[string]interface{}{
+			"id": id,
+			"changes": map[string]interface{}{
+				"cover_phash":    phash,
+				"cover_dhash":    dhash,
+				"cover_hash_url": coverURL,
+			},
+		},
+	}
+
+	if _, err := h.Execute(ctx, req); err != nil {
+		return fmt.Errorf("failed to store cover hash: %w", err)
+	}
+
+	return nil
+}
+
+// MergeUserLinks re-points a user's links to moveIDs onto canonicalID and
+// deletes their links to dropIDs in a single transaction. Returns how many
+// links were moved or deleted.
+func (h *HasuraClient) MergeUserLinks(ctx context.Context, kind MediaKind, userID, canonicalID string, dropIDs, moveIDs []string) (int, error) {
+	t, err := kind.table()
+	if err != nil {
+		return 0, err
+	}
+
+	// Links are dropped first so a moved link never collides with one being
+	// removed on the junction table's unique constraint
+	query := fmt.Sprintf(`
+		mutation MergeUserLinks($user_id: uuid!, $canonical: uuid!, $drop_ids: [uuid!]!, $move_ids: [uuid!]!) {
+			drop_links: delete_%[1]s(where: {user_id: {_eq: $user_id}, %[2]s: {_in: $drop_ids}}) {
+				affected_rows
+			}
+			move_links: update_%[1]s(where: {user_id: {_eq: $user_id}, %[2]s: {_in: $move_ids}}, _set: {%[2]s: $canonical}) {
+				affected_rows
+			}
+		}
+	`, t.junction, t.fkColumn)
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "MergeUserLinks",
+		Variables: map[string]interface{}{
+			"user_id":   userID,
+			"canonical": canonicalID,
+			"drop_ids":  dropIDs,
+			"move_ids":  moveIDs,
+		},
+	}
+
+	resp, err := h.Execute(ctx, req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to merge user links: %w", err)
+	}
+
+	total := 0
+	for _, field := range []string{"drop_links", "move_links"} {
+		result, ok := resp.Data[field].(map[string]interface{})
+		if !ok {
+			return 0, fmt.Errorf("unexpected %s data type", field)
+		}
+		affected, _ := result["affected_rows"].(float64)
+		total += int(affected)
+	}
+
+	return total, nil
+}
+
+// UnlinkAllItemsFromUser empties a user's collection of every kind in one
+// request and returns how many links were deleted
+func (h *HasuraClient) UnlinkAllItemsFromUser(ctx context.Context, userID string) (int, error) {
+	var fields strings.Builder
+	for _, kind := range []MediaKind{MediaKindMovie, MediaKindAlbum, MediaKindCassette} {
+		fmt.Fprintf(&fields, "\t\t\tdelete_%s(where: {user_id: {_eq: $user_id}}) {\n\t\t\t\taffected_rows\n\t\t\t}\n", mediaTables[kind].junction)
+	}
+
+	query := fmt.Sprintf(`
+		mutation UnlinkAllItemsFromUser($user_id: uuid!) {
+%s		}
+	`, fields.String())
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "UnlinkAllItemsFromUser",
+		Variables: map[string]interface{}{
+			"user_id": userID,
+		},
+	}
+
+	resp, err := h.Execute(ctx, req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unlink items from user: %w", err)
+	}
+
+	total := 0
+	for _, t := range mediaTables {
+		total += affectedRows(resp, "delete_"+t.junction)
+	}
+	return total, nil
+}
+
+// ClearCoverURLs removes the given cover URLs from every catalog row (VHS,
+// records, and cassettes) that uses them and returns how many rows changed
+func (h *HasuraClient) ClearCoverURLs(ctx context.Context, urls []string) (int, error) {
+	query := `
+		mutation ClearCoverURLs($urls: [String!]!) {
+			update_vhs(where: {cover_url: {_in: $urls}}, _set: {cover_url: null}) {
+				affected_rows
+			}
+			update_records(where: {cover_url: {_in: $urls}}, _set: {cover_url: null}) {
+				affected_rows
+			}
+			update_cassettes(where: {cover_url: {_in: $urls}}, _set: {cover_url: null}) {
+				affected_rows
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "ClearCoverURLs",
+		Variables: map[string]interface{}{
+			"urls": urls,
+		},
+	}
+
+	resp, err := h.Execute(ctx, req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear cover URLs: %w", err)
+	}
+
+	total := 0
+	for _, table := range []string{"vhs", "records", "cassettes"} {
+		total += affectedRows(resp, "update_"+table)
+	}
+	return total, nil
+}
+
+// GetCatalogRowsForKeys pages through a catalog table in id order for normalized
+// key backfills. With onlyMissing set, rows that already have a key are skipped.
+func (h *HasuraClient) GetCatalogRowsForKeys(ctx context.Context, kind MediaKind, afterID string, limit int, onlyMissing bool) ([]map[string]interface{}, error) {
+	t, err := kind.table()
+	if err != nil {
+		return nil, err
+	}
+
+	where := map[string]interface{}{}
+	if afterID != "" {
+		where["id"] = map[string]interface{}{"_gt": afterID}
+	}
+	if onlyMissing {
+		where["normalized_key"] = map[string]interface{}{"_is_null": true}
+	}
+
+	query := fmt.Sprintf(`
+		query GetCatalogRowsForKeys($where: %s_bool_exp!, $limit: Int!) {
+			%s(where: $where, order_by: {id: asc}, limit: $limit) {
+				id
+				%s
+				normalized_key
+			}
+		}
+	`, t.name, t.name, t.titleFields)
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetCatalogRowsForKeys",
+		Variables: map[string]interface{}{
+			"where": where,
+			"limit": limit,
+		},
+	}
+
+	resp, err := h.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	list, ok := resp.Data[t.name].([]interface{})
+	if !ok {
+		return []map[string]interface{}{}, nil
+	}
+
+	rows := make([]map[string]interface{}, 0, len(list))
+	for _, entry := range list {
+		if row, ok := entry.(map[string]interface{}); ok {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, nil
+}
+
+// SetNormalizedKeys writes normalized keys for a batch of catalog rows in one mutation
+func (h *HasuraClient) SetNormalizedKeys(ctx context.Context, kind MediaKind, keys map[string]string) error {
+	t, err := kind.table()
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	params := make([]string, 0, len(ids))
+	fields := make([]string, 0, len(ids))
+	variables := make(map[string]interface{}, len(ids)*2)
+	for i, id := range ids {
+		params = append(params, fmt.Sprintf("$id%d: uuid!, $key%d: String!", i, i))
+		fields = append(fields, fmt.Sprintf(
+			"u%d: update_%s_by_pk(pk_columns: {id: $id%d}, _set: {normalized_key: $key%d}) { id }",
+			i, t.name, i, i,
+		))
+		variables[fmt.Sprintf("id%d", i)] = id
+		variables[fmt.Sprintf("key%d", i)] = keys[id]
+	}
+
+	query := fmt.Sprintf("mutation SetNormalizedKeys(%s) {\n\t%s\n}",
+		strings.Join(params, ", "), strings.Join(fields, "\n\t"))
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "SetNormalizedKeys",
+		Variables:     variables,
+	}
+
+	if _, err := h.Execute(ctx, req); err != nil {
+		return fmt.Errorf("failed to update normalized keys: %w", err)
+	}
+
+	return nil
+}
+
+// GetCatalogRow fetches a catalog row of any kind with all of its data columns
+func (h *HasuraClient) GetCatalogRow(ctx context.Context, kind MediaKind, id string) (map[string]interface{}, error) {
+	t, err := kind.table()
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		query GetCatalogRow($id: uuid!) {
+			%s_by_pk(id: $id) {
+				id
+				%s
+				cover_phash
+				cover_dhash
+				cover_hash_url
+				normalized_key
+				created_at
+				updated_at
+			}
+		}
+	`, t.name, t.columnSelection("\t\t\t\t"))
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetCatalogRow",
+		Variables: map[string]interface{}{
+			"id": id,
+		},
+	}
+
+	resp, err := h.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	row, ok := resp.Data[t.name+"_by_pk"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	return row, nil
+}
+
+// GetCatalogLinks fetches the user junction rows pointing at any of the given catalog rows
+func (h *HasuraClient) GetCatalogLinks(ctx context.Context, kind MediaKind, itemIDs []string) ([]map[string]interface{}, error) {
+	t, err := kind.table()
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		query GetCatalogLinks($ids: [uuid!]!) {
+			%s(where: {%s: {_in: $ids}}) {
+				id
+				user_id
+				%s
+			}
+		}
+	`, t.junction, t.fkColumn, t.fkColumn)
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetCatalogLinks",
+		Variables: map[string]interface{}{
+			"ids": itemIDs,
+		},
+	}
+
+	resp, err := h.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	list, ok := resp.Data[t.junction].([]interface{})
+	if !ok {
+		return []map[string]interface{}{}, nil
+	}
+
+	links := make([]map[string]interface{}, 0, len(list))
+	for _, entry := range list {
+		if link, ok := entry.(map[string]interface{}); ok {
+			links = append(links, link)
+		}
+	}
+
+	return links, nil
+}
+
+// ExecuteCatalogMerge folds source into target in a single transaction: links
+// for users who already have target are dropped, the remaining links are
+// re-pointed, target takes the merged fields, source is deleted, and the
+// audit entry is written. Returns the audit entry ID.
+func (h *HasuraClient) ExecuteCatalogMerge(ctx context.Context, kind MediaKind, targetID, sourceID string, changes map[string]interface{}, dropLinkIDs []string, audit map[string]interface{}) (string, error) {
+	t, err := kind.table()
+	if err != nil {
+		return "", err
+	}
+
+	variables := map[string]interface{}{
+		"target":   targetID,
+		"source":   sourceID,
+		"drop_ids": dropLinkIDs,
+		"audit":    audit,
+	}
+
+	// The target is only updated when the source adds something to it
+	changesParam, updateTarget := "", ""
+	if len(changes) > 0 {
+		changesParam = fmt.Sprintf(", $changes: %s_set_input!", t.name)
+		updateTarget = fmt.Sprintf(`
+			update_target: update_%s_by_pk(pk_columns: {id: $target}, _set: $changes) {
+				id
+			}`, t.name)
+		variables["changes"] = changes
+	}
+
+	// Hasura runs the root fields of a mutation in order, in one transaction
+	query := fmt.Sprintf(`
+		mutation ExecuteCatalogMerge($target: uuid!, $source: uuid!%[4]s, $drop_ids: [uuid!]!, $audit: catalog_audit_log_insert_input!) {
+			drop_links: delete_%[2]s(where: {id: {_in: $drop_ids}}) {
+				affected_rows
+			}
+			move_links: update_%[2]s(where: {%[3]s: {_eq: $source}}, _set: {%[3]s: $target}) {
+				affected_rows
+			}%[5]s
+			delete_source: delete_%[1]s_by_pk(id: $source) {
+				id
+			}
+			insert_catalog_audit_log_one(object: $audit) {
+				id
+			}
+		}
+	`, t.name, t.junction, t.fkColumn, changesParam, updateTarget)
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "ExecuteCatalogMerge",
+		Variables:     variables,
+	}
+
+	resp, err := h.Execute(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to merge %s rows: %w", t.name, err)
+	}
+
+	if (updateTarget != "" && resp.Data["update_target"] == nil) || resp.Data["delete_source"] == nil {
+		return "", fmt.Errorf("failed to merge %s rows: target or source no longer exists", t.name)
+	}
+
+	return auditEntryID(resp), nil
+}
+
+// ExecuteCatalogSplit inserts a new catalog row and moves the given users'
+// links from source onto it in a single transaction. Returns the audit entry ID.
+func (h *HasuraClient) ExecuteCatalogSplit(ctx context.Context, kind MediaKind, sourceID string, object map[string]interface{}, userIDs []string, audit map[string]interface{}) (string, error) {
+	t, err := kind.table()
+	if err != nil {
+		return "", err
+	}
+
+	query := fmt.Sprintf(`
+		mutation ExecuteCatalogSplit($source: uuid!, $new_id: uuid!, $object: %[1]s_insert_input!, $user_ids: [uuid!]!, $audit: catalog_audit_log_insert_input!) {
+			insert_%[1]s_one(object: $object) {
+				id
+			}
+			move_links: update_%[2]s(where: {%[3]s: {_eq: $source}, user_id: {_in: $user_ids}}, _set: {%[3]s: $new_id}) {
+				affected_rows
+			}
+			insert_catalog_audit_log_one(object: $audit) {
+				id
+			}
+		}
+	`, t.name, t.junction, t.fkColumn)
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "ExecuteCatalogSplit",
+		Variables: map[string]interface{}{
+			"source":   sourceID,
+			"new_id":   object["id"],
+			"object":   object,
+			"user_ids": userIDs,
+			"audit":    audit,
+		},
+	}
+
+	resp, err := h.Execute(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to split %s row: %w", t.name, err)
+	}
+
+	return auditEntryID(resp), nil
+}
+
+func auditEntryID(resp *GraphQLResponse) string {
+	if entry, ok := resp.Data["insert_catalog_audit_log_one"].(map[string]interface{}); ok {
+		if id, ok := entry["id"].(string); ok {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHasuraClient_GetCatalogPaginated(t *testing.T) {
+	var received GraphQLRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"records": []map[string]interface{}{
+					{"id": "r1", "artist": "Radiohead", "album": "Kid A"},
+					{"id": "r2", "artist": "Radiohead", "album": "Amnesiac"},
+				},
+				"records_aggregate": map[string]interface{}{
+					"aggregate": map[string]interface{}{"count": 7},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := NewHasuraClient(server.URL, "")
+	result, err := client.GetCatalogPaginated(context.Background(), MediaKindAlbum, 2, 4, "ARTIST", "ASC", stringPtr(`radio"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Items) != 2 || result.TotalCount != 7 {
+		t.Errorf("expected 2 items of 7, got %d of %d", len(result.Items), result.TotalCount)
+	}
+	if received.OperationName != "GetCatalogPaginated" {
+		t.Errorf("unexpected operation %s", received.OperationName)
+	}
+	if !strings.Contains(received.Query, "records(where: $where") || strings.Contains(received.Query, "radio") {
+		t.Errorf("expected a records query with search passed as a variable, got %s", received.Query)
+	}
+	if received.Variables["limit"] != float64(2) || received.Variables["offset"] != float64(4) {
+		t.Errorf("unexpected limit/offset: %v / %v", received.Variables["limit"], received.Variables["offset"])
+	}
+
+	expectedWhere := map[string]interface{}{
+		"_or": []interface{}{
+			map[string]interface{}{"artist": map[string]interface{}{"_ilike": `%radio"}%`}},
+			map[string]interface{}{"album": map[string]interface{}{"_ilike": `%radio"}%`}},
+		},
+	}
+	if !reflect.DeepEqual(received.Variables["where"], expectedWhere) {
+		t.Errorf("expected where %v, got %v", expectedWhere, received.Variables["where"])
+	}
+}
+
+func TestCatalogOrderBy(t *testing.T) {
+	tests := []struct {
+		kind     MediaKind
+		field    string
+		order    string
+		expected map[string]interface{}
+	}{
+		{kind: MediaKindMovie, field: "TITLE", order: "ASC", expected: map[string]interface{}{"title": "asc"}},
+		{kind: MediaKindMovie, field: "ARTIST", order: "ASC", expected: map[string]interface{}{"created_at": "asc"}},
+		{kind: MediaKindAlbum, field: "TITLE", order: "DESC", expected: map[string]interface{}{"album": "desc"}},
+		{kind: MediaKindCassette, field: "ARTIST", order: "DESC", expected: map[string]interface{}{"artist": "desc"}},
+		{kind: MediaKindAlbum, field: "YEAR", order: "ASC", expected: map[string]interface{}{"year": "asc"}},
+		{kind: MediaKindAlbum, field: "CREATED_AT", order: "", expected: map[string]interface{}{"created_at": "desc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.kind)+"/"+tt.field, func(t *testing.T) {
+			orderBy := catalogOrderBy(tt.kind, tt.field, tt.order)
+			if len(orderBy) != 2 || !reflect.DeepEqual(orderBy[0], tt.expected) {
+				t.Errorf("expected %v first, got %v", tt.expected, orderBy)
+			}
+			if orderBy[1]["id"] != "asc" {
+				t.Errorf("expected id tiebreak, got %v", orderBy)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"mediacloset/api/internal/ratelimit"
+)
+
+// httpDoer sends HTTP requests. Services call external APIs through a
+// *resilient.Client; tests can use a plain *http.Client.
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// waitForLimit makes a resilient.Client wait for provider's rate limit
+// before every request it sends, so retries and hedges are counted too
+func waitForLimit(limiter *ratelimit.ServiceLimiter, provider ratelimit.Provider) func(*http.Request) error {
+	return func(req *http.Request) error {
+		if err := limiter.Wait(req.Context(), provider); err != nil {
+			return fmt.Errorf("rate limit wait failed: %w", err)
+		}
+		return nil
+	}
+}
+
+// pingClient checks providers are reachable. It bypasses the resilient
+// clients and rate limiters so health checks never use up a quota.
+var pingClient = &http.Client{Timeout: 5 * time.Second}
+
+// pingHost reports whether baseURL answers at all; any response below 500
+// counts, since the API itself needs parameters or keys to succeed
+func pingHost(ctx context.Context, baseURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := pingClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unreachable: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -11,20 +11,36 @@ import (
 	"time"
 
 	"mediacloset/api/internal/graph/model"
+	"mediacloset/api/internal/ratelimit"
+	"mediacloset/api/internal/resilient"
 )
 
 // ITunesService handles requests to the iTunes Search API
 type ITunesService struct {
-	client  *http.Client
+	client  httpDoer // Waits for the iTunes rate limit before each attempt
 	baseURL string
 }
 
-// NewITunesService creates a new iTunes Search API client
-func NewITunesService() *ITunesService {
+// itunesResilience hedges slow searches, which is safe because iTunes has
+// no quota to spend
+var itunesResilience = resilient.Config{
+	MaxRetries:       2,
+	BaseDelay:        200 * time.Millisecond,
+	MaxDelay:         5 * time.Second,
+	HedgeDelay:       1500 * time.Millisecond,
+	FailureThreshold: 5,
+	Cooldown:         30 * time.Second,
+}
+
+// NewITunesService creates a new iTunes Search API client with rate limiting
+func NewITunesService(limiter *ratelimit.ServiceLimiter) *ITunesService {
+	config := itunesResilience
+	config.BeforeAttempt = waitForLimit(limiter, ratelimit.ProviderITunes)
+
 	return &ITunesService{
-		client: &http.Client{
+		client: resilient.New("itunes", &http.Client{
 			Timeout: 5 * time.Second,
-		},
+		}, config),
 		baseURL: "https://itunes.apple.com",
 	}
 }
@@ -46,6 +62,7 @@ type ITunesSearchResponse struct {
 // SearchByBarcode searches iTunes for an album using a barcode (UPC)
 // Note: iTunes doesn't directly support barcode search, so we search by term
 func (s *ITunesService) SearchByBarcode(ctx context.Context, barcode string) (*model.AlbumData, error) {
+
 	// Build query URL
 	params := url.Values{}
 	params.Set("term", barcode)
@@ -128,3 +145,8 @@ func (s *ITunesService) SearchByBarcode(ctx context.Context, barcode string) (*m
 
 	return albumData, nil
 }
+
+// Ping checks that iTunes is reachable without calling its API
+func (s *ITunesService) Ping(ctx context.Context) error {
+	return pingHost(ctx, s.baseURL)
+}
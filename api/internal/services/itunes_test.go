@@ -4,7 +4,10 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+
+	"mediacloset/api/internal/ratelimit"
 )
 
 func TestITunesService_SearchByBarcode(t *testing.T) {
@@ -250,6 +253,34 @@ func TestITunesService_SearchByBarcode_ContextCancellation(t *testing.T) {
 	}
 }
 
+func TestITunesService_SearchByBarcode_RetriesWaitForLimiter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"resultCount": 1, "results": [{"artistName": "Artist", "collectionName": "Album"}]}`))
+	}))
+	defer server.Close()
+
+	limiter := ratelimit.NewServiceLimiter(ratelimit.NewMemoryStore(), map[ratelimit.Provider]ratelimit.ProviderLimit{
+		ratelimit.ProviderITunes: {RequestsPerMinute: 6000, DailyQuota: 10},
+	})
+	service := NewITunesService(limiter)
+	service.baseURL = server.URL
+
+	if _, err := service.SearchByBarcode(context.Background(), "123456"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, quota := range limiter.Quotas(context.Background()) {
+		if quota.Provider == ratelimit.ProviderITunes && quota.UsedToday != 2 {
+			t.Errorf("Expected the retry to take from the limiter too, got %d takes for %d calls", quota.UsedToday, calls)
+		}
+	}
+}
+
 // Helper function
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && containsHelper(s, substr))
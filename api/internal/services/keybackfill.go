@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// DefaultKeyBackfillBatchSize is how many rows are read and written per round trip
+const DefaultKeyBackfillBatchSize = 200
+
+// KeyBackfillService fills in (or recomputes) normalized_key on catalog rows
+// so find-or-insert lookups match rows saved before keys existed
+type KeyBackfillService struct {
+	hasuraClient *HasuraClient
+	batchSize    int
+}
+
+// KeyBackfillReport summarizes a run across all catalog tables
+type KeyBackfillReport struct {
+	DryRun bool
+	Tables []KeyBackfillTableReport
+}
+
+// KeyBackfillTableReport summarizes one catalog table
+type KeyBackfillTableReport struct {
+	Kind    MediaKind
+	Scanned int
+	Changed int // rows whose stored key is missing or out of date
+	Updated int
+	// SharedKeys lists keys held by more than one scanned row. These rows are
+	// duplicates that the key now exposes and are candidates for merging.
+	SharedKeys []SharedKey
+}
+
+// SharedKey is a normalized key held by several catalog rows
+type SharedKey struct {
+	Key string
+	IDs []string
+}
+
+// NewKeyBackfillService creates a backfill job
+func NewKeyBackfillService(hasuraClient *HasuraClient, batchSize int) *KeyBackfillService {
+	if batchSize <= 0 {
+		batchSize = DefaultKeyBackfillBatchSize
+	}
+	return &KeyBackfillService{
+		hasuraClient: hasuraClient,
+		batchSize:    batchSize,
+	}
+}
+
+// Run walks vhs, records, and cassettes. By default only rows without a key
+// are visited; all recomputes every key, which is needed after the
+// normalization rules change and is the only mode that can report every
+// shared key. In dry-run mode nothing is written.
+func (s *KeyBackfillService) Run(ctx context.Context, dryRun, all bool) (*KeyBackfillReport, error) {
+	report := &KeyBackfillReport{DryRun: dryRun}
+
+	for _, kind := range []MediaKind{MediaKindMovie, MediaKindAlbum, MediaKindCassette} {
+		table, err := s.backfillTable(ctx, kind, dryRun, all)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", kind, err)
+		}
+		report.Tables = append(report.Tables, *table)
+	}
+
+	return report, nil
+}
+
+func (s *KeyBackfillService) backfillTable(ctx context.Context, kind MediaKind, dryRun, all bool) (*KeyBackfillTableReport, error) {
+	report := &KeyBackfillTableReport{Kind: kind}
+	idsByKey := map[string][]string{}
+
+	// Keyset pagination on id keeps paging stable while rows are updated
+	afterID := ""
+	for {
+		rows, err := s.hasuraClient.GetCatalogRowsForKeys(ctx, kind, afterID, s.batchSize, !all)
+		if err != nil {
+			return report, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		changed := map[string]string{}
+		for _, row := range rows {
+			id, _ := row["id"].(string)
+			stored, _ := row["normalized_key"].(string)
+			key := kind.NormalizedKey(row)
+
+			report.Scanned++
+			idsByKey[key] = append(idsByKey[key], id)
+			if key != stored {
+				changed[id] = key
+			}
+			afterID = id
+		}
+
+		report.Changed += len(changed)
+		if !dryRun && len(changed) > 0 {
+			if err := s.hasuraClient.SetNormalizedKeys(ctx, kind, changed); err != nil {
+				return report, err
+			}
+			report.Updated += len(changed)
+		}
+
+		if len(rows) < s.batchSize {
+			break
+		}
+	}
+
+	for key, ids := range idsByKey {
+		if len(ids) > 1 {
+			report.SharedKeys = append(report.SharedKeys, SharedKey{Key: key, IDs: ids})
+		}
+	}
+	sort.Slice(report.SharedKeys, func(i, j int) bool {
+		return report.SharedKeys[i].Key < report.SharedKeys[j].Key
+	})
+
+	return report, nil
+}
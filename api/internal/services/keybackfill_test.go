@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeCatalogHasura serves GetCatalogRowsForKeys/SetNormalizedKeys from in-memory tables
+type fakeCatalogHasura struct {
+	tables  map[string][]map[string]interface{}
+	updates int
+}
+
+func (f *fakeCatalogHasura) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "GetCatalogRowsForKeys":
+			where := req.Variables["where"].(map[string]interface{})
+			limit := int(req.Variables["limit"].(float64))
+			after := ""
+			if id, ok := where["id"].(map[string]interface{}); ok {
+				after = id["_gt"].(string)
+			}
+			_, onlyMissing := where["normalized_key"]
+
+			for name, rows := range f.tables {
+				if !strings.Contains(req.Query, name+"(where") {
+					continue
+				}
+				sort.Slice(rows, func(i, j int) bool { return rows[i]["id"].(string) < rows[j]["id"].(string) })
+				page := []map[string]interface{}{}
+				for _, row := range rows {
+					if row["id"].(string) <= after || (onlyMissing && row["normalized_key"] != nil) {
+						continue
+					}
+					if len(page) < limit {
+						page = append(page, row)
+					}
+				}
+				data[name] = page
+			}
+		case "SetNormalizedKeys":
+			f.updates++
+			for name, rows := range f.tables {
+				if !strings.Contains(req.Query, "update_"+name+"_by_pk") {
+					continue
+				}
+				for i := 0; ; i++ {
+					id, ok := req.Variables["id"+strconv.Itoa(i)].(string)
+					if !ok {
+						break
+					}
+					for _, row := range rows {
+						if row["id"] == id {
+							row["normalized_key"] = req.Variables["key"+strconv.Itoa(i)]
+						}
+					}
+				}
+			}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+}
+
+func newFakeCatalog() *fakeCatalogHasura {
+	return &fakeCatalogHasura{tables: map[string][]map[string]interface{}{
+		"vhs": {
+			{"id": "v1", "title": "Aliens (Special Edition)", "director": "James Cameron"},
+			{"id": "v2", "title": "Aliens", "director": "James Cameron", "normalized_key": "aliens"},
+		},
+		"records": {
+			{"id": "r1", "artist": "The Beatles", "album": "Abbey Road"},
+			{"id": "r2", "artist": "Beatles, The", "album": "Abbey Road (Remastered)"},
+			{"id": "r3", "artist": "Radiohead", "album": "Kid A", "normalized_key": "stale"},
+			{"id": "r4", "artist": "Björk", "album": "Homogenic"},
+		},
+		"cassettes": {},
+	}}
+}
+
+func TestKeyBackfillService_Run(t *testing.T) {
+	tests := []struct {
+		name            string
+		dryRun          bool
+		all             bool
+		expectScanned   map[MediaKind]int
+		expectChanged   map[MediaKind]int
+		expectShared    int // shared keys in records
+		expectRecordKey map[string]interface{}
+	}{
+		{
+			name:          "dry run only reports missing keys",
+			dryRun:        true,
+			expectScanned: map[MediaKind]int{MediaKindMovie: 1, MediaKindAlbum: 3},
+			expectChanged: map[MediaKind]int{MediaKindMovie: 1, MediaKindAlbum: 3},
+			expectShared:  1,
+			expectRecordKey: map[string]interface{}{
+				"r1": nil,
+				"r3": "stale",
+			},
+		},
+		{
+			name:          "writes missing keys",
+			expectScanned: map[MediaKind]int{MediaKindMovie: 1, MediaKindAlbum: 3},
+			expectChanged: map[MediaKind]int{MediaKindMovie: 1, MediaKindAlbum: 3},
+			expectShared:  1,
+			expectRecordKey: map[string]interface{}{
+				"r1": "beatles|abbey road",
+				"r2": "beatles|abbey road",
+				"r3": "stale",
+				"r4": "bjork|homogenic",
+			},
+		},
+		{
+			name:          "all recomputes stale keys",
+			all:           true,
+			expectScanned: map[MediaKind]int{MediaKindMovie: 2, MediaKindAlbum: 4},
+			expectChanged: map[MediaKind]int{MediaKindMovie: 1, MediaKindAlbum: 4},
+			expectShared:  1,
+			expectRecordKey: map[string]interface{}{
+				"r3": "radiohead|kid a",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeCatalog()
+			server := httptest.NewServer(fake.handler(t))
+			defer server.Close()
+
+			// Batch size 2 forces paging
+			report, err := NewKeyBackfillService(NewHasuraClient(server.URL, ""), 2).Run(context.Background(), tt.dryRun, tt.all)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, table := range report.Tables {
+				if table.Scanned != tt.expectScanned[table.Kind] {
+					t.Errorf("%s: expected %d scanned, got %d", table.Kind, tt.expectScanned[table.Kind], table.Scanned)
+				}
+				if table.Changed != tt.expectChanged[table.Kind] {
+					t.Errorf("%s: expected %d changed, got %d", table.Kind, tt.expectChanged[table.Kind], table.Changed)
+				}
+				if tt.dryRun && table.Updated != 0 {
+					t.Errorf("%s: expected no updates in dry run, got %d", table.Kind, table.Updated)
+				}
+				if table.Kind == MediaKindAlbum && len(table.SharedKeys) != tt.expectShared {
+					t.Errorf("expected %d shared record keys, got %+v", tt.expectShared, table.SharedKeys)
+				}
+			}
+
+			if tt.dryRun && fake.updates != 0 {
+				t.Errorf("expected no writes in dry run, got %d", fake.updates)
+			}
+
+			for _, row := range fake.tables["records"] {
+				if expected, ok := tt.expectRecordKey[row["id"].(string)]; ok && row["normalized_key"] != expected {
+					t.Errorf("%s: expected key %v, got %v", row["id"], expected, row["normalized_key"])
+				}
+			}
+		})
+	}
+}
+
+func TestHasuraClient_FindRecordByArtistAlbum(t *testing.T) {
+	var received GraphQLRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"records": []map[string]interface{}{{"id": "r1", "artist": "The Beatles", "album": "Abbey Road"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := NewHasuraClient(server.URL, "")
+	record, err := client.FindRecordByArtistAlbum(context.Background(), `Beatles, The`, `Abbey Road (Remastered) "}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record == nil || record["id"] != "r1" {
+		t.Fatalf("expected r1, got %v", record)
+	}
+
+	if received.Variables["key"] != "beatles|abbey road" {
+		t.Errorf("expected normalized key beatles|abbey road, got %v", received.Variables["key"])
+	}
+	if strings.Contains(received.Query, "Abbey") {
+		t.Error("expected user input to be passed as variables, not interpolated into the query")
+	}
+}
+
+func TestHasuraClient_FindMovieByTitle(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"vhs": []map[string]interface{}{
+					{"id": "v1", "title": "Alien", "director": "James Cameron"},
+					{"id": "v2", "title": "Alien", "director": "Ridley Scott"},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := NewHasuraClient(server.URL, "")
+
+	tests := []struct {
+		name     string
+		director *string
+		expected interface{}
+	}{
+		{name: "no director takes first match", director: nil, expected: "v1"},
+		{name: "director compared normalized", director: stringPtr("ridley  SCOTT"), expected: "v2"},
+		{name: "unknown director", director: stringPtr("Jean-Pierre Jeunet"), expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movie, err := client.FindMovieByTitle(context.Background(), "Alien", tt.director, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var id interface{}
+			if movie != nil {
+				id = movie["id"]
+			}
+			if id != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, id)
+			}
+		})
+	}
+}
+
+func TestHasuraClient_FindMovieByTitle_ManyCandidates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		// Any limit cuts the candidates short, as it would in Hasura
+		rows := []map[string]interface{}{}
+		for i := 1; i <= 12; i++ {
+			rows = append(rows, map[string]interface{}{"id": "v" + strconv.Itoa(i), "title": "Hamlet", "director": "Director " + strconv.Itoa(i)})
+		}
+		if strings.Contains(req.Query, "limit:") {
+			rows = rows[:10]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"vhs": rows}})
+	}))
+	defer server.Close()
+
+	movie, err := NewHasuraClient(server.URL, "").FindMovieByTitle(context.Background(), "Hamlet", stringPtr("Director 12"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if movie == nil || movie["id"] != "v12" {
+		t.Errorf("expected the twelfth candidate to match, got %v", movie)
+	}
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mediacloset/api/internal/ratelimit"
+)
+
+// Login guard defaults. A 6-digit code has a million values, so five guesses
+// per code leave an attacker a 1 in 200,000 chance before the email is locked.
+const (
+	defaultMaxFailuresPerEmail = 5
+	defaultMaxFailuresPerIP    = 20
+	defaultFailureWindow       = 15 * time.Minute
+	defaultLockoutDuration     = 15 * time.Minute
+
+	// Code requests per email address back off exponentially: the second
+	// request waits 30s, the third 60s, and so on up to an hour. An address
+	// left alone for an hour starts over.
+	defaultRequestBackoffBase  = 30 * time.Second
+	defaultRequestBackoffMax   = time.Hour
+	defaultRequestBackoffReset = time.Hour
+	defaultMaxRequestsPerIP    = 20
+	defaultRequestWindow       = time.Hour
+
+	// loginGuardStateTTL is how long lockout and backoff state is kept. It
+	// exceeds the longest lockout and backoff, so expiry never ends one early.
+	loginGuardStateTTL = 24 * time.Hour
+)
+
+// LoginThrottledError is returned while an email address or IP is locked out
+// or asking for codes faster than the backoff allows
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many login attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginGuard counts login code requests and verification attempts per email
+// address and per IP. Counters live in a ratelimit.Store, so replicas sharing
+// a store share the limits. Attempts and failures are counted in fixed
+// windows; lockouts and backoff are stored as the time they end.
+type LoginGuard struct {
+	maxFailuresPerEmail int
+	maxFailuresPerIP    int
+	failureWindow       time.Duration
+	lockoutDuration     time.Duration
+	requestBackoffBase  time.Duration
+	requestBackoffMax   time.Duration
+	requestBackoffReset time.Duration
+	maxRequestsPerIP    int
+	requestWindow       time.Duration
+
+	store ratelimit.Store
+	now   func() time.Time
+}
+
+// NewLoginGuard creates a login guard with the default limits
+func NewLoginGuard(store ratelimit.Store) *LoginGuard {
+	return &LoginGuard{
+		maxFailuresPerEmail: defaultMaxFailuresPerEmail,
+		maxFailuresPerIP:    defaultMaxFailuresPerIP,
+		failureWindow:       defaultFailureWindow,
+		lockoutDuration:     defaultLockoutDuration,
+		requestBackoffBase:  defaultRequestBackoffBase,
+		requestBackoffMax:   defaultRequestBackoffMax,
+		requestBackoffReset: defaultRequestBackoffReset,
+		maxRequestsPerIP:    defaultMaxRequestsPerIP,
+		requestWindow:       defaultRequestWindow,
+		store:               store,
+		now:                 time.Now,
+	}
+}
+
+// AllowRequest records a login code request, or returns a
+// *LoginThrottledError when the address is locked out or backing off, or the
+// IP has asked for too many codes
+func (g *LoginGuard) AllowRequest(ctx context.Context, email, ip string) error {
+	now := g.now()
+	subject := "email:" + email
+
+	if err := g.checkLock(ctx, subject, now); err != nil {
+		return err
+	}
+	if wait := g.getTime(ctx, "next_request:"+subject).Sub(now); wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+
+	if ip != "" {
+		if err := g.take(ctx, "requests:ip:"+ip, g.maxRequestsPerIP, g.requestWindow, now); err != nil {
+			return err
+		}
+	}
+
+	requests := "requests:" + subject
+	if now.Sub(g.getTime(ctx, "last_request:"+subject)) >= g.requestBackoffReset {
+		g.set(ctx, g.key(requests), 0, loginGuardStateTTL)
+	}
+	n := g.store.Add(ctx, g.key(requests), 1, loginGuardStateTTL)
+	backoff := g.requestBackoffBase << (n - 1)
+	if backoff > g.requestBackoffMax || backoff <= 0 {
+		backoff = g.requestBackoffMax
+	}
+	g.setTime(ctx, "last_request:"+subject, now)
+	g.setTime(ctx, "next_request:"+subject, now.Add(backoff))
+
+	return nil
+}
+
+// BeginVerify reserves a verification attempt, or returns a
+// *LoginThrottledError when the address or IP has no attempts left. Every
+// attempt must be followed by RecordFailure, RecordSuccess, or
+// CancelVerify.
+func (g *LoginGuard) BeginVerify(ctx context.Context, email, ip string) error {
+	now := g.now()
+
+	if err := g.reserveAttempt(ctx, "email:"+email, g.maxFailuresPerEmail, now); err != nil {
+		return err
+	}
+	if ip != "" {
+		if err := g.reserveAttempt(ctx, "ip:"+ip, g.maxFailuresPerIP, now); err != nil {
+			g.release(ctx, g.windowKey("attempts:email:"+email, g.failureWindow, now), 1)
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordFailure locks out the address or IP once its attempts are used up.
+// Returns true when the email address was just locked, so its outstanding
+// codes can be invalidated.
+func (g *LoginGuard) RecordFailure(ctx context.Context, email, ip string) bool {
+	now := g.now()
+
+	if ip != "" {
+		g.lockIfExhausted(ctx, "ip:"+ip, g.maxFailuresPerIP, now)
+	}
+	return g.lockIfExhausted(ctx, "email:"+email, g.maxFailuresPerEmail, now)
+}
+
+// RecordSuccess clears the address's failed attempts and returns the IP's
+// reserved attempt. The IP keeps its other failures, so signing in to one
+// account does not reset guessing at others.
+func (g *LoginGuard) RecordSuccess(ctx context.Context, email, ip string) {
+	now := g.now()
+
+	g.set(ctx, g.windowKey("attempts:email:"+email, g.failureWindow, now), 0, g.failureWindow)
+	g.set(ctx, g.windowKey("failures:email:"+email, g.failureWindow, now), 0, g.failureWindow)
+	if ip != "" {
+		g.release(ctx, g.windowKey("attempts:ip:"+ip, g.failureWindow, now), 1)
+	}
+}
+
+// CancelVerify returns a reserved attempt that could not be checked, e.g.
+// because Hasura was unreachable
+func (g *LoginGuard) CancelVerify(ctx context.Context, email, ip string) {
+	now := g.now()
+
+	g.release(ctx, g.windowKey("attempts:email:"+email, g.failureWindow, now), 1)
+	if ip != "" {
+		g.release(ctx, g.windowKey("attempts:ip:"+ip, g.failureWindow, now), 1)
+	}
+}
+
+func (g *LoginGuard) reserveAttempt(ctx context.Context, subject string, max int, now time.Time) error {
+	if err := g.checkLock(ctx, subject, now); err != nil {
+		return err
+	}
+	return g.take(ctx, "attempts:"+subject, max, g.failureWindow, now)
+}
+
+// lockIfExhausted counts a failure and locks the subject when it is the
+// one that used up the window. The store's counter picks a single caller, so
+// concurrent failures across replicas lock only once.
+func (g *LoginGuard) lockIfExhausted(ctx context.Context, subject string, max int, now time.Time) bool {
+	failures := g.windowKey("failures:"+subject, g.failureWindow, now)
+	n := g.store.Add(ctx, failures, 1, g.failureWindow)
+	if n != int64(max) {
+		return false
+	}
+
+	g.setTime(ctx, "locked_until:"+subject, now.Add(g.lockoutDuration))
+	g.store.Add(ctx, failures, -n, g.failureWindow)
+	g.release(ctx, g.windowKey("attempts:"+subject, g.failureWindow, now), n)
+	return true
+}
+
+func (g *LoginGuard) checkLock(ctx context.Context, subject string, now time.Time) error {
+	if wait := g.getTime(ctx, "locked_until:"+subject).Sub(now); wait > 0 {
+		return &LoginThrottledError{RetryAfter: min(wait, g.lockoutDuration)}
+	}
+	return nil
+}
+
+// take counts one use of name in the current window, or returns a
+// *LoginThrottledError until the window ends once max is reached
+func (g *LoginGuard) take(ctx context.Context, name string, max int, window time.Duration, now time.Time) error {
+	key := g.windowKey(name, window, now)
+	if g.store.Add(ctx, key, 1, window) > int64(max) {
+		g.store.Add(ctx, key, -1, window)
+		return &LoginThrottledError{RetryAfter: now.Truncate(window).Add(window).Sub(now)}
+	}
+	return nil
+}
+
+// release returns n uses taken from an attempt counter, never taking it
+// below zero
+func (g *LoginGuard) release(ctx context.Context, key string, n int64) {
+	if left := g.store.Add(ctx, key, -n, g.failureWindow); left < 0 {
+		g.store.Add(ctx, key, -left, g.failureWindow)
+	}
+}
+
+func (g *LoginGuard) getTime(ctx context.Context, name string) time.Time {
+	return time.UnixMilli(g.store.Add(ctx, g.key(name), 0, loginGuardStateTTL))
+}
+
+func (g *LoginGuard) setTime(ctx context.Context, name string, t time.Time) {
+	g.set(ctx, g.key(name), t.UnixMilli(), loginGuardStateTTL)
+}
+
+// set overwrites a counter. Store only offers Add, so this is a read
+// followed by an add; callers use it where a lost race is harmless.
+func (g *LoginGuard) set(ctx context.Context, key string, value int64, ttl time.Duration) {
+	current := g.store.Add(ctx, key, 0, ttl)
+	if current != value {
+		g.store.Add(ctx, key, value-current, ttl)
+	}
+}
+
+func (g *LoginGuard) key(name string) string {
+	return "login:" + name
+}
+
+// windowKey names a counter for the fixed window containing now
+func (g *LoginGuard) windowKey(name string, window time.Duration, now time.Time) string {
+	return fmt.Sprintf("login:%s:%d", name, now.Truncate(window).Unix())
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"mediacloset/api/internal/ratelimit"
+)
+
+// newTestLoginGuard returns a guard whose clock only moves when advance is called
+func newTestLoginGuard() (*LoginGuard, func(time.Duration)) {
+	guard := NewLoginGuard(ratelimit.NewMemoryStore())
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	guard.now = func() time.Time { return now }
+	return guard, func(d time.Duration) { now = now.Add(d) }
+}
+
+func expectThrottled(t *testing.T, err error, retryAfter time.Duration) {
+	t.Helper()
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("expected a throttled error, got %v", err)
+	}
+	if throttled.RetryAfter != retryAfter {
+		t.Errorf("expected retry after %v, got %v", retryAfter, throttled.RetryAfter)
+	}
+}
+
+func TestLoginGuard_RequestBackoff(t *testing.T) {
+	guard, advance := newTestLoginGuard()
+	ctx := context.Background()
+
+	if err := guard.AllowRequest(ctx, "a@example.com", "203.0.113.7"); err != nil {
+		t.Fatalf("expected first request to be allowed, got %v", err)
+	}
+	expectThrottled(t, guard.AllowRequest(ctx, "a@example.com", "203.0.113.7"), 30*time.Second)
+
+	// Other addresses are unaffected
+	if err := guard.AllowRequest(ctx, "b@example.com", "203.0.113.7"); err != nil {
+		t.Fatalf("expected another address to be allowed, got %v", err)
+	}
+
+	// Each further request doubles the wait
+	for _, wait := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute} {
+		advance(wait)
+		if err := guard.AllowRequest(ctx, "a@example.com", "203.0.113.7"); err != nil {
+			t.Fatalf("expected request after %v to be allowed, got %v", wait, err)
+		}
+	}
+	expectThrottled(t, guard.AllowRequest(ctx, "a@example.com", "203.0.113.7"), 4*time.Minute)
+
+	// A quiet hour resets the backoff
+	advance(time.Hour)
+	if err := guard.AllowRequest(ctx, "a@example.com", "203.0.113.7"); err != nil {
+		t.Fatalf("expected request after a quiet hour to be allowed, got %v", err)
+	}
+	expectThrottled(t, guard.AllowRequest(ctx, "a@example.com", "203.0.113.7"), 30*time.Second)
+}
+
+func TestLoginGuard_RequestsPerIP(t *testing.T) {
+	guard, advance := newTestLoginGuard()
+	ctx := context.Background()
+	guard.maxRequestsPerIP = 3
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if err := guard.AllowRequest(ctx, email, "203.0.113.7"); err != nil {
+			t.Fatalf("expected request for %s to be allowed, got %v", email, err)
+		}
+	}
+	advance(10 * time.Minute)
+	expectThrottled(t, guard.AllowRequest(ctx, "d@example.com", "203.0.113.7"), 50*time.Minute)
+
+	if err := guard.AllowRequest(ctx, "d@example.com", "198.51.100.4"); err != nil {
+		t.Fatalf("expected another IP to be allowed, got %v", err)
+	}
+}
+
+func TestLoginGuard_VerifyLockout(t *testing.T) {
+	guard, advance := newTestLoginGuard()
+	ctx := context.Background()
+
+	for i := 1; i <= defaultMaxFailuresPerEmail; i++ {
+		if err := guard.BeginVerify(ctx, "a@example.com", "203.0.113.7"); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i, err)
+		}
+		locked := guard.RecordFailure(ctx, "a@example.com", "203.0.113.7")
+		if locked != (i == defaultMaxFailuresPerEmail) {
+			t.Errorf("attempt %d: expected locked=%v, got %v", i, i == defaultMaxFailuresPerEmail, locked)
+		}
+	}
+
+	expectThrottled(t, guard.BeginVerify(ctx, "a@example.com", "198.51.100.4"), defaultLockoutDuration)
+	expectThrottled(t, guard.AllowRequest(ctx, "a@example.com", "198.51.100.4"), defaultLockoutDuration)
+
+	advance(defaultLockoutDuration)
+	if err := guard.BeginVerify(ctx, "a@example.com", "203.0.113.7"); err != nil {
+		t.Fatalf("expected lockout to end, got %v", err)
+	}
+	guard.RecordSuccess(ctx, "a@example.com", "203.0.113.7")
+}
+
+func TestLoginGuard_SuccessResetsEmailOnly(t *testing.T) {
+	guard, _ := newTestLoginGuard()
+	ctx := context.Background()
+	guard.maxFailuresPerIP = 4
+
+	// Three wrong guesses at one account, then a good code for another
+	for i := 0; i < 3; i++ {
+		guard.BeginVerify(ctx, "victim@example.com", "203.0.113.7")
+		guard.RecordFailure(ctx, "victim@example.com", "203.0.113.7")
+	}
+	guard.BeginVerify(ctx, "me@example.com", "203.0.113.7")
+	guard.RecordSuccess(ctx, "me@example.com", "203.0.113.7")
+
+	// The IP still has only one attempt left
+	if err := guard.BeginVerify(ctx, "victim@example.com", "203.0.113.7"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	guard.RecordFailure(ctx, "victim@example.com", "203.0.113.7")
+	if err := guard.BeginVerify(ctx, "other@example.com", "203.0.113.7"); err == nil {
+		t.Error("expected the IP to be locked out")
+	}
+}
+
+func TestLoginGuard_ConcurrentAttemptsAreBounded(t *testing.T) {
+	guard, _ := newTestLoginGuard()
+	ctx := context.Background()
+
+	// Attempts are reserved up front, so guesses in flight count too
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if guard.BeginVerify(ctx, "a@example.com", "") == nil {
+			allowed++
+		}
+	}
+	if allowed != defaultMaxFailuresPerEmail {
+		t.Errorf("expected %d attempts in flight, got %d", defaultMaxFailuresPerEmail, allowed)
+	}
+
+	guard.CancelVerify(ctx, "a@example.com", "")
+	if err := guard.BeginVerify(ctx, "a@example.com", ""); err != nil {
+		t.Errorf("expected a cancelled attempt to be returned, got %v", err)
+	}
+}
+
+func TestLoginGuard_SharedStore(t *testing.T) {
+	// Two replicas sharing a store share the email's attempts
+	store := ratelimit.NewMemoryStore()
+	replicas := []*LoginGuard{NewLoginGuard(store), NewLoginGuard(store)}
+	ctx := context.Background()
+
+	for i := 0; i < defaultMaxFailuresPerEmail; i++ {
+		guard := replicas[i%len(replicas)]
+		if err := guard.BeginVerify(ctx, "a@example.com", ""); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i+1, err)
+		}
+		guard.RecordFailure(ctx, "a@example.com", "")
+	}
+
+	for i, guard := range replicas {
+		var throttled *LoginThrottledError
+		if err := guard.BeginVerify(ctx, "a@example.com", ""); !errors.As(err, &throttled) {
+			t.Errorf("replica %d: expected the address to be locked, got %v", i, err)
+		}
+	}
+}
+
+func TestAuthService_VerifyLoginCodeLockout(t *testing.T) {
+	invalidated := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "VerifyLoginCode":
+			data["login_codes"] = []interface{}{}
+		case "InvalidateLoginCodes":
+			if req.Variables["email"] != "a@example.com" {
+				t.Errorf("expected codes for a@example.com to be invalidated, got %v", req.Variables["email"])
+			}
+			invalidated++
+			data["update_login_codes"] = map[string]interface{}{"affected_rows": 1}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer server.Close()
+
+	auth := NewAuthService(NewHasuraClient(server.URL, ""), nil, "test-secret", true)
+	ctx := context.Background()
+	client := SessionClient{IPAddress: "203.0.113.7"}
+
+	for i := 0; i < defaultMaxFailuresPerEmail; i++ {
+		_, _, err := auth.VerifyLoginCode(ctx, "A@example.com", "000000", client)
+		if err == nil || err.Error() != "invalid or expired login code" {
+			t.Fatalf("attempt %d: expected invalid code, got %v", i+1, err)
+		}
+	}
+	if invalidated != 1 {
+		t.Errorf("expected outstanding codes to be invalidated once, got %d", invalidated)
+	}
+
+	_, _, err := auth.VerifyLoginCode(ctx, "a@example.com", "123456", client)
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) {
+		t.Errorf("expected locked out address to be throttled, got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"mediacloset/api/internal/logging"
+)
+
+// MagicLinkPath is where sign-in links point. The iOS app claims it as a
+// universal link; browsers get MagicLinkPageHandler instead.
+const MagicLinkPath = "/auth/magic"
+
+const (
+	magicLinkExpiry   = 15 * time.Minute
+	magicLinkAudience = "magic-link"
+	// magicLinkCodePrefix marks login_codes rows that hold a link nonce hash
+	// rather than a typed code
+	magicLinkCodePrefix = "link:"
+)
+
+var ErrInvalidMagicLink = errors.New("invalid or expired login link")
+
+// magicLinkClaims identify one login_codes row. The nonce is stored only as
+// a hash, and the signature lets forged links be rejected without a lookup.
+type magicLinkClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// SetMagicLinkURL sets the URL sign-in links point to, normally
+// PUBLIC_BASE_URL + MagicLinkPath
+func (a *AuthService) SetMagicLinkURL(linkURL string) {
+	a.magicLinkURL = linkURL
+}
+
+// RequestMagicLink emails a single-use sign-in link. It shares the login
+// code throttling and storage, so a lockout also kills outstanding links.
+func (a *AuthService) RequestMagicLink(ctx context.Context, email string, ipAddress string) error {
+	email = normalizeEmail(email)
+
+	if a.magicLinkURL == "" {
+		return fmt.Errorf("magic links are not configured")
+	}
+	if err := a.loginGuard.AllowRequest(ctx, email, ipAddress); err != nil {
+		return err
+	}
+
+	if _, err := a.getOrCreateUser(ctx, email); err != nil {
+		return fmt.Errorf("failed to get or create user: %w", err)
+	}
+
+	nonce, err := generateRefreshToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(magicLinkExpiry)
+
+	if err := a.storeLoginCode(ctx, email, magicLinkCode(nonce), expiresAt); err != nil {
+		return fmt.Errorf("failed to store login link: %w", err)
+	}
+
+	token, err := a.signMagicLink(email, nonce, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to sign login link: %w", err)
+	}
+	link := a.magicLinkURL + "?token=" + url.QueryEscape(token)
+
+	if a.isDev {
+		slog.InfoContext(ctx, "Login link issued (development only)", "email", email, "dev_link", logging.Revealed(link), "expires_in", magicLinkExpiry.String())
+	}
+
+	if a.emailService != nil {
+		if err := a.emailService.SendMagicLink(ctx, email, link); err != nil {
+			return fmt.Errorf("failed to send login link email: %w", err)
+		}
+	} else {
+		slog.WarnContext(ctx, "Email service not configured, skipping email send")
+	}
+
+	return nil
+}
+
+// VerifyMagicLink consumes a sign-in link token and starts a session, like
+// VerifyLoginCode
+func (a *AuthService) VerifyMagicLink(ctx context.Context, token string, client SessionClient) (*TokenPair, *User, error) {
+	claims := &magicLinkClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return a.magicLinkKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(magicLinkAudience))
+	if err != nil || claims.ID == "" || claims.Email == "" {
+		return nil, nil, ErrInvalidMagicLink
+	}
+
+	// Claiming the row is the single-use check; a second tap finds it used
+	claimed, err := a.claimMagicLink(ctx, claims.Email, magicLinkCode(claims.ID))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !claimed {
+		return nil, nil, ErrInvalidMagicLink
+	}
+
+	user, err := a.GetUserByEmail(ctx, claims.Email)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, nil, fmt.Errorf("user not found")
+	}
+
+	pair, err := a.createSession(ctx, user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
+}
+
+func (a *AuthService) claimMagicLink(ctx context.Context, email, code string) (bool, error) {
+	query := `
+		mutation ClaimMagicLink($email: String!, $code: String!) {
+			update_login_codes(
+				where: {
+					email: {_eq: $email}
+					code: {_eq: $code}
+					expires_at: {_gt: "now()"}
+					used_at: {_is_null: true}
+				}
+				_set: {used_at: "now()"}
+			) {
+				affected_rows
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "ClaimMagicLink",
+		Variables: map[string]interface{}{
+			"email": email,
+			"code":  code,
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim login link: %w", err)
+	}
+
+	return affectedRows(resp, "update_login_codes") == 1, nil
+}
+
+func (a *AuthService) signMagicLink(email, nonce string, expiresAt time.Time) (string, error) {
+	claims := &magicLinkClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        nonce,
+			Audience:  jwt.ClaimStrings{magicLinkAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "mediacloset",
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.magicLinkKey())
+}
+
+// magicLinkKey is derived from the JWT secret so a link can never pass as an
+// access token, or the other way around
+func (a *AuthService) magicLinkKey() []byte {
+	sum := sha256.Sum256([]byte(magicLinkAudience + ":" + a.jwtSecret))
+	return sum[:]
+}
+
+func magicLinkCode(nonce string) string {
+	return magicLinkCodePrefix + hashRefreshToken(nonce)
+}
+
+var magicLinkPage = template.Must(template.New("magic-link").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1.0">
+  <title>Sign in to MediaCloset</title>
+</head>
+<body style="margin: 0; padding: 40px 20px; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; background-color: #f5f5f7; text-align: center;">
+  <div style="max-width: 440px; margin: 0 auto; background-color: #ffffff; border-radius: 16px; padding: 40px;">
+    <h1 style="margin: 0 0 16px 0; font-size: 22px; color: #1a1a1a;">Sign in to MediaCloset</h1>
+    {{if .AppURL}}
+    <p style="font-size: 15px; line-height: 24px; color: #666666;">Open this link on the iPhone where MediaCloset is installed.</p>
+    <a href="{{.AppURL}}" style="display: inline-block; background-color: #6366f1; color: #ffffff; font-size: 16px; font-weight: 600; text-decoration: none; padding: 14px 32px; border-radius: 12px;">Open MediaCloset</a>
+    {{else}}
+    <p style="font-size: 15px; line-height: 24px; color: #666666;">This sign-in link is incomplete. Request a new one from the app.</p>
+    {{end}}
+  </div>
+</body>
+</html>`))
+
+// MagicLinkPageHandler serves MagicLinkPath to browsers, i.e. when the app
+// is not installed or the link was opened on another device. It hands the
+// token to the app's URL scheme and never consumes it, so mail scanners that
+// prefetch links cannot burn it.
+func MagicLinkPageHandler(appURLScheme string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := struct{ AppURL template.URL }{}
+		if token := r.URL.Query().Get("token"); token != "" && appURLScheme != "" {
+			data.AppURL = template.URL(appURLScheme + "://auth/magic?token=" + url.QueryEscape(token))
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		magicLinkPage.Execute(w, data)
+	})
+}
+
+// AppleAppSiteAssociationHandler lets the iOS app (TEAMID.bundle.id) open
+// MagicLinkPath as a universal link and use passkeys for this domain
+func AppleAppSiteAssociationHandler(appID string) http.Handler {
+	body, _ := json.Marshal(map[string]interface{}{
+		"applinks": map[string]interface{}{
+			"details": []map[string]interface{}{
+				{
+					"appIDs":     []string{appID},
+					"components": []map[string]string{{"/": MagicLinkPath}},
+				},
+			},
+		},
+		"webcredentials": map[string]interface{}{
+			"apps": []string{appID},
+		},
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLoginCodeHasura stores login_codes rows in memory and knows one user
+type fakeLoginCodeHasura struct {
+	mu    sync.Mutex
+	codes []map[string]interface{}
+}
+
+func (f *fakeLoginCodeHasura) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "GetUserByEmail":
+			data["users"] = []map[string]interface{}{{"id": "u1", "email": req.Variables["email"]}}
+		case "StoreLoginCode":
+			f.codes = append(f.codes, req.Variables)
+			data["insert_login_codes_one"] = map[string]interface{}{"id": "c1"}
+		case "ClaimMagicLink":
+			affected := 0
+			for _, row := range f.codes {
+				expiresAt, _ := time.Parse(time.RFC3339, row["expires_at"].(string))
+				if row["email"] == req.Variables["email"] && row["code"] == req.Variables["code"] &&
+					row["used_at"] == nil && time.Now().Before(expiresAt) {
+					row["used_at"] = time.Now().Format(time.RFC3339)
+					affected++
+				}
+			}
+			data["update_login_codes"] = map[string]interface{}{"affected_rows": affected}
+		case "CreateSession":
+			data["insert_sessions_one"] = map[string]interface{}{"id": "s1"}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+}
+
+func TestAuthService_RequestMagicLink(t *testing.T) {
+	fake := &fakeLoginCodeHasura{}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	auth := NewAuthService(NewHasuraClient(server.URL, ""), nil, "test-secret", true)
+	ctx := context.Background()
+
+	if err := auth.RequestMagicLink(ctx, "a@example.com", ""); err == nil {
+		t.Error("expected magic links to be disabled without a link URL")
+	}
+
+	auth.SetMagicLinkURL("https://mediacloset.example.com" + MagicLinkPath)
+	if err := auth.RequestMagicLink(ctx, "A@Example.com", "203.0.113.7"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.codes) != 1 {
+		t.Fatalf("expected one stored code, got %d", len(fake.codes))
+	}
+	row := fake.codes[0]
+	if row["email"] != "a@example.com" || !strings.HasPrefix(row["code"].(string), magicLinkCodePrefix) {
+		t.Errorf("expected a link row for a@example.com, got %+v", row)
+	}
+	expiresAt, _ := time.Parse(time.RFC3339, row["expires_at"].(string))
+	if d := time.Until(expiresAt); d < 14*time.Minute || d > magicLinkExpiry {
+		t.Errorf("expected link to expire in about 15 minutes, got %v", d)
+	}
+
+	// Links share the login code backoff
+	var throttled *LoginThrottledError
+	if err := auth.RequestMagicLink(ctx, "a@example.com", "203.0.113.7"); !errors.As(err, &throttled) {
+		t.Errorf("expected a second request to be throttled, got %v", err)
+	}
+}
+
+func TestAuthService_VerifyMagicLink(t *testing.T) {
+	fake := &fakeLoginCodeHasura{}
+	server := httptest.NewServer(fake.handler(t))
+	defer server.Close()
+
+	auth := NewAuthService(NewHasuraClient(server.URL, ""), nil, "test-secret", true)
+	ctx := context.Background()
+
+	issue := func(nonce string, expiresAt time.Time) string {
+		fake.codes = append(fake.codes, map[string]interface{}{
+			"email":      "a@example.com",
+			"code":       magicLinkCode(nonce),
+			"expires_at": expiresAt.Format(time.RFC3339),
+		})
+		token, err := auth.signMagicLink("a@example.com", nonce, expiresAt)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return token
+	}
+
+	token := issue("nonce-1", time.Now().Add(magicLinkExpiry))
+
+	pair, user, err := auth.VerifyMagicLink(ctx, token, SessionClient{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Email != "a@example.com" || pair.SessionID != "s1" {
+		t.Errorf("expected a session for a@example.com, got %+v, %+v", user, pair)
+	}
+	if _, err := auth.ValidateToken(ctx, pair.AccessToken); err != nil {
+		t.Errorf("expected the issued access token to be valid, got %v", err)
+	}
+	if _, err := auth.ValidateToken(ctx, token); err == nil {
+		t.Error("expected a magic link token to be rejected as an access token")
+	}
+
+	other := NewAuthService(nil, nil, "other-secret", true)
+	forged, _ := other.signMagicLink("a@example.com", "nonce-2", time.Now().Add(magicLinkExpiry))
+	accessToken, _ := auth.generateToken(&User{ID: "u1", Email: "a@example.com"}, "", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "second use", token: token},
+		{name: "expired", token: issue("nonce-3", time.Now().Add(-time.Minute))},
+		{name: "signed with another secret", token: forged},
+		{name: "access token", token: accessToken},
+		{name: "garbage", token: "not-a-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := auth.VerifyMagicLink(ctx, tt.token, SessionClient{}); !errors.Is(err, ErrInvalidMagicLink) {
+				t.Errorf("expected ErrInvalidMagicLink, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMagicLinkPageHandler(t *testing.T) {
+	handler := MagicLinkPageHandler("mediacloset")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", MagicLinkPath+"?token=abc.def%22%3E", nil))
+
+	body := rr.Body.String()
+	if !strings.Contains(body, `href="mediacloset://auth/magic?token=abc.def%22%3E"`) {
+		t.Errorf("expected an escaped app link, got %s", body)
+	}
+	if rr.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected the page not to be cached")
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", MagicLinkPath, nil))
+	if strings.Contains(rr.Body.String(), "mediacloset://") {
+		t.Error("expected no app link without a token")
+	}
+}
+
+func TestAppleAppSiteAssociationHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	AppleAppSiteAssociationHandler("TEAM123.com.example.MediaCloset").ServeHTTP(rr, httptest.NewRequest("GET", "/.well-known/apple-app-site-association", nil))
+
+	var aasa struct {
+		Applinks struct {
+			Details []struct {
+				AppIDs     []string            `json:"appIDs"`
+				Components []map[string]string `json:"components"`
+			}
+		}
+		Webcredentials struct {
+			Apps []string
+		}
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &aasa); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(aasa.Applinks.Details) != 1 || aasa.Applinks.Details[0].AppIDs[0] != "TEAM123.com.example.MediaCloset" ||
+		aasa.Applinks.Details[0].Components[0]["/"] != MagicLinkPath ||
+		len(aasa.Webcredentials.Apps) != 1 || aasa.Webcredentials.Apps[0] != "TEAM123.com.example.MediaCloset" {
+		t.Errorf("unexpected association: %s", rr.Body.String())
+	}
+}
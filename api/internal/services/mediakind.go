@@ -0,0 +1,172 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mediacloset/api/internal/normalize"
+)
+
+// MediaKind identifies one of the shared catalog tables
+type MediaKind string
+
+const (
+	MediaKindMovie    MediaKind = "vhs"
+	MediaKindAlbum    MediaKind = "records"
+	MediaKindCassette MediaKind = "cassettes"
+)
+
+// mediaTable describes how a kind is stored in Hasura
+type mediaTable struct {
+	name        string // catalog table
+	junction    string // user collection junction table
+	relation    string // junction -> catalog row relationship
+	fkColumn    string // junction column referencing the catalog row
+	titleFields string // fields that identify the item to a person
+	columns     []catalogColumn
+}
+
+// columnType is the Postgres type of a catalog data column
+type columnType int
+
+const (
+	columnText columnType = iota
+	columnInt
+	columnTextArray
+)
+
+// catalogColumn is an editable data column on a catalog table
+type catalogColumn struct {
+	name string
+	typ  columnType
+}
+
+var mediaTables = map[MediaKind]mediaTable{
+	MediaKindMovie: {
+		name:        "vhs",
+		junction:    "user_vhs",
+		relation:    "vhs",
+		fkColumn:    "vhs_id",
+		titleFields: "title\n\t\t\t\t\tdirector",
+		columns: []catalogColumn{
+			{"title", columnText},
+			{"director", columnText},
+			{"year", columnInt},
+			{"genre", columnText},
+			{"cover_url", columnText},
+		},
+	},
+	MediaKindAlbum: {
+		name:        "records",
+		junction:    "user_records",
+		relation:    "record",
+		fkColumn:    "record_id",
+		titleFields: "artist\n\t\t\t\t\talbum",
+		columns: []catalogColumn{
+			{"artist", columnText},
+			{"album", columnText},
+			{"year", columnInt},
+			{"label", columnText},
+			{"color_variants", columnTextArray},
+			{"genres", columnTextArray},
+			{"cover_url", columnText},
+			{"size", columnInt},
+		},
+	},
+	MediaKindCassette: {
+		name:        "cassettes",
+		junction:    "user_cassettes",
+		relation:    "cassette",
+		fkColumn:    "cassette_id",
+		titleFields: "artist\n\t\t\t\t\talbum",
+		columns: []catalogColumn{
+			{"artist", columnText},
+			{"album", columnText},
+			{"year", columnInt},
+			{"label", columnText},
+			{"genres", columnTextArray},
+			{"cover_url", columnText},
+			{"tape_type", columnText},
+		},
+	},
+}
+
+// ParseMediaKind accepts a table name or a friendly alias (movie, album, cassette)
+func ParseMediaKind(s string) (MediaKind, error) {
+	switch strings.ToLower(s) {
+	case "vhs", "movie", "movies":
+		return MediaKindMovie, nil
+	case "records", "record", "album", "albums":
+		return MediaKindAlbum, nil
+	case "cassettes", "cassette":
+		return MediaKindCassette, nil
+	}
+	return "", fmt.Errorf("unknown media kind: %q (expected movie, album, or cassette)", s)
+}
+
+func (k MediaKind) table() (mediaTable, error) {
+	t, ok := mediaTables[k]
+	if !ok {
+		return mediaTable{}, fmt.Errorf("unknown media kind: %q", string(k))
+	}
+	return t, nil
+}
+
+// NormalizedKey computes the normalized_key column for a catalog row from its
+// title fields, so spelling variants of a release share one key
+func (k MediaKind) NormalizedKey(row map[string]interface{}) string {
+	str := func(key string) string {
+		v, _ := row[key].(string)
+		return v
+	}
+
+	if k == MediaKindMovie {
+		return normalize.MovieKey(str("title"))
+	}
+	return normalize.AlbumKey(str("artist"), str("album"))
+}
+
+// ParseColumnValue converts a command-line value for one of the kind's data
+// columns: integers for year and size, comma-separated lists for arrays
+func (k MediaKind) ParseColumnValue(column, raw string) (interface{}, error) {
+	t, err := k.table()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range t.columns {
+		if c.name != column {
+			continue
+		}
+		switch c.typ {
+		case columnInt:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an integer", column)
+			}
+			return n, nil
+		case columnTextArray:
+			values := []interface{}{}
+			for _, v := range strings.Split(raw, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+			return values, nil
+		default:
+			return raw, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s has no editable column %q", k, column)
+}
+
+// columnSelection lists the kind's data columns for a GraphQL selection set
+func (t mediaTable) columnSelection(indent string) string {
+	names := make([]string, 0, len(t.columns))
+	for _, c := range t.columns {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, "\n"+indent)
+}
@@ -5,32 +5,58 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"mediacloset/api/internal/graph/model"
 	"mediacloset/api/internal/ratelimit"
+	"mediacloset/api/internal/resilient"
 )
 
 // MusicBrainzService handles requests to the MusicBrainz and Cover Art Archive APIs
 type MusicBrainzService struct {
-	client          *http.Client
-	limiter         *ratelimit.ServiceLimiter
+	client          httpDoer // Waits for the MusicBrainz rate limit before each API attempt
 	baseURL         string
 	coverArtBaseURL string
+
+	lookups singleflight.Group // Coalesces concurrent identical album searches
+}
+
+// musicBrainzResilience keeps retries at least a second apart, since
+// MusicBrainz answers 503 to clients that exceed 1 request per second
+var musicBrainzResilience = resilient.Config{
+	MaxRetries:       2,
+	BaseDelay:        2 * time.Second,
+	MaxDelay:         10 * time.Second,
+	FailureThreshold: 5,
+	Cooldown:         30 * time.Second,
 }
 
 // NewMusicBrainzService creates a new MusicBrainz API client with rate limiting
 func NewMusicBrainzService(limiter *ratelimit.ServiceLimiter) *MusicBrainzService {
-	return &MusicBrainzService{
-		client: &http.Client{
-			Timeout: 5 * time.Second,
-		},
-		limiter:         limiter,
+	s := &MusicBrainzService{
 		baseURL:         "https://musicbrainz.org",
 		coverArtBaseURL: "https://coverartarchive.org",
 	}
+
+	limit := waitForLimit(limiter, ratelimit.ProviderMusicBrainz)
+	config := musicBrainzResilience
+	config.BeforeAttempt = func(req *http.Request) error {
+		// Cover Art Archive shares the client but not the limit
+		if !strings.HasPrefix(req.URL.String(), s.baseURL) {
+			return nil
+		}
+		return limit(req)
+	}
+	s.client = resilient.New("musicbrainz", &http.Client{
+		Timeout: 5 * time.Second,
+	}, config)
+	return s
 }
 
 // MusicBrainzSearchResponse represents the search response from MusicBrainz API
@@ -74,10 +100,6 @@ type MusicBrainzBarcodeSearchResponse struct {
 
 // SearchByBarcode searches MusicBrainz releases by barcode and returns album metadata
 func (s *MusicBrainzService) SearchByBarcode(ctx context.Context, barcode string) (*model.AlbumData, error) {
-	if err := s.limiter.WaitMusicBrainz(ctx); err != nil {
-		return nil, fmt.Errorf("rate limit wait failed: %w", err)
-	}
-
 	params := url.Values{}
 	params.Set("query", fmt.Sprintf("barcode:%s", barcode))
 	params.Set("fmt", "json")
@@ -160,7 +182,7 @@ func (s *MusicBrainzService) SearchByBarcode(ctx context.Context, barcode string
 			lastErr = err
 		}
 		if coverURL == nil && lastErr != nil {
-			fmt.Printf("Failed to fetch cover art for barcode releases (tried %d): %v\n", len(searchResp.Releases), lastErr)
+			slog.WarnContext(ctx, "Failed to fetch cover art for barcode releases", "provider", "musicbrainz", "releases_tried", len(searchResp.Releases), "error", lastErr)
 		}
 	}
 
@@ -176,13 +198,15 @@ func (s *MusicBrainzService) SearchByBarcode(ctx context.Context, barcode string
 	return albumData, nil
 }
 
-// SearchAlbum searches for an album by artist and title, returns album metadata with cover art
+// SearchAlbum searches for an album by artist and title, returns album metadata with cover art.
+// Concurrent searches for the same album share one set of upstream requests.
 func (s *MusicBrainzService) SearchAlbum(ctx context.Context, artist string, album string) (*model.AlbumData, error) {
-	// Rate limit - wait for permission (1 req/sec)
-	if err := s.limiter.WaitMusicBrainz(ctx); err != nil {
-		return nil, fmt.Errorf("rate limit wait failed: %w", err)
-	}
+	return coalesce(ctx, &s.lookups, lookupKey(artist, album), func(ctx context.Context) (*model.AlbumData, error) {
+		return s.searchAlbum(ctx, artist, album)
+	})
+}
 
+func (s *MusicBrainzService) searchAlbum(ctx context.Context, artist string, album string) (*model.AlbumData, error) {
 	// Step 1: Search for releases
 	releaseIDs, err := s.searchReleases(ctx, artist, album)
 	if err != nil {
@@ -203,7 +227,7 @@ func (s *MusicBrainzService) SearchAlbum(ctx context.Context, artist string, alb
 
 	if coverURL == nil && lastErr != nil {
 		// Cover art is optional, log but don't fail
-		fmt.Printf("Failed to fetch cover art for releases (tried %d): %v\n", len(releaseIDs), lastErr)
+		slog.WarnContext(ctx, "Failed to fetch cover art for releases", "provider", "musicbrainz", "releases_tried", len(releaseIDs), "error", lastErr)
 	}
 
 	// Build album data model
@@ -356,3 +380,8 @@ func (s *MusicBrainzService) fetchCoverArtFromMetadata(ctx context.Context, rele
 
 	return nil, fmt.Errorf("no cover art found")
 }
+
+// Ping checks that MusicBrainz is reachable without calling its API
+func (s *MusicBrainzService) Ping(ctx context.Context) error {
+	return pingHost(ctx, s.baseURL)
+}
@@ -5,27 +5,37 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"mediacloset/api/internal/graph/model"
+	"mediacloset/api/internal/ratelimit"
+	"mediacloset/api/internal/resilient"
 )
 
 // OMDBService handles requests to the OMDB API (Open Movie Database)
 type OMDBService struct {
-	client  *http.Client
+	client  httpDoer // Waits for the OMDB rate limit and quota before each attempt
 	apiKey  string
 	baseURL string
+
+	lookups singleflight.Group // Coalesces concurrent identical searches
 }
 
-// NewOMDBService creates a new OMDB API client
-func NewOMDBService(apiKey string) *OMDBService {
+// NewOMDBService creates a new OMDB API client with rate limiting
+func NewOMDBService(apiKey string, limiter *ratelimit.ServiceLimiter) *OMDBService {
+	config := resilient.DefaultConfig
+	config.BeforeAttempt = waitForLimit(limiter, ratelimit.ProviderOMDB)
+
 	return &OMDBService{
-		client: &http.Client{
+		client: resilient.New("omdb", &http.Client{
 			Timeout: 5 * time.Second,
-		},
+		}, config),
 		apiKey:  apiKey,
 		baseURL: "https://www.omdbapi.com",
 	}
@@ -43,8 +53,17 @@ type OMDBResponse struct {
 	Error    string `json:"Error"`    // Error message if Response is "False"
 }
 
-// SearchMovie searches for a movie by title, with optional director and year filters
+// SearchMovie searches for a movie by title, with optional director and year filters.
+// Concurrent searches for the same title and year share one request.
 func (s *OMDBService) SearchMovie(ctx context.Context, title string, director *string, year *int) (*model.MovieData, error) {
+	// The director only affects logging, so it isn't part of the key
+	return coalesce(ctx, &s.lookups, lookupKey(title, optionalInt(year)), func(ctx context.Context) (*model.MovieData, error) {
+		return s.searchMovie(ctx, title, director, year)
+	})
+}
+
+func (s *OMDBService) searchMovie(ctx context.Context, title string, director *string, year *int) (*model.MovieData, error) {
+
 	// Build query parameters
 	params := url.Values{}
 	params.Set("apikey", s.apiKey)
@@ -103,7 +122,7 @@ func (s *OMDBService) SearchMovie(ctx context.Context, title string, director *s
 		if !strings.Contains(strings.ToLower(omdbResp.Director), strings.ToLower(*director)) &&
 			!strings.Contains(strings.ToLower(*director), strings.ToLower(omdbResp.Director)) {
 			// Log mismatch but still return result (same behavior as Swift version)
-			fmt.Printf("Director mismatch: expected '%s', got '%s'\n", *director, omdbResp.Director)
+			slog.DebugContext(ctx, "Director mismatch", "provider", "omdb", "expected", *director, "got", omdbResp.Director)
 		}
 	}
 
@@ -147,3 +166,8 @@ func (s *OMDBService) FetchMoviePosterURL(ctx context.Context, title string, dir
 	}
 	return movieData.PosterURL, nil
 }
+
+// Ping checks that OMDB is reachable without calling its API
+func (s *OMDBService) Ping(ctx context.Context) error {
+	return pingHost(ctx, s.baseURL)
+}
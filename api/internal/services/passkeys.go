@@ -0,0 +1,491 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	passkeyCeremonyRegistration = "registration"
+	passkeyCeremonyLogin        = "login"
+
+	// passkeyCeremonyTimeout is how long the user has to answer the
+	// authenticator prompt
+	passkeyCeremonyTimeout = 5 * time.Minute
+
+	maxPasskeyNameLength = 100
+)
+
+var ErrPasskeyNotFound = errors.New("passkey not found")
+
+// Passkey is a WebAuthn credential enrolled by a user
+type Passkey struct {
+	ID         string
+	UserID     string
+	Name       string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	credential webauthn.Credential
+}
+
+// PasskeyChallenge is the first half of a registration or sign-in. Options
+// is the JSON to hand to the platform authenticator; ChallengeID goes back
+// with its response.
+type PasskeyChallenge struct {
+	ChallengeID string
+	Options     string
+}
+
+// PasskeyService enrolls passkeys for signed-in users and signs users in
+// with them. Ceremony state lives in Hasura so any instance can finish a
+// ceremony another started, and each challenge can be answered only once.
+type PasskeyService struct {
+	hasuraClient *HasuraClient
+	auth         *AuthService
+	webauthn     *webauthn.WebAuthn
+}
+
+// NewPasskeyService creates a passkey service for the relying party rpID
+// (the domain passkeys are bound to) accepting responses from origins
+func NewPasskeyService(hasuraClient *HasuraClient, auth *AuthService, rpID string, origins []string) (*PasskeyService, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: passkeyCeremonyTimeout, TimeoutUVD: passkeyCeremonyTimeout}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "MediaCloset",
+		RPOrigins:     origins,
+		Timeouts:      webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebAuthn config: %w", err)
+	}
+
+	return &PasskeyService{
+		hasuraClient: hasuraClient,
+		auth:         auth,
+		webauthn:     w,
+	}, nil
+}
+
+// webauthnUser adapts a user and their passkeys to webauthn.User. The user
+// handle is the user ID, which is how discoverable sign-ins find the account.
+type webauthnUser struct {
+	user     *User
+	passkeys []*Passkey
+}
+
+func (u *webauthnUser) WebAuthnID() []byte          { return []byte(u.user.ID) }
+func (u *webauthnUser) WebAuthnName() string        { return u.user.Email }
+func (u *webauthnUser) WebAuthnDisplayName() string { return u.user.Email }
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.passkeys))
+	for i, passkey := range u.passkeys {
+		credentials[i] = passkey.credential
+	}
+	return credentials
+}
+
+// BeginRegistration starts enrolling a new passkey for the user
+func (s *PasskeyService) BeginRegistration(ctx context.Context, userID string) (*PasskeyChallenge, error) {
+	wUser, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := s.webauthn.BeginRegistration(wUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(wUser.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin registration: %w", err)
+	}
+
+	return s.storeChallenge(ctx, passkeyCeremonyRegistration, userID, creation, session)
+}
+
+// FinishRegistration verifies the authenticator's response and stores the
+// new passkey. name is how the passkey is listed, e.g. "iPhone".
+func (s *PasskeyService) FinishRegistration(ctx context.Context, userID, challengeID, response, name string) (*Passkey, error) {
+	session, err := s.takeChallenge(ctx, challengeID, passkeyCeremonyRegistration, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(strings.NewReader(response))
+	if err != nil {
+		return nil, fmt.Errorf("invalid passkey response: %w", err)
+	}
+
+	wUser, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webauthn.CreateCredential(wUser, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("passkey verification failed: %w", err)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > maxPasskeyNameLength {
+		name = strings.ToValidUTF8(name[:maxPasskeyNameLength], "")
+	}
+
+	return s.insertPasskey(ctx, userID, name, credential)
+}
+
+// BeginLogin starts a sign-in with any passkey on the device. The account is
+// identified by the passkey, so no email is needed.
+func (s *PasskeyService) BeginLogin(ctx context.Context) (*PasskeyChallenge, error) {
+	assertion, session, err := s.webauthn.BeginDiscoverableLogin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin sign-in: %w", err)
+	}
+
+	return s.storeChallenge(ctx, passkeyCeremonyLogin, "", assertion, session)
+}
+
+// FinishLogin verifies a passkey assertion and starts a session, issuing the
+// same tokens as VerifyLoginCode
+func (s *PasskeyService) FinishLogin(ctx context.Context, challengeID, response string, client SessionClient) (*TokenPair, *User, error) {
+	session, err := s.takeChallenge(ctx, challengeID, passkeyCeremonyLogin, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(strings.NewReader(response))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid passkey response: %w", err)
+	}
+
+	var wUser *webauthnUser
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		u, err := s.loadUser(ctx, string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		wUser = u
+		return u, nil
+	}
+
+	credential, err := s.webauthn.ValidateDiscoverableLogin(findUser, *session, parsed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("passkey verification failed: %w", err)
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, nil, fmt.Errorf("passkey verification failed: signature counter went backwards")
+	}
+
+	if err := s.recordUse(ctx, credential); err != nil {
+		// Log but don't fail - the assertion is already verified
+		slog.WarnContext(ctx, "Failed to record passkey use", "error", err)
+	}
+
+	pair, err := s.auth.createSession(ctx, wUser.user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, wUser.user, nil
+}
+
+// ListPasskeys returns the user's passkeys, oldest first
+func (s *PasskeyService) ListPasskeys(ctx context.Context, userID string) ([]*Passkey, error) {
+	query := `
+		query GetPasskeys($user_id: uuid!) {
+			webauthn_credentials(where: {user_id: {_eq: $user_id}}, order_by: {created_at: asc}) {
+				id
+				user_id
+				name
+				credential
+				created_at
+				last_used_at
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetPasskeys",
+		Variables: map[string]interface{}{
+			"user_id": userID,
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	list, _ := resp.Data["webauthn_credentials"].([]interface{})
+	passkeys := make([]*Passkey, 0, len(list))
+	for _, entry := range list {
+		row, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		passkey, err := passkeyFromMap(row)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+
+	return passkeys, nil
+}
+
+// DeletePasskey removes one of the user's passkeys
+func (s *PasskeyService) DeletePasskey(ctx context.Context, userID, passkeyID string) error {
+	query := `
+		mutation DeletePasskey($id: String!, $user_id: uuid!) {
+			delete_webauthn_credentials(where: {id: {_eq: $id}, user_id: {_eq: $user_id}}) {
+				affected_rows
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "DeletePasskey",
+		Variables: map[string]interface{}{
+			"id":      passkeyID,
+			"user_id": userID,
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+	if affectedRows(resp, "delete_webauthn_credentials") == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	return nil
+}
+
+func (s *PasskeyService) loadUser(ctx context.Context, userID string) (*webauthnUser, error) {
+	user, err := s.auth.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	passkeys, err := s.ListPasskeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webauthnUser{user: user, passkeys: passkeys}, nil
+}
+
+func (s *PasskeyService) storeChallenge(ctx context.Context, ceremony, userID string, options interface{}, session *webauthn.SessionData) (*PasskeyChallenge, error) {
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode passkey options: %w", err)
+	}
+
+	object := map[string]interface{}{
+		"ceremony":   ceremony,
+		"session":    session,
+		"expires_at": session.Expires.UTC().Format(time.RFC3339),
+	}
+	if userID != "" {
+		object["user_id"] = userID
+	}
+
+	// Unanswered challenges pile up, most from anonymous login prompts, so
+	// each new one clears out whatever has already expired
+	query := `
+		mutation StorePasskeyChallenge($object: webauthn_challenges_insert_input!, $now: timestamptz!) {
+			delete_webauthn_challenges(where: {expires_at: {_lt: $now}}) {
+				affected_rows
+			}
+			insert_webauthn_challenges_one(object: $object) {
+				id
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "StorePasskeyChallenge",
+		Variables: map[string]interface{}{
+			"object": object,
+			"now":    time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store passkey challenge: %w", err)
+	}
+
+	inserted, _ := resp.Data["insert_webauthn_challenges_one"].(map[string]interface{})
+	id, _ := inserted["id"].(string)
+	if id == "" {
+		return nil, fmt.Errorf("failed to extract challenge ID from response")
+	}
+
+	return &PasskeyChallenge{ChallengeID: id, Options: string(optionsJSON)}, nil
+}
+
+// takeChallenge deletes a challenge and returns its session data, so each
+// challenge is answered at most once
+func (s *PasskeyService) takeChallenge(ctx context.Context, challengeID, ceremony, userID string) (*webauthn.SessionData, error) {
+	query := `
+		mutation TakePasskeyChallenge($id: uuid!) {
+			delete_webauthn_challenges_by_pk(id: $id) {
+				ceremony
+				user_id
+				session
+				expires_at
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "TakePasskeyChallenge",
+		Variables: map[string]interface{}{
+			"id": challengeID,
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load passkey challenge: %w", err)
+	}
+
+	invalid := fmt.Errorf("invalid or expired passkey challenge")
+	row, ok := resp.Data["delete_webauthn_challenges_by_pk"].(map[string]interface{})
+	if !ok || row["ceremony"] != ceremony {
+		return nil, invalid
+	}
+	if owner, _ := row["user_id"].(string); owner != userID {
+		return nil, invalid
+	}
+	expiresAt, _ := row["expires_at"].(string)
+	if t, err := time.Parse(time.RFC3339, expiresAt); err != nil || time.Now().After(t) {
+		return nil, invalid
+	}
+
+	raw, err := json.Marshal(row["session"])
+	if err != nil {
+		return nil, invalid
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return nil, invalid
+	}
+
+	return &session, nil
+}
+
+func (s *PasskeyService) insertPasskey(ctx context.Context, userID, name string, credential *webauthn.Credential) (*Passkey, error) {
+	query := `
+		mutation InsertPasskey($object: webauthn_credentials_insert_input!) {
+			insert_webauthn_credentials_one(object: $object) {
+				id
+				user_id
+				name
+				credential
+				created_at
+				last_used_at
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "InsertPasskey",
+		Variables: map[string]interface{}{
+			"object": map[string]interface{}{
+				"id":         passkeyID(credential.ID),
+				"user_id":    userID,
+				"name":       name,
+				"credential": credential,
+			},
+		},
+	}
+
+	resp, err := s.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save passkey: %w", err)
+	}
+
+	row, ok := resp.Data["insert_webauthn_credentials_one"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to save passkey")
+	}
+	return passkeyFromMap(row)
+}
+
+// recordUse stores the new signature counter and when the passkey was used
+func (s *PasskeyService) recordUse(ctx context.Context, credential *webauthn.Credential) error {
+	query := `
+		mutation RecordPasskeyUse($id: String!, $credential: jsonb!, $now: timestamptz!) {
+			update_webauthn_credentials_by_pk(pk_columns: {id: $id}, _set: {credential: $credential, last_used_at: $now}) {
+				id
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "RecordPasskeyUse",
+		Variables: map[string]interface{}{
+			"id":         passkeyID(credential.ID),
+			"credential": credential,
+			"now":        time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	_, err := s.hasuraClient.Execute(ctx, req)
+	return err
+}
+
+func passkeyFromMap(row map[string]interface{}) (*Passkey, error) {
+	passkey := &Passkey{}
+	passkey.ID, _ = row["id"].(string)
+	passkey.UserID, _ = row["user_id"].(string)
+	passkey.Name, _ = row["name"].(string)
+	if createdAt, ok := row["created_at"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+			passkey.CreatedAt = t
+		}
+	}
+	if lastUsedAt, ok := row["last_used_at"].(string); ok {
+		if t, err := time.Parse(time.RFC3339, lastUsedAt); err == nil {
+			passkey.LastUsedAt = &t
+		}
+	}
+
+	raw, err := json.Marshal(row["credential"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passkey %s: %w", passkey.ID, err)
+	}
+	if err := json.Unmarshal(raw, &passkey.credential); err != nil {
+		return nil, fmt.Errorf("failed to read passkey %s: %w", passkey.ID, err)
+	}
+
+	return passkey, nil
+}
+
+// passkeyID is the credential ID as it appears in WebAuthn JSON
+func passkeyID(credentialID []byte) string {
+	return base64.RawURLEncoding.EncodeToString(credentialID)
+}
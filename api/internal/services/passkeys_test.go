@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/descope/virtualwebauthn"
+)
+
+const testUserID = "7b0c9a1e-2f34-4d5b-9c6a-1e2f3a4b5c6d"
+
+// fakePasskeyHasura stores challenges and credentials in memory and knows
+// one user
+type fakePasskeyHasura struct {
+	mu          sync.Mutex
+	challenges  map[string]map[string]interface{}
+	credentials map[string]map[string]interface{}
+	sessions    int
+	nextID      int
+}
+
+func (f *fakePasskeyHasura) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "GetUserByID":
+			if req.Variables["id"] == testUserID {
+				data["users_by_pk"] = map[string]interface{}{"id": testUserID, "email": "a@example.com"}
+			}
+		case "GetPasskeys":
+			list := []map[string]interface{}{}
+			for _, row := range f.credentials {
+				if row["user_id"] == req.Variables["user_id"] {
+					list = append(list, row)
+				}
+			}
+			data["webauthn_credentials"] = list
+		case "StorePasskeyChallenge":
+			now, _ := time.Parse(time.RFC3339, req.Variables["now"].(string))
+			purged := 0
+			for id, row := range f.challenges {
+				if expiresAt, _ := time.Parse(time.RFC3339, row["expires_at"].(string)); expiresAt.Before(now) {
+					delete(f.challenges, id)
+					purged++
+				}
+			}
+			data["delete_webauthn_challenges"] = map[string]interface{}{"affected_rows": purged}
+			f.nextID++
+			id := fmt.Sprintf("c%d", f.nextID)
+			f.challenges[id] = req.Variables["object"].(map[string]interface{})
+			data["insert_webauthn_challenges_one"] = map[string]interface{}{"id": id}
+		case "TakePasskeyChallenge":
+			id := req.Variables["id"].(string)
+			data["delete_webauthn_challenges_by_pk"] = f.challenges[id]
+			delete(f.challenges, id)
+		case "InsertPasskey":
+			row := req.Variables["object"].(map[string]interface{})
+			row["created_at"] = "2024-01-01T00:00:00Z"
+			f.credentials[row["id"].(string)] = row
+			data["insert_webauthn_credentials_one"] = row
+		case "RecordPasskeyUse":
+			row := f.credentials[req.Variables["id"].(string)]
+			row["credential"] = req.Variables["credential"]
+			row["last_used_at"] = req.Variables["now"]
+		case "DeletePasskey":
+			affected := 0
+			if row, ok := f.credentials[req.Variables["id"].(string)]; ok && row["user_id"] == req.Variables["user_id"] {
+				delete(f.credentials, req.Variables["id"].(string))
+				affected = 1
+			}
+			data["delete_webauthn_credentials"] = map[string]interface{}{"affected_rows": affected}
+		case "CreateSession":
+			f.sessions++
+			data["insert_sessions_one"] = map[string]interface{}{"id": fmt.Sprintf("s%d", f.sessions)}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+}
+
+func newPasskeyTestService(t *testing.T) (*PasskeyService, *fakePasskeyHasura) {
+	t.Helper()
+	fake := &fakePasskeyHasura{
+		challenges:  map[string]map[string]interface{}{},
+		credentials: map[string]map[string]interface{}{},
+	}
+	server := httptest.NewServer(fake.handler(t))
+	t.Cleanup(server.Close)
+
+	hasuraClient := NewHasuraClient(server.URL, "")
+	auth := NewAuthService(hasuraClient, nil, "test-secret", true)
+	service, err := NewPasskeyService(hasuraClient, auth, "mediacloset.example.com", []string{"https://mediacloset.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return service, fake
+}
+
+// registerPasskey enrolls a software passkey for the test user
+func registerPasskey(t *testing.T, service *PasskeyService, rp virtualwebauthn.RelyingParty, authenticator virtualwebauthn.Authenticator, credential virtualwebauthn.Credential) *Passkey {
+	t.Helper()
+	ctx := context.Background()
+
+	challenge, err := service.BeginRegistration(ctx, testUserID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	options, err := virtualwebauthn.ParseAttestationOptions(challenge.Options)
+	if err != nil {
+		t.Fatalf("invalid registration options: %v", err)
+	}
+	if options.UserID != testUserID || options.RelyingPartyID != rp.ID {
+		t.Errorf("expected options for %s at %s, got %+v", testUserID, rp.ID, options)
+	}
+
+	response := virtualwebauthn.CreateAttestationResponse(rp, authenticator, credential, *options)
+	passkey, err := service.FinishRegistration(ctx, testUserID, challenge.ChallengeID, response, "  Test iPhone ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return passkey
+}
+
+func TestPasskeyService_RegisterAndLogin(t *testing.T) {
+	service, fake := newPasskeyTestService(t)
+	ctx := context.Background()
+
+	rp := virtualwebauthn.RelyingParty{Name: "MediaCloset", ID: "mediacloset.example.com", Origin: "https://mediacloset.example.com"}
+	authenticator := virtualwebauthn.NewAuthenticatorWithOptions(virtualwebauthn.AuthenticatorOptions{UserHandle: []byte(testUserID)})
+	credential := virtualwebauthn.NewCredential(virtualwebauthn.KeyTypeEC2)
+
+	passkey := registerPasskey(t, service, rp, authenticator, credential)
+	if passkey.Name != "Test iPhone" || passkey.UserID != testUserID {
+		t.Errorf("unexpected passkey: %+v", passkey)
+	}
+	authenticator.AddCredential(credential)
+
+	// Registered passkeys are excluded from further registrations
+	challenge, _ := service.BeginRegistration(ctx, testUserID)
+	options, _ := virtualwebauthn.ParseAttestationOptions(challenge.Options)
+	if !credential.IsExcludedForAttestation(*options) {
+		t.Error("expected the registered passkey to be excluded")
+	}
+
+	challenge, err := service.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertionOptions, err := virtualwebauthn.ParseAssertionOptions(challenge.Options)
+	if err != nil {
+		t.Fatalf("invalid sign-in options: %v", err)
+	}
+	response := virtualwebauthn.CreateAssertionResponse(rp, authenticator, credential, *assertionOptions)
+
+	pair, user, err := service.FinishLogin(ctx, challenge.ChallengeID, response, SessionClient{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.ID != testUserID || pair.SessionID == "" {
+		t.Errorf("expected a session for %s, got %+v, %+v", testUserID, user, pair)
+	}
+	claims, err := service.auth.ValidateToken(ctx, pair.AccessToken)
+	if err != nil || claims.UserID != testUserID {
+		t.Errorf("expected a valid access token for %s, got %+v, %v", testUserID, claims, err)
+	}
+	if fake.credentials[passkey.ID]["last_used_at"] == nil {
+		t.Error("expected passkey use to be recorded")
+	}
+
+	// A challenge can be answered only once
+	if _, _, err := service.FinishLogin(ctx, challenge.ChallengeID, response, SessionClient{}); err == nil || !strings.Contains(err.Error(), "invalid or expired passkey challenge") {
+		t.Errorf("expected a replayed assertion to be rejected, got %v", err)
+	}
+
+	passkeys, err := service.ListPasskeys(ctx, testUserID)
+	if err != nil || len(passkeys) != 1 {
+		t.Fatalf("expected one passkey, got %d, %v", len(passkeys), err)
+	}
+	if err := service.DeletePasskey(ctx, "someone-else", passkey.ID); err != ErrPasskeyNotFound {
+		t.Errorf("expected another user's delete to miss, got %v", err)
+	}
+	if err := service.DeletePasskey(ctx, testUserID, passkey.ID); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPasskeyService_RejectsBadAssertions(t *testing.T) {
+	service, _ := newPasskeyTestService(t)
+	ctx := context.Background()
+
+	rp := virtualwebauthn.RelyingParty{Name: "MediaCloset", ID: "mediacloset.example.com", Origin: "https://mediacloset.example.com"}
+	authenticator := virtualwebauthn.NewAuthenticatorWithOptions(virtualwebauthn.AuthenticatorOptions{UserHandle: []byte(testUserID)})
+	credential := virtualwebauthn.NewCredential(virtualwebauthn.KeyTypeEC2)
+	registerPasskey(t, service, rp, authenticator, credential)
+
+	tests := []struct {
+		name       string
+		rp         virtualwebauthn.RelyingParty
+		credential virtualwebauthn.Credential
+	}{
+		{
+			name:       "wrong origin",
+			rp:         virtualwebauthn.RelyingParty{Name: "Phish", ID: "mediacloset.example.com", Origin: "https://mediacloset.example.net"},
+			credential: credential,
+		},
+		{
+			name:       "unregistered credential",
+			rp:         rp,
+			credential: virtualwebauthn.NewCredential(virtualwebauthn.KeyTypeEC2),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge, err := service.BeginLogin(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			options, _ := virtualwebauthn.ParseAssertionOptions(challenge.Options)
+			response := virtualwebauthn.CreateAssertionResponse(tt.rp, authenticator, tt.credential, *options)
+
+			if _, _, err := service.FinishLogin(ctx, challenge.ChallengeID, response, SessionClient{}); err == nil {
+				t.Error("expected sign-in to fail")
+			}
+		})
+	}
+
+	// Registration challenges cannot be used to sign in
+	challenge, _ := service.BeginRegistration(ctx, testUserID)
+	if _, _, err := service.FinishLogin(ctx, challenge.ChallengeID, "{}", SessionClient{}); err == nil {
+		t.Error("expected a registration challenge to be rejected for sign-in")
+	}
+}
+
+func TestPasskeyService_PurgesExpiredChallenges(t *testing.T) {
+	service, fake := newPasskeyTestService(t)
+	ctx := context.Background()
+
+	fake.challenges["stale"] = map[string]interface{}{
+		"ceremony":   "login",
+		"expires_at": time.Now().Add(-time.Minute).UTC().Format(time.RFC3339),
+	}
+	fake.challenges["pending"] = map[string]interface{}{
+		"ceremony":   "login",
+		"expires_at": time.Now().Add(time.Minute).UTC().Format(time.RFC3339),
+	}
+
+	challenge, err := service.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := fake.challenges["stale"]; ok {
+		t.Error("expected the expired challenge to be deleted")
+	}
+	for _, id := range []string{"pending", challenge.ChallengeID} {
+		if _, ok := fake.challenges[id]; !ok {
+			t.Errorf("expected challenge %s to be kept", id)
+		}
+	}
+}
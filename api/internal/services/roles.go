@@ -0,0 +1,42 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Role is a user's permission level, stored on users.role and carried in
+// the JWT
+type Role string
+
+const (
+	// RoleReadOnly can sign in and read but not change anything
+	RoleReadOnly Role = "read_only"
+	// RoleUser manages their own collection
+	RoleUser Role = "user"
+	// RoleAdmin also manages the shared catalog, users, and app config
+	RoleAdmin Role = "admin"
+)
+
+// roleRanks orders roles so each one includes everything below it
+var roleRanks = map[Role]int{
+	RoleReadOnly: 1,
+	RoleUser:     2,
+	RoleAdmin:    3,
+}
+
+// ParseRole accepts a role name in either case, with - or _ separators
+func ParseRole(s string) (Role, error) {
+	role := Role(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), "-", "_"))
+	if _, ok := roleRanks[role]; !ok {
+		return "", fmt.Errorf("unknown role: %q (expected read_only, user, or admin)", s)
+	}
+	return role, nil
+}
+
+// Satisfies reports whether r grants at least the required role. Unknown
+// roles satisfy nothing.
+func (r Role) Satisfies(required Role) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[required]
+}
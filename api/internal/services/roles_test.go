@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  Role
+		expectErr bool
+	}{
+		{input: "admin", expected: RoleAdmin},
+		{input: "USER", expected: RoleUser},
+		{input: "read-only", expected: RoleReadOnly},
+		{input: " read_only ", expected: RoleReadOnly},
+		{input: "root", expectErr: true},
+		{input: "", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			role, err := ParseRole(tt.input)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", role)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if role != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, role)
+			}
+		})
+	}
+}
+
+func TestRole_Satisfies(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		expected bool
+	}{
+		{role: RoleAdmin, required: RoleAdmin, expected: true},
+		{role: RoleAdmin, required: RoleUser, expected: true},
+		{role: RoleAdmin, required: RoleReadOnly, expected: true},
+		{role: RoleUser, required: RoleAdmin, expected: false},
+		{role: RoleUser, required: RoleUser, expected: true},
+		{role: RoleReadOnly, required: RoleUser, expected: false},
+		{role: RoleReadOnly, required: RoleReadOnly, expected: true},
+		{role: "", required: RoleReadOnly, expected: false},
+		{role: "superuser", required: RoleReadOnly, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role)+">="+string(tt.required), func(t *testing.T) {
+			if got := tt.role.Satisfies(tt.required); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAuthService_TokenCarriesRole(t *testing.T) {
+	auth := NewAuthService(nil, nil, "test-secret", true)
+
+	tests := []struct {
+		name     string
+		role     Role
+		expected Role
+	}{
+		{name: "admin", role: RoleAdmin, expected: RoleAdmin},
+		{name: "read-only", role: RoleReadOnly, expected: RoleReadOnly},
+		{name: "token from before roles", role: "", expected: RoleUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := auth.generateToken(&User{ID: "u1", Email: "u1@example.com", Role: tt.role}, "", time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			claims, err := auth.ValidateToken(context.Background(), token)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claims.UserID != "u1" || claims.Role != tt.expected {
+				t.Errorf("expected u1 with role %q, got %s with %q", tt.expected, claims.UserID, claims.Role)
+			}
+		})
+	}
+
+	other := NewAuthService(nil, nil, "other-secret", true)
+	token, _ := other.generateToken(&User{ID: "u1", Role: RoleAdmin}, "", time.Now().Add(time.Hour))
+	if _, err := auth.ValidateToken(context.Background(), token); err == nil {
+		t.Error("expected a token signed with another secret to be rejected")
+	}
+}
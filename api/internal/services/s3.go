@@ -2,54 +2,117 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/google/uuid"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-// S3Service handles generating presigned URLs for image uploads
+// S3Service stores cover images in AWS S3 or an S3-compatible service such as MinIO
 type S3Service struct {
+	client        *s3.Client
 	presignClient *s3.PresignClient
 	bucket        string
 	urlPrefix     string
 }
 
-// NewS3Service creates a new S3 service for presigned URL generation
-func NewS3Service(ctx context.Context, region, accessKeyID, secretAccessKey, bucket, urlPrefix string) (*S3Service, error) {
-	cfg, err := awsconfig.LoadDefaultConfig(ctx,
-		awsconfig.WithRegion(region),
-		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, "")),
-	)
+// S3Options configures an S3Service
+type S3Options struct {
+	Region          string
+	AccessKeyID     string // Optional - falls back to the default AWS credential chain
+	SecretAccessKey string
+	Bucket          string
+	URLPrefix       string // Public URL base, e.g. https://bucket.s3.amazonaws.com (derived if empty)
+
+	// Endpoint overrides the AWS endpoint for S3-compatible services, e.g. http://localhost:9000 for MinIO
+	Endpoint string
+	// UsePathStyle addresses objects as {endpoint}/{bucket}/{key}; required by MinIO
+	UsePathStyle bool
+}
+
+// StoredObject describes an object stored in the image bucket
+type StoredObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// NewS3Service creates a new S3 storage backend
+func NewS3Service(ctx context.Context, opts S3Options) (*S3Service, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket is required")
+	}
+
+	loadOpts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(opts.Region),
+	}
+	if opts.AccessKeyID != "" && opts.SecretAccessKey != "" {
+		loadOpts = append(loadOpts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(opts.AccessKeyID, opts.SecretAccessKey, ""),
+		))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	client := s3.NewFromConfig(cfg)
-	presignClient := s3.NewPresignClient(client)
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.UsePathStyle
+	})
+
+	return newS3ServiceWithClient(client, opts), nil
+}
+
+// newS3ServiceWithClient wraps an existing SDK client
+func newS3ServiceWithClient(client *s3.Client, opts S3Options) *S3Service {
+	urlPrefix := strings.TrimSuffix(opts.URLPrefix, "/")
+	if urlPrefix == "" {
+		urlPrefix = defaultS3URLPrefix(opts)
+	}
 
 	return &S3Service{
-		presignClient: presignClient,
-		bucket:        bucket,
+		client:        client,
+		presignClient: s3.NewPresignClient(client),
+		bucket:        opts.Bucket,
 		urlPrefix:     urlPrefix,
-	}, nil
+	}
+}
+
+// defaultS3URLPrefix derives the public URL base when S3_URL_PREFIX isn't set
+func defaultS3URLPrefix(opts S3Options) string {
+	if opts.Endpoint != "" {
+		endpoint := strings.TrimSuffix(opts.Endpoint, "/")
+		if opts.UsePathStyle {
+			return fmt.Sprintf("%s/%s", endpoint, opts.Bucket)
+		}
+		scheme, host, found := strings.Cut(endpoint, "://")
+		if !found {
+			return fmt.Sprintf("https://%s.%s", opts.Bucket, endpoint)
+		}
+		return fmt.Sprintf("%s://%s.%s", scheme, opts.Bucket, host)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com", opts.Bucket, opts.Region)
+}
+
+// Name identifies the backend in logs
+func (s *S3Service) Name() string {
+	return "s3"
 }
 
 // GenerateUploadURL creates a presigned PUT URL for uploading an image.
 // Returns the presigned upload URL and the final public image URL.
 func (s *S3Service) GenerateUploadURL(ctx context.Context, userID, contentType string) (uploadURL string, imageURL string, err error) {
-	ext := "jpg"
-	if contentType == "image/png" {
-		ext = "png"
-	} else if contentType == "image/webp" {
-		ext = "webp"
-	}
-
-	objectKey := fmt.Sprintf("covers/%s/%s.%s", userID, uuid.New().String(), ext)
+	objectKey := coverObjectKey(userID, contentType)
 
 	presignResult, err := s.presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(s.bucket),
@@ -64,3 +127,74 @@ func (s *S3Service) GenerateUploadURL(ctx context.Context, userID, contentType s
 
 	return presignResult.URL, imageURL, nil
 }
+
+// ListObjects returns every object in the bucket whose key starts with prefix
+func (s *S3Service) ListObjects(ctx context.Context, prefix string) ([]StoredObject, error) {
+	var objects []StoredObject
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, StoredObject{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+// DeleteObject removes a single object from the bucket
+func (s *S3Service) DeleteObject(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *types.NoSuchKey
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+// Ping checks the bucket exists and the credentials can reach it
+func (s *S3Service) Ping(ctx context.Context) error {
+	if _, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)}); err != nil {
+		return fmt.Errorf("bucket %s unavailable: %w", s.bucket, err)
+	}
+	return nil
+}
+
+// KeyFromURL maps a public image URL back to its object key.
+// Returns false for URLs that don't point into this bucket (e.g. Cover Art Archive or OMDB posters).
+func (s *S3Service) KeyFromURL(imageURL string) (string, bool) {
+	return keyFromURL(s.urlPrefix, imageURL)
+}
+
+// keyFromURL strips urlPrefix from imageURL, ignoring any query string or fragment
+func keyFromURL(urlPrefix, imageURL string) (string, bool) {
+	prefix := strings.TrimSuffix(urlPrefix, "/") + "/"
+	if !strings.HasPrefix(imageURL, prefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(imageURL, prefix)
+	if i := strings.IndexAny(key, "?#"); i >= 0 {
+		key = key[:i]
+	}
+	if key == "" {
+		return "", false
+	}
+	return key, true
+}
@@ -0,0 +1,521 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"mediacloset/api/internal/metrics"
+)
+
+const (
+	// DefaultAccessTokenTTL matches the lifetime tokens had before refresh
+	// tokens existed, so clients that never refresh keep working
+	DefaultAccessTokenTTL = 24 * time.Hour
+	// DefaultRefreshTokenTTL is how long a session survives without being used
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+	// sessionCacheTTL bounds how long a revoked session can still be used on
+	// another server instance
+	sessionCacheTTL  = 30 * time.Second
+	sessionCacheSize = 10000
+)
+
+// Session revocation reasons
+const (
+	RevokedLogout        = "logout"
+	RevokedByUser        = "revoked"
+	RevokedAllByUser     = "revoked_all"
+	RevokedReuse         = "refresh_token_reused"
+	RevokedEmailChange   = "email_changed"
+	RevokedAccountDelete = "account_deleted"
+	RevokedRoleChange    = "role_changed"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used; the session has been revoked")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+)
+
+// SessionClient describes the device a session belongs to
+type SessionClient struct {
+	DeviceName string
+	UserAgent  string
+	IPAddress  string
+}
+
+// Session is one signed-in device. Its ID is the jti of every access token
+// issued for it.
+type Session struct {
+	ID         string
+	UserID     string
+	DeviceName string
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+// TokenPair is what a client receives on sign-in and on every refresh
+type TokenPair struct {
+	AccessToken          string
+	AccessTokenExpiresAt time.Time
+	RefreshToken         string
+	SessionID            string
+}
+
+// sessionStatus is the cached result of a session lookup
+type sessionStatus struct {
+	userID string
+	active bool
+}
+
+// SetTokenLifetimes overrides the default access and refresh token lifetimes
+func (a *AuthService) SetTokenLifetimes(access, refresh time.Duration) {
+	if access > 0 {
+		a.accessTokenTTL = access
+	}
+	if refresh > 0 {
+		a.refreshTokenTTL = refresh
+	}
+}
+
+// RefreshSession exchanges a refresh token for a new token pair. Refresh
+// tokens are single use: presenting one that was already exchanged means it
+// leaked, so the whole session is revoked.
+func (a *AuthService) RefreshSession(ctx context.Context, refreshToken string, client SessionClient) (*TokenPair, *User, error) {
+	hash := hashRefreshToken(refreshToken)
+
+	query := `
+		query GetRefreshToken($hash: String!) {
+			refresh_tokens_by_pk(token_hash: $hash) {
+				used_at
+				session {
+					id
+					user_id
+					revoked_at
+					expires_at
+				}
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetRefreshToken",
+		Variables: map[string]interface{}{
+			"hash": hash,
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	tokenData, ok := resp.Data["refresh_tokens_by_pk"].(map[string]interface{})
+	if !ok {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	sessionData, ok := tokenData["session"].(map[string]interface{})
+	if !ok {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	sessionID, _ := sessionData["id"].(string)
+	userID, _ := sessionData["user_id"].(string)
+	if !sessionIsActive(sessionData) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if tokenData["used_at"] != nil {
+		a.revokeReusedSession(ctx, sessionID)
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	// Reload the user so role changes take effect on refresh. Everything that
+	// can fail happens before the token is claimed, so a failed refresh leaves
+	// it usable for a retry.
+	user, err := a.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	newRefreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Losing the claim to a concurrent refresh is reuse too
+	claimed, err := a.rotateRefreshToken(ctx, sessionID, hash, hashRefreshToken(newRefreshToken), client)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !claimed {
+		a.revokeReusedSession(ctx, sessionID)
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	pair, err := a.issueTokens(user, sessionID, newRefreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func (a *AuthService) ListSessions(ctx context.Context, userID string) ([]*Session, error) {
+	query := `
+		query ListSessions($user_id: uuid!, $now: timestamptz!) {
+			sessions(
+				where: {user_id: {_eq: $user_id}, revoked_at: {_is_null: true}, expires_at: {_gt: $now}}
+				order_by: {last_used_at: desc}
+			) {
+				id
+				user_id
+				device_name
+				user_agent
+				ip_address
+				created_at
+				last_used_at
+				expires_at
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "ListSessions",
+		Variables: map[string]interface{}{
+			"user_id": userID,
+			"now":     time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	list, _ := resp.Data["sessions"].([]interface{})
+	sessions := make([]*Session, 0, len(list))
+	for _, entry := range list {
+		if sessionMap, ok := entry.(map[string]interface{}); ok {
+			sessions = append(sessions, sessionFromMap(sessionMap))
+		}
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession signs one of the user's devices out. Returns false when the
+// session does not exist, belongs to someone else, or is already revoked.
+func (a *AuthService) RevokeSession(ctx context.Context, userID, sessionID, reason string) (bool, error) {
+	where := map[string]interface{}{
+		"id":         map[string]interface{}{"_eq": sessionID},
+		"user_id":    map[string]interface{}{"_eq": userID},
+		"revoked_at": map[string]interface{}{"_is_null": true},
+	}
+	revoked, err := a.revokeSessions(ctx, where, reason)
+	return revoked > 0, err
+}
+
+// RevokeAllSessions signs out every device of the user except keepSessionID
+// (pass "" to sign out everywhere) and returns how many were revoked
+func (a *AuthService) RevokeAllSessions(ctx context.Context, userID, keepSessionID, reason string) (int, error) {
+	where := map[string]interface{}{
+		"user_id":    map[string]interface{}{"_eq": userID},
+		"revoked_at": map[string]interface{}{"_is_null": true},
+	}
+	if keepSessionID != "" {
+		where["id"] = map[string]interface{}{"_neq": keepSessionID}
+	}
+	return a.revokeSessions(ctx, where, reason)
+}
+
+// createSession starts a session for a user who just signed in
+func (a *AuthService) createSession(ctx context.Context, user *User, client SessionClient) (*TokenPair, error) {
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	session := map[string]interface{}{
+		"user_id":      user.ID,
+		"device_name":  client.DeviceName,
+		"user_agent":   client.UserAgent,
+		"ip_address":   client.IPAddress,
+		"last_used_at": now.Format(time.RFC3339),
+		"expires_at":   now.Add(a.refreshTokenTTL).Format(time.RFC3339),
+		"refresh_tokens": map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"token_hash": hashRefreshToken(refreshToken)},
+			},
+		},
+	}
+
+	query := `
+		mutation CreateSession($session: sessions_insert_input!) {
+			insert_sessions_one(object: $session) {
+				id
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "CreateSession",
+		Variables: map[string]interface{}{
+			"session": session,
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	inserted, _ := resp.Data["insert_sessions_one"].(map[string]interface{})
+	sessionID, _ := inserted["id"].(string)
+	if sessionID == "" {
+		return nil, fmt.Errorf("failed to extract session ID from response")
+	}
+
+	return a.issueTokens(user, sessionID, refreshToken)
+}
+
+func (a *AuthService) issueTokens(user *User, sessionID, refreshToken string) (*TokenPair, error) {
+	expiresAt := time.Now().Add(a.accessTokenTTL)
+	accessToken, err := a.generateToken(user, sessionID, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	a.sessionCache.Add(sessionID, sessionStatus{userID: user.ID, active: true})
+
+	return &TokenPair{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: expiresAt,
+		RefreshToken:         refreshToken,
+		SessionID:            sessionID,
+	}, nil
+}
+
+// checkSession reports whether an access token's session is still usable
+func (a *AuthService) checkSession(ctx context.Context, sessionID, userID string) (bool, error) {
+	status, ok := a.sessionCache.Get(sessionID)
+	metrics.CacheLookup("sessions", ok)
+	if ok {
+		return status.active && status.userID == userID, nil
+	}
+
+	query := `
+		query GetSession($id: uuid!) {
+			sessions_by_pk(id: $id) {
+				user_id
+				revoked_at
+				expires_at
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "GetSession",
+		Variables: map[string]interface{}{
+			"id": sessionID,
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	status = sessionStatus{}
+	if sessionData, ok := resp.Data["sessions_by_pk"].(map[string]interface{}); ok {
+		status.userID, _ = sessionData["user_id"].(string)
+		status.active = sessionIsActive(sessionData)
+	}
+	a.sessionCache.Add(sessionID, status)
+
+	return status.active && status.userID == userID, nil
+}
+
+// rotateRefreshToken marks the old token used, stores its replacement and
+// extends the session in one transaction, so the client can never be left
+// holding a consumed token without a new one. Returns false when the old token
+// was already used; the replacement inserted alongside is then unknown to
+// anyone and dies with the session, which the caller revokes.
+func (a *AuthService) rotateRefreshToken(ctx context.Context, sessionID, oldHash, newHash string, client SessionClient) (bool, error) {
+	now := time.Now().UTC()
+	changes := map[string]interface{}{
+		"last_used_at": now.Format(time.RFC3339),
+		"expires_at":   now.Add(a.refreshTokenTTL).Format(time.RFC3339),
+	}
+	if client.IPAddress != "" {
+		changes["ip_address"] = client.IPAddress
+	}
+	if client.UserAgent != "" {
+		changes["user_agent"] = client.UserAgent
+	}
+
+	query := `
+		mutation RotateRefreshToken($old_hash: String!, $new_hash: String!, $session_id: uuid!, $now: timestamptz!, $changes: sessions_set_input!) {
+			update_refresh_tokens(
+				where: {token_hash: {_eq: $old_hash}, used_at: {_is_null: true}}
+				_set: {used_at: $now}
+			) {
+				affected_rows
+			}
+			insert_refresh_tokens_one(object: {token_hash: $new_hash, session_id: $session_id}) {
+				token_hash
+			}
+			update_sessions_by_pk(pk_columns: {id: $session_id}, _set: $changes) {
+				id
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "RotateRefreshToken",
+		Variables: map[string]interface{}{
+			"old_hash":   oldHash,
+			"new_hash":   newHash,
+			"session_id": sessionID,
+			"now":        now.Format(time.RFC3339),
+			"changes":    changes,
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return affectedRows(resp, "update_refresh_tokens") == 1, nil
+}
+
+// revokeReusedSession revokes a session whose refresh token was replayed.
+// Failures are logged; the refresh is refused either way.
+func (a *AuthService) revokeReusedSession(ctx context.Context, sessionID string) {
+	where := map[string]interface{}{
+		"id":         map[string]interface{}{"_eq": sessionID},
+		"revoked_at": map[string]interface{}{"_is_null": true},
+	}
+	if _, err := a.revokeSessions(ctx, where, RevokedReuse); err != nil {
+		slog.ErrorContext(ctx, "Failed to revoke session after refresh token reuse", "session_id", sessionID, "error", err)
+		return
+	}
+	slog.WarnContext(ctx, "Refresh token reuse detected, revoked session", "session_id", sessionID)
+}
+
+func (a *AuthService) revokeSessions(ctx context.Context, where map[string]interface{}, reason string) (int, error) {
+	query := `
+		mutation RevokeSessions($where: sessions_bool_exp!, $now: timestamptz!, $reason: String!) {
+			update_sessions(where: $where, _set: {revoked_at: $now, revoked_reason: $reason}) {
+				affected_rows
+				returning {
+					id
+				}
+			}
+		}
+	`
+
+	req := GraphQLRequest{
+		Query:         query,
+		OperationName: "RevokeSessions",
+		Variables: map[string]interface{}{
+			"where":  where,
+			"now":    time.Now().UTC().Format(time.RFC3339),
+			"reason": reason,
+		},
+	}
+
+	resp, err := a.hasuraClient.Execute(ctx, req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	if result, ok := resp.Data["update_sessions"].(map[string]interface{}); ok {
+		returning, _ := result["returning"].([]interface{})
+		for _, entry := range returning {
+			if row, ok := entry.(map[string]interface{}); ok {
+				if id, ok := row["id"].(string); ok {
+					a.sessionCache.Remove(id)
+				}
+			}
+		}
+	}
+
+	return affectedRows(resp, "update_sessions"), nil
+}
+
+// sessionIsActive checks revoked_at and expires_at on a session row
+func sessionIsActive(sessionData map[string]interface{}) bool {
+	if sessionData["revoked_at"] != nil {
+		return false
+	}
+	expiresAt, ok := sessionData["expires_at"].(string)
+	if !ok {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, expiresAt)
+	return err == nil && time.Now().Before(t)
+}
+
+func sessionFromMap(sessionMap map[string]interface{}) *Session {
+	session := &Session{}
+	session.ID, _ = sessionMap["id"].(string)
+	session.UserID, _ = sessionMap["user_id"].(string)
+	session.DeviceName, _ = sessionMap["device_name"].(string)
+	session.UserAgent, _ = sessionMap["user_agent"].(string)
+	session.IPAddress, _ = sessionMap["ip_address"].(string)
+	for key, field := range map[string]*time.Time{
+		"created_at":   &session.CreatedAt,
+		"last_used_at": &session.LastUsedAt,
+		"expires_at":   &session.ExpiresAt,
+	} {
+		if value, ok := sessionMap[key].(string); ok {
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				*field = t
+			}
+		}
+	}
+	return session
+}
+
+func affectedRows(resp *GraphQLResponse, field string) int {
+	if result, ok := resp.Data[field].(map[string]interface{}); ok {
+		if n, ok := result["affected_rows"].(float64); ok {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// generateRefreshToken returns 256 random bits. Only a hash is stored.
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
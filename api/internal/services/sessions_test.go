@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSessionHasura stores sessions and refresh tokens in memory
+type fakeSessionHasura struct {
+	mu       sync.Mutex
+	sessions map[string]map[string]interface{}
+	tokens   map[string]map[string]interface{}
+	nextID   int
+
+	failUserLookup bool
+}
+
+func newFakeSessionHasura() *fakeSessionHasura {
+	return &fakeSessionHasura{
+		sessions: map[string]map[string]interface{}{},
+		tokens:   map[string]map[string]interface{}{},
+	}
+}
+
+func (f *fakeSessionHasura) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		data := map[string]interface{}{}
+		switch req.OperationName {
+		case "CreateSession":
+			f.nextID++
+			id := fmt.Sprintf("s%d", f.nextID)
+			session := req.Variables["session"].(map[string]interface{})
+			session["id"] = id
+			session["created_at"] = session["last_used_at"]
+			for _, token := range session["refresh_tokens"].(map[string]interface{})["data"].([]interface{}) {
+				hash := token.(map[string]interface{})["token_hash"].(string)
+				f.tokens[hash] = map[string]interface{}{"session_id": id}
+			}
+			delete(session, "refresh_tokens")
+			f.sessions[id] = session
+			data["insert_sessions_one"] = map[string]interface{}{"id": id}
+		case "GetRefreshToken":
+			if token, ok := f.tokens[req.Variables["hash"].(string)]; ok {
+				data["refresh_tokens_by_pk"] = map[string]interface{}{
+					"used_at": token["used_at"],
+					"session": f.sessions[token["session_id"].(string)],
+				}
+			}
+		case "RotateRefreshToken":
+			affected := 0
+			if token, ok := f.tokens[req.Variables["old_hash"].(string)]; ok && token["used_at"] == nil {
+				token["used_at"] = req.Variables["now"]
+				affected = 1
+			}
+			data["update_refresh_tokens"] = map[string]interface{}{"affected_rows": affected}
+			id := req.Variables["session_id"].(string)
+			f.tokens[req.Variables["new_hash"].(string)] = map[string]interface{}{"session_id": id}
+			for key, value := range req.Variables["changes"].(map[string]interface{}) {
+				f.sessions[id][key] = value
+			}
+		case "GetUserByID":
+			if f.failUserLookup {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			data["users_by_pk"] = map[string]interface{}{"id": req.Variables["id"], "email": "u1@example.com", "role": "admin"}
+		case "SetUserRole":
+			data["update_users_by_pk"] = map[string]interface{}{"id": req.Variables["id"], "email": "u1@example.com", "role": req.Variables["role"]}
+		case "GetSession":
+			data["sessions_by_pk"] = f.sessions[req.Variables["id"].(string)]
+		case "ListSessions":
+			list := []map[string]interface{}{}
+			for _, session := range f.sessions {
+				if session["user_id"] == req.Variables["user_id"] && session["revoked_at"] == nil {
+					list = append(list, session)
+				}
+			}
+			data["sessions"] = list
+		case "RevokeSessions":
+			where := req.Variables["where"].(map[string]interface{})
+			returning := []map[string]interface{}{}
+			for id, session := range f.sessions {
+				if matchesSessionWhere(id, session, where) {
+					session["revoked_at"] = req.Variables["now"]
+					session["revoked_reason"] = req.Variables["reason"]
+					returning = append(returning, map[string]interface{}{"id": id})
+				}
+			}
+			data["update_sessions"] = map[string]interface{}{"affected_rows": len(returning), "returning": returning}
+		default:
+			t.Errorf("unexpected operation %s", req.OperationName)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}
+}
+
+// matchesSessionWhere evaluates the sessions_bool_exp shapes built by
+// RevokeSession and RevokeAllSessions
+func matchesSessionWhere(id string, session map[string]interface{}, where map[string]interface{}) bool {
+	if cond, ok := where["id"].(map[string]interface{}); ok {
+		if eq, ok := cond["_eq"]; ok && eq != id {
+			return false
+		}
+		if neq, ok := cond["_neq"]; ok && neq == id {
+			return false
+		}
+	}
+	if cond, ok := where["user_id"].(map[string]interface{}); ok && cond["_eq"] != session["user_id"] {
+		return false
+	}
+	return session["revoked_at"] == nil
+}
+
+func newSessionTestService(t *testing.T) (*AuthService, *fakeSessionHasura) {
+	t.Helper()
+	fake := newFakeSessionHasura()
+	server := httptest.NewServer(fake.handler(t))
+	t.Cleanup(server.Close)
+	return NewAuthService(NewHasuraClient(server.URL, ""), nil, "test-secret", true), fake
+}
+
+func TestAuthService_RefreshSession(t *testing.T) {
+	auth, fake := newSessionTestService(t)
+	ctx := context.Background()
+	user := &User{ID: "u1", Email: "u1@example.com", Role: RoleUser}
+
+	pair, err := auth.createSession(ctx, user, SessionClient{DeviceName: "iPhone", IPAddress: "203.0.113.7"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims, err := auth.ValidateToken(ctx, pair.AccessToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.ID != pair.SessionID {
+		t.Errorf("expected jti %q, got %q", pair.SessionID, claims.ID)
+	}
+	if fake.sessions[pair.SessionID]["device_name"] != "iPhone" {
+		t.Errorf("expected device name to be stored, got %+v", fake.sessions[pair.SessionID])
+	}
+
+	rotated, refreshedUser, err := auth.RefreshSession(ctx, pair.RefreshToken, SessionClient{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rotated.SessionID != pair.SessionID {
+		t.Errorf("expected refresh to keep session %s, got %s", pair.SessionID, rotated.SessionID)
+	}
+	if rotated.RefreshToken == pair.RefreshToken {
+		t.Error("expected refresh token to rotate")
+	}
+	if refreshedUser.Role != RoleAdmin {
+		t.Errorf("expected refresh to pick up the stored role, got %q", refreshedUser.Role)
+	}
+	if claims, err := auth.ValidateToken(ctx, rotated.AccessToken); err != nil || claims.Role != RoleAdmin {
+		t.Errorf("expected refreshed admin token, got %+v, %v", claims, err)
+	}
+
+	// Replaying the first refresh token revokes the whole session
+	if _, _, err := auth.RefreshSession(ctx, pair.RefreshToken, SessionClient{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected reuse to be detected, got %v", err)
+	}
+	if fake.sessions[pair.SessionID]["revoked_reason"] != RevokedReuse {
+		t.Errorf("expected session to be revoked for reuse, got %+v", fake.sessions[pair.SessionID])
+	}
+	if _, _, err := auth.RefreshSession(ctx, rotated.RefreshToken, SessionClient{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected rotated token to die with its session, got %v", err)
+	}
+	if _, err := auth.ValidateToken(ctx, rotated.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("expected access token of revoked session to be rejected, got %v", err)
+	}
+
+	if _, _, err := auth.RefreshSession(ctx, "not-a-token", SessionClient{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected unknown refresh token to be rejected, got %v", err)
+	}
+}
+
+func TestAuthService_RefreshSessionRetryAfterFailure(t *testing.T) {
+	auth, fake := newSessionTestService(t)
+	ctx := context.Background()
+
+	pair, err := auth.createSession(ctx, &User{ID: "u1", Email: "u1@example.com", Role: RoleUser}, SessionClient{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fake.mu.Lock()
+	fake.failUserLookup = true
+	fake.mu.Unlock()
+	if _, _, err := auth.RefreshSession(ctx, pair.RefreshToken, SessionClient{}); err == nil {
+		t.Fatal("expected the refresh to fail while the user can't be loaded")
+	}
+
+	// The failed attempt must not have used up the token
+	fake.mu.Lock()
+	fake.failUserLookup = false
+	fake.mu.Unlock()
+	if _, _, err := auth.RefreshSession(ctx, pair.RefreshToken, SessionClient{}); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if fake.sessions[pair.SessionID]["revoked_at"] != nil {
+		t.Errorf("expected the session to stay active, got %+v", fake.sessions[pair.SessionID])
+	}
+}
+
+func TestAuthService_RevokeSessions(t *testing.T) {
+	auth, fake := newSessionTestService(t)
+	ctx := context.Background()
+	user := &User{ID: "u1", Email: "u1@example.com", Role: RoleUser}
+
+	var pairs []*TokenPair
+	for i := 0; i < 3; i++ {
+		pair, err := auth.createSession(ctx, user, SessionClient{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		pairs = append(pairs, pair)
+	}
+	other, _ := auth.createSession(ctx, &User{ID: "u2"}, SessionClient{})
+
+	if revoked, err := auth.RevokeSession(ctx, "u1", other.SessionID, RevokedByUser); err != nil || revoked {
+		t.Errorf("expected another user's session to be left alone, got %v, %v", revoked, err)
+	}
+
+	count, err := auth.RevokeAllSessions(ctx, "u1", pairs[0].SessionID, RevokedAllByUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 sessions revoked, got %d", count)
+	}
+
+	if _, err := auth.ValidateToken(ctx, pairs[0].AccessToken); err != nil {
+		t.Errorf("expected kept session to stay valid, got %v", err)
+	}
+	for _, pair := range pairs[1:] {
+		if _, err := auth.ValidateToken(ctx, pair.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+			t.Errorf("expected session %s to be revoked, got %v", pair.SessionID, err)
+		}
+	}
+	if _, err := auth.ValidateToken(ctx, other.AccessToken); err != nil {
+		t.Errorf("expected other user's session to stay valid, got %v", err)
+	}
+
+	sessions, err := auth.ListSessions(ctx, "u1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != pairs[0].SessionID {
+		t.Errorf("expected only the kept session to be listed, got %+v", sessions)
+	}
+
+	// Another instance has no cached status and reads the session from Hasura
+	fresh := NewAuthService(auth.hasuraClient, nil, "test-secret", true)
+	if _, err := fresh.ValidateToken(ctx, pairs[1].AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("expected revoked session to be rejected on another instance, got %v", err)
+	}
+	if fake.sessions[pairs[1].SessionID]["revoked_reason"] != RevokedAllByUser {
+		t.Errorf("expected revoke reason to be recorded, got %+v", fake.sessions[pairs[1].SessionID])
+	}
+}
+
+func TestAuthService_SetUserRoleRevokesSessions(t *testing.T) {
+	auth, fake := newSessionTestService(t)
+	ctx := context.Background()
+
+	pair, err := auth.createSession(ctx, &User{ID: "u1", Role: RoleAdmin}, SessionClient{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other, _ := auth.createSession(ctx, &User{ID: "u2", Role: RoleAdmin}, SessionClient{})
+	if _, err := auth.ValidateToken(ctx, pair.AccessToken); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	user, err := auth.SetUserRole(ctx, "u1", RoleUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Role != RoleUser {
+		t.Errorf("expected the new role, got %s", user.Role)
+	}
+
+	// The admin token must not keep working until it expires
+	if _, err := auth.ValidateToken(ctx, pair.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("expected the demoted user's token to be rejected, got %v", err)
+	}
+	if fake.sessions[pair.SessionID]["revoked_reason"] != RevokedRoleChange {
+		t.Errorf("expected revoke reason to be recorded, got %+v", fake.sessions[pair.SessionID])
+	}
+	if _, err := auth.ValidateToken(ctx, other.AccessToken); err != nil {
+		t.Errorf("expected other user's session to stay valid, got %v", err)
+	}
+}
+
+func TestAuthService_TokenWithoutSession(t *testing.T) {
+	auth := NewAuthService(nil, nil, "test-secret", true)
+
+	// Tokens issued before sessions existed have no jti and skip the lookup
+	token, err := auth.generateToken(&User{ID: "u1"}, "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := auth.ValidateToken(context.Background(), token); err != nil {
+		t.Errorf("expected token without a session to be accepted, got %v", err)
+	}
+}
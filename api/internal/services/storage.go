@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ObjectStorage is implemented by every backend that can hold uploaded cover images.
+//
+// Uploads are always two-step: the API hands the client a short-lived upload URL,
+// the client PUTs the image bytes there directly, and then saves the returned
+// public image URL as the item's cover.
+type ObjectStorage interface {
+	// Name identifies the backend in logs ("s3", "local")
+	Name() string
+
+	// GenerateUploadURL returns a short-lived URL the client can PUT the image to,
+	// and the public URL the image will be served from once uploaded.
+	GenerateUploadURL(ctx context.Context, userID, contentType string) (uploadURL string, imageURL string, err error)
+
+	// ListObjects returns every stored object whose key starts with prefix
+	ListObjects(ctx context.Context, prefix string) ([]StoredObject, error)
+
+	// DeleteObject removes a single object. Deleting a missing object is not an error.
+	DeleteObject(ctx context.Context, key string) error
+
+	// Ping checks the backend is reachable and accepts writes
+	Ping(ctx context.Context) error
+
+	// KeyFromURL maps a public image URL back to its object key.
+	// Returns false for URLs that aren't served by this backend.
+	KeyFromURL(imageURL string) (string, bool)
+}
+
+// StorageConfig selects and configures an ObjectStorage backend
+type StorageConfig struct {
+	Backend string // "s3" or "local"
+
+	// S3 and S3-compatible endpoints (MinIO, R2, ...)
+	S3 S3Options
+
+	// Local filesystem backend
+	LocalDir      string // Directory files are written to
+	PublicBaseURL string // Base URL of this server, e.g. http://localhost:8080
+	SigningSecret string // Secret the upload URL signing key is derived from
+}
+
+// NewObjectStorage creates the storage backend selected by cfg.Backend
+func NewObjectStorage(ctx context.Context, cfg StorageConfig) (ObjectStorage, error) {
+	switch cfg.Backend {
+	case "s3":
+		s3Service, err := NewS3Service(ctx, cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		return s3Service, nil
+	case "local":
+		local, err := NewLocalStorageService(cfg.LocalDir, cfg.PublicBaseURL, cfg.SigningSecret)
+		if err != nil {
+			return nil, err
+		}
+		return local, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (must be s3 or local)", cfg.Backend)
+	}
+}
+
+// coverObjectKey builds the object key for a new cover upload: covers/{userID}/{uuid}.{ext}
+func coverObjectKey(userID, contentType string) string {
+	ext := "jpg"
+	if contentType == "image/png" {
+		ext = "png"
+	} else if contentType == "image/webp" {
+		ext = "webp"
+	}
+
+	return fmt.Sprintf("%s%s/%s.%s", coverKeyPrefix, userID, uuid.New().String(), ext)
+}
+
+// IsUploadedCoverURL reports whether coverURL points at a user upload, whose
+// key names the uploader. URLs the configured storage doesn't recognize (for
+// example from a previous backend) are judged by their path, and anything
+// unparseable counts as an upload.
+func IsUploadedCoverURL(storage ObjectStorage, coverURL string) bool {
+	if storage != nil {
+		if key, ok := storage.KeyFromURL(coverURL); ok {
+			return strings.HasPrefix(key, coverKeyPrefix)
+		}
+	}
+	parsed, err := url.Parse(coverURL)
+	if err != nil {
+		return true
+	}
+	return strings.Contains(parsed.Path, "/"+coverKeyPrefix)
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalUploadsPath is the URL path the local storage backend is mounted at
+const LocalUploadsPath = "/uploads/"
+
+// maxLocalUploadBytes caps the size of a single uploaded cover image
+const maxLocalUploadBytes = 10 << 20 // 10 MB
+
+// LocalStorageService stores cover images on the local filesystem and serves them
+// from the Go server itself. Intended for development and self-hosted setups where
+// no S3-compatible service is available.
+//
+// Upload URLs mimic S3 presigned URLs: they carry an expiry and an HMAC signature
+// over the object key and content type, so the PUT needs no other credentials.
+type LocalStorageService struct {
+	root          string
+	publicBaseURL string
+	secret        []byte
+	uploadExpiry  time.Duration
+}
+
+// NewLocalStorageService creates a filesystem storage backend rooted at dir.
+// publicBaseURL is the externally reachable base URL of this server (e.g. http://localhost:8080).
+func NewLocalStorageService(dir, publicBaseURL, signingSecret string) (*LocalStorageService, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("local storage directory is required")
+	}
+	if publicBaseURL == "" {
+		return nil, fmt.Errorf("public base URL is required for local storage")
+	}
+	if signingSecret == "" {
+		return nil, fmt.Errorf("signing secret is required for local storage")
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage directory: %w", err)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &LocalStorageService{
+		root:          root,
+		publicBaseURL: strings.TrimSuffix(publicBaseURL, "/"),
+		secret:        uploadSigningKey(signingSecret),
+		uploadExpiry:  5 * time.Minute,
+	}, nil
+}
+
+// Name identifies the backend in logs
+func (l *LocalStorageService) Name() string {
+	return "local"
+}
+
+// GenerateUploadURL returns a signed PUT URL served by Handler and the public image URL
+func (l *LocalStorageService) GenerateUploadURL(ctx context.Context, userID, contentType string) (uploadURL string, imageURL string, err error) {
+	objectKey := coverObjectKey(userID, contentType)
+	expires := time.Now().Add(l.uploadExpiry).Unix()
+
+	params := url.Values{}
+	params.Set("expires", strconv.FormatInt(expires, 10))
+	params.Set("contentType", contentType)
+	params.Set("signature", l.sign(objectKey, contentType, expires))
+
+	imageURL = l.publicURL(objectKey)
+	return imageURL + "?" + params.Encode(), imageURL, nil
+}
+
+// ListObjects walks the storage directory and returns objects whose key starts with prefix
+func (l *LocalStorageService) ListObjects(ctx context.Context, prefix string) ([]StoredObject, error) {
+	var objects []StoredObject
+
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, StoredObject{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	return objects, nil
+}
+
+// DeleteObject removes a stored file
+func (l *LocalStorageService) DeleteObject(ctx context.Context, key string) error {
+	p, err := l.pathForKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete object %s: %w", key, err)
+	}
+	return nil
+}
+
+// Ping checks the storage directory is still writable
+func (l *LocalStorageService) Ping(ctx context.Context) error {
+	f, err := os.CreateTemp(l.root, ".ping-*")
+	if err != nil {
+		return fmt.Errorf("storage directory not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// KeyFromURL maps a public image URL back to its object key
+func (l *LocalStorageService) KeyFromURL(imageURL string) (string, bool) {
+	return keyFromURL(l.publicBaseURL+strings.TrimSuffix(LocalUploadsPath, "/"), imageURL)
+}
+
+// Handler serves stored files (GET/HEAD) and accepts signed uploads (PUT).
+// Mount it at LocalUploadsPath.
+func (l *LocalStorageService) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, LocalUploadsPath)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			l.serveObject(w, r, key)
+		case http.MethodPut:
+			l.receiveUpload(w, r, key)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (l *LocalStorageService) serveObject(w http.ResponseWriter, r *http.Request, key string) {
+	p, err := l.pathForKey(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (l *LocalStorageService) receiveUpload(w http.ResponseWriter, r *http.Request, key string) {
+	query := r.URL.Query()
+	contentType := query.Get("contentType")
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid upload URL", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() > expires {
+		http.Error(w, "upload URL expired", http.StatusForbidden)
+		return
+	}
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(l.sign(key, contentType, expires))) {
+		http.Error(w, "invalid upload signature", http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("Content-Type") != contentType {
+		http.Error(w, "content type does not match upload URL", http.StatusBadRequest)
+		return
+	}
+
+	p, err := l.pathForKey(key)
+	if err != nil {
+		http.Error(w, "invalid object key", http.StatusBadRequest)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		http.Error(w, "failed to store upload", http.StatusInternalServerError)
+		return
+	}
+
+	// Write to a temp file first so readers never see a partial image
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		http.Error(w, "failed to store upload", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, http.MaxBytesReader(w, r.Body, maxLocalUploadBytes))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "upload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to store upload", http.StatusInternalServerError)
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		http.Error(w, "failed to store upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// pathForKey resolves an object key to a file path inside the storage root,
+// rejecting keys that would escape it
+func (l *LocalStorageService) pathForKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "..") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *LocalStorageService) publicURL(key string) string {
+	return l.publicBaseURL + LocalUploadsPath + key
+}
+
+// uploadSigningKey is derived from the configured secret, which is the JWT
+// secret, so an upload signature and a token never share a key
+func uploadSigningKey(secret string) []byte {
+	sum := sha256.Sum256([]byte("local-upload:" + secret))
+	return sum[:]
+}
+
+func (l *LocalStorageService) sign(key, contentType string, expires int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d", key, contentType, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
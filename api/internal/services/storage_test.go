@@ -0,0 +1,247 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorageService_UploadRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	// The public base URL must point at the server mounting the handler, so create
+	// the server first and build the storage service with its URL
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	storage, err := NewLocalStorageService(dir, server.URL, "test-secret")
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	mux.Handle(LocalUploadsPath, storage.Handler())
+
+	ctx := context.Background()
+	uploadURL, imageURL, err := storage.GenerateUploadURL(ctx, "user-1", "image/png")
+	if err != nil {
+		t.Fatalf("GenerateUploadURL failed: %v", err)
+	}
+	if !strings.HasPrefix(imageURL, server.URL+"/uploads/covers/user-1/") || !strings.HasSuffix(imageURL, ".png") {
+		t.Errorf("unexpected image URL: %s", imageURL)
+	}
+
+	// Upload the image
+	req, _ := http.NewRequest(http.MethodPut, uploadURL, bytes.NewReader([]byte("png-bytes")))
+	req.Header.Set("Content-Type", "image/png")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected upload status 200, got %d", resp.StatusCode)
+	}
+
+	// Fetch it back from the public URL
+	resp, err = http.Get(imageURL)
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "png-bytes" {
+		t.Fatalf("expected stored image, got status %d body %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("expected image/png content type, got %s", resp.Header.Get("Content-Type"))
+	}
+
+	// The key round-trips and shows up in listings
+	key, ok := storage.KeyFromURL(imageURL)
+	if !ok {
+		t.Fatalf("KeyFromURL did not recognize %s", imageURL)
+	}
+	objects, err := storage.ListObjects(ctx, coverKeyPrefix)
+	if err != nil {
+		t.Fatalf("ListObjects failed: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != key || objects[0].Size != int64(len("png-bytes")) {
+		t.Fatalf("unexpected listing: %+v", objects)
+	}
+
+	// Delete removes it; deleting again is not an error
+	if err := storage.DeleteObject(ctx, key); err != nil {
+		t.Fatalf("DeleteObject failed: %v", err)
+	}
+	if err := storage.DeleteObject(ctx, key); err != nil {
+		t.Fatalf("second DeleteObject failed: %v", err)
+	}
+	resp, err = http.Get(imageURL)
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", resp.StatusCode)
+	}
+}
+
+func TestLocalStorageService_RejectsBadUploads(t *testing.T) {
+	storage, err := NewLocalStorageService(t.TempDir(), "http://localhost:8080", "test-secret")
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	handler := storage.Handler()
+
+	uploadURL, _, err := storage.GenerateUploadURL(context.Background(), "user-1", "image/jpeg")
+	if err != nil {
+		t.Fatalf("GenerateUploadURL failed: %v", err)
+	}
+	valid, _ := url.Parse(uploadURL)
+
+	expired := *valid
+	q := expired.Query()
+	q.Set("expires", "1")
+	expired.RawQuery = q.Encode()
+
+	tampered := *valid
+	tampered.Path = strings.Replace(tampered.Path, "user-1", "user-2", 1)
+
+	escaping := *valid
+	escaping.Path = LocalUploadsPath + "../secrets.txt"
+
+	// A signature made with the raw secret, as a JWT would be, must not pass
+	rawKey := *valid
+	q = rawKey.Query()
+	mac := hmac.New(sha256.New, []byte("test-secret"))
+	fmt.Fprintf(mac, "%s\n%s\n%s", strings.TrimPrefix(valid.Path, LocalUploadsPath), "image/jpeg", q.Get("expires"))
+	q.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+	rawKey.RawQuery = q.Encode()
+
+	tests := []struct {
+		name        string
+		target      *url.URL
+		contentType string
+		wantStatus  int
+	}{
+		{"wrong content type", valid, "image/png", http.StatusBadRequest},
+		{"expired URL", &expired, "image/jpeg", http.StatusForbidden},
+		{"key not covered by signature", &tampered, "image/jpeg", http.StatusForbidden},
+		{"path traversal", &escaping, "image/jpeg", http.StatusForbidden},
+		{"signed with the raw secret", &rawKey, "image/jpeg", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.target.String(), bytes.NewReader([]byte("x")))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d (%s)", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestS3Service_PathStyleEndpoint(t *testing.T) {
+	fake := newFakeS3(t, "covers")
+	storage := newS3ServiceWithClient(fake.client(), S3Options{
+		Region:       "us-east-1",
+		Bucket:       "covers",
+		Endpoint:     fake.server.URL,
+		UsePathStyle: true,
+	})
+
+	uploadURL, imageURL, err := storage.GenerateUploadURL(context.Background(), "user-1", "image/webp")
+	if err != nil {
+		t.Fatalf("GenerateUploadURL failed: %v", err)
+	}
+	if !strings.HasPrefix(uploadURL, fake.server.URL+"/covers/covers/user-1/") {
+		t.Errorf("expected path-style upload URL on the custom endpoint, got %s", uploadURL)
+	}
+	if !strings.HasPrefix(imageURL, fake.server.URL+"/covers/covers/user-1/") || !strings.HasSuffix(imageURL, ".webp") {
+		t.Errorf("unexpected image URL: %s", imageURL)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, uploadURL, bytes.NewReader([]byte("webp-bytes")))
+	req.Header.Set("Content-Type", "image/webp")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	resp.Body.Close()
+
+	key, ok := storage.KeyFromURL(imageURL)
+	if !ok || !fake.has(key) {
+		t.Fatalf("expected uploaded object %q to exist", key)
+	}
+
+	objects, err := storage.ListObjects(context.Background(), "covers/user-1/")
+	if err != nil {
+		t.Fatalf("ListObjects failed: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != key {
+		t.Fatalf("unexpected listing: %+v", objects)
+	}
+	if time.Since(objects[0].LastModified) > time.Minute {
+		t.Errorf("unexpected last modified time: %v", objects[0].LastModified)
+	}
+}
+
+func TestStoragePing(t *testing.T) {
+	fake := newFakeS3(t, "covers")
+	local, err := NewLocalStorageService(t.TempDir(), "http://localhost:8080", "test-secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		storage ObjectStorage
+		wantErr bool
+	}{
+		{"S3 bucket exists", newS3ServiceWithClient(fake.client(), S3Options{Bucket: "covers", Endpoint: fake.server.URL, UsePathStyle: true}), false},
+		{"S3 bucket missing", newS3ServiceWithClient(fake.client(), S3Options{Bucket: "missing", Endpoint: fake.server.URL, UsePathStyle: true}), true},
+		{"Local directory writable", local, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.storage.Ping(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDefaultS3URLPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		opts S3Options
+		want string
+	}{
+		{"aws", S3Options{Region: "us-west-2", Bucket: "covers"}, "https://covers.s3.us-west-2.amazonaws.com"},
+		{"minio path style", S3Options{Bucket: "covers", Endpoint: "http://localhost:9000/", UsePathStyle: true}, "http://localhost:9000/covers"},
+		{"virtual hosted endpoint", S3Options{Bucket: "covers", Endpoint: "https://r2.example.com"}, "https://covers.r2.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := defaultS3URLPrefix(tt.opts); got != tt.want {
+				t.Errorf("defaultS3URLPrefix() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GraphQL is a gqlgen extension that wraps each operation in a span with a
+// child span per resolver call. Add it with the server's Use.
+type GraphQL struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+} = GraphQL{}
+
+func (GraphQL) ExtensionName() string {
+	return "Tracing"
+}
+
+func (GraphQL) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (GraphQL) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	name := "graphql"
+	var attrs []attribute.KeyValue
+	if graphql.HasOperationContext(ctx) {
+		oc := graphql.GetOperationContext(ctx)
+		if oc.Operation != nil {
+			if oc.Operation.Name != "" {
+				name += " " + oc.Operation.Name
+				attrs = append(attrs, attribute.String("graphql.operation.name", oc.Operation.Name))
+			}
+			attrs = append(attrs, attribute.String("graphql.operation.type", string(oc.Operation.Operation)))
+		}
+	}
+
+	ctx, span := Start(ctx, name, trace.SpanKindInternal, attrs...)
+	defer span.End()
+
+	resp := next(ctx)
+	if resp != nil && len(resp.Errors) > 0 {
+		span.SetStatus(codes.Error, resp.Errors.Error())
+	}
+	return resp
+}
+
+// InterceptField traces resolvers only; plain struct fields are too cheap
+// and too many to be worth a span each
+func (GraphQL) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	ctx, span := Start(ctx, fc.Object+"."+fc.Field.Name, trace.SpanKindInternal,
+		attribute.String("graphql.field.path", fc.Path().String()),
+	)
+	res, err := next(ctx)
+	End(span, err)
+	return res, err
+}
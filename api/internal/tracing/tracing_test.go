@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans routes spans to a recorder for the rest of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	if _, err := setup(context.Background(), ExporterNone, nil); err != nil {
+		t.Fatalf("Expected setup to succeed, got %v", err)
+	}
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := recordSpans(t)
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/uploads/*", func(w http.ResponseWriter, r *http.Request) {
+		// Outgoing calls to Hasura carry the request's trace
+		header := http.Header{}
+		Inject(r.Context(), header)
+		w.Write([]byte(header.Get("traceparent")))
+	})
+	r.Get("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/uploads/covers/a.jpg", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/broken", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+
+	upload := spans[0]
+	if upload.Name() != "GET /uploads/*" {
+		t.Errorf("Expected span named after the route, got %q", upload.Name())
+	}
+	if upload.SpanContext().TraceID().String() != traceID || upload.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected span to continue the incoming trace, got trace %s parent %s", upload.SpanContext().TraceID(), upload.Parent().SpanID())
+	}
+	if want := "00-" + traceID + "-" + upload.SpanContext().SpanID().String() + "-01"; rr.Body.String() != want {
+		t.Errorf("Expected injected traceparent %q, got %q", want, rr.Body.String())
+	}
+
+	if broken := spans[1]; broken.Status().Code != codes.Error || broken.Parent().IsValid() {
+		t.Errorf("Expected a failed root span for the 500, got status %v parent %v", broken.Status().Code, broken.Parent())
+	}
+}
+
+func TestEnd(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, span := Start(context.Background(), "ok", 0)
+	End(span, nil)
+	_, span = Start(context.Background(), "failed", 0)
+	End(span, context.DeadlineExceeded)
+
+	spans := recorder.Ended()
+	if spans[0].Status().Code != codes.Unset {
+		t.Errorf("Expected no status on success, got %v", spans[0].Status().Code)
+	}
+	if spans[1].Status().Code != codes.Error || len(spans[1].Events()) != 1 {
+		t.Errorf("Expected the error recorded, got status %v and %d events", spans[1].Status().Code, len(spans[1].Events()))
+	}
+}
+
+func TestSetup(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	t.Run("Stdout exporter writes spans on shutdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		shutdown, err := setup(context.Background(), "stdout", &buf)
+		if err != nil {
+			t.Fatalf("Expected setup to succeed, got %v", err)
+		}
+		_, span := Start(context.Background(), "lookup", 0)
+		span.End()
+		if err := shutdown(context.Background()); err != nil {
+			t.Fatalf("Expected shutdown to succeed, got %v", err)
+		}
+		if !strings.Contains(buf.String(), `"Name":"lookup"`) || !strings.Contains(buf.String(), serviceName) {
+			t.Errorf("Expected the span with the service name, got %s", buf.String())
+		}
+	})
+
+	t.Run("Unknown exporters are rejected", func(t *testing.T) {
+		if _, err := setup(context.Background(), "zipkin", nil); err == nil {
+			t.Error("Expected an error for an unknown exporter")
+		}
+	})
+}
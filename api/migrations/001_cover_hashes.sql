@@ -0,0 +1,20 @@
+-- Perceptual cover hashes used by findDuplicates / itemsByCover.
+-- Run in Neon, then refresh Hasura metadata.
+--
+-- Hashes are 64-bit values stored as 16 hex characters. cover_hash_url is the
+-- cover_url the hashes were computed from; when they differ the API rehashes.
+
+ALTER TABLE vhs
+ADD COLUMN cover_phash TEXT,
+ADD COLUMN cover_dhash TEXT,
+ADD COLUMN cover_hash_url TEXT;
+
+ALTER TABLE records
+ADD COLUMN cover_phash TEXT,
+ADD COLUMN cover_dhash TEXT,
+ADD COLUMN cover_hash_url TEXT;
+
+ALTER TABLE cassettes
+ADD COLUMN cover_phash TEXT,
+ADD COLUMN cover_dhash TEXT,
+ADD COLUMN cover_hash_url TEXT;
@@ -0,0 +1,14 @@
+-- Normalized artist/title keys for find-or-insert dedup (see internal/normalize).
+-- Run in Neon, then refresh Hasura metadata, then fill existing rows with:
+--   go run ./cmd/admin backfill-keys -dry-run=false
+--
+-- Movies: normalized title. Records and cassettes: "<artist>|<album>".
+-- Rows with a NULL key are still matched exactly until backfilled.
+
+ALTER TABLE vhs ADD COLUMN normalized_key TEXT;
+ALTER TABLE records ADD COLUMN normalized_key TEXT;
+ALTER TABLE cassettes ADD COLUMN normalized_key TEXT;
+
+CREATE INDEX vhs_normalized_key_idx ON vhs (normalized_key);
+CREATE INDEX records_normalized_key_idx ON records (normalized_key);
+CREATE INDEX cassettes_normalized_key_idx ON cassettes (normalized_key);
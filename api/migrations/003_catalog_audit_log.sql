@@ -0,0 +1,20 @@
+-- Audit trail for catalog merges and splits (admin merge/split commands).
+-- Run in Neon, then track the table in Hasura.
+--
+-- details holds the affected rows as they were before the change, so an
+-- operation can be reviewed or reversed by hand.
+
+CREATE TABLE catalog_audit_log (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  action TEXT NOT NULL CHECK (action IN ('merge', 'split')),
+  kind TEXT NOT NULL,
+  target_id UUID NOT NULL,
+  source_id UUID NOT NULL,
+  actor TEXT NOT NULL,
+  reason TEXT NOT NULL DEFAULT '',
+  details JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX catalog_audit_log_target_idx ON catalog_audit_log (target_id);
+CREATE INDEX catalog_audit_log_source_idx ON catalog_audit_log (source_id);
@@ -0,0 +1,5 @@
+-- Public/private profiles. Private (the default) means only the user can read
+-- their collection; public profiles can be browsed by any API client.
+-- Run in Neon, then refresh Hasura metadata.
+
+ALTER TABLE users ADD COLUMN is_public BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,18 @@
+-- Per-user roles and admin-managed app settings.
+-- Run in Neon, track app_config in Hasura, then refresh metadata.
+--
+-- Roles are carried in the JWT, so a change applies from the user's next
+-- sign-in. Grant the first admin with `admin set-role`.
+
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+  CHECK (role IN ('read_only', 'user', 'admin'));
+
+-- Settings that override environment defaults (MINIMUM_IOS_VERSION,
+-- FORCE_UPDATE_MESSAGE, APP_STORE_URL). Keys that are absent fall back to
+-- the environment.
+CREATE TABLE app_config (
+  key TEXT PRIMARY KEY,
+  value TEXT NOT NULL,
+  updated_by TEXT NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
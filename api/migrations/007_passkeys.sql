@@ -0,0 +1,29 @@
+-- Passkeys (WebAuthn). Run in Neon, track both tables and the
+-- webauthn_credentials.user_id relationship in Hasura, then refresh metadata.
+--
+-- Credential ids are the base64url WebAuthn credential ids; credential holds
+-- the public key and signature counter. Ceremony challenges are deleted when
+-- answered, so each can be used once; expired rows are purged whenever a
+-- new challenge is stored.
+
+CREATE TABLE webauthn_credentials (
+  id TEXT PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  credential JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+CREATE TABLE webauthn_challenges (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  ceremony TEXT NOT NULL CHECK (ceremony IN ('registration', 'login')),
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+  session JSONB NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX webauthn_challenges_expires_at_idx ON webauthn_challenges (expires_at);
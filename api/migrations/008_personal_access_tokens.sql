@@ -0,0 +1,20 @@
+-- Personal access tokens for scripts and integrations. Run in Neon, track the
+-- table and its user relationship (personal_access_tokens.user_id -> user) in
+-- Hasura, then refresh metadata.
+--
+-- Only SHA-256 hashes of tokens are stored. scopes is a JSON array such as
+-- ["collection:read"]; revoked rows are kept for auditing.
+
+CREATE TABLE personal_access_tokens (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  scopes JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ,
+  last_used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX personal_access_tokens_user_id_idx ON personal_access_tokens (user_id) WHERE revoked_at IS NULL;
@@ -0,0 +1,17 @@
+-- Client keys sent by apps and integrations as X-API-Key, replacing the single
+-- API_KEY. Run in Neon, track the table in Hasura, then refresh metadata.
+-- Manage keys with `go run ./cmd/admin client-keys`.
+--
+-- Only SHA-256 hashes of keys are stored. Rotating a key issues a new one
+-- with the same name and sets rotated_at and expires_at on the old one, so
+-- both work until installed apps have updated.
+
+CREATE TABLE api_client_keys (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT NOT NULL,
+  key_hash TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  rotated_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,19 @@
+-- Pending email changes. Run in Neon, track the table in Hasura, then
+-- refresh metadata.
+--
+-- A user has at most one pending change. Codes for the current and the new
+-- address are stored only as HMAC-SHA256 hashes keyed by the server secret;
+-- attempts counts wrong guesses.
+-- Deleting a user cascades here, and deleteAccount relies on the existing
+-- ON DELETE CASCADE on sessions, personal_access_tokens and
+-- webauthn_credentials.
+
+CREATE TABLE email_changes (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  new_email TEXT NOT NULL,
+  current_code_hash TEXT NOT NULL,
+  new_code_hash TEXT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);